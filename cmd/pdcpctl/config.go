@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"pdcplet/pkg/pdcpserver/client"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ENV_PDCPCONFIG     = "PDCPCONFIG"
+	DEFAULT_CONFIG_DIR = ".pdcp"
+	DEFAULT_NAMESPACE  = "default"
+)
+
+var (
+	ErrContextNotFound = errors.New("context not found")
+	ErrNoServer        = errors.New("no server configured, use --server or pdcpctl config set-context")
+)
+
+// Context 一个pdcpserver的地址和凭据, apiKey与token只需配置一个
+type Context struct {
+	Name               string `yaml:"name"`
+	Server             string `yaml:"server"`
+	APIKey             string `yaml:"apiKey,omitempty"`
+	Token              string `yaml:"token,omitempty"`
+	CAFile             string `yaml:"caFile,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty"`
+	Namespace          string `yaml:"namespace,omitempty"` // 未指定--namespace时使用
+}
+
+// Config 与kubeconfig类似的上下文文件, 默认位于~/.pdcp/config, 可以通过PDCPCONFIG环境变量指定
+type Config struct {
+	CurrentContext string    `yaml:"currentContext"`
+	Contexts       []Context `yaml:"contexts"`
+}
+
+// DefaultConfigPath 返回PDCPCONFIG或~/.pdcp/config
+func DefaultConfigPath() string {
+	if path := os.Getenv(ENV_PDCPCONFIG); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(DEFAULT_CONFIG_DIR, "config")
+	}
+	return filepath.Join(home, DEFAULT_CONFIG_DIR, "config")
+}
+
+// LoadConfig 读取上下文文件, 文件不存在时返回空配置
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Save 写入上下文文件, 文件中包含凭据, 只允许当前用户读写
+func (cfg *Config) Save(path string) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func (cfg *Config) Context(name string) (*Context, bool) {
+	for i := range cfg.Contexts {
+		if cfg.Contexts[i].Name == name {
+			return &cfg.Contexts[i], true
+		}
+	}
+	return nil, false
+}
+
+// SetContext 添加或替换同名上下文
+func (cfg *Config) SetContext(ctx Context) {
+	if existing, ok := cfg.Context(ctx.Name); ok {
+		*existing = ctx
+		return
+	}
+	cfg.Contexts = append(cfg.Contexts, ctx)
+}
+
+func (cfg *Config) DeleteContext(name string) bool {
+	for i := range cfg.Contexts {
+		if cfg.Contexts[i].Name == name {
+			cfg.Contexts = append(cfg.Contexts[:i], cfg.Contexts[i+1:]...)
+			if cfg.CurrentContext == name {
+				cfg.CurrentContext = ""
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve 返回name指定的上下文, name为空时使用currentContext, 都为空时返回空上下文
+func (cfg *Config) Resolve(name string) (Context, error) {
+	if name == "" {
+		name = cfg.CurrentContext
+	}
+	if name == "" {
+		return Context{}, nil
+	}
+	ctx, ok := cfg.Context(name)
+	if !ok {
+		return Context{}, fmt.Errorf("%w: %s", ErrContextNotFound, name)
+	}
+	return *ctx, nil
+}
+
+// NewClient 根据上下文创建pdcpserver客户端
+func (ctx Context) NewClient(timeout time.Duration) (*client.Client, error) {
+	if ctx.Server == "" {
+		return nil, ErrNoServer
+	}
+	opts := []client.Option{client.WithTimeout(timeout)}
+	if ctx.APIKey != "" {
+		opts = append(opts, client.WithAPIKey(ctx.APIKey))
+	}
+	if ctx.Token != "" {
+		opts = append(opts, client.WithBearerToken(ctx.Token))
+	}
+	if ctx.CAFile != "" {
+		opts = append(opts, client.WithCAFile(ctx.CAFile))
+	}
+	if ctx.InsecureSkipVerify {
+		opts = append(opts, client.WithInsecureSkipVerify())
+	}
+	return client.New(ctx.Server, opts...), nil
+}
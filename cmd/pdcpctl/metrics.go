@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"pdcplet/pkg/pdcpserver/model"
+
+	"github.com/spf13/cobra"
+)
+
+func newMetricsCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "metrics",
+		Short: "Query VM traffic metrics",
+	}
+
+	var (
+		req      model.MetricsQueryRequest
+		vid      int64
+		from, to string
+	)
+	query := &cobra.Command{
+		Use:   "query",
+		Short: "Query traffic series of VMs",
+		Example: `  pdcpctl metrics query --metric avgbps --vm vm1 --from 1h
+  pdcpctl metrics query --metric dropped --agg sum --step 5m --from 2026-01-02T00:00:00Z -o json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, namespace, err := o.client()
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			if req.From, err = parseTimeFlag(from, now); err != nil {
+				return err
+			}
+			if req.To, err = parseTimeFlag(to, now); err != nil {
+				return err
+			}
+			if cmd.Flags().Changed("vid") {
+				req.Vid = &vid
+			}
+			if req.VmName != "" || o.namespace != "" {
+				req.Namespace = namespace
+			}
+
+			resp, err := c.QueryTraffic(cmd.Context(), req)
+			if err != nil {
+				return err
+			}
+			return o.print(resp, func() table {
+				t := table{header: []string{"NODE", "TASK", "VM", "NAMESPACE", "VID", "MAC", "TIMESTAMP", resp.Metric}}
+				for _, series := range resp.Series {
+					l := series.Labels
+					vid := "-"
+					if l.Vid != nil {
+						vid = strconv.FormatInt(*l.Vid, 10)
+					}
+					for _, point := range series.Points {
+						t.add(l.NodeName, strconv.Itoa(l.TaskId), orDash(l.VmName), orDash(l.Namespace), vid, orDash(l.Mac),
+							formatTime(point.Timestamp), strconv.FormatFloat(point.Value, 'f', -1, 64))
+					}
+				}
+				return t
+			})
+		},
+	}
+	flags := query.Flags()
+	flags.StringVar(&req.Metric, "metric", "", "Metric, option: sent/dropped/avgbps/avgpps/realbps/realpps")
+	flags.StringVar(&req.VmName, "vm", "", "Only query the VM, in the namespace of --namespace or the context")
+	flags.StringVar(&req.NodeName, "node", "", "Only query the node")
+	flags.StringVar(&req.Mac, "mac", "", "Only query the NIC with the MAC, implies --level nic")
+	flags.Int64Var(&vid, "vid", 0, "Only query the VLAN")
+	flags.StringVar(&req.Level, "level", "", "Series level, option: task/nic")
+	flags.StringVar(&req.Aggregation, "agg", "", "Aggregation of points in a step, option: sum/avg/max/rate")
+	flags.StringVar(&req.Step, "step", "", "Step of points, such as 1m")
+	flags.StringVar(&req.Resolution, "resolution", "", "Resolution of stored data, option: raw/1m/1h")
+	flags.StringVar(&from, "from", "", "Start time, RFC3339 or a duration before now such as 1h")
+	flags.StringVar(&to, "to", "", "End time, RFC3339 or a duration before now")
+	query.MarkFlagRequired("metric")
+
+	cmd.AddCommand(query)
+	return cmd
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"pdcplet/pkg/pdcpserver/model"
+
+	"github.com/spf13/cobra"
+)
+
+func newNodeCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "node",
+		Short: "Show pdcplet nodes",
+	}
+
+	var req model.NodeListRequest
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List pdcplet nodes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, _, err := o.client()
+			if err != nil {
+				return err
+			}
+			resp, err := c.ListNodes(cmd.Context(), req)
+			if err != nil {
+				return err
+			}
+			return o.print(resp, func() table {
+				t := table{header: []string{"NAME", "STATUS", "VERSION", "INPPLAT", "RULES", "MODULES", "LAST HEARTBEAT"}}
+				for _, node := range resp.Items {
+					t.add(node.Name, string(node.Status), orDash(node.Version), strconv.FormatBool(node.InpplatReachable),
+						orDash(node.AppliedRuleVersion), orDash(strings.Join(node.Modules, ",")), formatAge(node.LastHeartbeatAt))
+				}
+				return t
+			})
+		},
+	}
+	list.Flags().StringVar(&req.Status, "status", "", "Only list nodes with the status, option: Ready/Degraded/Stale")
+
+	cmd.AddCommand(list)
+	return cmd
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 输出格式
+const (
+	OUTPUT_TABLE = "table"
+	OUTPUT_JSON  = "json"
+	OUTPUT_YAML  = "yaml"
+)
+
+// table 表格输出的列名和各行内容
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+func (t *table) add(row ...string) {
+	t.rows = append(t.rows, row)
+}
+
+// printObject 按format输出obj, table格式时输出toTable生成的表格. json和yaml使用API的JSON字段名
+func printObject(w io.Writer, format string, obj interface{}, toTable func() table) error {
+	switch format {
+	case OUTPUT_TABLE, "":
+		t := toTable()
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+		for _, row := range t.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	case OUTPUT_JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(obj)
+	case OUTPUT_YAML:
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		// 先解析为yaml.Node以保持JSON中的字段顺序
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return err
+		}
+		resetStyle(&node)
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("unknown output format %q, option: table/json/yaml", format)
+	}
+}
+
+// resetStyle JSON被解析为flow风格, 改为block风格输出
+func resetStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetStyle(child)
+	}
+}
+
+// readManifests 读取YAML或JSON文件中的一个或多个文档, 按JSON字段名解析为T.
+// path为-时读取标准输入, 文档为数组时展开
+func readManifests[T any](path string, stdin io.Reader) ([]T, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var items []T
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc interface{}
+		if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		if doc == nil {
+			continue
+		}
+		docs, ok := doc.([]interface{})
+		if !ok {
+			docs = []interface{}{doc}
+		}
+		for _, d := range docs {
+			item, err := decodeStrict[T](d)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s: %w", path, err)
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// decodeStrict 经由JSON解析, 未知字段视为错误以发现拼写错误
+func decodeStrict[T any](doc interface{}) (T, error) {
+	var item T
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return item, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&item)
+	return item, err
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+// formatAge 以1d2h/3m等形式输出距今的时长
+func formatAge(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// parseTimeFlag 解析RFC3339时间或相对当前时间的时长, 如1h表示1小时前
+func parseTimeFlag(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, use RFC3339 or a duration such as 1h", value)
+	}
+	return t, nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"pdcplet/pkg/pdcpserver/client"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	TARGET_NAME     = "pdcpctl"
+	DEFAULT_TIMEOUT = 30 * time.Second
+)
+
+// options 全局参数, 命令行参数优先于上下文文件
+type options struct {
+	configPath string
+	context    string
+	server     string
+	apiKey     string
+	token      string
+	namespace  string
+	output     string
+	timeout    time.Duration
+
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+// currentContext 合并上下文文件和命令行参数
+func (o *options) currentContext() (Context, error) {
+	cfg, err := LoadConfig(o.configPath)
+	if err != nil {
+		return Context{}, err
+	}
+	ctx, err := cfg.Resolve(o.context)
+	if err != nil {
+		return Context{}, err
+	}
+	if o.server != "" {
+		ctx.Server = o.server
+	}
+	if o.apiKey != "" {
+		ctx.APIKey, ctx.Token = o.apiKey, ""
+	}
+	if o.token != "" {
+		ctx.Token, ctx.APIKey = o.token, ""
+	}
+	if o.namespace != "" {
+		ctx.Namespace = o.namespace
+	}
+	if ctx.Namespace == "" {
+		ctx.Namespace = DEFAULT_NAMESPACE
+	}
+	return ctx, nil
+}
+
+func (o *options) client() (*client.Client, string, error) {
+	ctx, err := o.currentContext()
+	if err != nil {
+		return nil, "", err
+	}
+	c, err := ctx.NewClient(o.timeout)
+	if err != nil {
+		return nil, "", err
+	}
+	return c, ctx.Namespace, nil
+}
+
+func (o *options) print(obj interface{}, toTable func() table) error {
+	return printObject(o.stdout, o.output, obj, toTable)
+}
+
+// NewCommand 创建pdcpctl的根命令
+func NewCommand() *cobra.Command {
+	o := &options{stdin: os.Stdin, stdout: os.Stdout}
+	cmd := &cobra.Command{
+		Use:           TARGET_NAME,
+		Short:         "Command line client of pdcpserver",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			o.stdin = cmd.InOrStdin()
+			o.stdout = cmd.OutOrStdout()
+		},
+	}
+
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&o.configPath, "pdcpconfig", DefaultConfigPath(), "Path of the context file, defaults to $"+ENV_PDCPCONFIG+" or ~/.pdcp/config")
+	flags.StringVar(&o.context, "context", "", "Context to use instead of the current context")
+	flags.StringVar(&o.server, "server", "", "URL of pdcpserver, such as https://pdcpserver:8080")
+	flags.StringVar(&o.apiKey, "api-key", "", "API key to authenticate with")
+	flags.StringVar(&o.token, "token", "", "Bearer token to authenticate with")
+	flags.StringVarP(&o.namespace, "namespace", "n", "", "Namespace of the VM, defaults to the namespace of the context or default")
+	flags.StringVarP(&o.output, "output", "o", OUTPUT_TABLE, "Output format, option: table/json/yaml")
+	flags.DurationVar(&o.timeout, "request-timeout", DEFAULT_TIMEOUT, "Timeout of a single request")
+
+	cmd.AddCommand(newConfigCommand(o), newVMCommand(o), newNodeCommand(o), newMetricsCommand(o), newRulesCommand(o))
+	return cmd
+}
+
+func Execute() {
+	if err := NewCommand().ExecuteContext(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func newConfigCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage contexts of the context file",
+	}
+
+	var ctx Context
+	setContext := &cobra.Command{
+		Use:   "set-context <name>",
+		Short: "Add a context or update the flags given of an existing one",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := LoadConfig(o.configPath)
+			if err != nil {
+				return err
+			}
+			updated := Context{Name: args[0]}
+			if existing, ok := cfg.Context(args[0]); ok {
+				updated = *existing
+			}
+			changed := cmd.Flags().Changed
+			if o.server != "" {
+				updated.Server = o.server
+			}
+			if o.apiKey != "" {
+				updated.APIKey, updated.Token = o.apiKey, ""
+			}
+			if o.token != "" {
+				updated.Token, updated.APIKey = o.token, ""
+			}
+			if o.namespace != "" {
+				updated.Namespace = o.namespace
+			}
+			if changed("ca-file") {
+				updated.CAFile = ctx.CAFile
+			}
+			if changed("insecure-skip-tls-verify") {
+				updated.InsecureSkipVerify = ctx.InsecureSkipVerify
+			}
+			cfg.SetContext(updated)
+			if cfg.CurrentContext == "" {
+				cfg.CurrentContext = updated.Name
+			}
+			if err := cfg.Save(o.configPath); err != nil {
+				return err
+			}
+			fmt.Fprintf(o.stdout, "Context %q set\n", updated.Name)
+			return nil
+		},
+	}
+	setContext.Flags().StringVar(&ctx.CAFile, "ca-file", "", "CA certificate to verify pdcpserver")
+	setContext.Flags().BoolVar(&ctx.InsecureSkipVerify, "insecure-skip-tls-verify", false, "Skip verification of the pdcpserver certificate")
+
+	useContext := &cobra.Command{
+		Use:   "use-context <name>",
+		Short: "Set the current context",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := LoadConfig(o.configPath)
+			if err != nil {
+				return err
+			}
+			if _, ok := cfg.Context(args[0]); !ok {
+				return fmt.Errorf("%w: %s", ErrContextNotFound, args[0])
+			}
+			cfg.CurrentContext = args[0]
+			if err := cfg.Save(o.configPath); err != nil {
+				return err
+			}
+			fmt.Fprintf(o.stdout, "Switched to context %q\n", args[0])
+			return nil
+		},
+	}
+
+	deleteContext := &cobra.Command{
+		Use:   "delete-context <name>",
+		Short: "Delete a context",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := LoadConfig(o.configPath)
+			if err != nil {
+				return err
+			}
+			if !cfg.DeleteContext(args[0]) {
+				return fmt.Errorf("%w: %s", ErrContextNotFound, args[0])
+			}
+			return cfg.Save(o.configPath)
+		},
+	}
+
+	getContexts := &cobra.Command{
+		Use:   "get-contexts",
+		Short: "List contexts, credentials are not printed",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := LoadConfig(o.configPath)
+			if err != nil {
+				return err
+			}
+			contexts := make([]Context, 0, len(cfg.Contexts))
+			for _, ctx := range cfg.Contexts {
+				ctx.APIKey, ctx.Token = redact(ctx.APIKey), redact(ctx.Token)
+				contexts = append(contexts, ctx)
+			}
+			return o.print(contexts, func() table {
+				t := table{header: []string{"CURRENT", "NAME", "SERVER", "NAMESPACE", "AUTH"}}
+				for _, ctx := range contexts {
+					current := ""
+					if ctx.Name == cfg.CurrentContext {
+						current = "*"
+					}
+					auth := "none"
+					if ctx.APIKey != "" {
+						auth = "api-key"
+					} else if ctx.Token != "" {
+						auth = "token"
+					}
+					t.add(current, ctx.Name, ctx.Server, orDash(ctx.Namespace), auth)
+				}
+				return t
+			})
+		},
+	}
+
+	currentContext := &cobra.Command{
+		Use:   "current-context",
+		Short: "Print the current context",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := LoadConfig(o.configPath)
+			if err != nil {
+				return err
+			}
+			if cfg.CurrentContext == "" {
+				return fmt.Errorf("current context is not set")
+			}
+			fmt.Fprintln(o.stdout, cfg.CurrentContext)
+			return nil
+		},
+	}
+
+	cmd.AddCommand(setContext, useContext, deleteContext, getContexts, currentContext)
+	return cmd
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "REDACTED"
+}
+
+func main() {
+	Execute()
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"pdcplet/pkg/pdcpserver"
+	"pdcplet/pkg/pdcpserver/client"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// run 执行pdcpctl命令, 返回标准输出
+func run(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+	cmd := NewCommand()
+	var out bytes.Buffer
+	cmd.SetArgs(args)
+	cmd.SetIn(strings.NewReader(stdin))
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestConfigContexts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pdcp", "config")
+	if _, err := run(t, "", "--pdcpconfig", path, "config", "set-context", "dev",
+		"--server", "http://dev:8080", "--api-key", "key1", "-n", "ns1"); err != nil {
+		t.Fatalf("set-context dev: %v", err)
+	}
+	if _, err := run(t, "", "--pdcpconfig", path, "config", "set-context", "prod",
+		"--server", "https://prod:8080", "--token", "token1", "--insecure-skip-tls-verify"); err != nil {
+		t.Fatalf("set-context prod: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("config file mode: %v, %v", info, err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if cfg.CurrentContext != "dev" || len(cfg.Contexts) != 2 {
+		t.Fatalf("config = %+v", cfg)
+	}
+	if prod, _ := cfg.Context("prod"); prod.Token != "token1" || !prod.InsecureSkipVerify || prod.APIKey != "" {
+		t.Fatalf("prod context = %+v", prod)
+	}
+
+	// 命令行参数优先于上下文
+	o := &options{configPath: path, namespace: "ns2"}
+	ctx, err := o.currentContext()
+	if err != nil || ctx.Server != "http://dev:8080" || ctx.APIKey != "key1" || ctx.Namespace != "ns2" {
+		t.Fatalf("current context = %+v, %v", ctx, err)
+	}
+	o = &options{configPath: path, context: "prod", apiKey: "key2"}
+	ctx, err = o.currentContext()
+	if err != nil || ctx.APIKey != "key2" || ctx.Token != "" || ctx.Namespace != DEFAULT_NAMESPACE {
+		t.Fatalf("prod context with --api-key = %+v, %v", ctx, err)
+	}
+	if _, err := (&options{configPath: path, context: "missing"}).currentContext(); !errors.Is(err, ErrContextNotFound) {
+		t.Fatalf("missing context: err = %v", err)
+	}
+
+	out, err := run(t, "", "--pdcpconfig", path, "config", "get-contexts", "-o", "json")
+	if err != nil || strings.Contains(out, "key1") || strings.Contains(out, "token1") {
+		t.Fatalf("get-contexts printed credentials: %s, %v", out, err)
+	}
+	if _, err := run(t, "", "--pdcpconfig", path, "config", "use-context", "prod"); err != nil {
+		t.Fatalf("use-context: %v", err)
+	}
+	if out, _ := run(t, "", "--pdcpconfig", path, "config", "current-context"); strings.TrimSpace(out) != "prod" {
+		t.Fatalf("current-context = %q", out)
+	}
+	if _, err := run(t, "", "--pdcpconfig", path, "config", "delete-context", "prod"); err != nil {
+		t.Fatalf("delete-context: %v", err)
+	}
+	if cfg, _ := LoadConfig(path); cfg.CurrentContext != "" || len(cfg.Contexts) != 1 {
+		t.Fatalf("config after delete = %+v", cfg)
+	}
+	if _, _, err := (&options{configPath: filepath.Join(t.TempDir(), "none")}).client(); !errors.Is(err, ErrNoServer) {
+		t.Fatalf("client without server: err = %v", err)
+	}
+}
+
+func TestReadManifests(t *testing.T) {
+	multi := "name: a\nprotocol: http\n---\nname: b\nprotocol: dns\n"
+	rules, err := readManifests[model.RuleRequest]("-", strings.NewReader(multi))
+	if err != nil || len(rules) != 2 || rules[1].Name != "b" {
+		t.Fatalf("multi documents: %+v, %v", rules, err)
+	}
+	array := `[{"name": "a", "protocol": "http"}, {"name": "b", "protocol": "dns", "priority": 5}]`
+	rules, err = readManifests[model.RuleRequest]("-", strings.NewReader(array))
+	if err != nil || len(rules) != 2 || rules[1].Priority != 5 {
+		t.Fatalf("array: %+v, %v", rules, err)
+	}
+	if _, err := readManifests[model.RuleRequest]("-", strings.NewReader("name: a\nprotcol: http\n")); err == nil {
+		t.Fatalf("unknown field accepted")
+	}
+}
+
+func TestParseTimeFlag(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	if got, err := parseTimeFlag("1h", now); err != nil || !got.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("1h = %v, %v", got, err)
+	}
+	if got, err := parseTimeFlag("2026-01-01T00:00:00Z", now); err != nil || got.Day() != 1 {
+		t.Fatalf("RFC3339 = %v, %v", got, err)
+	}
+	if _, err := parseTimeFlag("yesterday", now); err == nil {
+		t.Fatalf("invalid time accepted")
+	}
+}
+
+func TestCommands(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := pdcpserver.New("127.0.0.1", 0, config.DBConfig{TypeStr: database.TYPE_SQLITE3,
+		Sqlite3: config.SQLiteConfig{Database: filepath.Join(t.TempDir(), "pdcpserver.db")}})
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "config")
+	if _, err := run(t, "", "--pdcpconfig", path, "config", "set-context", "test", "--server", srv.URL); err != nil {
+		t.Fatalf("set-context: %v", err)
+	}
+
+	rules := `
+name: http
+protocol: http
+filter: tcp port 80
+---
+name: dns
+protocol: dns
+priority: 10
+`
+	out, err := run(t, rules, "--pdcpconfig", path, "rules", "apply", "-f", "-")
+	if err != nil || out != "rule/http created\nrule/dns created\n" {
+		t.Fatalf("rules apply: %q, %v", out, err)
+	}
+	out, err = run(t, "name: http\nprotocol: http\nfilter: tcp port 8080\n", "--pdcpconfig", path, "rules", "apply", "-f", "-")
+	if err != nil || out != "rule/http configured\n" {
+		t.Fatalf("rules apply again: %q, %v", out, err)
+	}
+	info, err := client.New(srv.URL).GetRule(t.Context(), "http")
+	if err != nil || info.Filter != "tcp port 8080" || info.Version != 2 {
+		t.Fatalf("applied rule = %+v, %v", info, err)
+	}
+
+	out, err = run(t, "", "--pdcpconfig", path, "node", "list", "-o", "json")
+	if err != nil {
+		t.Fatalf("node list: %v", err)
+	}
+	var nodes model.NodeListResponse
+	if err := json.Unmarshal([]byte(out), &nodes); err != nil || len(nodes.Items) != 0 {
+		t.Fatalf("node list output %q: %v", out, err)
+	}
+	if out, err = run(t, "", "--pdcpconfig", path, "node", "list"); err != nil || !strings.HasPrefix(out, "NAME") {
+		t.Fatalf("node list table: %q, %v", out, err)
+	}
+
+	out, err = run(t, "", "--pdcpconfig", path, "vm", "list", "-A", "-o", "yaml")
+	if err != nil || !strings.Contains(out, "items: []") {
+		t.Fatalf("vm list yaml: %q, %v", out, err)
+	}
+	_, err = run(t, "", "--pdcpconfig", path, "vm", "get", "missing", "-n", "ns1")
+	if !client.IsNotFound(err) {
+		t.Fatalf("vm get missing: err = %v, want 404", err)
+	}
+	if _, err := run(t, "", "--pdcpconfig", path, "metrics", "query", "--metric", "sent", "--from", "soon"); err == nil {
+		t.Fatalf("invalid --from accepted")
+	}
+	if _, err := run(t, "", "--pdcpconfig", path, "vm", "list", "-o", "xml"); err == nil {
+		t.Fatalf("unknown output format accepted")
+	}
+
+	// 不指定--wait时只提交任务
+	submit := func(stdin string, args ...string) model.Job {
+		t.Helper()
+		out, err := run(t, stdin, append([]string{"--pdcpconfig", path, "-o", "json"}, args...)...)
+		if err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		var accepted model.JobAcceptedResponse
+		if err := json.Unmarshal([]byte(out), &accepted); err != nil || accepted.JobID == "" {
+			t.Fatalf("%v output %q: %v", args, out, err)
+		}
+		var job model.Job
+		if err := database.DB.Where("id = ?", accepted.JobID).First(&job).Error; err != nil {
+			t.Fatalf("get job %s: %v", accepted.JobID, err)
+		}
+		if job.Status != model.JobQueued {
+			t.Fatalf("job %s status = %s", job.ID, job.Status)
+		}
+		return job
+	}
+	job := submit("", "vm", "create", "vm1", "-n", "ns1", "--cpu", "2", "--memory", "1Gi", "--image", "cirros", "--label", "team=net")
+	var req model.VMCreateRequest
+	json.Unmarshal([]byte(job.Payload), &req)
+	if job.Type != model.JobTypeCreateVM || req.Name != "vm1" || req.Namespace != "ns1" || req.CPU != 2 ||
+		req.Memory != "1Gi" || req.Image != "cirros" || req.Labels["team"] != "net" {
+		t.Fatalf("create job %+v, request %+v", job, req)
+	}
+	// 命令行参数覆盖文件中的字段, --label合并到文件中的标签
+	manifest := "name: vm2\nnamespace: ns2\ncpu: 1\nmemory: 1Gi\nimage: cirros\nlabels:\n  app: web\n"
+	job = submit(manifest, "vm", "create", "-f", "-", "--memory", "4Gi", "--label", "team=net")
+	req = model.VMCreateRequest{}
+	json.Unmarshal([]byte(job.Payload), &req)
+	if req.Name != "vm2" || req.Namespace != "ns2" || req.CPU != 1 || req.Memory != "4Gi" || req.Image != "cirros" ||
+		req.Labels["app"] != "web" || req.Labels["team"] != "net" {
+		t.Fatalf("create request from file = %+v", req)
+	}
+	job = submit(manifest, "vm", "create", "vm3", "-f", "-", "-n", "ns3")
+	if job.VmName != "vm3" || job.VmNamespace != "ns3" {
+		t.Fatalf("create job with name and namespace flags = %+v", job)
+	}
+	for _, op := range []model.JobType{model.JobTypeDeleteVM, model.JobTypeOf(model.VMOperationStart), model.JobTypeOf(model.VMOperationStop)} {
+		job = submit("", "vm", string(op), "vm1", "-n", "ns1")
+		if job.Type != op || job.VmName != "vm1" || job.VmNamespace != "ns1" {
+			t.Fatalf("%s job = %+v", op, job)
+		}
+	}
+
+	// --wait等待任务结束并输出任务, 任务失败时返回错误
+	waitTests := []struct {
+		args    []string
+		status  model.JobStatus
+		wantErr string
+	}{
+		{args: []string{"vm", "create", "vm1", "--memory", "1Gi", "--image", "cirros"}, status: model.JobSucceeded},
+		{args: []string{"vm", "delete", "vm1"}, status: model.JobSucceeded},
+		{args: []string{"vm", "start", "vm1"}, status: model.JobSucceeded},
+		{args: []string{"vm", "stop", "vm1"}, status: model.JobFailed, wantErr: "job job1 failed (NotFound): virtual machine not found"},
+	}
+	for _, tt := range waitTests {
+		t.Run("wait "+strings.Join(tt.args[:2], " "), func(t *testing.T) {
+			srv := jobServer(t, tt.status)
+			path := filepath.Join(t.TempDir(), "config")
+			args := append([]string{"--pdcpconfig", path, "--server", srv.URL}, tt.args...)
+			out, err := run(t, "", append(args, "--wait")...)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("wait: %v", err)
+			}
+			if !strings.HasPrefix(out, "JOB") || !strings.Contains(out, string(tt.status)) {
+				t.Fatalf("output = %q", out)
+			}
+			if _, err := run(t, "", append(args, "--wait", "--wait-timeout", "0s")...); err == nil {
+				t.Fatalf("wait with zero timeout should fail")
+			}
+		})
+	}
+}
+
+// jobServer 模拟pdcpserver的VM接口, 提交的任务立即以status结束
+func jobServer(t *testing.T, status model.JobStatus) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	accept := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(model.JobAcceptedResponse{Name: "vm1", JobID: "job1", Location: client.JOB_PATH + "/job1"})
+	}
+	mux.HandleFunc("POST "+client.VM_PATH+"/create", accept)
+	mux.HandleFunc("POST "+client.VM_PATH+"/delete", accept)
+	mux.HandleFunc("POST "+client.VM_PATH+"/{name}/{op}", accept)
+	mux.HandleFunc("GET "+client.JOB_PATH+"/job1", func(w http.ResponseWriter, r *http.Request) {
+		job := model.JobInfo{ID: "job1", Type: model.JobTypeCreateVM, VmName: "vm1", Namespace: "default", Status: status,
+			Attempts: 1, MaxAttempts: 3}
+		if status == model.JobFailed {
+			job.Error, job.Code = "virtual machine not found", model.ErrorNotFound
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	"pdcplet/pkg/pdcpserver/client"
+	"pdcplet/pkg/pdcpserver/model"
+
+	"github.com/spf13/cobra"
+)
+
+func newRulesCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rules",
+		Short: "Manage dissection rules",
+	}
+
+	var file string
+	apply := &cobra.Command{
+		Use:   "apply",
+		Short: "Create or update dissection rules from a YAML/JSON file",
+		Long: `Create or update dissection rules from a YAML/JSON file.
+The file may contain several documents or an array of rules. A rule is created
+when it does not exist, otherwise it is updated, with the version of the file
+as the expected version if given.`,
+		Example: `  pdcpctl rules apply -f rules.yaml
+  cat rules.yaml | pdcpctl rules apply -f -`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, _, err := o.client()
+			if err != nil {
+				return err
+			}
+			rules, err := readManifests[model.RuleRequest](file, o.stdin)
+			if err != nil {
+				return err
+			}
+			for i, rule := range rules {
+				if rule.Name == "" {
+					return fmt.Errorf("rule %d of %s has no name", i, file)
+				}
+			}
+
+			for _, rule := range rules {
+				_, err := c.GetRule(cmd.Context(), rule.Name)
+				switch {
+				case client.IsNotFound(err):
+					if _, err := c.CreateRule(cmd.Context(), rule); err != nil {
+						return fmt.Errorf("create rule %s: %w", rule.Name, err)
+					}
+					fmt.Fprintf(o.stdout, "rule/%s created\n", rule.Name)
+				case err != nil:
+					return err
+				default:
+					if _, err := c.UpdateRule(cmd.Context(), rule.Name, rule); err != nil {
+						return fmt.Errorf("update rule %s: %w", rule.Name, err)
+					}
+					fmt.Fprintf(o.stdout, "rule/%s configured\n", rule.Name)
+				}
+			}
+			return nil
+		},
+	}
+	apply.Flags().StringVarP(&file, "filename", "f", "", "YAML or JSON file of the rules, - for stdin")
+	apply.MarkFlagRequired("filename")
+
+	cmd.AddCommand(apply)
+	return cmd
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pdcplet/pkg/pdcpserver/client"
+	"pdcplet/pkg/pdcpserver/model"
+
+	"github.com/spf13/cobra"
+)
+
+const DEFAULT_WAIT_TIMEOUT = 10 * time.Minute
+
+// waitOptions 提交异步任务的命令等待任务结束的参数
+type waitOptions struct {
+	wait    bool
+	timeout time.Duration
+}
+
+func (w *waitOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&w.wait, "wait", false, "Wait until the job succeeds or fails")
+	cmd.Flags().DurationVar(&w.timeout, "wait-timeout", DEFAULT_WAIT_TIMEOUT, "How long to wait for the job")
+}
+
+// finish 输出已提交的任务, 指定--wait时等待任务结束, 任务失败时返回错误
+func (w *waitOptions) finish(ctx context.Context, o *options, c *client.Client, accepted *model.JobAcceptedResponse) error {
+	if !w.wait {
+		return o.print(accepted, func() table {
+			t := table{header: []string{"NAME", "JOB", "MESSAGE"}}
+			t.add(accepted.Name, accepted.JobID, accepted.Message)
+			return t
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+	job, err := c.WaitJob(ctx, accepted.JobID, 0)
+	if err != nil {
+		return fmt.Errorf("wait for job %s: %w", accepted.JobID, err)
+	}
+	if err := o.print(job, func() table { return jobTable(job) }); err != nil {
+		return err
+	}
+	if job.Status == model.JobFailed {
+		if job.Code != "" {
+			return fmt.Errorf("job %s failed (%s): %s", job.ID, job.Code, job.Error)
+		}
+		return fmt.Errorf("job %s failed: %s", job.ID, job.Error)
+	}
+	return nil
+}
+
+func jobTable(job *model.JobInfo) table {
+	t := table{header: []string{"JOB", "TYPE", "VM", "NAMESPACE", "STATUS", "ATTEMPTS", "ERROR"}}
+	t.add(job.ID, string(job.Type), job.VmName, job.Namespace, string(job.Status),
+		fmt.Sprintf("%d/%d", job.Attempts, job.MaxAttempts), orDash(job.Error))
+	return t
+}
+
+func vmTable(vms ...model.VMInfo) table {
+	t := table{header: []string{"NAME", "NAMESPACE", "STATUS", "READY", "CPU", "MEMORY", "NODE", "IPS", "AGE"}}
+	for _, vm := range vms {
+		t.add(vm.Name, vm.Namespace, string(vm.Status), strconv.FormatBool(vm.Ready), strconv.Itoa(vm.CPU), vm.Memory,
+			orDash(vm.NodeName), orDash(strings.Join(vm.IPs, ",")), formatAge(vm.CreatedAt))
+	}
+	return t
+}
+
+func newVMCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "vm",
+		Short: "Manage virtual machines",
+	}
+	cmd.AddCommand(newVMCreateCommand(o), newVMDeleteCommand(o), newVMListCommand(o), newVMGetCommand(o),
+		newVMOperationCommand(o, model.VMOperationStart), newVMOperationCommand(o, model.VMOperationStop))
+	return cmd
+}
+
+func newVMCreateCommand(o *options) *cobra.Command {
+	var (
+		file   string
+		req    model.VMCreateRequest
+		labels map[string]string
+		wait   waitOptions
+	)
+	cmd := &cobra.Command{
+		Use:   "create [name]",
+		Short: "Create a virtual machine from flags or a YAML/JSON file, flags given override the file",
+		Example: `  pdcpctl vm create vm1 --template small --memory 2Gi
+  pdcpctl vm create vm1 --cpu 2 --memory 2Gi --image quay.io/containerdisks/fedora:latest --wait
+  pdcpctl vm create -f vm1.yaml
+  pdcpctl vm create vm2 -f vm1.yaml --memory 4Gi --label team=net`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, namespace, err := o.client()
+			if err != nil {
+				return err
+			}
+
+			vm := req
+			vm.Labels = labels
+			if file != "" {
+				reqs, err := readManifests[model.VMCreateRequest](file, o.stdin)
+				if err != nil {
+					return err
+				}
+				if len(reqs) != 1 {
+					return fmt.Errorf("%s must contain exactly one VM, got %d", file, len(reqs))
+				}
+				vm = reqs[0]
+				applyVMCreateFlags(cmd, &vm, req, labels)
+			}
+			if len(args) == 1 {
+				vm.Name = args[0]
+			}
+			if vm.Name == "" {
+				return fmt.Errorf("VM name is required")
+			}
+			if vm.Namespace == "" || o.namespace != "" {
+				vm.Namespace = namespace
+			}
+
+			accepted, err := c.CreateVM(cmd.Context(), vm)
+			if err != nil {
+				return err
+			}
+			return wait.finish(cmd.Context(), o, c, accepted)
+		},
+	}
+	cmd.Flags().StringVarP(&file, "filename", "f", "", "YAML or JSON file of the create request, - for stdin")
+	cmd.Flags().StringVar(&req.Template, "template", "", "VM template to create from")
+	cmd.Flags().IntVar(&req.CPU, "cpu", 0, "Number of CPU cores")
+	cmd.Flags().StringVar(&req.Memory, "memory", "", "Memory, such as 2Gi")
+	cmd.Flags().StringVar(&req.Image, "image", "", "containerDisk image of the boot disk")
+	cmd.Flags().StringToStringVar(&labels, "label", nil, "Labels of the VM, such as --label team=net")
+	wait.addFlags(cmd)
+	return cmd
+}
+
+// applyVMCreateFlags 用命令行中指定的参数覆盖文件中的创建请求, --label合并到文件中的标签
+func applyVMCreateFlags(cmd *cobra.Command, vm *model.VMCreateRequest, flags model.VMCreateRequest, labels map[string]string) {
+	changed := cmd.Flags().Changed
+	if changed("template") {
+		vm.Template = flags.Template
+	}
+	if changed("cpu") {
+		vm.CPU = flags.CPU
+	}
+	if changed("memory") {
+		vm.Memory = flags.Memory
+	}
+	if changed("image") {
+		vm.Image = flags.Image
+	}
+	if len(labels) > 0 && vm.Labels == nil {
+		vm.Labels = make(map[string]string, len(labels))
+	}
+	for k, v := range labels {
+		vm.Labels[k] = v
+	}
+}
+
+func newVMDeleteCommand(o *options) *cobra.Command {
+	var wait waitOptions
+	cmd := &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete a virtual machine",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, namespace, err := o.client()
+			if err != nil {
+				return err
+			}
+			accepted, err := c.DeleteVM(cmd.Context(), model.VMDeleteRequest{Name: args[0], Namespace: namespace})
+			if err != nil {
+				return err
+			}
+			return wait.finish(cmd.Context(), o, c, accepted)
+		},
+	}
+	wait.addFlags(cmd)
+	return cmd
+}
+
+func newVMOperationCommand(o *options, op model.VMOperation) *cobra.Command {
+	var wait waitOptions
+	cmd := &cobra.Command{
+		Use:   string(op) + " <name>",
+		Short: strings.ToUpper(string(op[:1])) + string(op[1:]) + " a virtual machine",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, namespace, err := o.client()
+			if err != nil {
+				return err
+			}
+			accepted, err := c.OperateVM(cmd.Context(), op, args[0], namespace)
+			if err != nil {
+				return err
+			}
+			return wait.finish(cmd.Context(), o, c, accepted)
+		},
+	}
+	wait.addFlags(cmd)
+	return cmd
+}
+
+func newVMListCommand(o *options) *cobra.Command {
+	var (
+		req           model.VMListRequest
+		allNamespaces bool
+		all           bool
+	)
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List virtual machines",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, namespace, err := o.client()
+			if err != nil {
+				return err
+			}
+			if !allNamespaces {
+				req.Namespace = namespace
+			}
+
+			// --all时按游标取完所有页
+			resp, err := c.ListVMs(cmd.Context(), req)
+			if err != nil {
+				return err
+			}
+			for all && resp.NextCursor != "" {
+				req.Cursor = resp.NextCursor
+				page, err := c.ListVMs(cmd.Context(), req)
+				if err != nil {
+					return err
+				}
+				resp.Items = append(resp.Items, page.Items...)
+				resp.NextCursor = page.NextCursor
+			}
+			return o.print(resp, func() table { return vmTable(resp.Items...) })
+		},
+	}
+	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "List VMs of all namespaces the caller can access")
+	cmd.Flags().StringVar(&req.Status, "status", "", "Only list VMs with the status")
+	cmd.Flags().StringVar(&req.NamePrefix, "prefix", "", "Only list VMs whose name starts with the prefix")
+	cmd.Flags().IntVar(&req.Limit, "limit", 0, "Maximum number of VMs per page")
+	cmd.Flags().BoolVar(&all, "all", false, "Fetch all pages")
+	cmd.Flags().BoolVar(&req.Live, "live", false, "Merge the live status from KubeVirt")
+	return cmd
+}
+
+func newVMGetCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "get <name>",
+		Short: "Show a virtual machine",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, namespace, err := o.client()
+			if err != nil {
+				return err
+			}
+			vm, err := c.GetVM(cmd.Context(), args[0], namespace)
+			if err != nil {
+				return err
+			}
+			return o.print(vm, func() table { return vmTable(*vm) })
+		},
+	}
+}
@@ -38,10 +38,13 @@ var rootCmd = &cobra.Command{
 			panic("No modules specified in config")
 		}
 
-		slog.Info("Modules to start", "modules", listModules(modulesNeedToStart))
+		enabledModules := moduleNames(modulesNeedToStart)
+		slog.Info("Modules to start", "modules", strings.Join(enabledModules, ", "))
 		for _, m := range modulesNeedToStart {
 			moduleName := m.Name
-			moduleParams := m.Config.Params
+			moduleParams := newModuleParams(m)
+			moduleParams["version"] = configContent.Version
+			moduleParams["enabledModules"] = enabledModules
 			moduleConnections := make([]config.Connection, 0, len(m.Config.Connections))
 			for _, connName := range m.Config.Connections {
 				alreadyFound := false
@@ -120,16 +123,23 @@ func initLog() {
 	log.InitLogger(logCfg, TARGET_NAME, version)
 }
 
-func listModules(list []config.Module) string {
-	if len(list) == 0 {
-		return ""
+// newModuleParams 复制模块配置中的params, 配置中没有params时viper解析出的map为nil,
+// 直接写入version等公共参数会panic
+func newModuleParams(m config.Module) map[string]interface{} {
+	params := make(map[string]interface{}, len(m.Config.Params)+2)
+	for k, v := range m.Config.Params {
+		params[k] = v
 	}
+	return params
+}
 
+// moduleNames 返回配置中所有模块的名称
+func moduleNames(list []config.Module) []string {
 	names := make([]string, 0, len(list))
 	for _, module := range list {
 		names = append(names, module.Name)
 	}
-	return strings.Join(names, ", ")
+	return names
 }
 
 func main() {
@@ -8,6 +8,11 @@ import (
 	"pdcplet/pkg/log"
 	"pdcplet/pkg/pdcpserver"
 	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -33,15 +38,17 @@ var rootCmd = &cobra.Command{
 
 		address := viper.GetString("listen.address")
 		port := viper.GetUint32("listen.port")
-		dbType := viper.GetString("db.type")
-		var dbFilePath string
-		switch dbType {
-		case "sqlite3":
-			dbFilePath = viper.GetString("db.sqlite3.database")
-		default:
-			slog.Error("Unsupported db type", "dbType", dbType)
-		}
-		s := pdcpserver.New(address, port, dbFilePath)
+		s := pdcpserver.New(address, port, configContent.Db,
+			pdcpserver.WithMetricsConfig(configContent.Metrics),
+			pdcpserver.WithStatusSyncConfig(configContent.StatusSync),
+			pdcpserver.WithLifecycleConfig(configContent.Lifecycle),
+			pdcpserver.WithJobsConfig(configContent.Jobs),
+			pdcpserver.WithNodesConfig(configContent.Nodes),
+			pdcpserver.WithEventsConfig(configContent.Events),
+			pdcpserver.WithWebhooksConfig(configContent.Webhooks),
+			pdcpserver.WithAuthConfig(configContent.Auth),
+			pdcpserver.WithTLSConfig(configContent.Listen.TLS),
+		)
 
 		slog.Info("Starting server", "address", address, "port", port)
 		if err := s.Start(); err != nil {
@@ -52,6 +59,155 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+var apiKeyCmd = &cobra.Command{
+	Use:   "apikey",
+	Short: "Manage API keys of pdcpserver",
+}
+
+var (
+	apiKeyKind     string
+	apiKeyUser     string
+	apiKeyNodeName string
+	userRole       string
+	userNamespaces []string
+)
+
+// apiKeyCreateCmd 直接在数据库中创建API Key, 用于启用认证后创建第一个Key
+var apiKeyCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create an API key and print it",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := database.Init(configContent.Db); err != nil {
+			return err
+		}
+		resp, err := service.NewAPIKeyService().CreateKey(model.APIKeyRequest{
+			Name:     args[0],
+			Kind:     model.APIKeyKind(apiKeyKind),
+			UserName: apiKeyUser,
+			NodeName: apiKeyNodeName,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp.Key)
+		return nil
+	},
+}
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage users of pdcpserver",
+}
+
+// userCreateCmd 直接在数据库中创建用户, 用于启用认证后创建第一个admin
+var userCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create a user with a role",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := database.Init(configContent.Db); err != nil {
+			return err
+		}
+		_, err := service.NewUserService().CreateUser(model.UserRequest{
+			Name:       args[0],
+			Role:       model.Role(userRole),
+			Namespaces: userNamespaces,
+		})
+		return err
+	},
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Manage database schema migrations",
+}
+
+var (
+	migrateTarget uint
+	migrateYes    bool
+)
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show applied and pending migrations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := database.Open(configContent.Db); err != nil {
+			return err
+		}
+		statuses, err := database.MigrationStatuses()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return w.Flush()
+	},
+}
+
+// migrateUpCmd 启动pdcpserver时也会自动执行未执行的迁移
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply pending migrations up to --to, or the latest version",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := database.Open(configContent.Db); err != nil {
+			return err
+		}
+		if err := database.MigrateUp(migrateTarget); err != nil {
+			return err
+		}
+		return printSchemaVersion()
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Revert migrations above --to, or only the last one",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := database.Open(configContent.Db); err != nil {
+			return err
+		}
+		target := migrateTarget
+		if !cmd.Flags().Changed("to") {
+			current, err := database.CurrentVersion()
+			if err != nil {
+				return err
+			}
+			if current == 0 {
+				return printSchemaVersion()
+			}
+			target = current - 1
+		}
+		// 回滚版本1会删除所有表, 包括不带--to只回滚最后一个版本时
+		if target == 0 && !migrateYes {
+			return fmt.Errorf("reverting to version 0 drops all tables, pass --yes to confirm")
+		}
+		if err := database.MigrateDown(target); err != nil {
+			return err
+		}
+		return printSchemaVersion()
+	},
+}
+
+func printSchemaVersion() error {
+	current, err := database.CurrentVersion()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version: %d (latest %d)\n", current, database.LatestVersion())
+	return nil
+}
+
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
@@ -64,6 +220,23 @@ func init() {
 
 	rootCmd.PersistentFlags().StringVarP(&configFilePath, "config", "f", "", "Config file path")
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+
+	apiKeyCreateCmd.Flags().StringVar(&apiKeyKind, "kind", string(model.APIKeyUser), "Key kind, option: user/agent")
+	apiKeyCreateCmd.Flags().StringVar(&apiKeyUser, "user", "", "Owner of a user key, defaults to the key name")
+	apiKeyCreateCmd.Flags().StringVar(&apiKeyNodeName, "node", "", "Restrict an agent key to the node")
+	apiKeyCmd.AddCommand(apiKeyCreateCmd)
+	rootCmd.AddCommand(apiKeyCmd)
+
+	userCreateCmd.Flags().StringVar(&userRole, "role", string(model.RoleViewer), "Role of the user, option: admin/operator/viewer")
+	userCreateCmd.Flags().StringSliceVar(&userNamespaces, "namespace", nil, "Namespaces the user can access, * for all")
+	userCmd.AddCommand(userCreateCmd)
+	rootCmd.AddCommand(userCmd)
+
+	migrateUpCmd.Flags().UintVar(&migrateTarget, "to", 0, "Target version, 0 for the latest")
+	migrateDownCmd.Flags().UintVar(&migrateTarget, "to", 0, "Target version, 0 reverts all migrations and drops all tables")
+	migrateDownCmd.Flags().BoolVar(&migrateYes, "yes", false, "Confirm reverting to version 0, which drops all tables")
+	migrateCmd.AddCommand(migrateStatusCmd, migrateUpCmd, migrateDownCmd)
+	rootCmd.AddCommand(migrateCmd)
 }
 
 func initConfig() {
@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/httputil"
+	"sync"
 	"time"
 )
 
@@ -20,12 +21,27 @@ type CreateResponse struct {
 
 // TODO: 约定传参
 type CreateTaskParams struct {
-	Name string `mapstructure:"name"`
-	VID  string `mapstructure:"vid"`
+	Name      string `mapstructure:"name"`
+	VID       string `mapstructure:"vid"`
+	Namespace string `mapstructure:"namespace"`
+	UID       string `mapstructure:"uid"`
+}
+
+type Task struct {
+	Id        int    `json:"id"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	UID       string `json:"uid"`
 }
 
 var randGen *rand.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
 
+// 已创建的任务, 用于/api/task/list
+var (
+	tasksMu sync.Mutex
+	tasks   = make(map[int]Task)
+)
+
 func main() {
 	// 注册全局请求处理器（网页1/8方案结合）
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -37,6 +53,12 @@ func main() {
 		if r.URL.Path == "/mock/api/task/create" {
 			handleCreate(w, r)
 			return
+		} else if r.URL.Path == "/mock/api/task/list" {
+			handleListTasks(w, r)
+			return
+		} else if r.URL.Path == "/mock/api/rules/list" {
+			writeJSON(w, []interface{}{})
+			return
 		} else if r.URL.Path == "/mock/api/metrics/" {
 			handleMetrics(w, r)
 			return
@@ -74,6 +96,9 @@ func handleCreate(w http.ResponseWriter, r *http.Request) {
 		Id:      randGen.Intn(50) + 1,
 	}
 	fmt.Printf("Response: taskId %d\n", response.Id)
+	tasksMu.Lock()
+	tasks[response.Id] = Task{Id: response.Id, Name: req.Name, Namespace: req.Namespace, UID: req.UID}
+	tasksMu.Unlock()
 	// 设置响应头（网页5关键实践）
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
@@ -84,6 +109,24 @@ func handleCreate(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func handleListTasks(w http.ResponseWriter, r *http.Request) {
+	tasksMu.Lock()
+	list := make([]Task, 0, len(tasks))
+	for _, task := range tasks {
+		list = append(list, task)
+	}
+	tasksMu.Unlock()
+	writeJSON(w, list)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
+	}
+}
+
 func handleMetrics(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("Received metrics request")
 	return
@@ -0,0 +1,43 @@
+package agent
+
+import "time"
+
+// pdcplet上报节点事件的路由, 相对于pdcpserver连接的urlPrefix
+const EVENTS_ROUTE = "/nodes/events"
+
+// pdcplet上报的事件类型
+const (
+	EventTaskCreated = "task.created"
+	EventTaskClosed  = "task.closed"
+	EventAlert       = "alert"
+)
+
+// NodeEvent pdcplet上发生的inpplat任务变化或告警
+type NodeEvent struct {
+	Type      string     `json:"type"`
+	Namespace string     `json:"namespace"`
+	VmiName   string     `json:"vmi_name"`
+	TaskId    int        `json:"task_id"`
+	Alert     *AlertInfo `json:"alert,omitempty"`
+	Time      time.Time  `json:"time"`
+}
+
+// AlertInfo 告警的内容, State为firing或resolved
+type AlertInfo struct {
+	Rule      string     `json:"rule"`
+	Metric    string     `json:"metric"`
+	State     string     `json:"state"`
+	Value     float64    `json:"value"`
+	Threshold float64    `json:"threshold"`
+	Vid       int64      `json:"vid,omitempty"`
+	Mac       string     `json:"mac,omitempty"`
+	StartsAt  time.Time  `json:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at,omitempty"`
+}
+
+// NodeEvents 一次上报的事件, 按发生顺序排列
+type NodeEvents struct {
+	NodeName  string      `json:"node_name"`
+	SessionId string      `json:"session_id"`
+	Events    []NodeEvent `json:"events"`
+}
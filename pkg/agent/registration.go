@@ -0,0 +1,38 @@
+package agent
+
+import "time"
+
+// pdcplet向pdcpserver注册和发送心跳的路由, 相对于pdcpserver连接的urlPrefix
+const (
+	REGISTER_ROUTE  = "/nodes/register"
+	HEARTBEAT_ROUTE = "/nodes/heartbeat"
+)
+
+// Registration pdcplet启动时上报的节点信息
+type Registration struct {
+	NodeName  string   `json:"node_name"`
+	Version   string   `json:"version"`
+	SessionId string   `json:"session_id"` // pdcplet每次启动生成, 心跳的SessionId与注册不一致时需要重新注册
+	Modules   []string `json:"modules"`
+	InpplatStatus
+}
+
+// Heartbeat pdcplet周期性上报的心跳
+type Heartbeat struct {
+	NodeName  string `json:"node_name"`
+	SessionId string `json:"session_id"`
+	InpplatStatus
+}
+
+// InpplatStatus pdcplet到inpplat的连通性
+type InpplatStatus struct {
+	InpplatReachable bool   `json:"inpplat_reachable"`
+	InpplatError     string `json:"inpplat_error,omitempty"`
+}
+
+// Ack pdcpserver对注册和心跳的确认
+type Ack struct {
+	NodeName   string    `json:"node_name"`
+	SessionId  string    `json:"session_id"`
+	ReceivedAt time.Time `json:"received_at"`
+}
@@ -0,0 +1,36 @@
+package agent
+
+// pdcplet拉取规则集和上报规则下发结果的路由, 相对于pdcpserver连接的urlPrefix
+const (
+	RULES_ROUTE        = "/nodes/rules"
+	RULES_STATUS_ROUTE = "/nodes/rules/status"
+)
+
+// RuleSet 节点上所有VM生效的规则, Version由内容计算, 内容不变时Version不变
+type RuleSet struct {
+	NodeName string        `json:"node_name"`
+	Version  string        `json:"version"`
+	Bindings []RuleBinding `json:"bindings"`
+}
+
+// RuleBinding 一个VM上生效的规则
+type RuleBinding struct {
+	Namespace string     `json:"namespace"`
+	VmName    string     `json:"vm_name"`
+	Rules     []RuleSpec `json:"rules"`
+}
+
+type RuleSpec struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	Filter   string `json:"filter,omitempty"`
+	Priority int    `json:"priority"`
+	Version  int64  `json:"version"`
+}
+
+// RuleSetStatus pdcplet下发规则集的结果, Error不为空时AppliedVersion为上一次成功下发的版本
+type RuleSetStatus struct {
+	NodeName       string `json:"node_name"`
+	AppliedVersion string `json:"applied_version"`
+	Error          string `json:"error,omitempty"`
+}
@@ -15,8 +15,10 @@ const (
 	CREATETASKROUTER  = "/api/task/create"
 	CLOSETASKROUTER   = "/api/task/close"
 	HEARTBEATROUTER   = "/api/task/heartbeat"
+	LISTTASKSROUTER   = "/api/task/list"
 	BINDRULESROUTER   = "/api/rules/bind"
 	UNBINDRULESROUTER = "/api/rules/unbind"
+	LISTRULESROUTER   = "/api/rules/list"
 	GETFORWARDMETRICS = "/api/metrics/"
 )
 
@@ -28,8 +30,12 @@ type Client interface {
 	CreateTask(map[string]string) (int, error)
 	CloseTask(int) error
 	SendHeartbeat(int) error
+	// ListTasks 返回所有未关闭的任务, pdcplet重启后用于重建taskId到VMI的映射
+	ListTasks() ([]Task, error)
 	BindRules([]Rule) error
 	UnbindRules([]Rule) error
+	// ListRules 返回所有任务上已绑定的规则
+	ListRules() ([]Rule, error)
 	GetForwardMetricsByTask(taskId int) (ForwardMetrics, error)
 	GetAllForwardMetricsGroupByTask() ([]ForwardMetrics, error)
 	// GetForwardMetricsByVid(vid []int) error
@@ -114,6 +120,21 @@ func (p *restProxyClient) SendHeartbeat(id int) error {
 	return err
 }
 
+func (p *restProxyClient) ListTasks() ([]Task, error) {
+	var tasks []Task
+	resp, err := p.client.R().
+		SetResult(&tasks).
+		Get(LISTTASKSROUTER)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		slog.Error("ListTasks failed", "Response Message", resp.String())
+		return nil, fmt.Errorf("ListTasks failed, status: %d", resp.StatusCode())
+	}
+	return tasks, nil
+}
+
 func (p *restProxyClient) BindRules(rules []Rule) error {
 	resp, err := p.client.R().
 		SetBody(rules).
@@ -124,7 +145,7 @@ func (p *restProxyClient) BindRules(rules []Rule) error {
 	// TODO: 需要约定HTTP方法的响应码和响应消息
 	if resp.StatusCode() != http.StatusOK {
 		slog.Error("BindRules failed, Recvied: %s", "Response Message", resp.String())
-		return err
+		return fmt.Errorf("BindRules failed, status: %d", resp.StatusCode())
 	}
 
 	return err
@@ -140,12 +161,27 @@ func (p *restProxyClient) UnbindRules(rules []Rule) error {
 	// TODO: 需要约定HTTP方法的响应码和响应消息
 	if resp.StatusCode() != http.StatusOK {
 		slog.Error("UnbindRules failed, Recvied: %s", "Response Message", resp.String())
-		return err
+		return fmt.Errorf("UnbindRules failed, status: %d", resp.StatusCode())
 	}
 
 	return err
 }
 
+func (p *restProxyClient) ListRules() ([]Rule, error) {
+	var rules []Rule
+	resp, err := p.client.R().
+		SetResult(&rules).
+		Get(LISTRULESROUTER)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		slog.Error("ListRules failed", "Response Message", resp.String())
+		return nil, fmt.Errorf("ListRules failed, status: %d", resp.StatusCode())
+	}
+	return rules, nil
+}
+
 func (p *restProxyClient) GetForwardMetricsByTask(taskId int) (ForwardMetrics, error) {
 	var result ForwardMetrics
 
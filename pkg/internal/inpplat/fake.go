@@ -0,0 +1,139 @@
+package inpplat
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var _ Client = (*FakeClient)(nil)
+
+// FakeClient 内存实现的inpplat客户端, 用于测试规则下发等流程
+type FakeClient struct {
+	mu      sync.Mutex
+	tasks   map[int]Task
+	rules   map[int]map[string]Rule
+	metrics []ForwardMetrics
+	nextId  int
+	// BindErr 不为nil时BindRules返回该错误
+	BindErr error
+}
+
+func NewFakeClient() *FakeClient {
+	return &FakeClient{tasks: make(map[int]Task), rules: make(map[int]map[string]Rule)}
+}
+
+func (f *FakeClient) CreateTask(taskParams map[string]string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextId++
+	params := CompleteTaskParams(taskParams)
+	f.tasks[f.nextId] = Task{Id: f.nextId, Name: params.Name, Namespace: params.Namespace, UID: params.UID}
+	return f.nextId, nil
+}
+
+func (f *FakeClient) CloseTask(id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.tasks, id)
+	delete(f.rules, id)
+	return nil
+}
+
+// ListTasks 返回未关闭的任务, 按Id排序
+func (f *FakeClient) ListTasks() ([]Task, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tasks := make([]Task, 0, len(f.tasks))
+	for _, task := range f.tasks {
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Id < tasks[j].Id })
+	return tasks, nil
+}
+
+func (f *FakeClient) SendHeartbeat(int) error {
+	return nil
+}
+
+func (f *FakeClient) BindRules(rules []Rule) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.BindErr != nil {
+		return f.BindErr
+	}
+	for _, rule := range rules {
+		if f.rules[rule.TaskId] == nil {
+			f.rules[rule.TaskId] = make(map[string]Rule)
+		}
+		f.rules[rule.TaskId][rule.Name] = rule
+	}
+	return nil
+}
+
+func (f *FakeClient) UnbindRules(rules []Rule) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, rule := range rules {
+		if _, ok := f.rules[rule.TaskId][rule.Name]; !ok {
+			return errors.New("rule is not bound")
+		}
+		delete(f.rules[rule.TaskId], rule.Name)
+	}
+	return nil
+}
+
+// ListRules 返回所有任务上已绑定的规则, 按TaskId和Name排序
+func (f *FakeClient) ListRules() ([]Rule, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var rules []Rule
+	for _, bound := range f.rules {
+		for _, rule := range bound {
+			rules = append(rules, rule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].TaskId != rules[j].TaskId {
+			return rules[i].TaskId < rules[j].TaskId
+		}
+		return rules[i].Name < rules[j].Name
+	})
+	return rules, nil
+}
+
+// SetMetrics 设置GetAllForwardMetricsGroupByTask返回的流量指标
+func (f *FakeClient) SetMetrics(metrics []ForwardMetrics) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.metrics = append([]ForwardMetrics(nil), metrics...)
+}
+
+// BoundRules 返回任务上已绑定的规则, 按Name排序
+func (f *FakeClient) BoundRules(taskId int) []Rule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rules := make([]Rule, 0, len(f.rules[taskId]))
+	for _, rule := range f.rules[taskId] {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+func (f *FakeClient) GetForwardMetricsByTask(taskId int) (ForwardMetrics, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range f.metrics {
+		if m.TaskId == taskId {
+			return m, nil
+		}
+	}
+	return ForwardMetrics{}, errors.New("task not found")
+}
+
+func (f *FakeClient) GetAllForwardMetricsGroupByTask() ([]ForwardMetrics, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]ForwardMetrics(nil), f.metrics...), nil
+}
@@ -6,12 +6,30 @@ const (
 	MOCK_API_BASE_URL = "/mock/"
 )
 
-type Rule struct{}
+// Rule 绑定到inpplat任务上的解析规则, 同一任务上Name唯一
+type Rule struct {
+	TaskId   int    `json:"task_id"`
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	Filter   string `json:"filter,omitempty"`
+	Priority int    `json:"priority"`
+	Version  int64  `json:"version"`
+}
 
 // TODO: 约定传参
 type CreateTaskParams struct {
-	Name string `mapstructure:"name"`
-	VID  string `mapstructure:"vid"`
+	Name      string `mapstructure:"name"`
+	VID       string `mapstructure:"vid"`
+	Namespace string `mapstructure:"namespace"`
+	UID       string `mapstructure:"uid"`
+}
+
+// Task inpplat上已创建的任务, Namespace/Name/UID为创建任务时传入的VMI信息
+type Task struct {
+	Id        int    `json:"id"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	UID       string `json:"uid"`
 }
 
 // TODO: 约定返回接口
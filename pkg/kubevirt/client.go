@@ -1,12 +1,17 @@
 package kubevirt
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 
+	networkv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 	"github.com/spf13/pflag"
+	k8sv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/retry"
 	kubevirtv1 "kubevirt.io/api/core/v1"
 	"kubevirt.io/client-go/kubecli"
@@ -29,42 +34,192 @@ func init() {
 	virtClient = client
 }
 
-func CreateVM(vm *kubevirtv1.VirtualMachine) error {
-	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		_, err := virtClient.VirtualMachine(vm.Namespace).Create(vm)
+// Client 返回全局的KubeVirt客户端, 初始化失败时为nil
+func Client() kubecli.KubevirtClient {
+	return virtClient
+}
+
+// VMClient VM的创建、查询与删除, 便于在测试中以fake实现替换KubeVirt
+type VMClient interface {
+	CreateVM(vm *kubevirtv1.VirtualMachine) (*kubevirtv1.VirtualMachine, error)
+	GetVM(vmName string, vmNamespace string) (*kubevirtv1.VirtualMachine, error)
+	DeleteVM(vmName string, vmNamespace string) error
+	CreateSecret(secret *k8sv1.Secret) error
+	OrphanDataVolume(dvName string, dvNamespace string) error
+	AdoptDataVolume(dvName string, dvNamespace string, owner k8smetav1.OwnerReference) error
+	CreateVlanNetwork(namespace string, source string, target string, vlanID int64) error
+}
+
+type vmClient struct {
+	client kubecli.KubevirtClient
+}
+
+func NewVMClient(client kubecli.KubevirtClient) VMClient {
+	return &vmClient{client: client}
+}
+
+func (c *vmClient) CreateVM(vm *kubevirtv1.VirtualMachine) (*kubevirtv1.VirtualMachine, error) {
+	var created *kubevirtv1.VirtualMachine
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var err error
+		created, err = c.client.VirtualMachine(vm.Namespace).Create(vm)
 		return err
 	})
+	return created, err
 }
 
-func DeleteVM(vmName string, vmNamespace string) error {
+func (c *vmClient) GetVM(vmName string, vmNamespace string) (*kubevirtv1.VirtualMachine, error) {
+	return c.client.VirtualMachine(vmNamespace).Get(vmName, &k8smetav1.GetOptions{})
+}
+
+func (c *vmClient) DeleteVM(vmName string, vmNamespace string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		return c.client.VirtualMachine(vmNamespace).Delete(vmName, &k8smetav1.DeleteOptions{})
+	})
+}
+
+func (c *vmClient) CreateSecret(secret *k8sv1.Secret) error {
+	_, err := c.client.CoreV1().Secrets(secret.Namespace).Create(context.Background(), secret, k8smetav1.CreateOptions{})
+	return err
+}
+
+// OrphanDataVolume 移除DataVolume的ownerReferences, 删除VM时DataVolume及其PVC不会被垃圾回收
+func (c *vmClient) OrphanDataVolume(dvName string, dvNamespace string) error {
+	dataVolumes := c.client.CdiClient().CdiV1beta1().DataVolumes(dvNamespace)
 	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		err := virtClient.VirtualMachine(vmNamespace).Delete(vmName, &k8smetav1.DeleteOptions{})
+		dv, err := dataVolumes.Get(context.Background(), dvName, k8smetav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if len(dv.OwnerReferences) == 0 {
+			return nil
+		}
+		dv.OwnerReferences = nil
+		_, err = dataVolumes.Update(context.Background(), dv, k8smetav1.UpdateOptions{})
 		return err
 	})
 }
 
-func StartVM(vm *kubevirtv1.VirtualMachine) error {
-	patchData := map[string]interface{}{
-		"spec": map[string]interface{}{
-			"running": true,
-		},
-	}
-	patchBytes, _ := json.Marshal(patchData)
+// AdoptDataVolume 将保留的DataVolume的owner设为新VM, 之后与dataVolumeTemplate创建的DataVolume一样随VM删除或保留
+func (c *vmClient) AdoptDataVolume(dvName string, dvNamespace string, owner k8smetav1.OwnerReference) error {
+	dataVolumes := c.client.CdiClient().CdiV1beta1().DataVolumes(dvNamespace)
 	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		_, err := virtClient.VirtualMachine(vm.Namespace).Patch(vm.Name, types.JSONPatchType, patchBytes, &k8smetav1.PatchOptions{}, "")
+		dv, err := dataVolumes.Get(context.Background(), dvName, k8smetav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if len(dv.OwnerReferences) == 1 && dv.OwnerReferences[0].UID == owner.UID {
+			return nil
+		}
+		dv.OwnerReferences = []k8smetav1.OwnerReference{owner}
+		_, err = dataVolumes.Update(context.Background(), dv, k8smetav1.UpdateOptions{})
 		return err
 	})
 }
 
-func Stop(vm *kubevirtv1.VirtualMachine) error {
-	patchData := map[string]interface{}{
-		"spec": map[string]interface{}{
-			"running": false,
+// CreateVlanNetwork 复制source NetworkAttachmentDefinition的CNI配置并设置vlan, 创建名为target的网络,
+// bridge和sriov CNI均以vlan字段配置VLAN. target已存在时不做修改
+func (c *vmClient) CreateVlanNetwork(namespace string, source string, target string, vlanID int64) error {
+	nads := c.client.NetworkClient().K8sCniCncfIoV1().NetworkAttachmentDefinitions(namespace)
+	if _, err := nads.Get(context.Background(), target, k8smetav1.GetOptions{}); err == nil || !apierrors.IsNotFound(err) {
+		return err
+	}
+	nad, err := nads.Get(context.Background(), source, k8smetav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	config, err := vlanNetworkConfig(nad.Spec.Config, vlanID)
+	if err != nil {
+		return fmt.Errorf("network %s/%s: %w", namespace, source, err)
+	}
+	vlanNad := &networkv1.NetworkAttachmentDefinition{
+		ObjectMeta: k8smetav1.ObjectMeta{
+			Name:        target,
+			Namespace:   namespace,
+			Annotations: nad.Annotations,
 		},
+		Spec: networkv1.NetworkAttachmentDefinitionSpec{Config: config},
+	}
+	_, err = nads.Create(context.Background(), vlanNad, k8smetav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+// vlanNetworkConfig 设置CNI配置中的vlan, 插件列表格式的配置设置在第一个插件上
+func vlanNetworkConfig(config string, vlanID int64) (string, error) {
+	var conf map[string]interface{}
+	if err := json.Unmarshal([]byte(config), &conf); err != nil {
+		return "", fmt.Errorf("invalid cni config: %w", err)
 	}
-	patchBytes, _ := json.Marshal(patchData)
+	plugin := conf
+	if plugins, ok := conf["plugins"].([]interface{}); ok {
+		if len(plugins) == 0 {
+			return "", errors.New("empty cni plugin list")
+		}
+		first, ok := plugins[0].(map[string]interface{})
+		if !ok {
+			return "", errors.New("invalid cni plugin list")
+		}
+		plugin = first
+	}
+	plugin["vlan"] = vlanID
+	if name, ok := conf["name"].(string); ok {
+		conf["name"] = fmt.Sprintf("%s-vlan%d", name, vlanID)
+	}
+	out, err := json.Marshal(conf)
+	return string(out), err
+}
+
+func CreateVM(vm *kubevirtv1.VirtualMachine) error {
+	_, err := NewVMClient(virtClient).CreateVM(vm)
+	return err
+}
+
+func DeleteVM(vmName string, vmNamespace string) error {
+	return NewVMClient(virtClient).DeleteVM(vmName, vmNamespace)
+}
+
+func GetVM(vmName string, vmNamespace string) (*kubevirtv1.VirtualMachine, error) {
+	return NewVMClient(virtClient).GetVM(vmName, vmNamespace)
+}
+
+func GetVMI(vmiName string, vmiNamespace string) (*kubevirtv1.VirtualMachineInstance, error) {
+	return virtClient.VirtualMachineInstance(vmiNamespace).Get(vmiName, &k8smetav1.GetOptions{})
+}
+
+// StartVM 通过start子资源启动VM
+func StartVM(vmName string, vmNamespace string) error {
 	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		_, err := virtClient.VirtualMachine(vm.Namespace).Patch(vm.Name, types.JSONPatchType, patchBytes, &k8smetav1.PatchOptions{}, "")
-		return err
+		return virtClient.VirtualMachine(vmNamespace).Start(vmName, &kubevirtv1.StartOptions{})
+	})
+}
+
+// StopVM 通过stop子资源停止VM
+func StopVM(vmName string, vmNamespace string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		return virtClient.VirtualMachine(vmNamespace).Stop(vmName, &kubevirtv1.StopOptions{})
+	})
+}
+
+// RestartVM 通过restart子资源重启VM
+func RestartVM(vmName string, vmNamespace string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		return virtClient.VirtualMachine(vmNamespace).Restart(vmName, &kubevirtv1.RestartOptions{})
+	})
+}
+
+// PauseVM 通过VMI的pause子资源暂停VM
+func PauseVM(vmName string, vmNamespace string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		return virtClient.VirtualMachineInstance(vmNamespace).Pause(vmName, &kubevirtv1.PauseOptions{})
+	})
+}
+
+// UnpauseVM 通过VMI的unpause子资源恢复VM
+func UnpauseVM(vmName string, vmNamespace string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		return virtClient.VirtualMachineInstance(vmNamespace).Unpause(vmName, &kubevirtv1.UnpauseOptions{})
 	})
 }
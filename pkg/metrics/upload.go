@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"pdcplet/pkg/internal/inpplat"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pdcplet与pdcpserver之间上报指标时使用的HTTP头
+const (
+	HEADER_SIGNATURE     = "X-Pdcp-Signature"
+	HEADER_NODE_NAME     = "X-Pdcp-Node"
+	HEADER_TIMESTAMP     = "X-Pdcp-Timestamp"
+	SIGNATURE_PREFIX     = "sha256="
+	BEARER_PREFIX        = "Bearer "
+	CONTENT_ENCODING     = "gzip"
+	AUTH_MODE_HMAC       = "hmac"
+	AUTH_MODE_BEARER     = "bearer"
+	UPLOAD_METRICS_ROUTE = "/metrics/"
+)
+
+// SIGNATURE_MAX_SKEW 请求签名中的时间戳与服务端时间允许的最大偏差, 超出时视为重放
+const SIGNATURE_MAX_SKEW = 5 * time.Minute
+
+// 上报请求的大小限制, pdcpserver可以通过配置覆盖
+const (
+	DEFAULT_MAX_UPLOAD_BODY = 8 << 20  // 请求体的最大字节数
+	DEFAULT_MAX_UPLOAD_SIZE = 64 << 20 // 解压后JSON的最大字节数, 防止压缩比极高的请求体耗尽内存
+)
+
+var (
+	ErrSignatureExpired = errors.New("signature timestamp is missing or expired")
+	ErrSignatureInvalid = errors.New("signature mismatch")
+	ErrUploadTooLarge   = errors.New("metrics upload is too large")
+)
+
+// Envelope 一个采集周期的指标及其来源信息
+type Envelope struct {
+	NodeName    string                   `json:"node_name"`
+	Version     string                   `json:"version"`
+	SessionId   string                   `json:"session_id"` // pdcplet每次启动生成, 用于区分重启后重新计数的序号
+	Sequence    uint64                   `json:"sequence"`
+	CollectedAt time.Time                `json:"collected_at"`
+	Tasks       []TaskRef                `json:"tasks,omitempty"`
+	Metrics     []inpplat.ForwardMetrics `json:"metrics"`
+}
+
+// TaskRef inpplat任务对应的VMI
+type TaskRef struct {
+	TaskId    int    `json:"task_id"`
+	Namespace string `json:"namespace"`
+	VmiName   string `json:"vmi_name"`
+}
+
+// Upload 一次上报请求, 包含尚未被确认的所有Envelope
+type Upload struct {
+	Envelopes []Envelope `json:"envelopes"`
+}
+
+// Ack pdcpserver对上报请求的确认
+type Ack struct {
+	NodeName      string   `json:"node_name"`
+	SessionId     string   `json:"session_id"`
+	AckedSequence uint64   `json:"acked_sequence"` // 已持久化的最大序号, 小于等于该序号的Envelope无需重发
+	Duplicates    []uint64 `json:"duplicates,omitempty"`
+	Gaps          []uint64 `json:"gaps,omitempty"`
+}
+
+// Encode 将Upload序列化为gzip压缩的JSON
+func Encode(upload Upload) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(upload); err != nil {
+		zw.Close()
+		return nil, fmt.Errorf("encode metrics upload failed: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("compress metrics upload failed: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode 解析上报请求体, gzipped表示请求体是否经过gzip压缩. 解压后超过maxSize字节时返回ErrUploadTooLarge,
+// maxSize不大于0时使用DEFAULT_MAX_UPLOAD_SIZE
+func Decode(body []byte, gzipped bool, maxSize int64) (Upload, error) {
+	var upload Upload
+	if maxSize <= 0 {
+		maxSize = DEFAULT_MAX_UPLOAD_SIZE
+	}
+	var r io.Reader = bytes.NewReader(body)
+	if gzipped {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return upload, fmt.Errorf("decompress metrics upload failed: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	// 多读一个字节以判断是否超出限制
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return upload, fmt.Errorf("decompress metrics upload failed: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return upload, fmt.Errorf("%w: exceeds %d bytes", ErrUploadTooLarge, maxSize)
+	}
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return upload, fmt.Errorf("decode metrics upload failed: %w", err)
+	}
+	return upload, nil
+}
+
+// Sign 计算请求体的HMAC-SHA256签名
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return SIGNATURE_PREFIX + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验请求体的HMAC-SHA256签名
+func Verify(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, SIGNATURE_PREFIX) {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// SignRequest 计算pdcplet请求的HMAC-SHA256签名, 签名内容为方法、路径、排序后的查询参数、
+// 时间戳(unix秒)和请求体的SHA256, 使不同请求的签名不同且过期后无法重放
+func SignRequest(secret, method, path string, query url.Values, timestamp string, body []byte) string {
+	return Sign(secret, canonicalRequest(method, path, query, timestamp, body))
+}
+
+// VerifyRequest 校验SignRequest生成的签名, 时间戳与now相差超过SIGNATURE_MAX_SKEW时返回ErrSignatureExpired
+func VerifyRequest(secret, method, path string, query url.Values, timestamp string, body []byte, signature string, now time.Time) error {
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrSignatureExpired
+	}
+	if skew := now.Sub(time.Unix(sec, 0)); skew > SIGNATURE_MAX_SKEW || skew < -SIGNATURE_MAX_SKEW {
+		return ErrSignatureExpired
+	}
+	if !Verify(secret, canonicalRequest(method, path, query, timestamp, body), signature) {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
+
+func canonicalRequest(method, path string, query url.Values, timestamp string, body []byte) []byte {
+	digest := sha256.Sum256(body)
+	return []byte(strings.Join([]string{
+		strings.ToUpper(method), path, query.Encode(), timestamp, hex.EncodeToString(digest[:]),
+	}, "\n"))
+}
@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"pdcplet/pkg/internal/inpplat"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	collectedAt := time.Unix(1700000000, 0).UTC()
+	upload := Upload{Envelopes: []Envelope{{
+		NodeName:    "node1",
+		Version:     "v1",
+		SessionId:   "s1",
+		Sequence:    3,
+		CollectedAt: collectedAt,
+		Tasks:       []TaskRef{{TaskId: 7, Namespace: "default", VmiName: "vm1"}},
+		Metrics:     []inpplat.ForwardMetrics{{TaskId: 7}},
+	}}}
+
+	body, err := Encode(upload)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	got, err := Decode(body, true, 0)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(got.Envelopes) != 1 {
+		t.Fatalf("decoded %d envelopes, want 1", len(got.Envelopes))
+	}
+	e := got.Envelopes[0]
+	if e.NodeName != "node1" || e.SessionId != "s1" || e.Sequence != 3 || !e.CollectedAt.Equal(collectedAt) ||
+		len(e.Tasks) != 1 || e.Tasks[0].VmiName != "vm1" || len(e.Metrics) != 1 || e.Metrics[0].TaskId != 7 {
+		t.Fatalf("unexpected envelope: %+v", e)
+	}
+
+	if _, err := Decode(body, false, 0); err == nil {
+		t.Fatalf("decode gzipped body as plain json should fail")
+	}
+	if _, err := Decode([]byte(`{"envelopes":[{"sequence":1}]}`), false, 0); err != nil {
+		t.Fatalf("decode plain json: %v", err)
+	}
+	if _, err := Decode([]byte("not gzip"), true, 0); err == nil {
+		t.Fatalf("decode invalid gzip should fail")
+	}
+}
+
+func TestDecodeMaxSize(t *testing.T) {
+	// 高度重复的内容压缩后远小于解压后的大小
+	upload := Upload{Envelopes: make([]Envelope, 2000)}
+	for i := range upload.Envelopes {
+		upload.Envelopes[i] = Envelope{NodeName: "node1", SessionId: "s1", Sequence: uint64(i)}
+	}
+	body, err := Encode(upload)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	plain, _ := json.Marshal(upload)
+	size := int64(len(plain)) + 1 // Encode在末尾写入换行
+
+	tests := []struct {
+		name    string
+		body    []byte
+		gzipped bool
+		maxSize int64
+		wantErr error
+	}{
+		{name: "gzip within limit", body: body, gzipped: true, maxSize: size},
+		{name: "gzip exceeds limit", body: body, gzipped: true, maxSize: size - 1, wantErr: ErrUploadTooLarge},
+		{name: "plain within limit", body: plain, maxSize: int64(len(plain))},
+		{name: "plain exceeds limit", body: plain, maxSize: int64(len(plain)) - 1, wantErr: ErrUploadTooLarge},
+		{name: "default limit", body: body, gzipped: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.body, tt.gzipped, tt.maxSize)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && len(got.Envelopes) != len(upload.Envelopes) {
+				t.Fatalf("decoded %d envelopes", len(got.Envelopes))
+			}
+		})
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"envelopes":[]}`)
+	signature := Sign("secret", body)
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{name: "valid", secret: "secret", body: body, signature: signature, want: true},
+		{name: "wrong secret", secret: "other", body: body, signature: signature},
+		{name: "body changed", secret: "secret", body: []byte(`{"envelopes":null}`), signature: signature},
+		{name: "no prefix", secret: "secret", body: body, signature: signature[len(SIGNATURE_PREFIX):]},
+		{name: "empty", secret: "secret", body: body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.body, tt.signature); got != tt.want {
+				t.Fatalf("Verify = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignRequestVerifyRequest(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	query := url.Values{"version": {"3"}, "node": {"node1"}}
+	body := []byte(`{"node_name":"node1"}`)
+	signature := SignRequest("secret", "post", "/pdcplet/nodes/heartbeat", query, timestamp, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		method    string
+		path      string
+		query     url.Values
+		timestamp string
+		body      []byte
+		now       time.Time
+		want      error
+	}{
+		{name: "valid", method: "POST", want: nil},
+		{name: "method case insensitive", method: "post", want: nil},
+		{name: "query order", query: url.Values{"node": {"node1"}, "version": {"3"}}, want: nil},
+		{name: "skew within limit", now: now.Add(SIGNATURE_MAX_SKEW), want: nil},
+		{name: "expired", now: now.Add(SIGNATURE_MAX_SKEW + time.Second), want: ErrSignatureExpired},
+		{name: "from future", now: now.Add(-SIGNATURE_MAX_SKEW - time.Second), want: ErrSignatureExpired},
+		{name: "invalid timestamp", timestamp: "abc", want: ErrSignatureExpired},
+		{name: "wrong secret", secret: "other", want: ErrSignatureInvalid},
+		{name: "method changed", method: "PUT", want: ErrSignatureInvalid},
+		{name: "path changed", path: "/pdcplet/nodes/register", want: ErrSignatureInvalid},
+		{name: "query changed", query: url.Values{"version": {"4"}, "node": {"node1"}}, want: ErrSignatureInvalid},
+		{name: "timestamp changed", timestamp: strconv.FormatInt(now.Unix()+1, 10), want: ErrSignatureInvalid},
+		{name: "body changed", body: []byte(`{"node_name":"node2"}`), want: ErrSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 未指定的字段使用签名时的值
+			if tt.secret == "" {
+				tt.secret = "secret"
+			}
+			if tt.method == "" {
+				tt.method = "POST"
+			}
+			if tt.path == "" {
+				tt.path = "/pdcplet/nodes/heartbeat"
+			}
+			if tt.query == nil {
+				tt.query = query
+			}
+			if tt.timestamp == "" {
+				tt.timestamp = timestamp
+			}
+			if tt.body == nil {
+				tt.body = body
+			}
+			if tt.now.IsZero() {
+				tt.now = now
+			}
+			err := VerifyRequest(tt.secret, tt.method, tt.path, tt.query, tt.timestamp, tt.body, signature, tt.now)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("VerifyRequest = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
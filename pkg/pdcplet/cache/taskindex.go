@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"fmt"
+	"log/slog"
+	"pdcplet/pkg/internal/inpplat"
+	"sync"
+)
+
+// VmiRef 记录inpplat任务对应的VMI身份信息
+type VmiRef struct {
+	Namespace string
+	Name      string
+	UID       string
+}
+
+// TaskIndex 维护taskId到VMI的映射, 供不同模块之间共享
+type TaskIndex interface {
+	Put(taskId int, ref VmiRef)
+	Get(taskId int) (VmiRef, error)
+	Remove(taskId int)
+	// Find 根据VMI查找taskId
+	Find(namespace string, name string) (int, bool)
+}
+
+var (
+	defaultTaskIndex = NewTaskIndex()
+
+	defaultTaskIndexMu     sync.Mutex
+	defaultTaskIndexLoaded bool
+)
+
+// DefaultTaskIndex 返回进程内共享的TaskIndex
+func DefaultTaskIndex() TaskIndex {
+	return defaultTaskIndex
+}
+
+// LoadDefaultTaskIndex 从inpplat加载pdcplet重启前创建的任务到DefaultTaskIndex, 只在首次成功时加载.
+// 使用DefaultTaskIndex的模块在启动时调用, 失败时在下一个周期重试
+func LoadDefaultTaskIndex(client inpplat.Client) error {
+	defaultTaskIndexMu.Lock()
+	defer defaultTaskIndexMu.Unlock()
+	if defaultTaskIndexLoaded {
+		return nil
+	}
+	if err := LoadTaskIndex(defaultTaskIndex, client); err != nil {
+		return err
+	}
+	defaultTaskIndexLoaded = true
+	return nil
+}
+
+// LoadTaskIndex 将inpplat上未关闭的任务加入index, 已存在的taskId保持不变.
+// 没有VMI信息的任务(由旧版本pdcplet创建)无法对应到VMI, 跳过
+func LoadTaskIndex(index TaskIndex, client inpplat.Client) error {
+	tasks, err := client.ListTasks()
+	if err != nil {
+		return fmt.Errorf("list inpplat tasks failed: %w", err)
+	}
+	loaded, skipped := 0, 0
+	for _, task := range tasks {
+		if task.Namespace == "" || task.Name == "" {
+			skipped++
+			continue
+		}
+		if _, err := index.Get(task.Id); err == nil {
+			continue
+		}
+		index.Put(task.Id, VmiRef{Namespace: task.Namespace, Name: task.Name, UID: task.UID})
+		loaded++
+	}
+	slog.Info("Task index loaded from inpplat", "loaded", loaded, "skipped", skipped)
+	return nil
+}
+
+type taskIndex struct {
+	mu    sync.RWMutex
+	tasks map[int]VmiRef
+}
+
+func NewTaskIndex() TaskIndex {
+	return &taskIndex{
+		tasks: make(map[int]VmiRef),
+	}
+}
+
+func (t *taskIndex) Put(taskId int, ref VmiRef) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tasks[taskId] = ref
+}
+
+func (t *taskIndex) Get(taskId int) (VmiRef, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	ref, exist := t.tasks[taskId]
+	if !exist {
+		return VmiRef{}, fmt.Errorf("no TaskId(%d) in index", taskId)
+	}
+	return ref, nil
+}
+
+func (t *taskIndex) Remove(taskId int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.tasks, taskId)
+}
+
+func (t *taskIndex) Find(namespace string, name string) (int, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for taskId, ref := range t.tasks {
+		if ref.Namespace == namespace && ref.Name == name {
+			return taskId, true
+		}
+	}
+	return 0, false
+}
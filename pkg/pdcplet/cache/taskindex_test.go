@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"pdcplet/pkg/internal/inpplat"
+	"testing"
+)
+
+func TestLoadTaskIndex(t *testing.T) {
+	fake := inpplat.NewFakeClient()
+	vm1, _ := fake.CreateTask(map[string]string{"name": "vm1", "namespace": "default", "uid": "uid1"})
+	vm2, _ := fake.CreateTask(map[string]string{"name": "vm2", "namespace": "team-a", "uid": "uid2"})
+	legacy, _ := fake.CreateTask(map[string]string{"name": "vm3"})
+	closed, _ := fake.CreateTask(map[string]string{"name": "vm4", "namespace": "default"})
+	fake.CloseTask(closed)
+
+	index := NewTaskIndex()
+	// 重启后已由vmiproxy重新写入的任务保持不变
+	index.Put(vm2, VmiRef{Namespace: "team-a", Name: "vm2", UID: "uid2-new"})
+	if err := LoadTaskIndex(index, fake); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		taskId int
+		want   VmiRef
+		exists bool
+	}{
+		{"loaded", vm1, VmiRef{Namespace: "default", Name: "vm1", UID: "uid1"}, true},
+		{"kept", vm2, VmiRef{Namespace: "team-a", Name: "vm2", UID: "uid2-new"}, true},
+		{"without namespace", legacy, VmiRef{}, false},
+		{"closed", closed, VmiRef{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := index.Get(tt.taskId)
+			if (err == nil) != tt.exists || ref != tt.want {
+				t.Fatalf("Get(%d) = %+v, %v, want %+v exists=%v", tt.taskId, ref, err, tt.want, tt.exists)
+			}
+		})
+	}
+	if taskId, ok := index.Find("default", "vm1"); !ok || taskId != vm1 {
+		t.Errorf("Find(default/vm1) = %d, %v", taskId, ok)
+	}
+}
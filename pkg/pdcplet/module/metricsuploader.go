@@ -0,0 +1,102 @@
+package module
+
+import (
+	"fmt"
+	"log/slog"
+	"pdcplet/pkg/internal/inpplat"
+	"pdcplet/pkg/metrics"
+	vcache "pdcplet/pkg/pdcplet/cache"
+	"pdcplet/pkg/pdcpserver/client"
+	"strconv"
+	"time"
+
+	"resty.dev/v3"
+)
+
+const DEFAULT_MAX_PENDING_UPLOADS = 120
+
+// metricsUploader 将每个周期的指标封装成带序号的Envelope, 批量压缩签名后上报pdcpserver,
+// 未被pdcpserver确认的Envelope会保留到下次上报时重发
+type metricsUploader struct {
+	pdcpclient *client.AgentClient
+	nodeName   string
+	version    string
+	sessionId  string
+	maxPending int
+	sequence   uint64
+	pending    []metrics.Envelope
+}
+
+func newMetricsUploader(restclient *resty.Client, nodeName, version, authMode, authToken string, maxPending int) (*metricsUploader, error) {
+	switch authMode {
+	case "":
+		authMode = metrics.AUTH_MODE_HMAC
+	case metrics.AUTH_MODE_HMAC, metrics.AUTH_MODE_BEARER:
+	default:
+		return nil, fmt.Errorf("upload auth mode %s is not supported", authMode)
+	}
+	if maxPending <= 0 {
+		maxPending = DEFAULT_MAX_PENDING_UPLOADS
+	}
+	return &metricsUploader{
+		pdcpclient: client.NewAgentClient(restclient, nodeName, authMode, authToken),
+		nodeName:   nodeName,
+		version:    version,
+		sessionId:  strconv.FormatInt(time.Now().UnixNano(), 36),
+		maxPending: maxPending,
+	}, nil
+}
+
+// Enqueue 为本周期采集到的指标分配序号
+func (u *metricsUploader) Enqueue(forwardMetrics []inpplat.ForwardMetrics, collectedAt time.Time) {
+	tasks := make([]metrics.TaskRef, 0, len(forwardMetrics))
+	for _, m := range forwardMetrics {
+		if ref, err := vcache.DefaultTaskIndex().Get(m.TaskId); err == nil {
+			tasks = append(tasks, metrics.TaskRef{TaskId: m.TaskId, Namespace: ref.Namespace, VmiName: ref.Name})
+		}
+	}
+
+	u.sequence++
+	u.pending = append(u.pending, metrics.Envelope{
+		NodeName:    u.nodeName,
+		Version:     u.version,
+		SessionId:   u.sessionId,
+		Sequence:    u.sequence,
+		CollectedAt: collectedAt,
+		Tasks:       tasks,
+		Metrics:     forwardMetrics,
+	})
+	if overflow := len(u.pending) - u.maxPending; overflow > 0 {
+		slog.Warn("Too many unacked metrics uploads, drop the oldest",
+			"dropped", overflow, "fromSequence", u.pending[0].Sequence, "toSequence", u.pending[overflow-1].Sequence)
+		u.pending = u.pending[overflow:]
+	}
+}
+
+// Flush 上报所有未确认的Envelope, 并根据pdcpserver的确认序号清理已确认部分
+func (u *metricsUploader) Flush() error {
+	if len(u.pending) == 0 {
+		return nil
+	}
+
+	ack, err := u.pdcpclient.UploadMetrics(metrics.Upload{Envelopes: u.pending})
+	if err != nil {
+		return err
+	}
+	if ack.SessionId != u.sessionId {
+		return fmt.Errorf("metrics ack session mismatch, expect %s, got %s", u.sessionId, ack.SessionId)
+	}
+	if len(ack.Duplicates) > 0 || len(ack.Gaps) > 0 {
+		slog.Warn("pdcpserver reported irregular metrics sequences", "duplicates", ack.Duplicates, "gaps", ack.Gaps)
+	}
+
+	acked := 0
+	for acked < len(u.pending) && u.pending[acked].Sequence <= ack.AckedSequence {
+		acked++
+	}
+	u.pending = u.pending[acked:]
+	if len(u.pending) > 0 {
+		return fmt.Errorf("metrics upload partially acked, acked sequence %d, latest sequence %d", ack.AckedSequence, u.sequence)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package module
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"pdcplet/pkg/internal/inpplat"
+	"pdcplet/pkg/metrics"
+	vcache "pdcplet/pkg/pdcplet/cache"
+	"slices"
+	"testing"
+	"time"
+
+	"resty.dev/v3"
+)
+
+// metricsServer 模拟pdcpserver的指标上报接口, 校验签名后按ackUpTo确认
+type metricsServer struct {
+	t         *testing.T
+	ackUpTo   func(upload metrics.Upload) uint64
+	session   string // 非空时替换返回的SessionId
+	status    int    // 非0时直接返回该状态码
+	uploads   []metrics.Upload
+	authorize string
+}
+
+func (s *metricsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.authorize = r.Header.Get("Authorization")
+	if s.authorize == "" {
+		err := metrics.VerifyRequest("secret", r.Method, r.URL.Path, r.URL.Query(), r.Header.Get(metrics.HEADER_TIMESTAMP),
+			body, r.Header.Get(metrics.HEADER_SIGNATURE), time.Now())
+		if err != nil {
+			s.t.Errorf("verify request: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	if r.URL.Path != metrics.UPLOAD_METRICS_ROUTE || r.Header.Get("Content-Encoding") != metrics.CONTENT_ENCODING {
+		s.t.Errorf("unexpected request %s, content encoding %q", r.URL.Path, r.Header.Get("Content-Encoding"))
+	}
+	upload, err := metrics.Decode(body, true, 0)
+	if err != nil {
+		s.t.Errorf("decode upload: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.uploads = append(s.uploads, upload)
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	ack := metrics.Ack{NodeName: upload.Envelopes[0].NodeName, SessionId: upload.Envelopes[0].SessionId, AckedSequence: s.ackUpTo(upload)}
+	if s.session != "" {
+		ack.SessionId = s.session
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ack)
+}
+
+// ackAll 确认请求中的全部Envelope
+func ackAll(upload metrics.Upload) uint64 {
+	return upload.Envelopes[len(upload.Envelopes)-1].Sequence
+}
+
+func sequences(envelopes []metrics.Envelope) []uint64 {
+	seqs := make([]uint64, 0, len(envelopes))
+	for _, e := range envelopes {
+		seqs = append(seqs, e.Sequence)
+	}
+	return seqs
+}
+
+func newTestMetricsUploader(t *testing.T, srv *httptest.Server, authMode string, maxPending int) *metricsUploader {
+	t.Helper()
+	u, err := newMetricsUploader(resty.New().SetBaseURL(srv.URL), "node1", "v1", authMode, "secret", maxPending)
+	if err != nil {
+		t.Fatalf("new uploader: %v", err)
+	}
+	return u
+}
+
+func TestNewMetricsUploader(t *testing.T) {
+	tests := []struct {
+		authMode   string
+		maxPending int
+		wantErr    bool
+		wantMax    int
+	}{
+		{authMode: "", wantMax: DEFAULT_MAX_PENDING_UPLOADS},
+		{authMode: metrics.AUTH_MODE_HMAC, maxPending: 5, wantMax: 5},
+		{authMode: metrics.AUTH_MODE_BEARER, maxPending: -1, wantMax: DEFAULT_MAX_PENDING_UPLOADS},
+		{authMode: "basic", wantErr: true},
+	}
+	for _, tt := range tests {
+		u, err := newMetricsUploader(resty.New(), "node1", "v1", tt.authMode, "secret", tt.maxPending)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("auth mode %q: want error", tt.authMode)
+			}
+			continue
+		}
+		if err != nil || u.maxPending != tt.wantMax || u.sessionId == "" {
+			t.Errorf("auth mode %q: err=%v maxPending=%d sessionId=%q", tt.authMode, err, u.maxPending, u.sessionId)
+		}
+	}
+}
+
+func TestMetricsUploaderEnqueue(t *testing.T) {
+	vcache.DefaultTaskIndex().Put(41, vcache.VmiRef{Namespace: "default", Name: "vm41"})
+	defer vcache.DefaultTaskIndex().Remove(41)
+	u, err := newMetricsUploader(resty.New(), "node1", "v1", "", "secret", 3)
+	if err != nil {
+		t.Fatalf("new uploader: %v", err)
+	}
+
+	collectedAt := time.Now()
+	u.Enqueue([]inpplat.ForwardMetrics{{TaskId: 41}, {TaskId: 42}}, collectedAt)
+	e := u.pending[0]
+	if e.NodeName != "node1" || e.Version != "v1" || e.SessionId != u.sessionId || e.Sequence != 1 ||
+		!e.CollectedAt.Equal(collectedAt) || len(e.Metrics) != 2 {
+		t.Fatalf("unexpected envelope: %+v", e)
+	}
+	// 不在TaskIndex中的任务没有TaskRef
+	if len(e.Tasks) != 1 || e.Tasks[0] != (metrics.TaskRef{TaskId: 41, Namespace: "default", VmiName: "vm41"}) {
+		t.Fatalf("tasks = %+v", e.Tasks)
+	}
+
+	// 超过maxPending时丢弃最早的Envelope, 序号继续递增
+	for i := 0; i < 4; i++ {
+		u.Enqueue(nil, collectedAt)
+	}
+	if got := sequences(u.pending); !slices.Equal(got, []uint64{3, 4, 5}) {
+		t.Fatalf("pending sequences = %v, want [3 4 5]", got)
+	}
+}
+
+func TestMetricsUploaderFlush(t *testing.T) {
+	tests := []struct {
+		name        string
+		authMode    string
+		ackUpTo     func(upload metrics.Upload) uint64
+		session     string
+		status      int
+		wantErr     bool
+		wantPending []uint64
+	}{
+		{name: "all acked", ackUpTo: ackAll, wantPending: []uint64{}},
+		{name: "bearer", authMode: metrics.AUTH_MODE_BEARER, ackUpTo: ackAll, wantPending: []uint64{}},
+		{name: "partially acked", ackUpTo: func(metrics.Upload) uint64 { return 2 }, wantErr: true, wantPending: []uint64{3}},
+		{name: "nothing acked", ackUpTo: func(metrics.Upload) uint64 { return 0 }, wantErr: true, wantPending: []uint64{1, 2, 3}},
+		{name: "session mismatch", ackUpTo: ackAll, session: "other", wantErr: true, wantPending: []uint64{1, 2, 3}},
+		{name: "server error", status: http.StatusInternalServerError, wantErr: true, wantPending: []uint64{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &metricsServer{t: t, ackUpTo: tt.ackUpTo, session: tt.session, status: tt.status}
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+			u := newTestMetricsUploader(t, srv, tt.authMode, 0)
+
+			for i := 0; i < 3; i++ {
+				u.Enqueue([]inpplat.ForwardMetrics{{TaskId: i}}, time.Now())
+			}
+			err := u.Flush()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("flush error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := sequences(u.pending); !slices.Equal(got, tt.wantPending) {
+				t.Fatalf("pending sequences = %v, want %v", got, tt.wantPending)
+			}
+			if len(handler.uploads) != 1 || !slices.Equal(sequences(handler.uploads[0].Envelopes), []uint64{1, 2, 3}) {
+				t.Fatalf("uploads = %+v", handler.uploads)
+			}
+			if tt.authMode == metrics.AUTH_MODE_BEARER && handler.authorize != metrics.BEARER_PREFIX+"secret" {
+				t.Fatalf("authorization = %q", handler.authorize)
+			}
+		})
+	}
+}
+
+func TestMetricsUploaderResend(t *testing.T) {
+	acked := uint64(1)
+	handler := &metricsServer{t: t, ackUpTo: func(metrics.Upload) uint64 { return acked }}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	u := newTestMetricsUploader(t, srv, "", 0)
+
+	u.Enqueue(nil, time.Now())
+	u.Enqueue(nil, time.Now())
+	if err := u.Flush(); err == nil {
+		t.Fatalf("flush should report partial ack")
+	}
+	// 未确认的Envelope与新的Envelope一起重发
+	acked = 3
+	u.Enqueue(nil, time.Now())
+	if err := u.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if len(handler.uploads) != 2 || !slices.Equal(sequences(handler.uploads[1].Envelopes), []uint64{2, 3}) {
+		t.Fatalf("uploads = %+v", handler.uploads)
+	}
+	// 没有待上报的Envelope时不发送请求
+	if err := u.Flush(); err != nil || len(handler.uploads) != 2 {
+		t.Fatalf("empty flush: err=%v uploads=%d", err, len(handler.uploads))
+	}
+}
@@ -11,6 +11,8 @@ func init() {
 	// Example: RegisterConstructor("example", NewExampleModule)
 	modulesFactory.Register("vmiproxy", NewVmiProxyModule)
 	modulesFactory.Register("vmimetrics", NewVmiMetricsModule)
+	modulesFactory.Register("noderegistration", NewNodeRegistrationModule)
+	modulesFactory.Register("rulesync", NewRuleSyncModule)
 }
 
 func CreateModule(name string, params map[string]interface{}) (Module, error) {
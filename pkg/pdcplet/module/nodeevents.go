@@ -0,0 +1,87 @@
+package module
+
+import (
+	"log/slog"
+	"pdcplet/pkg/agent"
+	"sync"
+	"time"
+)
+
+// 排队等待上报的节点事件上限, 未启用NodeRegistration或pdcpserver不可达时丢弃最早的事件
+const NODE_EVENT_QUEUE_SIZE = 1024
+
+var nodeEvents = newNodeEventQueue(NODE_EVENT_QUEUE_SIZE)
+
+// nodeEventQueue 在模块之间传递节点事件, 由NodeRegistration模块随心跳上报给pdcpserver
+type nodeEventQueue struct {
+	mu      sync.Mutex
+	size    int
+	events  []agent.NodeEvent
+	dropped int
+}
+
+func newNodeEventQueue(size int) *nodeEventQueue {
+	return &nodeEventQueue{size: size}
+}
+
+func (q *nodeEventQueue) publish(event agent.NodeEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.events = append(q.events, event)
+	q.trimLocked()
+}
+
+// drain 取出所有排队的事件
+func (q *nodeEventQueue) drain() []agent.NodeEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	events := q.events
+	q.events = nil
+	if q.dropped > 0 {
+		slog.Warn("Node events dropped because the queue is full", "dropped", q.dropped, "queueSize", q.size)
+		q.dropped = 0
+	}
+	return events
+}
+
+// requeue 上报失败时将事件放回队首, 保持发生顺序
+func (q *nodeEventQueue) requeue(events []agent.NodeEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.events = append(events, q.events...)
+	q.trimLocked()
+}
+
+func (q *nodeEventQueue) trimLocked() {
+	if over := len(q.events) - q.size; over > 0 {
+		q.events = q.events[over:]
+		q.dropped += over
+	}
+}
+
+// nodeEventAlertNotifier 将告警作为节点事件上报给pdcpserver
+type nodeEventAlertNotifier struct{}
+
+func (n *nodeEventAlertNotifier) Notify(alert Alert) error {
+	nodeEvents.publish(agent.NodeEvent{
+		Type:      agent.EventAlert,
+		Namespace: alert.Namespace,
+		VmiName:   alert.VmiName,
+		TaskId:    alert.TaskId,
+		Alert: &agent.AlertInfo{
+			Rule:      alert.Rule,
+			Metric:    alert.Metric,
+			State:     string(alert.State),
+			Value:     alert.Value,
+			Threshold: alert.Threshold,
+			Vid:       alert.Vid,
+			Mac:       alert.Mac,
+			StartsAt:  alert.StartsAt,
+			EndsAt:    alert.EndsAt,
+		},
+	})
+	return nil
+}
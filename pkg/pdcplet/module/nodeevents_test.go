@@ -0,0 +1,88 @@
+package module
+
+import (
+	"pdcplet/pkg/agent"
+	"slices"
+	"testing"
+	"time"
+)
+
+// taskIds 返回事件的TaskId, 用于比较顺序
+func taskIds(events []agent.NodeEvent) []int {
+	ids := make([]int, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.TaskId)
+	}
+	return ids
+}
+
+func TestNodeEventQueue(t *testing.T) {
+	tests := []struct {
+		name    string
+		publish []int // 依次发布的TaskId
+		requeue []int // drain之后放回队首的TaskId
+		later   []int // 放回之后发布的TaskId
+		want    []int
+		dropped int
+	}{
+		{name: "in order", publish: []int{1, 2, 3}, want: []int{1, 2, 3}},
+		{name: "drop oldest when full", publish: []int{1, 2, 3, 4, 5}, want: []int{3, 4, 5}, dropped: 2},
+		{name: "requeue before new events", requeue: []int{1, 2}, later: []int{3}, want: []int{1, 2, 3}},
+		{name: "requeue drops oldest", requeue: []int{1, 2}, later: []int{3, 4}, want: []int{2, 3, 4}, dropped: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newNodeEventQueue(3)
+			for _, id := range tt.publish {
+				q.publish(agent.NodeEvent{Type: agent.EventTaskCreated, TaskId: id})
+			}
+			if tt.requeue != nil {
+				var events []agent.NodeEvent
+				for _, id := range tt.requeue {
+					events = append(events, agent.NodeEvent{Type: agent.EventTaskCreated, TaskId: id, Time: time.Now()})
+				}
+				q.requeue(events)
+			}
+			for _, id := range tt.later {
+				q.publish(agent.NodeEvent{Type: agent.EventTaskCreated, TaskId: id})
+			}
+
+			if q.dropped != tt.dropped {
+				t.Errorf("dropped = %d, want %d", q.dropped, tt.dropped)
+			}
+			events := q.drain()
+			if got := taskIds(events); !slices.Equal(got, tt.want) {
+				t.Fatalf("drained %v, want %v", got, tt.want)
+			}
+			for _, event := range events {
+				if event.Time.IsZero() {
+					t.Errorf("event %d has no time", event.TaskId)
+				}
+			}
+			if q.dropped != 0 || len(q.drain()) != 0 {
+				t.Fatalf("queue not empty after drain")
+			}
+		})
+	}
+}
+
+func TestNodeEventAlertNotifier(t *testing.T) {
+	nodeEvents.drain()
+	startsAt := time.Now()
+	alert := Alert{Rule: "high-rx", Metric: "rx_bps", State: AlertStateFiring, TaskId: 7, Namespace: "default",
+		VmiName: "vm1", Value: 200, Threshold: 100, StartsAt: startsAt}
+	if err := (&nodeEventAlertNotifier{}).Notify(alert); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+
+	events := nodeEvents.drain()
+	if len(events) != 1 {
+		t.Fatalf("queued %d events, want 1", len(events))
+	}
+	event := events[0]
+	if event.Type != agent.EventAlert || event.TaskId != 7 || event.Namespace != "default" || event.VmiName != "vm1" ||
+		event.Alert == nil || event.Alert.Rule != "high-rx" || event.Alert.State != string(AlertStateFiring) ||
+		event.Alert.Value != 200 || !event.Alert.StartsAt.Equal(startsAt) {
+		t.Fatalf("unexpected event: %+v, alert %+v", event, event.Alert)
+	}
+}
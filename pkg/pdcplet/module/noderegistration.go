@@ -0,0 +1,218 @@
+package module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"pdcplet/pkg/agent"
+	"pdcplet/pkg/config"
+	"pdcplet/pkg/internal/inpplat"
+	"pdcplet/pkg/metrics"
+	"pdcplet/pkg/pdcpserver/client"
+	"strconv"
+	"sync"
+	"time"
+
+	"resty.dev/v3"
+)
+
+const NODE_REGISTRATION_NAME = "NodeRegistration"
+
+const DEFAULT_HEARTBEAT_INTERVAL = 15 * time.Second
+
+var errNodeNotRegistered = errors.New("node is not registered in pdcpserver")
+
+// nodeRegistrationModule 启动时向pdcpserver注册节点, 之后周期性发送心跳.
+// pdcpserver重启丢失注册信息或心跳被拒绝时自动重新注册
+type nodeRegistrationModule struct {
+	name         string
+	pdcpclient   *client.AgentClient
+	inpplatproxy inpplat.Client
+	interval     time.Duration
+	registration agent.Registration
+	registered   bool
+}
+
+func NewNodeRegistrationModule(params map[string]interface{}) (Module, error) {
+	if len(params) == 0 {
+		slog.Error("nodeRegistrationModule params is nil or empty")
+		return nil, fmt.Errorf("nodeRegistrationModule params is nil or empty")
+	}
+
+	nrm := &nodeRegistrationModule{
+		name:     NODE_REGISTRATION_NAME,
+		interval: DEFAULT_HEARTBEAT_INTERVAL,
+	}
+	var restclient *resty.Client
+	var authToken string
+	conns, _ := params["connections"].([]map[string]interface{})
+	for _, conn := range conns {
+		switch conn["name"] {
+		case config.INPPLAT_CONNECTION_NAME:
+			proxy, err := NewInpProxy(conn)
+			if err != nil {
+				slog.Error("NewInpProxy failed", "errMsg", err)
+				return nil, fmt.Errorf("NewInpProxy failed: %w", err)
+			}
+			nrm.inpplatproxy = proxy
+		case config.PDCPSERVER_CONNECTION_NAME:
+			var err error
+			restclient, authToken, err = newPdcpServerRestClient(conn)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if restclient == nil {
+		slog.Error("nodeRegistrationModule requires pdcpserver connection")
+		return nil, fmt.Errorf("nodeRegistrationModule requires %s connection", config.PDCPSERVER_CONNECTION_NAME)
+	}
+
+	authMode, _ := params["authMode"].(string)
+	switch authMode {
+	case "":
+		authMode = metrics.AUTH_MODE_HMAC
+	case metrics.AUTH_MODE_HMAC, metrics.AUTH_MODE_BEARER:
+	default:
+		return nil, fmt.Errorf("nodeRegistrationModule auth mode %s is not supported", authMode)
+	}
+	if interval, ok := params["heartbeatInterval"].(string); ok {
+		nrm.interval = convertToTimeDuration(interval, DEFAULT_HEARTBEAT_INTERVAL)
+	}
+
+	nodeName, err := getNodeName()
+	if err != nil {
+		return nil, err
+	}
+	nrm.pdcpclient = client.NewAgentClient(restclient, nodeName, authMode, authToken)
+	version, _ := params["version"].(string)
+	modules, _ := params["enabledModules"].([]string)
+	nrm.registration = agent.Registration{
+		NodeName:  nodeName,
+		Version:   version,
+		SessionId: strconv.FormatInt(time.Now().UnixNano(), 36),
+		Modules:   modules,
+	}
+	return nrm, nil
+}
+
+func (n *nodeRegistrationModule) Name() string {
+	return n.name
+}
+
+func (n *nodeRegistrationModule) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := n.doJob(); err != nil {
+			slog.Error("nodeRegistrationModule failed to report to pdcpserver", "errMsg", err, "registered", n.registered)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// doJob 未注册时注册, 否则发送心跳; 心跳返回未注册时立即重新注册. 注册或心跳成功后上报排队的节点事件
+func (n *nodeRegistrationModule) doJob() error {
+	status := n.probeInpplat()
+	if n.registered {
+		ack, err := n.pdcpclient.Heartbeat(agent.Heartbeat{
+			NodeName:      n.registration.NodeName,
+			SessionId:     n.registration.SessionId,
+			InpplatStatus: status,
+		})
+		if err = n.checkAck(agent.HEARTBEAT_ROUTE, ack, err); err == nil {
+			return n.flushEvents()
+		}
+		if !errors.Is(err, errNodeNotRegistered) {
+			return err
+		}
+		slog.Warn("pdcpserver rejected heartbeat, register again", "nodeName", n.registration.NodeName)
+		n.registered = false
+	}
+
+	reg := n.registration
+	reg.InpplatStatus = status
+	ack, err := n.pdcpclient.Register(reg)
+	if err := n.checkAck(agent.REGISTER_ROUTE, ack, err); err != nil {
+		return err
+	}
+	n.registered = true
+	slog.Info("Node registered to pdcpserver", "nodeName", reg.NodeName, "sessionId", reg.SessionId, "modules", reg.Modules)
+	return n.flushEvents()
+}
+
+// flushEvents 上报排队的节点事件, 失败时放回队列在下一次心跳时重试
+func (n *nodeRegistrationModule) flushEvents() error {
+	events := nodeEvents.drain()
+	if len(events) == 0 {
+		return nil
+	}
+	ack, err := n.pdcpclient.ReportEvents(agent.NodeEvents{
+		NodeName:  n.registration.NodeName,
+		SessionId: n.registration.SessionId,
+		Events:    events,
+	})
+	if err = n.checkAck(agent.EVENTS_ROUTE, ack, err); err != nil {
+		nodeEvents.requeue(events)
+		if errors.Is(err, errNodeNotRegistered) {
+			n.registered = false
+		}
+		return fmt.Errorf("report %d node events failed: %w", len(events), err)
+	}
+	return nil
+}
+
+// probeInpplat 通过查询转发指标检查inpplat是否可达, 未配置inpplat连接时视为不可达
+func (n *nodeRegistrationModule) probeInpplat() agent.InpplatStatus {
+	if n.inpplatproxy == nil {
+		return agent.InpplatStatus{InpplatError: "inpplat connection is not configured"}
+	}
+	if _, err := n.inpplatproxy.GetAllForwardMetricsGroupByTask(); err != nil {
+		return agent.InpplatStatus{InpplatError: err.Error()}
+	}
+	return agent.InpplatStatus{InpplatReachable: true}
+}
+
+// checkAck 检查pdcpserver的确认, 404表示pdcpserver中没有本节点的当前会话
+func (n *nodeRegistrationModule) checkAck(route string, ack *agent.Ack, err error) error {
+	if client.IsNotFound(err) {
+		return errNodeNotRegistered
+	}
+	if err != nil {
+		return err
+	}
+	if ack.SessionId != n.registration.SessionId {
+		return fmt.Errorf("%s ack session mismatch, expect %s, got %s", route, n.registration.SessionId, ack.SessionId)
+	}
+	return nil
+}
+
+// newPdcpServerRestClient 根据pdcpserver连接配置创建REST客户端, 同时返回连接的authToken
+func newPdcpServerRestClient(conn map[string]interface{}) (*resty.Client, string, error) {
+	restConfig, ok := conn["httpOverTcpIp"].(map[string]interface{})
+	if !ok {
+		slog.Error("PDCPSERVER_CONNECTION_NAME config is invalid")
+		return nil, "", fmt.Errorf("PDCPSERVER_CONNECTION_NAME config is invalid")
+	}
+	scheme := "http"
+	if enabled, _ := restConfig["tls"].(bool); enabled {
+		scheme = "https"
+	}
+	restclient := resty.New().
+		SetBaseURL(fmt.Sprintf("%s://%s:%d%s", scheme, restConfig["host"], restConfig["port"], restConfig["urlPrefix"])).
+		SetTimeout(HTTP_TIMEOUT).
+		SetHeaders(map[string]string{"Content-Type": "application/json"})
+	if caFile, _ := restConfig["caFile"].(string); caFile != "" {
+		restclient.SetRootCertificates(caFile)
+	}
+	authToken, _ := restConfig["authToken"].(string)
+	return restclient, authToken, nil
+}
@@ -0,0 +1,62 @@
+package module
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pdcplet/pkg/agent"
+	"pdcplet/pkg/metrics"
+	"pdcplet/pkg/pdcpserver/client"
+	"testing"
+
+	"resty.dev/v3"
+)
+
+func TestNodeRegistrationReregister(t *testing.T) {
+	var registers, heartbeats int
+	session := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload agent.Heartbeat
+		json.NewDecoder(r.Body).Decode(&payload)
+		if r.Header.Get(metrics.HEADER_SIGNATURE) == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case agent.REGISTER_ROUTE:
+			registers++
+			session = payload.SessionId
+		case agent.HEARTBEAT_ROUTE:
+			heartbeats++
+			if payload.SessionId != session {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(agent.Ack{NodeName: payload.NodeName, SessionId: payload.SessionId})
+	}))
+	defer srv.Close()
+
+	n := &nodeRegistrationModule{
+		pdcpclient:   client.NewAgentClient(resty.New().SetBaseURL(srv.URL), "node1", metrics.AUTH_MODE_HMAC, "secret"),
+		registration: agent.Registration{NodeName: "node1", SessionId: "s1"},
+	}
+	for i := 0; i < 2; i++ {
+		if err := n.doJob(); err != nil {
+			t.Fatalf("doJob: %v", err)
+		}
+	}
+	if registers != 1 || heartbeats != 1 {
+		t.Fatalf("registers=%d heartbeats=%d, want 1 and 1", registers, heartbeats)
+	}
+
+	// pdcpserver丢失注册信息
+	session = ""
+	if err := n.doJob(); err != nil {
+		t.Fatalf("doJob: %v", err)
+	}
+	if registers != 2 || !n.registered {
+		t.Fatalf("registers=%d registered=%v, want re-registered", registers, n.registered)
+	}
+}
@@ -0,0 +1,263 @@
+package module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"pdcplet/pkg/agent"
+	"pdcplet/pkg/config"
+	"pdcplet/pkg/internal/inpplat"
+	"pdcplet/pkg/metrics"
+	vcache "pdcplet/pkg/pdcplet/cache"
+	"pdcplet/pkg/pdcpserver/client"
+	"sync"
+	"time"
+
+	"resty.dev/v3"
+)
+
+const RULE_SYNC_NAME = "RuleSync"
+
+const DEFAULT_RULE_SYNC_INTERVAL = 10 * time.Second
+
+// ruleKey inpplat任务上规则的唯一标识
+type ruleKey struct {
+	taskId int
+	name   string
+}
+
+// ruleSyncModule 周期性地从pdcpserver拉取本节点的规则集, 与已下发到inpplat的规则比较后增量绑定/解绑,
+// 并上报下发结果. 任务尚未创建的VM在任务创建后的下一个周期下发.
+// 启动时从inpplat重建任务索引和已绑定的规则, 避免重启后重复绑定或遗留已删除的规则
+type ruleSyncModule struct {
+	name         string
+	pdcpclient   *client.AgentClient
+	inpplatproxy inpplat.Client
+	tasks        vcache.TaskIndex
+	nodeName     string
+	interval     time.Duration
+
+	loaded         bool                     // 是否已从inpplat重建任务索引和已绑定的规则
+	ruleSet        *agent.RuleSet           // 最近一次拉取的规则集
+	applied        map[ruleKey]inpplat.Rule // 已绑定到inpplat的规则
+	appliedVersion string                   // 最近一次完整下发成功的版本
+	reported       *agent.RuleSetStatus     // 最近一次成功上报的结果
+}
+
+func NewRuleSyncModule(params map[string]interface{}) (Module, error) {
+	if len(params) == 0 {
+		slog.Error("ruleSyncModule params is nil or empty")
+		return nil, fmt.Errorf("ruleSyncModule params is nil or empty")
+	}
+
+	rsm := &ruleSyncModule{
+		name:     RULE_SYNC_NAME,
+		tasks:    vcache.DefaultTaskIndex(),
+		interval: DEFAULT_RULE_SYNC_INTERVAL,
+		applied:  make(map[ruleKey]inpplat.Rule),
+	}
+	var restclient *resty.Client
+	var authToken string
+	conns, _ := params["connections"].([]map[string]interface{})
+	for _, conn := range conns {
+		switch conn["name"] {
+		case config.INPPLAT_CONNECTION_NAME:
+			proxy, err := NewInpProxy(conn)
+			if err != nil {
+				slog.Error("NewInpProxy failed", "errMsg", err)
+				return nil, fmt.Errorf("NewInpProxy failed: %w", err)
+			}
+			rsm.inpplatproxy = proxy
+		case config.PDCPSERVER_CONNECTION_NAME:
+			var err error
+			restclient, authToken, err = newPdcpServerRestClient(conn)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if restclient == nil || rsm.inpplatproxy == nil {
+		slog.Error("ruleSyncModule requires inpplat and pdcpserver connections")
+		return nil, fmt.Errorf("ruleSyncModule requires %s and %s connections",
+			config.INPPLAT_CONNECTION_NAME, config.PDCPSERVER_CONNECTION_NAME)
+	}
+
+	authMode, _ := params["authMode"].(string)
+	switch authMode {
+	case "":
+		authMode = metrics.AUTH_MODE_HMAC
+	case metrics.AUTH_MODE_HMAC, metrics.AUTH_MODE_BEARER:
+	default:
+		return nil, fmt.Errorf("ruleSyncModule auth mode %s is not supported", authMode)
+	}
+	if interval, ok := params["syncInterval"].(string); ok {
+		rsm.interval = convertToTimeDuration(interval, DEFAULT_RULE_SYNC_INTERVAL)
+	}
+
+	nodeName, err := getNodeName()
+	if err != nil {
+		return nil, err
+	}
+	rsm.nodeName = nodeName
+	rsm.pdcpclient = client.NewAgentClient(restclient, nodeName, authMode, authToken)
+	return rsm, nil
+}
+
+func (r *ruleSyncModule) Name() string {
+	return r.name
+}
+
+func (r *ruleSyncModule) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.doJob(); err != nil {
+			slog.Error("ruleSyncModule failed to sync rules", "errMsg", err, "appliedVersion", r.appliedVersion)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// doJob 拉取规则集并下发, 下发结果变化时上报pdcpserver
+func (r *ruleSyncModule) doJob() error {
+	if !r.loaded {
+		if err := r.load(); err != nil {
+			return err
+		}
+		r.loaded = true
+	}
+	if err := r.fetch(); err != nil {
+		return err
+	}
+
+	status := agent.RuleSetStatus{NodeName: r.nodeName}
+	applyErr := r.apply()
+	if applyErr == nil {
+		r.appliedVersion = r.ruleSet.Version
+	} else {
+		status.Error = applyErr.Error()
+	}
+	status.AppliedVersion = r.appliedVersion
+
+	if r.reported == nil || *r.reported != status {
+		if err := r.report(status); err != nil {
+			return errors.Join(applyErr, err)
+		}
+		r.reported = &status
+	}
+	return applyErr
+}
+
+// load 从inpplat加载重启前创建的任务和已绑定的规则, 失败时在下一个周期重试
+func (r *ruleSyncModule) load() error {
+	if err := vcache.LoadTaskIndex(r.tasks, r.inpplatproxy); err != nil {
+		return err
+	}
+	rules, err := r.inpplatproxy.ListRules()
+	if err != nil {
+		return fmt.Errorf("list inpplat rules failed: %w", err)
+	}
+	for _, rule := range rules {
+		r.applied[ruleKey{rule.TaskId, rule.Name}] = rule
+	}
+	slog.Info("Applied rules loaded from inpplat", "nodeName", r.nodeName, "rules", len(rules))
+	return nil
+}
+
+// fetch 拉取规则集, 版本未变化时pdcpserver返回304, 沿用上一次的规则集
+func (r *ruleSyncModule) fetch() error {
+	version := ""
+	if r.ruleSet != nil {
+		version = r.ruleSet.Version
+	}
+
+	set, err := r.pdcpclient.GetRuleSet(version)
+	if err != nil {
+		return err
+	}
+	if set != nil {
+		if set.Version != version {
+			slog.Info("Rule set changed", "nodeName", r.nodeName, "version", set.Version, "bindings", len(set.Bindings))
+		}
+		r.ruleSet = set
+	}
+	return nil
+}
+
+// desiredRules 将规则集转换为inpplat规则, 跳过尚未创建inpplat任务的VM
+func (r *ruleSyncModule) desiredRules() map[ruleKey]inpplat.Rule {
+	desired := make(map[ruleKey]inpplat.Rule)
+	for _, binding := range r.ruleSet.Bindings {
+		taskId, ok := r.tasks.Find(binding.Namespace, binding.VmName)
+		if !ok {
+			continue
+		}
+		for _, spec := range binding.Rules {
+			desired[ruleKey{taskId, spec.Name}] = inpplat.Rule{
+				TaskId:   taskId,
+				Name:     spec.Name,
+				Protocol: spec.Protocol,
+				Filter:   spec.Filter,
+				Priority: spec.Priority,
+				Version:  spec.Version,
+			}
+		}
+	}
+	return desired
+}
+
+// apply 先解绑已删除或已变化的规则, 再绑定新增或已变化的规则
+func (r *ruleSyncModule) apply() error {
+	// 任务关闭时inpplat已删除其上的规则
+	for key := range r.applied {
+		if _, err := r.tasks.Get(key.taskId); err != nil {
+			delete(r.applied, key)
+		}
+	}
+
+	desired := r.desiredRules()
+	var unbind, bind []inpplat.Rule
+	for key, rule := range r.applied {
+		if want, ok := desired[key]; !ok || want != rule {
+			unbind = append(unbind, rule)
+		}
+	}
+	for key, rule := range desired {
+		if have, ok := r.applied[key]; !ok || have != rule {
+			bind = append(bind, rule)
+		}
+	}
+
+	if len(unbind) > 0 {
+		if err := r.inpplatproxy.UnbindRules(unbind); err != nil {
+			return fmt.Errorf("unbind %d rules failed: %w", len(unbind), err)
+		}
+		for _, rule := range unbind {
+			delete(r.applied, ruleKey{rule.TaskId, rule.Name})
+		}
+	}
+	if len(bind) > 0 {
+		if err := r.inpplatproxy.BindRules(bind); err != nil {
+			return fmt.Errorf("bind %d rules failed: %w", len(bind), err)
+		}
+		for _, rule := range bind {
+			r.applied[ruleKey{rule.TaskId, rule.Name}] = rule
+		}
+	}
+	if len(unbind) > 0 || len(bind) > 0 {
+		slog.Info("Rules applied to inpplat", "version", r.ruleSet.Version, "bound", len(bind), "unbound", len(unbind))
+	}
+	return nil
+}
+
+func (r *ruleSyncModule) report(status agent.RuleSetStatus) error {
+	return r.pdcpclient.ReportRuleStatus(status)
+}
@@ -0,0 +1,173 @@
+package module
+
+import (
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"pdcplet/pkg/agent"
+	"pdcplet/pkg/internal/inpplat"
+	"pdcplet/pkg/metrics"
+	vcache "pdcplet/pkg/pdcplet/cache"
+	"pdcplet/pkg/pdcpserver/auth"
+	"pdcplet/pkg/pdcpserver/client"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/router"
+	"pdcplet/pkg/pdcpserver/service"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"resty.dev/v3"
+)
+
+// newRuleSyncServer 启动注册了pdcplet路由的pdcpserver, 使用HMAC签名认证, 并注册node1
+func newRuleSyncServer(t *testing.T) (*httptest.Server, service.NodeService, service.RuleService) {
+	t.Helper()
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	gin.SetMode(gin.TestMode)
+	cfg := config.MetricsConfig{AuthMode: metrics.AUTH_MODE_HMAC, AuthToken: "secret"}
+	nodes := service.NewNodeService(config.NodesConfig{})
+	rules := service.NewRuleService()
+	r := gin.New()
+	mw, err := auth.NewMiddleware(config.AuthConfig{}, cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("auth middleware: %v", err)
+	}
+	r.Use(mw)
+	router.RegisterNodeRoutes(r, nodes, rules)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	if _, err := nodes.Register(agent.Registration{NodeName: "node1", SessionId: "s1"}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	return srv, nodes, rules
+}
+
+func newTestRuleSyncModule(srv *httptest.Server, fake *inpplat.FakeClient, tasks vcache.TaskIndex) *ruleSyncModule {
+	return &ruleSyncModule{
+		pdcpclient:   client.NewAgentClient(resty.New().SetBaseURL(srv.URL+"/pdcplet"), "node1", metrics.AUTH_MODE_HMAC, "secret"),
+		inpplatproxy: fake,
+		tasks:        tasks,
+		nodeName:     "node1",
+		applied:      make(map[ruleKey]inpplat.Rule),
+	}
+}
+
+// TestRuleSyncEndToEnd pdcpserver中的规则经由ruleSyncModule下发到fake inpplat
+func TestRuleSyncEndToEnd(t *testing.T) {
+	srv, nodes, rules := newRuleSyncServer(t)
+	vm := model.VirtualMachineRecord{Name: "vm1", Namespace: "default", CPU: 1, Memory: "1Gi", Status: model.Created, NodeName: "node1"}
+	if err := database.DB.Create(&vm).Error; err != nil {
+		t.Fatalf("create vm: %v", err)
+	}
+	if _, err := rules.CreateRule(model.RuleRequest{Name: "http", Protocol: "http", VMs: []string{"default/vm1"}}); err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+
+	fake := inpplat.NewFakeClient()
+	tasks := vcache.NewTaskIndex()
+	rsm := newTestRuleSyncModule(srv, fake, tasks)
+	appliedVersion := func() string {
+		resp, _ := nodes.ListNodes(model.NodeListRequest{})
+		return resp.Items[0].AppliedRuleVersion
+	}
+
+	// VM尚未创建inpplat任务
+	if err := rsm.doJob(); err != nil {
+		t.Fatalf("doJob: %v", err)
+	}
+	tasks.Put(7, vcache.VmiRef{Namespace: "default", Name: "vm1"})
+	if err := rsm.doJob(); err != nil {
+		t.Fatalf("doJob: %v", err)
+	}
+	bound := fake.BoundRules(7)
+	if len(bound) != 1 || bound[0].Name != "http" || bound[0].Version != 1 {
+		t.Fatalf("unexpected bound rules: %+v", bound)
+	}
+	if appliedVersion() != rsm.ruleSet.Version {
+		t.Fatalf("applied version = %q, want %q", appliedVersion(), rsm.ruleSet.Version)
+	}
+
+	// 规则更新后重新绑定, 新增的规则绑定, 删除的规则解绑
+	if _, err := rules.UpdateRule("http", model.RuleRequest{Protocol: "http", Filter: "tcp port 80", VMs: []string{"default/vm1"}}); err != nil {
+		t.Fatalf("update rule: %v", err)
+	}
+	if _, err := rules.CreateRule(model.RuleRequest{Name: "dns", Protocol: "dns", VMs: []string{"default/vm1"}}); err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+	if err := rsm.doJob(); err != nil {
+		t.Fatalf("doJob: %v", err)
+	}
+	bound = fake.BoundRules(7)
+	if len(bound) != 2 || bound[0].Name != "dns" || bound[1].Filter != "tcp port 80" || bound[1].Version != 2 {
+		t.Fatalf("unexpected bound rules after update: %+v", bound)
+	}
+
+	if err := rules.DeleteRule("dns"); err != nil {
+		t.Fatalf("delete rule: %v", err)
+	}
+	if err := rsm.doJob(); err != nil {
+		t.Fatalf("doJob: %v", err)
+	}
+	if bound = fake.BoundRules(7); len(bound) != 1 || bound[0].Name != "http" {
+		t.Fatalf("unexpected bound rules after delete: %+v", bound)
+	}
+	synced := appliedVersion()
+
+	// 下发失败时上报错误, 已下发的版本不变
+	fake.BindErr = errors.New("inpplat unavailable")
+	if _, err := rules.CreateRule(model.RuleRequest{Name: "tls", Protocol: "tls", VMs: []string{"default/vm1"}}); err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+	if err := rsm.doJob(); err == nil {
+		t.Fatalf("doJob: want bind error")
+	}
+	resp, _ := nodes.ListNodes(model.NodeListRequest{})
+	if resp.Items[0].AppliedRuleVersion != synced || resp.Items[0].RuleSyncError == "" {
+		t.Fatalf("unexpected node rule status: %+v", resp.Items[0])
+	}
+}
+
+// TestRuleSyncRestart 重启后从inpplat重建任务索引和已绑定的规则, 不重复绑定未变化的规则, 并解绑重启期间删除的规则
+func TestRuleSyncRestart(t *testing.T) {
+	srv, _, rules := newRuleSyncServer(t)
+	vm := model.VirtualMachineRecord{Name: "vm1", Namespace: "default", CPU: 1, Memory: "1Gi", Status: model.Created, NodeName: "node1"}
+	if err := database.DB.Create(&vm).Error; err != nil {
+		t.Fatalf("create vm: %v", err)
+	}
+	for _, name := range []string{"http", "dns"} {
+		if _, err := rules.CreateRule(model.RuleRequest{Name: name, Protocol: name, VMs: []string{"default/vm1"}}); err != nil {
+			t.Fatalf("create rule: %v", err)
+		}
+	}
+
+	fake := inpplat.NewFakeClient()
+	taskId, _ := fake.CreateTask(map[string]string{"name": "vm1", "namespace": "default", "uid": "uid1"})
+	before := newTestRuleSyncModule(srv, fake, vcache.NewTaskIndex())
+	if err := before.doJob(); err != nil {
+		t.Fatalf("doJob: %v", err)
+	}
+	if bound := fake.BoundRules(taskId); len(bound) != 2 {
+		t.Fatalf("unexpected bound rules: %+v", bound)
+	}
+
+	// 重启期间删除dns, 重启后的模块使用空的任务索引
+	if err := rules.DeleteRule("dns"); err != nil {
+		t.Fatalf("delete rule: %v", err)
+	}
+	fake.BindErr = errors.New("http must not be bound again")
+	after := newTestRuleSyncModule(srv, fake, vcache.NewTaskIndex())
+	if err := after.doJob(); err != nil {
+		t.Fatalf("doJob after restart: %v", err)
+	}
+	if id, ok := after.tasks.Find("default", "vm1"); !ok || id != taskId {
+		t.Fatalf("task index not rebuilt: %d, %v", id, ok)
+	}
+	if bound := fake.BoundRules(taskId); len(bound) != 1 || bound[0].Name != "http" {
+		t.Fatalf("unexpected bound rules after restart: %+v", bound)
+	}
+}
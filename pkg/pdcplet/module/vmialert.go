@@ -0,0 +1,436 @@
+package module
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"pdcplet/pkg/internal/inpplat"
+	vcache "pdcplet/pkg/pdcplet/cache"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	k8sv1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"kubevirt.io/client-go/kubecli"
+	"resty.dev/v3"
+)
+
+const (
+	ALERT_METRIC_DROP_RATIO = "dropRatio" // 周期内 dropped/(sent+dropped) 的百分比
+	ALERT_METRIC_REALPPS    = "realpps"
+	ALERT_METRIC_REALBPS    = "realbps"
+)
+
+const (
+	ALERT_SCOPE_TASK = "task" // 按任务的Total统计
+	ALERT_SCOPE_NIC  = "nic"  // 按任务下每个网卡统计
+)
+
+const (
+	ALERT_EVENT_REASON_FIRING   = "TrafficAlertFiring"
+	ALERT_EVENT_REASON_RESOLVED = "TrafficAlertResolved"
+)
+
+// ALERT_NOTIFY_QUEUE_SIZE 每个异步通知方式排队等待发送的告警上限
+const ALERT_NOTIFY_QUEUE_SIZE = 256
+
+// AlertRule 告警规则, 通过VmiMetrics模块的alertRules参数配置
+type AlertRule struct {
+	Name      string  `mapstructure:"name"`
+	Metric    string  `mapstructure:"metric"`
+	Threshold float64 `mapstructure:"threshold"`
+	Cycles    int     `mapstructure:"cycles"` // 连续超过(或恢复)多少个采集周期后才触发(或解除)
+	Scope     string  `mapstructure:"scope"`
+}
+
+type AlertState string
+
+const (
+	AlertStateFiring   AlertState = "firing"
+	AlertStateResolved AlertState = "resolved"
+)
+
+// Alert 告警通知内容, 同时作为webhook的请求体
+type Alert struct {
+	Rule      string     `json:"rule"`
+	Metric    string     `json:"metric"`
+	State     AlertState `json:"state"`
+	Value     float64    `json:"value"`
+	Threshold float64    `json:"threshold"`
+	TaskId    int        `json:"task_id"`
+	Vid       int64      `json:"vid,omitempty"`
+	Mac       string     `json:"mac,omitempty"`
+	Namespace string     `json:"namespace,omitempty"`
+	VmiName   string     `json:"vmi_name,omitempty"`
+	Node      string     `json:"node,omitempty"`
+	StartsAt  time.Time  `json:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at,omitempty"`
+
+	vmiUID string
+}
+
+// ParseAlertRules 从模块参数中解析告警规则
+func ParseAlertRules(raw interface{}) ([]AlertRule, error) {
+	var rules []AlertRule
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           &rules,
+		TagName:          "mapstructure",
+		WeaklyTypedInput: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(raw); err != nil {
+		return nil, fmt.Errorf("decode alertRules failed: %w", err)
+	}
+
+	names := make(map[string]bool, len(rules))
+	for i := range rules {
+		r := &rules[i]
+		if r.Name == "" {
+			return nil, fmt.Errorf("alertRules[%d] name is empty", i)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("alertRules[%d] name %s is duplicated", i, r.Name)
+		}
+		names[r.Name] = true
+
+		switch strings.ToLower(r.Metric) {
+		case strings.ToLower(ALERT_METRIC_DROP_RATIO):
+			r.Metric = ALERT_METRIC_DROP_RATIO
+		case ALERT_METRIC_REALPPS, ALERT_METRIC_REALBPS:
+			r.Metric = strings.ToLower(r.Metric)
+		default:
+			return nil, fmt.Errorf("alertRules[%d] metric %s is not supported", i, r.Metric)
+		}
+
+		switch strings.ToLower(r.Scope) {
+		case "", ALERT_SCOPE_TASK:
+			r.Scope = ALERT_SCOPE_TASK
+		case ALERT_SCOPE_NIC:
+			r.Scope = ALERT_SCOPE_NIC
+		default:
+			return nil, fmt.Errorf("alertRules[%d] scope %s is not supported", i, r.Scope)
+		}
+
+		if r.Threshold < 0 {
+			return nil, fmt.Errorf("alertRules[%d] threshold must not be negative", i)
+		}
+		if r.Cycles <= 0 {
+			r.Cycles = 1
+		}
+	}
+	return rules, nil
+}
+
+type alertKey struct {
+	rule   string
+	taskId int
+	vid    int64
+	mac    string
+}
+
+// alertSeries 记录某条规则在某个任务/网卡上的评估状态
+type alertSeries struct {
+	lastSent    int64
+	lastDropped int64
+	hasLast     bool
+	breaches    int
+	clears      int
+	firing      bool
+	startsAt    time.Time
+	value       float64
+	generation  uint64
+}
+
+type AlertNotifier interface {
+	Notify(alert Alert) error
+}
+
+// alertEvaluator 每个采集周期评估一次规则, 只在状态切换时发出通知
+type alertEvaluator struct {
+	rules      []AlertRule
+	series     map[alertKey]*alertSeries
+	generation uint64
+	nodeName   string
+	taskIndex  vcache.TaskIndex
+	notifiers  []AlertNotifier
+}
+
+func newAlertEvaluator(rules []AlertRule, nodeName string, taskIndex vcache.TaskIndex, notifiers ...AlertNotifier) *alertEvaluator {
+	return &alertEvaluator{
+		rules:     rules,
+		series:    make(map[alertKey]*alertSeries),
+		nodeName:  nodeName,
+		taskIndex: taskIndex,
+		notifiers: notifiers,
+	}
+}
+
+func (e *alertEvaluator) Evaluate(metrics []inpplat.ForwardMetrics) {
+	e.generation++
+	now := time.Now()
+
+	for _, rule := range e.rules {
+		for _, m := range metrics {
+			switch rule.Scope {
+			case ALERT_SCOPE_NIC:
+				for _, nic := range m.Nics {
+					key := alertKey{rule: rule.Name, taskId: m.TaskId, vid: nic.Vid, mac: nic.Mac}
+					e.observe(rule, key, nic.BaseMetric, now)
+				}
+			default:
+				key := alertKey{rule: rule.Name, taskId: m.TaskId, vid: -1}
+				e.observe(rule, key, m.Total, now)
+			}
+		}
+	}
+
+	// 本周期没有再出现的任务/网卡视为已消失, 正在告警的需要发出恢复通知
+	for key, s := range e.series {
+		if s.generation == e.generation {
+			continue
+		}
+		if s.firing {
+			e.notify(e.newAlert(e.ruleByName(key.rule), key, s, AlertStateResolved, now))
+		}
+		delete(e.series, key)
+	}
+}
+
+func (e *alertEvaluator) observe(rule AlertRule, key alertKey, metric inpplat.BaseMetric, now time.Time) {
+	s, exist := e.series[key]
+	if !exist {
+		s = &alertSeries{}
+		e.series[key] = s
+	}
+	s.generation = e.generation
+
+	value, ok := s.sample(rule.Metric, metric)
+	if !ok {
+		return
+	}
+	s.value = value
+
+	if value > rule.Threshold {
+		s.breaches++
+		s.clears = 0
+	} else {
+		s.clears++
+		s.breaches = 0
+	}
+
+	if !s.firing && s.breaches >= rule.Cycles {
+		s.firing = true
+		s.startsAt = now
+		e.notify(e.newAlert(rule, key, s, AlertStateFiring, now))
+	} else if s.firing && s.clears >= rule.Cycles {
+		s.firing = false
+		e.notify(e.newAlert(rule, key, s, AlertStateResolved, now))
+	}
+}
+
+// sample 计算本周期的指标值, dropRatio需要两次采样的差值, 首次采样返回false
+func (s *alertSeries) sample(metricName string, metric inpplat.BaseMetric) (float64, bool) {
+	switch metricName {
+	case ALERT_METRIC_REALPPS:
+		return float64(metric.Realpps), true
+	case ALERT_METRIC_REALBPS:
+		return float64(metric.Realbps), true
+	}
+
+	if !s.hasLast {
+		s.lastSent, s.lastDropped, s.hasLast = metric.Sent, metric.Dropped, true
+		return 0, false
+	}
+	sent := metric.Sent - s.lastSent
+	dropped := metric.Dropped - s.lastDropped
+	if sent < 0 || dropped < 0 {
+		// 计数器被重置(如任务重建), 以当前值作为本周期增量
+		sent, dropped = metric.Sent, metric.Dropped
+	}
+	s.lastSent, s.lastDropped = metric.Sent, metric.Dropped
+
+	if sent+dropped == 0 {
+		return 0, true
+	}
+	return float64(dropped) * 100 / float64(sent+dropped), true
+}
+
+func (e *alertEvaluator) ruleByName(name string) AlertRule {
+	for _, r := range e.rules {
+		if r.Name == name {
+			return r
+		}
+	}
+	return AlertRule{Name: name}
+}
+
+func (e *alertEvaluator) newAlert(rule AlertRule, key alertKey, s *alertSeries, state AlertState, now time.Time) Alert {
+	alert := Alert{
+		Rule:      rule.Name,
+		Metric:    rule.Metric,
+		State:     state,
+		Value:     s.value,
+		Threshold: rule.Threshold,
+		TaskId:    key.taskId,
+		Node:      e.nodeName,
+		StartsAt:  s.startsAt,
+	}
+	if key.vid >= 0 {
+		alert.Vid = key.vid
+		alert.Mac = key.mac
+	}
+	if state == AlertStateResolved {
+		endsAt := now
+		alert.EndsAt = &endsAt
+	}
+	if e.taskIndex != nil {
+		if ref, err := e.taskIndex.Get(key.taskId); err == nil {
+			alert.Namespace = ref.Namespace
+			alert.VmiName = ref.Name
+			alert.vmiUID = ref.UID
+		}
+	}
+	return alert
+}
+
+func (e *alertEvaluator) notify(alert Alert) {
+	for _, n := range e.notifiers {
+		if err := n.Notify(alert); err != nil {
+			slog.Error("Notify alert failed", "rule", alert.Rule, "taskId", alert.TaskId, "state", alert.State, "errMsg", err)
+		}
+	}
+}
+
+// asyncAlertNotifier 在单独的goroutine中按顺序调用next, 队列满时丢弃新的告警并返回错误
+type asyncAlertNotifier struct {
+	next  AlertNotifier
+	queue chan Alert
+}
+
+func newAsyncAlertNotifier(next AlertNotifier, size int) *asyncAlertNotifier {
+	n := &asyncAlertNotifier{
+		next:  next,
+		queue: make(chan Alert, size),
+	}
+	go n.run()
+	return n
+}
+
+func (n *asyncAlertNotifier) Notify(alert Alert) error {
+	select {
+	case n.queue <- alert:
+		return nil
+	default:
+		return fmt.Errorf("alert queue of %T is full, alert dropped", n.next)
+	}
+}
+
+func (n *asyncAlertNotifier) run() {
+	for alert := range n.queue {
+		if err := n.next.Notify(alert); err != nil {
+			slog.Error("Notify alert failed", "rule", alert.Rule, "taskId", alert.TaskId, "state", alert.State, "errMsg", err)
+		}
+	}
+}
+
+// logAlertNotifier 输出结构化日志
+type logAlertNotifier struct{}
+
+func (n *logAlertNotifier) Notify(alert Alert) error {
+	level := slog.LevelWarn
+	if alert.State == AlertStateResolved {
+		level = slog.LevelInfo
+	}
+	slog.Log(context.Background(), level, "Traffic alert "+string(alert.State),
+		"rule", alert.Rule,
+		"metric", alert.Metric,
+		"value", alert.Value,
+		"threshold", alert.Threshold,
+		"taskId", alert.TaskId,
+		"vid", alert.Vid,
+		"mac", alert.Mac,
+		"namespace", alert.Namespace,
+		"vmiName", alert.VmiName,
+	)
+	return nil
+}
+
+// eventAlertNotifier 在告警对应的VMI上生成Kubernetes Event
+type eventAlertNotifier struct {
+	kubevirtClient kubecli.KubevirtClient
+	nodeName       string
+}
+
+func (n *eventAlertNotifier) Notify(alert Alert) error {
+	if alert.VmiName == "" {
+		slog.Debug("Skip alert event, no vmi found for task", "taskId", alert.TaskId, "rule", alert.Rule)
+		return nil
+	}
+
+	eventType, reason := k8sv1.EventTypeWarning, ALERT_EVENT_REASON_FIRING
+	if alert.State == AlertStateResolved {
+		eventType, reason = k8sv1.EventTypeNormal, ALERT_EVENT_REASON_RESOLVED
+	}
+	target := "total"
+	if alert.Mac != "" {
+		target = fmt.Sprintf("nic(vid=%d, mac=%s)", alert.Vid, alert.Mac)
+	}
+
+	now := k8smetav1.Now()
+	event := &k8sv1.Event{
+		ObjectMeta: k8smetav1.ObjectMeta{
+			GenerateName: alert.VmiName + ".",
+			Namespace:    alert.Namespace,
+		},
+		InvolvedObject: k8sv1.ObjectReference{
+			Kind:       "VirtualMachineInstance",
+			APIVersion: "kubevirt.io/v1",
+			Namespace:  alert.Namespace,
+			Name:       alert.VmiName,
+			UID:        types.UID(alert.vmiUID),
+		},
+		Reason: reason,
+		Message: fmt.Sprintf("rule %s %s: %s of %s is %.2f (threshold %.2f)",
+			alert.Rule, alert.State, alert.Metric, target, alert.Value, alert.Threshold),
+		Type:           eventType,
+		Source:         k8sv1.EventSource{Component: "pdcplet", Host: n.nodeName},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err := n.kubevirtClient.CoreV1().Events(alert.Namespace).Create(context.Background(), event, k8smetav1.CreateOptions{})
+	return err
+}
+
+// webhookAlertNotifier 将告警以JSON POST到配置的webhook地址
+type webhookAlertNotifier struct {
+	url        string
+	restclient *resty.Client
+}
+
+func newWebhookAlertNotifier(url string) *webhookAlertNotifier {
+	return &webhookAlertNotifier{
+		url: url,
+		restclient: resty.New().
+			SetTimeout(HTTP_TIMEOUT).
+			SetHeaders(map[string]string{"Content-Type": "application/json"}),
+	}
+}
+
+func (n *webhookAlertNotifier) Notify(alert Alert) error {
+	resp, err := n.restclient.R().
+		SetBody(alert).
+		Post(n.url)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() < http.StatusOK || resp.StatusCode() >= http.StatusMultipleChoices {
+		return fmt.Errorf("alert webhook responded %d: %s", resp.StatusCode(), resp.String())
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package module
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pdcplet/pkg/internal/inpplat"
+	vcache "pdcplet/pkg/pdcplet/cache"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	k8sv1 "k8s.io/api/core/v1"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"kubevirt.io/client-go/kubecli"
+)
+
+// recordingNotifier 记录收到的告警, block不为nil时在发送前等待, 并通过started通知已开始发送
+type recordingNotifier struct {
+	mu      sync.Mutex
+	alerts  []Alert
+	block   chan struct{}
+	started chan struct{}
+}
+
+func (n *recordingNotifier) Notify(alert Alert) error {
+	if n.started != nil {
+		select {
+		case n.started <- struct{}{}:
+		default:
+		}
+	}
+	if n.block != nil {
+		<-n.block
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func (n *recordingNotifier) received() []Alert {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]Alert(nil), n.alerts...)
+}
+
+func TestParseAlertRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     interface{}
+		want    AlertRule
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			raw:  []map[string]interface{}{{"name": "drop", "metric": "DropRatio", "threshold": "5"}},
+			want: AlertRule{Name: "drop", Metric: ALERT_METRIC_DROP_RATIO, Threshold: 5, Cycles: 1, Scope: ALERT_SCOPE_TASK},
+		},
+		{
+			name: "nic scope",
+			raw:  []map[string]interface{}{{"name": "pps", "metric": "REALPPS", "threshold": 100, "cycles": 3, "scope": "NIC"}},
+			want: AlertRule{Name: "pps", Metric: ALERT_METRIC_REALPPS, Threshold: 100, Cycles: 3, Scope: ALERT_SCOPE_NIC},
+		},
+		{name: "no name", raw: []map[string]interface{}{{"metric": "realpps"}}, wantErr: true},
+		{name: "duplicated name", raw: []map[string]interface{}{{"name": "a", "metric": "realpps"}, {"name": "a", "metric": "realbps"}}, wantErr: true},
+		{name: "unknown metric", raw: []map[string]interface{}{{"name": "a", "metric": "latency"}}, wantErr: true},
+		{name: "unknown scope", raw: []map[string]interface{}{{"name": "a", "metric": "realpps", "scope": "vm"}}, wantErr: true},
+		{name: "negative threshold", raw: []map[string]interface{}{{"name": "a", "metric": "realpps", "threshold": -1}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseAlertRules(tt.raw)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseAlertRules should fail")
+				}
+				return
+			}
+			if err != nil || len(rules) != 1 || rules[0] != tt.want {
+				t.Fatalf("rules = %+v err = %v, want %+v", rules, err, tt.want)
+			}
+		})
+	}
+}
+
+func taskMetrics(taskId int, total inpplat.BaseMetric, nics ...inpplat.NicMetric) inpplat.ForwardMetrics {
+	return inpplat.ForwardMetrics{TaskId: taskId, Total: total, Nics: nics}
+}
+
+func TestAlertEvaluator(t *testing.T) {
+	pps := func(v int64) inpplat.BaseMetric { return inpplat.BaseMetric{Realpps: v} }
+	counters := func(sent, dropped int64) inpplat.BaseMetric { return inpplat.BaseMetric{Sent: sent, Dropped: dropped} }
+
+	tests := []struct {
+		name   string
+		rule   AlertRule
+		cycles [][]inpplat.ForwardMetrics
+		want   []AlertState // 每个周期结束后累计收到的通知
+		values []float64
+	}{
+		{
+			name: "fires after consecutive breaches and resolves after consecutive clears",
+			rule: AlertRule{Name: "pps", Metric: ALERT_METRIC_REALPPS, Threshold: 100, Cycles: 2, Scope: ALERT_SCOPE_TASK},
+			cycles: [][]inpplat.ForwardMetrics{
+				{taskMetrics(1, pps(150))},
+				{taskMetrics(1, pps(50))}, // 中断连续超限
+				{taskMetrics(1, pps(150))},
+				{taskMetrics(1, pps(200))},
+				{taskMetrics(1, pps(50))},
+				{taskMetrics(1, pps(50))},
+			},
+			want:   []AlertState{AlertStateFiring, AlertStateResolved},
+			values: []float64{200, 50},
+		},
+		{
+			name: "drop ratio uses the delta of counters",
+			rule: AlertRule{Name: "drop", Metric: ALERT_METRIC_DROP_RATIO, Threshold: 10, Cycles: 1, Scope: ALERT_SCOPE_TASK},
+			cycles: [][]inpplat.ForwardMetrics{
+				{taskMetrics(1, counters(1000, 1000))}, // 首次采样没有增量
+				{taskMetrics(1, counters(1080, 1020))}, // 20/100
+				{taskMetrics(1, counters(100, 0))},     // 计数器被重置
+			},
+			want:   []AlertState{AlertStateFiring, AlertStateResolved},
+			values: []float64{20, 0},
+		},
+		{
+			name: "disappeared task resolves",
+			rule: AlertRule{Name: "pps", Metric: ALERT_METRIC_REALPPS, Threshold: 100, Cycles: 1, Scope: ALERT_SCOPE_NIC},
+			cycles: [][]inpplat.ForwardMetrics{
+				{taskMetrics(1, pps(0), inpplat.NicMetric{Vid: 10, Mac: "aa", BaseMetric: pps(500)})},
+				{},
+			},
+			want:   []AlertState{AlertStateFiring, AlertStateResolved},
+			values: []float64{500, 500},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := vcache.NewTaskIndex()
+			index.Put(1, vcache.VmiRef{Namespace: "default", Name: "vm1", UID: "uid1"})
+			notifier := &recordingNotifier{}
+			e := newAlertEvaluator([]AlertRule{tt.rule}, "node1", index, notifier)
+			for _, metrics := range tt.cycles {
+				e.Evaluate(metrics)
+			}
+
+			alerts := notifier.received()
+			if len(alerts) != len(tt.want) {
+				t.Fatalf("alerts = %+v, want states %v", alerts, tt.want)
+			}
+			for i, alert := range alerts {
+				if alert.State != tt.want[i] || alert.Value != tt.values[i] {
+					t.Errorf("alert[%d] = %s %.2f, want %s %.2f", i, alert.State, alert.Value, tt.want[i], tt.values[i])
+				}
+				if alert.Namespace != "default" || alert.VmiName != "vm1" || alert.Node != "node1" || alert.Rule != tt.rule.Name {
+					t.Errorf("alert[%d] = %+v, want vmi default/vm1 on node1", i, alert)
+				}
+			}
+			if alerts[len(alerts)-1].EndsAt == nil || alerts[0].EndsAt != nil {
+				t.Errorf("EndsAt should only be set when resolved")
+			}
+		})
+	}
+}
+
+func TestWebhookAlertNotifier(t *testing.T) {
+	var got Alert
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	n := newWebhookAlertNotifier(srv.URL)
+	alert := Alert{Rule: "pps", Metric: ALERT_METRIC_REALPPS, State: AlertStateFiring, Value: 200, TaskId: 1, VmiName: "vm1"}
+	if err := n.Notify(alert); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	if got.Rule != "pps" || got.State != AlertStateFiring || got.VmiName != "vm1" || got.Value != 200 {
+		t.Fatalf("webhook received %+v", got)
+	}
+
+	status = http.StatusInternalServerError
+	if err := n.Notify(alert); err == nil {
+		t.Fatalf("notify should fail when webhook responds %d", status)
+	}
+}
+
+func TestAsyncAlertNotifier(t *testing.T) {
+	next := &recordingNotifier{block: make(chan struct{}), started: make(chan struct{}, 1)}
+	n := newAsyncAlertNotifier(next, 2)
+
+	// 第一个告警被取出后阻塞在next中, Notify不等待发送完成, 队列中还能容纳两个
+	if err := n.Notify(Alert{Rule: "r", TaskId: 1}); err != nil {
+		t.Fatalf("notify 1: %v", err)
+	}
+	select {
+	case <-next.started:
+	case <-time.After(time.Second):
+		t.Fatalf("alert 1 was not sent")
+	}
+	for i := 2; i <= 3; i++ {
+		if err := n.Notify(Alert{Rule: "r", TaskId: i}); err != nil {
+			t.Fatalf("notify %d: %v", i, err)
+		}
+	}
+	if err := n.Notify(Alert{Rule: "r", TaskId: 4}); err == nil {
+		t.Fatalf("notify should fail when the queue is full")
+	}
+
+	close(next.block)
+	deadline := time.Now().Add(time.Second)
+	for len(next.received()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	alerts := next.received()
+	if len(alerts) != 3 || alerts[0].TaskId != 1 || alerts[2].TaskId != 3 {
+		t.Fatalf("delivered alerts = %+v, want tasks 1..3 in order", alerts)
+	}
+}
+
+func TestEventAlertNotifier(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	clientset := k8sfake.NewSimpleClientset()
+	// fake clientset不处理GenerateName
+	generated := 0
+	clientset.PrependReactor("create", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		event := action.(k8stesting.CreateAction).GetObject().(*k8sv1.Event)
+		generated++
+		event.Name = event.GenerateName + strconv.Itoa(generated)
+		return false, nil, nil
+	})
+	virtClient := kubecli.NewMockKubevirtClient(ctrl)
+	virtClient.EXPECT().CoreV1().Return(clientset.CoreV1()).AnyTimes()
+	n := &eventAlertNotifier{kubevirtClient: virtClient, nodeName: "node1"}
+
+	// 没有对应VMI的告警不生成Event
+	if err := n.Notify(Alert{Rule: "pps", State: AlertStateFiring, TaskId: 1}); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	alerts := []Alert{
+		{Rule: "pps", Metric: ALERT_METRIC_REALPPS, State: AlertStateFiring, Value: 200, Threshold: 100, TaskId: 1,
+			Namespace: "default", VmiName: "vm1", vmiUID: "uid1"},
+		{Rule: "pps", Metric: ALERT_METRIC_REALPPS, State: AlertStateResolved, Value: 50, Threshold: 100, TaskId: 1,
+			Vid: 10, Mac: "aa", Namespace: "default", VmiName: "vm1", vmiUID: "uid1"},
+	}
+	for _, alert := range alerts {
+		if err := n.Notify(alert); err != nil {
+			t.Fatalf("notify: %v", err)
+		}
+	}
+
+	events, err := clientset.CoreV1().Events("default").List(context.Background(), k8smetav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events.Items) != 2 {
+		t.Fatalf("events = %d, want 2", len(events.Items))
+	}
+	reasons := map[string]string{}
+	for _, event := range events.Items {
+		if event.InvolvedObject.Name != "vm1" || event.InvolvedObject.UID != "uid1" || event.Source.Host != "node1" {
+			t.Errorf("unexpected event %+v", event)
+		}
+		reasons[event.Reason] = event.Type
+	}
+	if reasons[ALERT_EVENT_REASON_FIRING] != k8sv1.EventTypeWarning || reasons[ALERT_EVENT_REASON_RESOLVED] != k8sv1.EventTypeNormal {
+		t.Errorf("event reasons = %v", reasons)
+	}
+}
@@ -6,10 +6,9 @@ import (
 	"log/slog"
 	"pdcplet/pkg/config"
 	"pdcplet/pkg/internal/inpplat"
+	vcache "pdcplet/pkg/pdcplet/cache"
 	"sync"
 	"time"
-
-	"resty.dev/v3"
 )
 
 const VMI_METRICS_NAME = "VmiMetrics"
@@ -17,8 +16,9 @@ const VMI_METRICS_NAME = "VmiMetrics"
 type vmiMetricsModule struct {
 	name         string
 	inpplatproxy inpplat.Client
-	restclient   *resty.Client
+	uploader     *metricsUploader
 	cycle        time.Duration // 采集周期
+	alerts       *alertEvaluator
 }
 
 // var MOCK_SERVER = RestClientConfig{
@@ -64,15 +64,23 @@ func NewVmiMetricsModule(params map[string]interface{}) (Module, error) {
 		}
 
 		if conn["name"] == config.PDCPSERVER_CONNECTION_NAME {
-			if restConfig, ok := conn["httpOverTcpIp"].(map[string]interface{}); ok {
-				vmm.restclient = resty.New().
-					SetBaseURL(fmt.Sprintf("http://%s:%d%s", restConfig["host"], restConfig["port"], restConfig["urlPrefix"])).
-					SetTimeout(HTTP_TIMEOUT).
-					SetHeaders(map[string]string{"Content-Type": "application/json"})
-			} else {
-				slog.Error("PDCPSERVER_CONNECTION_NAME config is invalid")
-				return nil, fmt.Errorf("PDCPSERVER_CONNECTION_NAME config is invalid")
+			restclient, authToken, err := newPdcpServerRestClient(conn)
+			if err != nil {
+				return nil, err
+			}
+			authMode, _ := params["uploadAuthMode"].(string)
+			maxPending, _ := params["maxPendingUploads"].(int)
+			version, _ := params["version"].(string)
+			nodeName, err := getNodeName()
+			if err != nil {
+				return nil, err
 			}
+			uploader, err := newMetricsUploader(restclient, nodeName, version, authMode, authToken, maxPending)
+			if err != nil {
+				slog.Error("vmiMetricsModule uploader init failed", "errMsg", err)
+				return nil, fmt.Errorf("vmiMetricsModule uploader init failed: %w", err)
+			}
+			vmm.uploader = uploader
 		}
 	}
 	if vmm.inpplatproxy == nil {
@@ -85,9 +93,48 @@ func NewVmiMetricsModule(params map[string]interface{}) (Module, error) {
 	}
 	vmm.cycle = cycle
 
+	if rawRules, ok := params["alertRules"]; ok {
+		alerts, err := newVmiMetricsAlerts(rawRules, params["alertWebhook"])
+		if err != nil {
+			slog.Error("vmiMetricsModule alertRules is invalid", "errMsg", err)
+			return nil, fmt.Errorf("vmiMetricsModule alertRules is invalid: %w", err)
+		}
+		vmm.alerts = alerts
+	}
+
 	return vmm, nil
 }
 
+func newVmiMetricsAlerts(rawRules interface{}, rawWebhook interface{}) (*alertEvaluator, error) {
+	rules, err := ParseAlertRules(rawRules)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	notifiers := []AlertNotifier{&logAlertNotifier{}, &nodeEventAlertNotifier{}}
+
+	// 节点名只用于Event的Source字段, 获取失败不影响告警
+	nodeName, _ := getNodeName()
+	kubevirtClient, _ := NewKubevirtClient()
+	// 调用Kubernetes API和webhook的通知异步发送, 避免阻塞采集周期
+	if kubevirtClient != nil {
+		notifiers = append(notifiers, newAsyncAlertNotifier(&eventAlertNotifier{
+			kubevirtClient: kubevirtClient,
+			nodeName:       nodeName,
+		}, ALERT_NOTIFY_QUEUE_SIZE))
+	}
+
+	if webhook, ok := rawWebhook.(string); ok && webhook != "" {
+		notifiers = append(notifiers, newAsyncAlertNotifier(newWebhookAlertNotifier(webhook), ALERT_NOTIFY_QUEUE_SIZE))
+	}
+
+	slog.Info("vmiMetricsModule alert rules loaded", "rules_len", len(rules), "notifiers_len", len(notifiers))
+	return newAlertEvaluator(rules, nodeName, vcache.DefaultTaskIndex(), notifiers...), nil
+}
+
 func (v *vmiMetricsModule) Name() string {
 	return v.name
 }
@@ -119,6 +166,7 @@ func (v *vmiMetricsModule) doJob() {
 }
 
 func (v *vmiMetricsModule) CollectForwardMetrics() error {
+	collectedAt := time.Now()
 	metrics, err := v.inpplatproxy.GetAllForwardMetricsGroupByTask()
 	if err != nil {
 		slog.Error("GetAllForwardMetricsGroupByTask failed", "errMsg", err)
@@ -127,13 +175,21 @@ func (v *vmiMetricsModule) CollectForwardMetrics() error {
 
 	slog.Debug("GetAllForwardMetricsGroupByTask successfully", "metrics_len", len(metrics))
 
-	// TODO: 需要处理返回结果
-	_, err = v.restclient.R().
-		SetBody(metrics).
-		SetResult(nil).
-		Post("/metrics/")
-	if err != nil {
-		slog.Error("Post metrics failed", "errMsg", err)
+	// 重启前创建的任务需要从inpplat加载, 否则告警和上报中缺少VMI信息
+	if err := vcache.LoadDefaultTaskIndex(v.inpplatproxy); err != nil {
+		slog.Warn("Load task index from inpplat failed, will retry in next cycle", "errMsg", err)
+	}
+
+	if v.alerts != nil {
+		v.alerts.Evaluate(metrics)
+	}
+
+	if v.uploader == nil {
+		return nil
+	}
+	v.uploader.Enqueue(metrics, collectedAt)
+	if err := v.uploader.Flush(); err != nil {
+		slog.Error("Upload metrics failed", "errMsg", err, "pending", len(v.uploader.pending))
 	}
 	return nil
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"pdcplet/pkg/agent"
 	"pdcplet/pkg/config"
 	"pdcplet/pkg/internal/inpplat"
 	vcache "pdcplet/pkg/pdcplet/cache"
@@ -361,14 +362,23 @@ func (a *vmiProxyModule) doJob(key interface{}) {
 	switch workItem.op {
 	case CreateTaskOp:
 		taskId, err := a.inpplatproxy.CreateTask(map[string]string{
-			"name": workItem.vmi.Name,
+			"name":      workItem.vmi.Name,
+			"namespace": workItem.vmi.Namespace,
+			"uid":       string(workItem.vmi.UID),
 		})
 		if err != nil {
 			slog.Error("CreateTask failed", "vmiName", workItem.vmi.Name, "taskId", taskId, "errMsg", err)
 			a.queue.AddRateLimited(workItem)
 		} else {
 			a.cache.SetTaskId(workItem.vmi.Name, taskId)
+			vcache.DefaultTaskIndex().Put(taskId, vcache.VmiRef{
+				Namespace: workItem.vmi.Namespace,
+				Name:      workItem.vmi.Name,
+				UID:       string(workItem.vmi.UID),
+			})
 			slog.Info("CreateTask sucessfully", "taskId", taskId)
+			nodeEvents.publish(agent.NodeEvent{Type: agent.EventTaskCreated, Namespace: workItem.vmi.Namespace,
+				VmiName: workItem.vmi.Name, TaskId: taskId})
 			a.cache.MarkTaskCreated(workItem.vmi.Name)
 			a.queue.Forget(workItem)
 		}
@@ -384,6 +394,9 @@ func (a *vmiProxyModule) doJob(key interface{}) {
 			a.queue.AddRateLimited(workItem)
 		} else {
 			slog.Info("CloseTask sucessfully", "taskId", taskId)
+			vcache.DefaultTaskIndex().Remove(taskId)
+			nodeEvents.publish(agent.NodeEvent{Type: agent.EventTaskClosed, Namespace: workItem.vmi.Namespace,
+				VmiName: workItem.vmi.Name, TaskId: taskId})
 			a.cache.MarkTaskClosed(workItem.vmi.Name)
 			a.queue.Forget(workItem)
 		}
@@ -0,0 +1,237 @@
+// Package apierror pdcpserver统一的错误响应, 所有handler和中间件通过Respond或Abort返回错误
+package apierror
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"pdcplet/pkg/pdcpserver/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	HEADER_REQUEST_ID = "X-Request-Id"
+	REQUEST_ID_KEY    = "pdcpserver.requestId"
+)
+
+// 调用方传入的请求ID只接受该格式, 否则重新生成
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+var registerFieldNames sync.Once
+
+// Middleware 为每个请求分配请求ID并写入响应头, 调用方已通过X-Request-Id指定时沿用.
+// 需在其他中间件之前注册, 使所有错误响应都带有请求ID
+func Middleware() gin.HandlerFunc {
+	registerFieldNames.Do(useJSONFieldNames)
+	return func(c *gin.Context) {
+		id := c.GetHeader(HEADER_REQUEST_ID)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Set(REQUEST_ID_KEY, id)
+		c.Header(HEADER_REQUEST_ID, id)
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestID 返回Middleware分配的请求ID
+func RequestID(c *gin.Context) string {
+	return c.GetString(REQUEST_ID_KEY)
+}
+
+// useJSONFieldNames binding校验错误中的字段使用json或form标签中的名称, 与请求中的字段名一致
+func useJSONFieldNames() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, key := range []string{"json", "form", "uri"} {
+			name, _, _ := strings.Cut(field.Tag.Get(key), ",")
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return field.Name
+	})
+}
+
+// Respond 以model.ErrorResponse返回err. status为500时按Kubernetes API错误修正状态码,
+// 使KubeVirt返回的NotFound、AlreadyExists等不被报告为服务端错误
+func Respond(c *gin.Context, status int, err error) {
+	if status == http.StatusInternalServerError {
+		status = Status(err)
+	}
+	c.JSON(status, NewResponse(c, status, err))
+}
+
+// Abort 用于中间件, 返回错误并停止执行后续handler
+func Abort(c *gin.Context, status int, err error) {
+	Respond(c, status, err)
+	c.Abort()
+}
+
+// Status 返回Kubernetes API错误对应的HTTP状态码, 其他错误返回500
+func Status(err error) int {
+	switch {
+	case apierrors.IsNotFound(err):
+		return http.StatusNotFound
+	case apierrors.IsAlreadyExists(err), apierrors.IsConflict(err):
+		return http.StatusConflict
+	case apierrors.IsInvalid(err):
+		return http.StatusUnprocessableEntity
+	case apierrors.IsBadRequest(err):
+		return http.StatusBadRequest
+	case apierrors.IsTooManyRequests(err):
+		return http.StatusTooManyRequests
+	case apierrors.IsServerTimeout(err), apierrors.IsTimeout(err):
+		return http.StatusGatewayTimeout
+	case apierrors.IsServiceUnavailable(err):
+		return http.StatusServiceUnavailable
+	default:
+		// Kubernetes返回的401/403是pdcpserver自身的权限问题, 对调用方是服务端错误
+		return http.StatusInternalServerError
+	}
+}
+
+// NewResponse 生成错误响应体, binding校验错误、JSON类型错误、Kubernetes的字段错误和model.FieldError展开为details
+func NewResponse(c *gin.Context, status int, err error) model.ErrorResponse {
+	resp := model.ErrorResponse{
+		Code:      Code(status, err),
+		Message:   err.Error(),
+		RequestID: RequestID(c),
+	}
+
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var fieldErr *model.FieldError
+	var statusErr apierrors.APIStatus
+	switch {
+	case errors.As(err, &validationErrs):
+		resp.Message = "request validation failed"
+		for _, fe := range validationErrs {
+			resp.Details = append(resp.Details, model.ErrorDetail{Field: fieldPath(fe), Message: validationMessage(fe)})
+		}
+	case errors.As(err, &typeErr):
+		resp.Details = []model.ErrorDetail{{Field: typeErr.Field, Message: "must be " + jsonType(typeErr.Type)}}
+	case errors.As(err, &fieldErr):
+		resp.Details = []model.ErrorDetail{{Field: fieldErr.Field, Message: fieldErr.Message}}
+	case errors.As(err, &statusErr):
+		if details := statusErr.Status().Details; details != nil {
+			for _, cause := range details.Causes {
+				resp.Details = append(resp.Details, model.ErrorDetail{Field: cause.Field, Message: cause.Message})
+			}
+		}
+	}
+	return resp
+}
+
+// Code 返回状态码对应的错误类型, 已映射的Kubernetes错误使用其StatusReason
+func Code(status int, err error) model.ErrorCode {
+	if status != http.StatusInternalServerError {
+		if reason := apierrors.ReasonForError(err); reason != "" {
+			return model.ErrorCode(reason)
+		}
+	}
+	switch status {
+	case http.StatusBadRequest:
+		return model.ErrorBadRequest
+	case http.StatusUnauthorized:
+		return model.ErrorUnauthorized
+	case http.StatusForbidden:
+		return model.ErrorForbidden
+	case http.StatusNotFound:
+		return model.ErrorNotFound
+	case http.StatusConflict:
+		return model.ErrorConflict
+	case http.StatusUnprocessableEntity:
+		return model.ErrorInvalid
+	case http.StatusTooManyRequests:
+		return model.ErrorTooManyRequests
+	case http.StatusServiceUnavailable:
+		return model.ErrorServiceUnavailable
+	case http.StatusGatewayTimeout:
+		return model.ErrorTimeout
+	default:
+		if status < http.StatusInternalServerError {
+			return model.ErrorBadRequest
+		}
+		return model.ErrorInternal
+	}
+}
+
+// fieldPath 去掉校验错误路径中的请求类型名, 如VMCreateRequest.disks[0].name返回disks[0].name
+func fieldPath(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return path
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "min", "gte":
+		return "must be at least " + fe.Param()
+	case "max", "lte":
+		return "must be at most " + fe.Param()
+	default:
+		if fe.Param() != "" {
+			return fmt.Sprintf("failed on the %s=%s rule", fe.Tag(), fe.Param())
+		}
+		return fmt.Sprintf("failed on the %s rule", fe.Tag())
+	}
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// Recovery 替换gin.Recovery, handler panic时返回500错误响应
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		Abort(c, http.StatusInternalServerError, errors.New("internal server error"))
+	})
+}
+
+// NoRoute 未注册的路由返回404错误响应
+func NoRoute(c *gin.Context) {
+	Respond(c, http.StatusNotFound, fmt.Errorf("route %s %s not found", c.Request.Method, c.Request.URL.Path))
+}
@@ -0,0 +1,106 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"pdcplet/pkg/pdcpserver/model"
+
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var vmResource = schema.GroupResource{Group: "kubevirt.io", Resource: "virtualmachines"}
+
+func TestStatus(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   model.ErrorCode
+	}{
+		{apierrors.NewNotFound(vmResource, "vm1"), http.StatusNotFound, model.ErrorNotFound},
+		{fmt.Errorf("create vm: %w", apierrors.NewAlreadyExists(vmResource, "vm1")), http.StatusConflict, model.ErrorAlreadyExists},
+		{apierrors.NewConflict(vmResource, "vm1", errors.New("modified")), http.StatusConflict, model.ErrorConflict},
+		{apierrors.NewInvalid(schema.GroupKind{Group: "kubevirt.io", Kind: "VirtualMachine"}, "vm1", nil), http.StatusUnprocessableEntity, model.ErrorInvalid},
+		{apierrors.NewForbidden(vmResource, "vm1", errors.New("rbac")), http.StatusInternalServerError, model.ErrorInternal},
+		{errors.New("database is locked"), http.StatusInternalServerError, model.ErrorInternal},
+	}
+	for _, c := range cases {
+		status := Status(c.err)
+		if status != c.status || Code(status, c.err) != c.code {
+			t.Errorf("%v: status %d code %s, want %d %s", c.err, status, Code(status, c.err), c.status, c.code)
+		}
+	}
+}
+
+func TestRespond(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Recovery(), Middleware())
+	r.NoRoute(NoRoute)
+	r.POST("/vms", func(c *gin.Context) {
+		var req model.VMCreateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			Respond(c, http.StatusBadRequest, err)
+			return
+		}
+		invalid := apierrors.NewInvalid(schema.GroupKind{Group: "kubevirt.io", Kind: "VirtualMachine"}, req.Name,
+			field.ErrorList{field.Invalid(field.NewPath("spec", "running"), "x", "bad value")})
+		Respond(c, http.StatusInternalServerError, invalid)
+	})
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	do := func(method, path, body, requestID string) (*httptest.ResponseRecorder, model.ErrorResponse) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if requestID != "" {
+			req.Header.Set(HEADER_REQUEST_ID, requestID)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp model.ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s %s: decode %q: %v", method, path, w.Body.String(), err)
+		}
+		return w, resp
+	}
+
+	w, resp := do(http.MethodPost, "/vms", `{"cpu": 0}`, "req-1")
+	if w.Code != http.StatusBadRequest || resp.Code != model.ErrorBadRequest || resp.RequestID != "req-1" ||
+		w.Header().Get(HEADER_REQUEST_ID) != "req-1" {
+		t.Fatalf("binding error: %d %+v", w.Code, resp)
+	}
+	if len(resp.Details) != 1 || resp.Details[0].Field != "name" || resp.Details[0].Message != "is required" {
+		t.Errorf("binding details = %+v", resp.Details)
+	}
+
+	_, resp = do(http.MethodPost, "/vms", `{"name": "vm1", "cpu": "two"}`, "")
+	if len(resp.Details) != 1 || resp.Details[0].Field != "cpu" || resp.Details[0].Message != "must be a number" {
+		t.Errorf("type error details = %+v", resp.Details)
+	}
+	if len(resp.RequestID) != 32 {
+		t.Errorf("generated request id = %q", resp.RequestID)
+	}
+
+	w, resp = do(http.MethodPost, "/vms", `{"name": "vm1"}`, "bad id with spaces")
+	if w.Code != http.StatusUnprocessableEntity || resp.Code != model.ErrorInvalid ||
+		len(resp.Details) != 1 || resp.Details[0].Field != "spec.running" {
+		t.Errorf("kubernetes invalid: %d %+v", w.Code, resp)
+	}
+	if resp.RequestID == "bad id with spaces" {
+		t.Errorf("invalid request id was accepted")
+	}
+
+	if w, resp = do(http.MethodGet, "/missing", "", ""); w.Code != http.StatusNotFound || resp.Code != model.ErrorNotFound {
+		t.Errorf("no route: %d %+v", w.Code, resp)
+	}
+	if w, resp = do(http.MethodGet, "/panic", "", ""); w.Code != http.StatusInternalServerError || resp.Code != model.ErrorInternal || resp.RequestID == "" {
+		t.Errorf("panic: %d %+v", w.Code, resp)
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"pdcplet/pkg/metrics"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sharedSecretAuthenticator 校验pdcplet共用的metrics.authToken, 按authMode校验请求的HMAC签名或bearer token.
+// HMAC签名包含方法、路径、查询参数、时间戳和请求体, 超过metrics.SIGNATURE_MAX_SKEW的签名被拒绝
+type sharedSecretAuthenticator struct {
+	cfg config.MetricsConfig
+}
+
+func NewSharedSecretAuthenticator(cfg config.MetricsConfig) Authenticator {
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = metrics.DEFAULT_MAX_UPLOAD_BODY
+	}
+	return &sharedSecretAuthenticator{cfg: cfg}
+}
+
+func (a *sharedSecretAuthenticator) Authenticate(c *gin.Context) (*Principal, error) {
+	// 所有节点共用authToken, 无法确定调用方是哪个节点, 因此不使用未签名的X-Pdcp-Node, 也不限制上报的节点
+	principal := &Principal{Subject: SHARED_AGENT_SUBJECT, Kind: model.APIKeyAgent, Method: MethodShared}
+
+	switch a.cfg.AuthMode {
+	case metrics.AUTH_MODE_BEARER:
+		token, ok := bearerToken(c)
+		if !ok || strings.HasPrefix(token, service.API_KEY_PREFIX) {
+			return nil, nil
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.cfg.AuthToken)) != 1 {
+			return nil, errors.New("invalid pdcplet credential")
+		}
+		return principal, nil
+	default:
+		signature := c.GetHeader(metrics.HEADER_SIGNATURE)
+		if signature == "" {
+			return nil, nil
+		}
+		// 签名校验在handler之前读取请求体, 同样需要限制大小
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, a.cfg.MaxBodySize)
+		body, err := c.GetRawData()
+		if err != nil {
+			return nil, err
+		}
+		// 还原请求体供后续handler读取
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		req := c.Request
+		if err := metrics.VerifyRequest(a.cfg.AuthToken, req.Method, req.URL.Path, req.URL.Query(),
+			c.GetHeader(metrics.HEADER_TIMESTAMP), body, signature, time.Now()); err != nil {
+			return nil, fmt.Errorf("invalid pdcplet credential: %w", err)
+		}
+		return principal, nil
+	}
+}
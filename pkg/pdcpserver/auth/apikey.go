@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"pdcplet/pkg/metrics"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyAuthenticator 校验X-API-Key或Bearer中的API Key, 只接受指定类型的Key
+type apiKeyAuthenticator struct {
+	keys service.APIKeyService
+	kind model.APIKeyKind
+}
+
+func NewAPIKeyAuthenticator(keys service.APIKeyService, kind model.APIKeyKind) Authenticator {
+	return &apiKeyAuthenticator{keys: keys, kind: kind}
+}
+
+func (a *apiKeyAuthenticator) Authenticate(c *gin.Context) (*Principal, error) {
+	plaintext := c.GetHeader(HEADER_API_KEY)
+	if plaintext == "" {
+		token, ok := bearerToken(c)
+		if !ok || !strings.HasPrefix(token, service.API_KEY_PREFIX) {
+			return nil, nil
+		}
+		plaintext = token
+	}
+
+	key, err := a.keys.Authenticate(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if key.Kind != a.kind {
+		return nil, fmt.Errorf("%w: %s key %s is not allowed here", service.ErrInvalidCredential, key.Kind, key.Name)
+	}
+	principal := &Principal{Subject: key.UserName, Kind: key.Kind, Method: MethodAPIKey}
+	if principal.Subject == "" {
+		// 引入用户之前创建的Key以Key名称作为用户名
+		principal.Subject = key.Name
+	}
+	// 绑定节点的agent key以节点名作为身份, 上报内容中的节点由AuthorizeNode校验. 未绑定节点的key不限制节点
+	if key.Kind == model.APIKeyAgent && key.NodeName != "" {
+		if nodeName := c.GetHeader(metrics.HEADER_NODE_NAME); nodeName != "" && nodeName != key.NodeName {
+			return nil, fmt.Errorf("%w: key %s is bound to node %s", service.ErrInvalidCredential, key.Name, key.NodeName)
+		}
+		principal.Subject = key.NodeName
+		principal.NodeName = key.NodeName
+	}
+	return principal, nil
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"pdcplet/pkg/pdcpserver/apierror"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	MAX_AUDIT_ERROR_BODY = 4096    // 审计记录中保存的错误响应的最大长度
+	MAX_AUDIT_BODY       = 1 << 20 // 审计的请求需要读取请求体计算哈希, 超出时返回413
+)
+
+const ANONYMOUS_ACTOR = "anonymous"
+
+// auditResponseWriter 缓存错误响应的响应体, 用于在审计记录中保存错误信息
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditResponseWriter) capture(b []byte) {
+	if w.Status() >= http.StatusBadRequest && w.body.Len() < MAX_AUDIT_ERROR_BODY {
+		w.body.Write(b[:min(len(b), MAX_AUDIT_ERROR_BODY-w.body.Len())])
+	}
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	w.capture(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditResponseWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// AuditMiddleware 记录所有修改类请求以及被拒绝(401/403)的请求, 需在认证中间件之前注册以记录认证失败.
+// pdcplet的上报请求数量大, 只记录被拒绝的请求. 请求体限制为MAX_AUDIT_BODY, 只保存SHA-256
+func AuditMiddleware(audits service.AuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mutating := c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead &&
+			c.Request.Method != http.MethodOptions
+		agent := strings.HasPrefix(c.Request.URL.Path, AGENT_ROUTE_PREFIX)
+
+		writer := &auditResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		start := time.Now()
+
+		var body []byte
+		if mutating && !agent {
+			var err error
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MAX_AUDIT_BODY)
+			if body, err = c.GetRawData(); err != nil {
+				// 中止后仍然记录, 不保存请求体的哈希
+				body = nil
+				status := http.StatusBadRequest
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					status = http.StatusRequestEntityTooLarge
+				}
+				apierror.Abort(c, status, err)
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		c.Next()
+
+		status := writer.Status()
+		denied := status == http.StatusUnauthorized || status == http.StatusForbidden
+		if !denied && (!mutating || agent) {
+			return
+		}
+
+		event := model.AuditEvent{
+			Timestamp:  start,
+			Source:     model.AuditSourceAPI,
+			Actor:      ANONYMOUS_ACTOR,
+			Action:     c.Request.Method + " " + c.Request.URL.Path,
+			Result:     model.AuditResultSuccess,
+			StatusCode: status,
+			LatencyMs:  time.Since(start).Milliseconds(),
+			ClientIP:   c.ClientIP(),
+		}
+		if route := c.FullPath(); route != "" {
+			event.Action = c.Request.Method + " " + route
+		}
+		if p := FromContext(c); p != nil {
+			event.Actor = p.Subject
+			event.AuthMethod = p.Method
+		}
+		if len(body) > 0 {
+			sum := sha256.Sum256(body)
+			event.PayloadHash = hex.EncodeToString(sum[:])
+		}
+		event.TargetNamespace, event.TargetName = auditTarget(c, body)
+
+		switch {
+		case denied:
+			event.Result = model.AuditResultDenied
+		case status >= http.StatusBadRequest:
+			event.Result = model.AuditResultFailure
+		}
+		if status >= http.StatusBadRequest {
+			var resp model.ErrorResponse
+			if json.Unmarshal(writer.body.Bytes(), &resp) == nil && resp.Message != "" {
+				event.Error = resp.Message
+			} else {
+				event.Error = http.StatusText(status)
+			}
+		}
+		audits.Record(event)
+	}
+}
+
+// auditTarget 从路径参数、查询参数和JSON请求体中提取操作对象
+func auditTarget(c *gin.Context, body []byte) (namespace string, name string) {
+	name = c.Param("name")
+	if name == "" {
+		name = c.Param("id")
+	}
+	namespace = c.Query("namespace")
+
+	if (name == "" || namespace == "") && len(body) > 0 {
+		var target struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		}
+		if json.Unmarshal(body, &target) == nil {
+			if name == "" {
+				name = target.Name
+			}
+			if namespace == "" {
+				namespace = target.Namespace
+			}
+		}
+	}
+	return namespace, name
+}
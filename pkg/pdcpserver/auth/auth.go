@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"pdcplet/pkg/metrics"
+	"pdcplet/pkg/pdcpserver/apierror"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	PRINCIPAL_KEY      = "pdcpserver.principal"
+	AGENT_ROUTE_PREFIX = "/pdcplet/" // pdcplet访问的路由, 只接受pdcplet的凭据
+	HEADER_API_KEY     = "X-API-Key"
+
+	SHARED_AGENT_SUBJECT = "pdcplet" // 使用共用authToken的调用方
+)
+
+// 认证方式
+const (
+	MethodAPIKey = "apikey"
+	MethodJWT    = "jwt"
+	MethodShared = "shared" // pdcplet共用的metrics.authToken
+)
+
+// Principal 认证通过的调用方
+type Principal struct {
+	Subject  string           // 用户名或节点名
+	Kind     model.APIKeyKind // user或agent
+	Method   string
+	NodeName string // agent凭据对应的节点
+
+	// 以下字段由用户的角色确定, 用户不存在时Role为空, 所有操作都被拒绝
+	Role       model.Role
+	Namespaces []string
+}
+
+// Authenticator 一种认证方式. 请求未携带该方式的凭据时返回nil, nil, 凭据无效时返回error
+type Authenticator interface {
+	Authenticate(c *gin.Context) (*Principal, error)
+}
+
+// Middleware 按请求路径选择认证方式: /pdcplet下的路由使用agents, 其余路由使用users.
+// 依次尝试各认证方式, 对应的列表为空时不校验
+func Middleware(users []Authenticator, agents []Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chain := users
+		if strings.HasPrefix(c.Request.URL.Path, AGENT_ROUTE_PREFIX) {
+			chain = agents
+		}
+		if len(chain) == 0 {
+			c.Next()
+			return
+		}
+
+		for _, authenticator := range chain {
+			principal, err := authenticator.Authenticate(c)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				apierror.Abort(c, http.StatusRequestEntityTooLarge, err)
+				return
+			} else if err != nil {
+				slog.Warn("Request authentication failed", "path", c.Request.URL.Path, "clientIP", c.ClientIP(), "error", err)
+				c.Header("WWW-Authenticate", "Bearer")
+				apierror.Abort(c, http.StatusUnauthorized, err)
+				return
+			}
+			if principal != nil {
+				c.Set(PRINCIPAL_KEY, principal)
+				c.Next()
+				return
+			}
+		}
+		c.Header("WWW-Authenticate", "Bearer")
+		apierror.Abort(c, http.StatusUnauthorized, errors.New("missing credential"))
+	}
+}
+
+// FromContext 返回请求的调用方, 未启用认证时返回nil
+func FromContext(c *gin.Context) *Principal {
+	if v, ok := c.Get(PRINCIPAL_KEY); ok {
+		return v.(*Principal)
+	}
+	return nil
+}
+
+func bearerToken(c *gin.Context) (string, bool) {
+	return strings.CutPrefix(c.GetHeader("Authorization"), metrics.BEARER_PREFIX)
+}
+
+// NewMiddleware 根据配置组装认证中间件. pdcplet可以使用metrics.authToken或agent类型的API Key,
+// 用户可以使用user类型的API Key或JWT. 未启用认证时只按metrics.authToken校验pdcplet
+func NewMiddleware(cfg config.AuthConfig, metricsCfg config.MetricsConfig, keys service.APIKeyService,
+	accounts service.UserService) (gin.HandlerFunc, error) {
+	var users, agents []Authenticator
+	if metricsCfg.AuthToken != "" {
+		agents = append(agents, NewSharedSecretAuthenticator(metricsCfg))
+	}
+	if !cfg.Enabled {
+		slog.Warn("API authentication is disabled, anyone who can reach pdcpserver can manage VMs")
+		return Middleware(nil, agents), nil
+	}
+
+	users = append(users, withUserRole(NewAPIKeyAuthenticator(keys, model.APIKeyUser), accounts))
+	agents = append(agents, NewAPIKeyAuthenticator(keys, model.APIKeyAgent))
+	if cfg.JWT.HMACSecret != "" || cfg.JWT.JWKSFile != "" || cfg.JWT.JWKSURL != "" {
+		jwt, err := NewJWTAuthenticator(cfg.JWT)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, withUserRole(jwt, accounts))
+	}
+	return Middleware(users, agents), nil
+}
@@ -0,0 +1,516 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"pdcplet/pkg/metrics"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signedToken(header map[string]string, claims map[string]interface{}, sign func(signed []byte) []byte) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := b64(h) + "." + b64(c)
+	return signed + "." + b64(sign([]byte(signed)))
+}
+
+func hs256(secret string) func([]byte) []byte {
+	return func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+}
+
+func newTestEngine(t *testing.T, cfg config.AuthConfig, metricsCfg config.MetricsConfig) *gin.Engine {
+	t.Helper()
+	mw, err := NewMiddleware(cfg, metricsCfg, service.NewAPIKeyService(), service.NewUserService())
+	if err != nil {
+		t.Fatalf("new middleware: %v", err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(mw)
+	handler := func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.JSON(http.StatusOK, gin.H{"subject": FromContext(c).Subject, "body": string(body)})
+	}
+	r.GET("/pdcpserver/api/workload/vm", handler)
+	r.POST("/pdcplet/metrics/", handler)
+	r.GET("/pdcplet/nodes/rules", handler)
+	return r
+}
+
+// signShared 以共用的authToken签名请求, 与client.AgentClient一致
+func signShared(req *http.Request, secret string, body string, at time.Time) {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	req.Header.Set(metrics.HEADER_TIMESTAMP, timestamp)
+	req.Header.Set(metrics.HEADER_SIGNATURE,
+		metrics.SignRequest(secret, req.Method, req.URL.Path, req.URL.Query(), timestamp, []byte(body)))
+}
+
+func serve(r *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddlewareAPIKeys(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	if _, err := service.NewUserService().CreateUser(model.UserRequest{Name: "admin", Role: model.RoleAdmin}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	keys := service.NewAPIKeyService()
+	user, err := keys.CreateKey(model.APIKeyRequest{Name: "admin"})
+	if err != nil {
+		t.Fatalf("create user key: %v", err)
+	}
+	agent, err := keys.CreateKey(model.APIKeyRequest{Name: "node1", Kind: model.APIKeyAgent, NodeName: "node1"})
+	if err != nil {
+		t.Fatalf("create agent key: %v", err)
+	}
+	r := newTestEngine(t, config.AuthConfig{Enabled: true},
+		config.MetricsConfig{AuthMode: metrics.AUTH_MODE_HMAC, AuthToken: "shared"})
+
+	req := httptest.NewRequest(http.MethodGet, "/pdcpserver/api/workload/vm", nil)
+	if w := serve(r, req); w.Code != http.StatusUnauthorized {
+		t.Fatalf("no credential: status = %d, want 401", w.Code)
+	}
+	req.Header.Set(HEADER_API_KEY, user.Key)
+	if w := serve(r, req); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"subject":"admin"`) {
+		t.Fatalf("user key: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	req.Header.Set(HEADER_API_KEY, user.Key+"x")
+	if w := serve(r, req); w.Code != http.StatusUnauthorized {
+		t.Fatalf("tampered key: status = %d, want 401", w.Code)
+	}
+	req.Header.Set(HEADER_API_KEY, agent.Key)
+	if w := serve(r, req); w.Code != http.StatusUnauthorized {
+		t.Fatalf("agent key on user route: status = %d, want 401", w.Code)
+	}
+
+	// agent key只能用于所绑定的节点
+	req = httptest.NewRequest(http.MethodPost, "/pdcplet/metrics/", strings.NewReader("{}"))
+	req.Header.Set("Authorization", metrics.BEARER_PREFIX+agent.Key)
+	req.Header.Set(metrics.HEADER_NODE_NAME, "node2")
+	if w := serve(r, req); w.Code != http.StatusUnauthorized {
+		t.Fatalf("agent key of another node: status = %d, want 401", w.Code)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/pdcplet/metrics/", strings.NewReader("{}"))
+	req.Header.Set("Authorization", metrics.BEARER_PREFIX+agent.Key)
+	req.Header.Set(metrics.HEADER_NODE_NAME, "node1")
+	if w := serve(r, req); w.Code != http.StatusOK {
+		t.Fatalf("agent key: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	req = httptest.NewRequest(http.MethodPost, "/pdcplet/metrics/", strings.NewReader("{}"))
+	req.Header.Set(HEADER_API_KEY, user.Key)
+	if w := serve(r, req); w.Code != http.StatusUnauthorized {
+		t.Fatalf("user key on agent route: status = %d, want 401", w.Code)
+	}
+
+	// 共用的authToken签名, 签名校验后handler仍能读取请求体
+	body := `{"node_name":"node3"}`
+	req = httptest.NewRequest(http.MethodPost, "/pdcplet/metrics/", strings.NewReader(body))
+	signShared(req, "shared", body, time.Now())
+	req.Header.Set(metrics.HEADER_NODE_NAME, "node3")
+	w := serve(r, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `node_name`) {
+		t.Fatalf("shared secret: status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	if err := keys.DeleteKey("admin"); err != nil {
+		t.Fatalf("delete key: %v", err)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/pdcpserver/api/workload/vm", nil)
+	req.Header.Set(HEADER_API_KEY, user.Key)
+	if w := serve(r, req); w.Code != http.StatusUnauthorized {
+		t.Fatalf("deleted key: status = %d, want 401", w.Code)
+	}
+}
+
+// TestSharedSecretSignature 签名覆盖方法、路径、查询参数和时间戳, 修改任一部分或超过时间偏差的请求被拒绝
+func TestSharedSecretSignature(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	r := newTestEngine(t, config.AuthConfig{Enabled: true},
+		config.MetricsConfig{AuthMode: metrics.AUTH_MODE_HMAC, AuthToken: "shared", MaxBodySize: 1024})
+	const rulesURL = "/pdcplet/nodes/rules?node_name=node1&version=v1"
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string // POST默认为{}
+		modify func(req *http.Request)
+		at     time.Duration // 签名时间相对当前时间的偏移
+		want   int
+	}{
+		{name: "get", method: http.MethodGet, url: rulesURL, want: http.StatusOK},
+		{name: "post", method: http.MethodPost, url: "/pdcplet/metrics/", want: http.StatusOK},
+		// 签名校验需要读取请求体, 超出metrics.maxBodySize时不读取剩余部分
+		{name: "body too large", method: http.MethodPost, url: "/pdcplet/metrics/", body: strings.Repeat("x", 1025),
+			want: http.StatusRequestEntityTooLarge},
+		{name: "clock skew within limit", method: http.MethodGet, url: rulesURL, at: -time.Minute, want: http.StatusOK},
+		{name: "replayed", method: http.MethodGet, url: rulesURL, at: -2 * metrics.SIGNATURE_MAX_SKEW, want: http.StatusUnauthorized},
+		{name: "from future", method: http.MethodGet, url: rulesURL, at: 2 * metrics.SIGNATURE_MAX_SKEW, want: http.StatusUnauthorized},
+		{name: "no timestamp", method: http.MethodGet, url: rulesURL, want: http.StatusUnauthorized,
+			modify: func(req *http.Request) { req.Header.Del(metrics.HEADER_TIMESTAMP) }},
+		{name: "timestamp changed", method: http.MethodGet, url: rulesURL, want: http.StatusUnauthorized,
+			modify: func(req *http.Request) {
+				req.Header.Set(metrics.HEADER_TIMESTAMP, strconv.FormatInt(time.Now().Unix()+1, 10))
+			}},
+		{name: "query changed", method: http.MethodGet, url: rulesURL, want: http.StatusUnauthorized,
+			modify: func(req *http.Request) { req.URL.RawQuery = "node_name=node2&version=v1" }},
+		{name: "path changed", method: http.MethodPost, url: "/pdcplet/metrics/", want: http.StatusUnauthorized,
+			modify: func(req *http.Request) { req.URL.Path = "/pdcplet/nodes/rules" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := tt.body
+			if tt.method == http.MethodPost && body == "" {
+				body = "{}"
+			}
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(body))
+			signShared(req, "shared", body, time.Now().Add(tt.at))
+			if tt.modify != nil {
+				tt.modify(req)
+			}
+			if w := serve(r, req); w.Code != tt.want {
+				t.Fatalf("status = %d, want %d, body = %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthorizeNamespaces(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	users := service.NewUserService()
+	users.CreateUser(model.UserRequest{Name: "ops", Role: model.RoleOperator, Namespaces: []string{"team-a"}})
+	users.CreateUser(model.UserRequest{Name: "auditor", Role: model.RoleViewer, Namespaces: []string{model.ALL_NAMESPACES}})
+
+	mw, err := NewMiddleware(config.AuthConfig{Enabled: true, JWT: config.JWTConfig{HMACSecret: "secret"}},
+		config.MetricsConfig{}, service.NewAPIKeyService(), users)
+	if err != nil {
+		t.Fatalf("new middleware: %v", err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(mw)
+	r.POST("/vm/:namespace", func(c *gin.Context) {
+		if Authorize(c, ActionWrite, c.Param("namespace")) {
+			c.JSON(http.StatusOK, gin.H{"namespaces": VisibleNamespaces(c)})
+		}
+	})
+	r.GET("/vm/:namespace", func(c *gin.Context) {
+		if Authorize(c, ActionRead, c.Param("namespace")) {
+			c.JSON(http.StatusOK, gin.H{"namespaces": VisibleNamespaces(c)})
+		}
+	})
+	r.POST("/templates", Require(ActionAdmin), func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	token := func(sub string) string {
+		claims := map[string]interface{}{"sub": sub, "exp": time.Now().Add(time.Hour).Unix()}
+		return signedToken(map[string]string{"alg": "HS256"}, claims, hs256("secret"))
+	}
+	cases := []struct {
+		subject, method, path string
+		want                  int
+	}{
+		{"ops", http.MethodPost, "/vm/team-a", http.StatusOK},
+		{"ops", http.MethodPost, "/vm/team-b", http.StatusForbidden},
+		{"ops", http.MethodGet, "/vm/team-b", http.StatusForbidden},
+		{"ops", http.MethodPost, "/templates", http.StatusForbidden},
+		{"auditor", http.MethodGet, "/vm/team-b", http.StatusOK},
+		{"auditor", http.MethodPost, "/vm/team-b", http.StatusForbidden},
+		{"stranger", http.MethodGet, "/vm/team-a", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Authorization", metrics.BEARER_PREFIX+token(tc.subject))
+		if w := serve(r, req); w.Code != tc.want {
+			t.Fatalf("%s %s %s: status = %d, want %d, body = %s", tc.subject, tc.method, tc.path, w.Code, tc.want, w.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/vm/team-a", nil)
+	req.Header.Set("Authorization", metrics.BEARER_PREFIX+token("ops"))
+	if w := serve(r, req); !strings.Contains(w.Body.String(), `"namespaces":["team-a"]`) {
+		t.Fatalf("visible namespaces of ops: %s", w.Body.String())
+	}
+}
+
+func TestAuthorizeNode(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	keys := service.NewAPIKeyService()
+	bound, err := keys.CreateKey(model.APIKeyRequest{Name: "node1", Kind: model.APIKeyAgent, NodeName: "node1"})
+	if err != nil {
+		t.Fatalf("create bound key: %v", err)
+	}
+	unbound, err := keys.CreateKey(model.APIKeyRequest{Name: "fleet", Kind: model.APIKeyAgent})
+	if err != nil {
+		t.Fatalf("create unbound key: %v", err)
+	}
+	mw, err := NewMiddleware(config.AuthConfig{Enabled: true},
+		config.MetricsConfig{AuthMode: metrics.AUTH_MODE_HMAC, AuthToken: "shared"}, keys, service.NewUserService())
+	if err != nil {
+		t.Fatalf("new middleware: %v", err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(mw)
+	r.POST("/pdcplet/nodes/register", func(c *gin.Context) {
+		var reg struct {
+			NodeName string `json:"node_name"`
+		}
+		c.ShouldBindJSON(&reg)
+		if AuthorizeNode(c, reg.NodeName) {
+			c.JSON(http.StatusOK, gin.H{"subject": FromContext(c).Subject})
+		}
+	})
+
+	cases := []struct {
+		name, key, header, node string
+		want                    int
+	}{
+		{"bound key as its node", bound.Key, "", "node1", http.StatusOK},
+		{"bound key as another node", bound.Key, "", "node2", http.StatusForbidden},
+		{"bound key with forged header", bound.Key, "node2", "node2", http.StatusUnauthorized},
+		{"unbound key", unbound.Key, "", "node2", http.StatusOK},
+		{"shared secret", "", "node1", "node2", http.StatusOK},
+	}
+	for _, tc := range cases {
+		body := `{"node_name":"` + tc.node + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/pdcplet/nodes/register", strings.NewReader(body))
+		if tc.key != "" {
+			req.Header.Set(HEADER_API_KEY, tc.key)
+		} else {
+			signShared(req, "shared", body, time.Now())
+		}
+		if tc.header != "" {
+			req.Header.Set(metrics.HEADER_NODE_NAME, tc.header)
+		}
+		w := serve(r, req)
+		if w.Code != tc.want {
+			t.Fatalf("%s: status = %d, want %d, body = %s", tc.name, w.Code, tc.want, w.Body.String())
+		}
+		// 共用authToken的调用方不以X-Pdcp-Node作为身份
+		if tc.key == "" && !strings.Contains(w.Body.String(), `"subject":"`+SHARED_AGENT_SUBJECT+`"`) {
+			t.Fatalf("%s: body = %s", tc.name, w.Body.String())
+		}
+	}
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa1", "alg": "RS256", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))),
+			"y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+	}})
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, jwks, 0600); err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+
+	a, err := NewJWTAuthenticator(config.JWTConfig{HMACSecret: "secret", JWKSFile: jwksFile, Issuer: "idp", Audience: "pdcpserver"})
+	if err != nil {
+		t.Fatalf("new jwt authenticator: %v", err)
+	}
+	verifier := a.(*jwtAuthenticator)
+	now := time.Now()
+	claims := map[string]interface{}{"sub": "alice", "iss": "idp", "aud": []string{"pdcpserver"}, "exp": now.Add(time.Hour).Unix()}
+
+	rs256 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		return sig
+	}
+	es256 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		r, s, _ := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+
+	valid := map[string]string{
+		"HS256": signedToken(map[string]string{"alg": "HS256"}, claims, hs256("secret")),
+		"RS256": signedToken(map[string]string{"alg": "RS256", "kid": "rsa1"}, claims, rs256),
+		"ES256": signedToken(map[string]string{"alg": "ES256", "kid": "ec1"}, claims, es256),
+	}
+	for alg, token := range valid {
+		if c, err := verifier.verify(token, now); err != nil || c.Subject != "alice" {
+			t.Fatalf("%s: claims = %+v, err = %v", alg, c, err)
+		}
+	}
+
+	expired := map[string]interface{}{"sub": "alice", "iss": "idp", "aud": "pdcpserver", "exp": now.Add(-time.Hour).Unix()}
+	otherAud := map[string]interface{}{"sub": "alice", "iss": "idp", "aud": "other", "exp": now.Add(time.Hour).Unix()}
+	invalid := map[string]string{
+		"wrong secret":  signedToken(map[string]string{"alg": "HS256"}, claims, hs256("other")),
+		"alg none":      signedToken(map[string]string{"alg": "none"}, claims, func([]byte) []byte { return nil }),
+		"alg mismatch":  signedToken(map[string]string{"alg": "RS512", "kid": "rsa1"}, claims, rs256),
+		"unknown kid":   signedToken(map[string]string{"alg": "RS256", "kid": "rsa2"}, claims, rs256),
+		"expired":       signedToken(map[string]string{"alg": "HS256"}, expired, hs256("secret")),
+		"wrong aud":     signedToken(map[string]string{"alg": "HS256"}, otherAud, hs256("secret")),
+		"ec key as rsa": signedToken(map[string]string{"alg": "RS256", "kid": "ec1"}, claims, rs256),
+	}
+	for name, token := range invalid {
+		if _, err := verifier.verify(token, now); err == nil {
+			t.Fatalf("%s: want error", name)
+		}
+	}
+}
+
+// jwksURL单独配置时同样启用JWT认证
+func TestMiddlewareJWKSURL(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa1", "alg": "RS256", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+	}})
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jwks)
+	}))
+	defer idp.Close()
+
+	r := newTestEngine(t, config.AuthConfig{Enabled: true, JWT: config.JWTConfig{JWKSURL: idp.URL, Issuer: "idp"}},
+		config.MetricsConfig{})
+	rs256 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		sig, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		return sig
+	}
+	claims := map[string]interface{}{"sub": "alice", "iss": "idp", "exp": time.Now().Add(time.Hour).Unix()}
+
+	req := httptest.NewRequest(http.MethodGet, "/pdcpserver/api/workload/vm", nil)
+	req.Header.Set("Authorization", metrics.BEARER_PREFIX+signedToken(map[string]string{"alg": "RS256", "kid": "rsa1"}, claims, rs256))
+	if w := serve(r, req); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"subject":"alice"`) {
+		t.Fatalf("jwks token: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	req.Header.Set("Authorization", metrics.BEARER_PREFIX+signedToken(map[string]string{"alg": "HS256"}, claims, hs256("secret")))
+	if w := serve(r, req); w.Code != http.StatusUnauthorized {
+		t.Fatalf("hmac token without hmacSecret: status = %d, want 401", w.Code)
+	}
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	service.NewUserService().CreateUser(model.UserRequest{Name: "ops", Role: model.RoleOperator, Namespaces: []string{"team-a"}})
+	mw, err := NewMiddleware(config.AuthConfig{Enabled: true, JWT: config.JWTConfig{HMACSecret: "secret"}},
+		config.MetricsConfig{}, service.NewAPIKeyService(), service.NewUserService())
+	if err != nil {
+		t.Fatalf("new middleware: %v", err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	audits := service.NewAuditService()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		audits.Run(ctx)
+		close(done)
+	}()
+	r.Use(AuditMiddleware(audits), mw)
+	handler := func(c *gin.Context) {
+		var req struct {
+			Namespace string `json:"namespace"`
+		}
+		c.ShouldBindJSON(&req)
+		if Authorize(c, ActionWrite, req.Namespace) {
+			c.JSON(http.StatusAccepted, gin.H{})
+		}
+	}
+	r.POST("/vm/create", handler)
+	r.GET("/vm", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{}) })
+
+	token := signedToken(map[string]string{"alg": "HS256"},
+		map[string]interface{}{"sub": "ops", "exp": time.Now().Add(time.Hour).Unix()}, hs256("secret"))
+	send := func(method string, path string, body string, authorized bool) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if authorized {
+			req.Header.Set("Authorization", metrics.BEARER_PREFIX+token)
+		}
+		serve(r, req)
+	}
+	send(http.MethodPost, "/vm/create", `{"name":"vm1","namespace":"team-a"}`, true)
+	send(http.MethodPost, "/vm/create", `{"name":"vm2","namespace":"team-b"}`, true)
+	send(http.MethodPost, "/vm/create", `{"name":"vm3","namespace":"team-a"}`, false)
+	// 只读请求只在被拒绝时记录
+	send(http.MethodGet, "/vm", "", true)
+	send(http.MethodGet, "/vm", "", false)
+	// 超出MAX_AUDIT_BODY的请求体在认证前被拒绝
+	send(http.MethodPost, "/vm/create", `{"name":"`+strings.Repeat("a", MAX_AUDIT_BODY)+`"}`, true)
+	cancel()
+	<-done
+
+	var events []model.AuditEvent
+	database.DB.Order("id asc").Find(&events)
+	if len(events) != 5 {
+		t.Fatalf("audit events = %d, want 5: %+v", len(events), events)
+	}
+	want := []struct {
+		actor, name, result string
+		status              int
+	}{
+		{"ops", "vm1", model.AuditResultSuccess, http.StatusAccepted},
+		{"ops", "vm2", model.AuditResultDenied, http.StatusForbidden},
+		{ANONYMOUS_ACTOR, "vm3", model.AuditResultDenied, http.StatusUnauthorized},
+		{ANONYMOUS_ACTOR, "", model.AuditResultDenied, http.StatusUnauthorized},
+		{ANONYMOUS_ACTOR, "", model.AuditResultFailure, http.StatusRequestEntityTooLarge},
+	}
+	for i, w := range want {
+		got := events[i]
+		if got.Actor != w.actor || got.TargetName != w.name || got.Result != w.result || got.StatusCode != w.status {
+			t.Errorf("event %d = %+v, want %+v", i, got, w)
+		}
+	}
+	sum := sha256.Sum256([]byte(`{"name":"vm1","namespace":"team-a"}`))
+	if events[0].Action != "POST /vm/create" || events[0].TargetNamespace != "team-a" ||
+		events[0].PayloadHash != hex.EncodeToString(sum[:]) || events[0].AuthMethod != MethodJWT {
+		t.Errorf("unexpected first event: %+v", events[0])
+	}
+	if !strings.Contains(events[1].Error, `namespace "team-b"`) {
+		t.Errorf("denied event error = %q", events[1].Error)
+	}
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const DEFAULT_JWT_LEEWAY = time.Minute
+
+var (
+	hmacMethods       = []string{"HS256", "HS384", "HS512"}
+	publicKeyMethods  = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+	errJWKSNotEnabled = errors.New("jwks is not configured")
+)
+
+// jwtAuthenticator 校验Bearer中的JWT, HS*使用hmacSecret, RS*/PS*/ES*使用JWKS中的公钥.
+// 签名和exp/nbf/iss/aud由golang-jwt校验, 这里只将sub映射为用户
+type jwtAuthenticator struct {
+	cfg    config.JWTConfig
+	parser *jwt.Parser
+	jwks   jwt.Keyfunc // 未配置JWKS时为nil
+}
+
+func NewJWTAuthenticator(cfg config.JWTConfig) (Authenticator, error) {
+	if cfg.HMACSecret == "" && cfg.JWKSFile == "" && cfg.JWKSURL == "" {
+		return nil, errors.New("jwt requires hmacSecret, jwksFile or jwksURL")
+	}
+	if cfg.JWKSFile != "" && cfg.JWKSURL != "" {
+		return nil, errors.New("jwksFile and jwksURL are mutually exclusive")
+	}
+	if cfg.Leeway <= 0 {
+		cfg.Leeway = DEFAULT_JWT_LEEWAY
+	}
+
+	a := &jwtAuthenticator{cfg: cfg}
+	var methods []string
+	if cfg.HMACSecret != "" {
+		methods = append(methods, hmacMethods...)
+	}
+	switch {
+	case cfg.JWKSFile != "":
+		jwks := &jwksFile{path: cfg.JWKSFile}
+		if _, err := jwks.reload(); err != nil {
+			return nil, err
+		}
+		a.jwks = jwks.keyfunc
+	case cfg.JWKSURL != "":
+		// keyfunc在后台定期刷新JWKS, 遇到未知kid时也会刷新
+		jwks, err := keyfunc.NewDefault([]string{cfg.JWKSURL})
+		if err != nil {
+			return nil, fmt.Errorf("load jwks from %s: %w", cfg.JWKSURL, err)
+		}
+		a.jwks = jwks.Keyfunc
+	}
+	if a.jwks != nil {
+		methods = append(methods, publicKeyMethods...)
+	}
+
+	opts := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithLeeway(cfg.Leeway), jwt.WithExpirationRequired()}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	a.parser = jwt.NewParser(opts...)
+	return a, nil
+}
+
+func (a *jwtAuthenticator) Authenticate(c *gin.Context) (*Principal, error) {
+	token, ok := bearerToken(c)
+	if !ok || strings.HasPrefix(token, service.API_KEY_PREFIX) || strings.Count(token, ".") != 2 {
+		return nil, nil
+	}
+	claims, err := a.verify(token, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", service.ErrInvalidCredential, err)
+	}
+	return &Principal{Subject: claims.Subject, Kind: model.APIKeyUser, Method: MethodJWT}, nil
+}
+
+func (a *jwtAuthenticator) verify(token string, now time.Time) (*jwt.RegisteredClaims, error) {
+	var claims jwt.RegisteredClaims
+	parser := *a.parser
+	jwt.WithTimeFunc(func() time.Time { return now })(&parser)
+	if _, err := parser.ParseWithClaims(token, &claims, a.keyfunc); err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("jwt has no sub")
+	}
+	return &claims, nil
+}
+
+// keyfunc HMAC算法使用hmacSecret, 其余算法按kid从JWKS中查找公钥. 算法与密钥类型不匹配时由golang-jwt拒绝
+func (a *jwtAuthenticator) keyfunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		return []byte(a.cfg.HMACSecret), nil
+	}
+	if a.jwks == nil {
+		return nil, errJWKSNotEnabled
+	}
+	return a.jwks(token)
+}
+
+// jwksFile 从文件加载的JWKS, 找不到kid且文件修改时间变化时重新加载
+type jwksFile struct {
+	path string
+
+	mu      sync.Mutex
+	keys    keyfunc.Keyfunc
+	modTime time.Time
+}
+
+func (f *jwksFile) keyfunc(token *jwt.Token) (interface{}, error) {
+	f.mu.Lock()
+	keys := f.keys
+	f.mu.Unlock()
+
+	key, err := keys.Keyfunc(token)
+	if err == nil {
+		return key, nil
+	}
+	if reloaded, reloadErr := f.reload(); reloadErr != nil || !reloaded {
+		return nil, err
+	}
+	f.mu.Lock()
+	keys = f.keys
+	f.mu.Unlock()
+	return keys.Keyfunc(token)
+}
+
+// reload 文件修改时间变化时重新加载, 返回是否重新加载
+func (f *jwksFile) reload() (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, fmt.Errorf("stat jwks file: %w", err)
+	}
+	if f.keys != nil && info.ModTime().Equal(f.modTime) {
+		return false, nil
+	}
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return false, fmt.Errorf("read jwks file: %w", err)
+	}
+	keys, err := keyfunc.NewJWKSetJSON(b)
+	if err != nil {
+		return false, fmt.Errorf("parse jwks file %s: %w", f.path, err)
+	}
+	// 校验文件中的公钥都可以读取, 避免请求时才发现格式错误
+	if _, err := keys.Storage().KeyReadAll(context.Background()); err != nil {
+		return false, fmt.Errorf("parse jwks file %s: %w", f.path, err)
+	}
+	f.keys = keys
+	f.modTime = info.ModTime()
+	return true, nil
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"pdcplet/pkg/agent"
+	"pdcplet/pkg/metrics"
+
+	"resty.dev/v3"
+)
+
+// AgentClient pdcplet访问pdcpserver的客户端, restclient的BaseURL为pdcplet路由的前缀, 如https://pdcpserver:8080/pdcplet.
+// 按authMode以bearer token或请求的HMAC签名认证
+type AgentClient struct {
+	restclient *resty.Client
+	nodeName   string
+	authMode   string
+	authToken  string
+}
+
+func NewAgentClient(restclient *resty.Client, nodeName, authMode, authToken string) *AgentClient {
+	return &AgentClient{
+		restclient: restclient,
+		nodeName:   nodeName,
+		authMode:   authMode,
+		authToken:  authToken,
+	}
+}
+
+func (c *AgentClient) NodeName() string {
+	return c.nodeName
+}
+
+// request 创建携带节点名和凭据的请求, HMAC签名的内容为方法、完整路径、查询参数、当前时间和body
+func (c *AgentClient) request(method, route string, query url.Values, body []byte) (*resty.Request, error) {
+	req := c.restclient.R().SetHeader(metrics.HEADER_NODE_NAME, c.nodeName).SetQueryParamsFromValues(query)
+	if c.authToken == "" {
+		return req, nil
+	}
+	switch c.authMode {
+	case metrics.AUTH_MODE_BEARER:
+		req.SetHeader("Authorization", metrics.BEARER_PREFIX+c.authToken)
+	default:
+		// 与resty相同, 相对路由拼接在BaseURL之后
+		u, err := url.Parse(c.restclient.BaseURL() + route)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s failed: %w", method, route, err)
+		}
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.SetHeader(metrics.HEADER_TIMESTAMP, timestamp).
+			SetHeader(metrics.HEADER_SIGNATURE, metrics.SignRequest(c.authToken, method, u.Path, query, timestamp, body))
+	}
+	return req, nil
+}
+
+// post 发送JSON请求体, 签名的内容与发送的内容一致
+func (c *AgentClient) post(route string, payload, result interface{}, expect int) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := c.request(http.MethodPost, route, nil, body)
+	if err != nil {
+		return err
+	}
+	req.SetHeader("Content-Type", "application/json").SetBody(body)
+	if result != nil {
+		req.SetResult(result)
+	}
+	return c.execute(req, http.MethodPost, route, expect)
+}
+
+func (c *AgentClient) execute(req *resty.Request, method, route string, expect int) error {
+	resp, err := req.Execute(method, route)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, route, err)
+	}
+	if resp.StatusCode() != expect {
+		return newError(method, route, resp.StatusCode(), resp.Bytes())
+	}
+	return nil
+}
+
+// Register 注册节点, 节点已注册时更新会话
+func (c *AgentClient) Register(reg agent.Registration) (*agent.Ack, error) {
+	var ack agent.Ack
+	if err := c.post(agent.REGISTER_ROUTE, reg, &ack, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &ack, nil
+}
+
+// Heartbeat 发送心跳, 节点未注册或会话已失效时返回404
+func (c *AgentClient) Heartbeat(hb agent.Heartbeat) (*agent.Ack, error) {
+	var ack agent.Ack
+	if err := c.post(agent.HEARTBEAT_ROUTE, hb, &ack, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &ack, nil
+}
+
+func (c *AgentClient) ReportEvents(events agent.NodeEvents) (*agent.Ack, error) {
+	var ack agent.Ack
+	if err := c.post(agent.EVENTS_ROUTE, events, &ack, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &ack, nil
+}
+
+// GetRuleSet 拉取本节点的规则集, 版本与version相同时返回nil
+func (c *AgentClient) GetRuleSet(version string) (*agent.RuleSet, error) {
+	var set agent.RuleSet
+	query := url.Values{"node_name": {c.nodeName}, "version": {version}}
+	req, err := c.request(http.MethodGet, agent.RULES_ROUTE, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := req.SetResult(&set).Get(agent.RULES_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", http.MethodGet, agent.RULES_ROUTE, err)
+	}
+	switch resp.StatusCode() {
+	case http.StatusOK:
+		return &set, nil
+	case http.StatusNotModified:
+		return nil, nil
+	default:
+		return nil, newError(http.MethodGet, agent.RULES_ROUTE, resp.StatusCode(), resp.Bytes())
+	}
+}
+
+func (c *AgentClient) ReportRuleStatus(status agent.RuleSetStatus) error {
+	return c.post(agent.RULES_STATUS_ROUTE, status, nil, http.StatusNoContent)
+}
+
+// UploadMetrics 压缩上报指标, 签名的内容为压缩后的请求体
+func (c *AgentClient) UploadMetrics(upload metrics.Upload) (*metrics.Ack, error) {
+	body, err := metrics.Encode(upload)
+	if err != nil {
+		return nil, err
+	}
+	var ack metrics.Ack
+	req, err := c.request(http.MethodPost, metrics.UPLOAD_METRICS_ROUTE, nil, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetHeader("Content-Encoding", metrics.CONTENT_ENCODING).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body).
+		SetResult(&ack)
+	if err := c.execute(req, http.MethodPost, metrics.UPLOAD_METRICS_ROUTE, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &ack, nil
+}
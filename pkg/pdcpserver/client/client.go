@@ -0,0 +1,211 @@
+// Package client pdcpserver REST API的Go客户端, 请求和响应使用model包中的类型.
+// Client访问/pdcpserver/api下的用户API, AgentClient访问/pdcplet下的pdcplet API
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"pdcplet/pkg/metrics"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/openapi"
+
+	"resty.dev/v3"
+)
+
+const (
+	API_PREFIX      = "/pdcpserver/api"
+	DEFAULT_TIMEOUT = 30 * time.Second
+	HEADER_API_KEY  = "X-API-Key"
+	MAX_ERROR_BODY  = 64 * 1024 // 读取错误响应体的上限
+)
+
+// Error pdcpserver返回的非预期响应, Code、Details和RequestID取自model.ErrorResponse
+type Error struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Code       model.ErrorCode
+	Message    string
+	Details    []model.ErrorDetail
+	RequestID  string
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s %s failed, status: %d, error: %s", e.Method, e.Path, e.StatusCode, e.Message)
+	for _, detail := range e.Details {
+		msg += fmt.Sprintf("; %s: %s", detail.Field, detail.Message)
+	}
+	if e.RequestID != "" {
+		msg += ", request id: " + e.RequestID
+	}
+	return msg
+}
+
+// StatusCode 返回err对应的HTTP响应码, err不是*Error时返回0
+func StatusCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// newError 从model.ErrorResponse响应体中取出错误信息, 响应体不是该格式时使用原文
+func newError(method, path string, statusCode int, body []byte) *Error {
+	apiErr := &Error{Method: method, Path: path, StatusCode: statusCode}
+	var resp model.ErrorResponse
+	if err := json.Unmarshal(body, &resp); err == nil && resp.Message != "" {
+		apiErr.Code, apiErr.Message, apiErr.Details, apiErr.RequestID = resp.Code, resp.Message, resp.Details, resp.RequestID
+	} else {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(statusCode)
+	}
+	return apiErr
+}
+
+// Client pdcpserver用户API的客户端
+type Client struct {
+	rest   *resty.Client
+	stream *http.Client // 事件流和审计导出等长连接不设置超时
+
+	baseURL string
+	apiKey  string
+	token   string
+}
+
+type Option func(*Client)
+
+// WithAPIKey 以X-API-Key头携带API Key
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithBearerToken 以Authorization头携带JWT或API Key
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.rest.SetTimeout(timeout)
+	}
+}
+
+// WithCAFile 使用指定的CA证书校验pdcpserver的证书
+func WithCAFile(caFile string) Option {
+	return func(c *Client) {
+		c.rest.SetRootCertificates(caFile)
+	}
+}
+
+func WithInsecureSkipVerify() Option {
+	return func(c *Client) {
+		c.rest.SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true})
+	}
+}
+
+// New 创建客户端, baseURL为pdcpserver的根地址, 如https://pdcpserver:8080
+func New(baseURL string, opts ...Option) *Client {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	c := &Client{
+		rest:    resty.New().SetBaseURL(baseURL).SetTimeout(DEFAULT_TIMEOUT),
+		baseURL: baseURL,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.apiKey != "" {
+		c.rest.SetHeader(HEADER_API_KEY, c.apiKey)
+	}
+	if c.token != "" {
+		c.rest.SetHeader("Authorization", metrics.BEARER_PREFIX+c.token)
+	}
+	c.stream = &http.Client{Transport: c.rest.Client().Transport}
+	return c
+}
+
+// do 发送请求, 响应码不是expect时返回*Error
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, result interface{}, expect int) error {
+	req := c.rest.R().SetContext(ctx)
+	if query != nil {
+		req.SetQueryParamsFromValues(query)
+	}
+	if body != nil {
+		req.SetBody(body)
+	}
+	if result != nil {
+		req.SetResult(result)
+	}
+	resp, err := req.Execute(method, path)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	if resp.StatusCode() != expect {
+		return newError(method, path, resp.StatusCode(), resp.Bytes())
+	}
+	return nil
+}
+
+// openStream 发送GET请求并返回未读取的响应, 调用方负责关闭Body
+func (c *Client) openStream(ctx context.Context, path string, query url.Values, header http.Header) (*http.Response, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if c.apiKey != "" {
+		req.Header.Set(HEADER_API_KEY, c.apiKey)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", metrics.BEARER_PREFIX+c.token)
+	}
+
+	resp, err := c.stream.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GET %s failed: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, MAX_ERROR_BODY))
+		return nil, newError(http.MethodGet, path, resp.StatusCode, body)
+	}
+	return resp, nil
+}
+
+// OpenAPI 返回pdcpserver的OpenAPI文档
+func (c *Client) OpenAPI(ctx context.Context) (*openapi.Document, error) {
+	var doc openapi.Document
+	if err := c.do(ctx, http.MethodGet, API_PREFIX+"/openapi.json", nil, nil, &doc, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func escape(name string) string {
+	return url.PathEscape(name)
+}
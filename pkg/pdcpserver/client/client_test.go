@@ -0,0 +1,204 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"pdcplet/pkg/agent"
+	"pdcplet/pkg/metrics"
+	"pdcplet/pkg/pdcpserver"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"resty.dev/v3"
+)
+
+// newTestServer 启动未开启认证的pdcpserver
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	s := pdcpserver.New("127.0.0.1", 0, config.DBConfig{TypeStr: database.TYPE_SQLITE3,
+		Sqlite3: config.SQLiteConfig{Database: filepath.Join(t.TempDir(), "pdcpserver.db")}},
+		pdcpserver.WithWebhooksConfig(config.WebhooksConfig{SecretKey: "test-secret-key"}))
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestQueryValues(t *testing.T) {
+	vid := int64(0)
+	from := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		req  interface{}
+		want url.Values
+	}{
+		{model.VMListRequest{Namespace: "ns1", CreatedAfter: from, Limit: 10, Live: true, Namespaces: []string{"ns2"}},
+			url.Values{"namespace": {"ns1"}, "createdAfter": {"2026-01-02T03:04:05Z"}, "limit": {"10"}, "live": {"true"}}},
+		{model.EventStreamRequest{Types: []model.EventType{model.EventVMStatus, model.EventAlert}},
+			url.Values{"type": {string(model.EventVMStatus), string(model.EventAlert)}}},
+		{model.MetricsQueryRequest{Metric: "sent", Vid: &vid}, url.Values{"metric": {"sent"}, "vid": {"0"}}},
+		{model.VMOperationRequest{Name: "vm1"}, url.Values{}},
+	}
+	for _, c := range cases {
+		if got := queryValues(c.req); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("queryValues(%+v) = %v, want %v", c.req, got, c.want)
+		}
+	}
+}
+
+func TestClientRoundTrip(t *testing.T) {
+	srv := newTestServer(t)
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	doc, err := c.OpenAPI(ctx)
+	if err != nil {
+		t.Fatalf("openapi: %v", err)
+	}
+	if doc.Paths["/pdcpserver/api/templates/{name}"]["put"] == nil {
+		t.Fatalf("update template missing from document")
+	}
+
+	tpl := model.VMTemplateRequest{Name: "small", CPU: 1, Memory: "1Gi",
+		Disks: []model.DiskSpec{{Name: "root", Image: "quay.io/containerdisks/fedora:latest"}}}
+	if _, err := c.CreateTemplate(ctx, tpl); err != nil {
+		t.Fatalf("create template: %v", err)
+	}
+	if _, err := c.CreateTemplate(ctx, tpl); StatusCode(err) != http.StatusConflict {
+		t.Fatalf("duplicate template: err = %v, want 409", err)
+	}
+	tpl.CPU = 2
+	if info, err := c.UpdateTemplate(ctx, "small", tpl); err != nil || info.CPU != 2 {
+		t.Fatalf("update template: %+v, %v", info, err)
+	}
+	if list, err := c.ListTemplates(ctx); err != nil || len(list.Items) != 1 {
+		t.Fatalf("list templates: %+v, %v", list, err)
+	}
+	if err := c.DeleteTemplate(ctx, "small"); err != nil {
+		t.Fatalf("delete template: %v", err)
+	}
+	_, err = c.GetTemplate(ctx, "small")
+	var apiErr *Error
+	if !IsNotFound(err) || !errors.As(err, &apiErr) || apiErr.Message == "" {
+		t.Fatalf("get deleted template: err = %v, want 404 with message", err)
+	}
+	if apiErr.Code != model.ErrorNotFound || apiErr.RequestID == "" {
+		t.Fatalf("get deleted template: code %q, request id %q", apiErr.Code, apiErr.RequestID)
+	}
+	_, err = c.CreateVM(ctx, model.VMCreateRequest{Name: "vm1", Namespace: "default", CPU: 1, Memory: "2GB", Image: "cirros"})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest ||
+		len(apiErr.Details) != 1 || apiErr.Details[0].Field != "memory" {
+		t.Fatalf("create vm with invalid memory: err = %v, want 400 with memory detail", err)
+	}
+
+	if _, err := c.CreateRule(ctx, model.RuleRequest{Name: "http", Protocol: "http"}); err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+	if _, err := c.CreateUser(ctx, model.UserRequest{Name: "alice", Role: model.RoleViewer, Namespaces: []string{"ns1"}}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	key, err := c.CreateAPIKey(ctx, model.APIKeyRequest{Name: "alice"})
+	if err != nil || key.Key == "" {
+		t.Fatalf("create api key: %+v, %v", key, err)
+	}
+	hook, err := c.CreateWebhook(ctx, model.WebhookRequest{Name: "hook", URL: "http://127.0.0.1:1"})
+	if err != nil || hook.Secret == "" {
+		t.Fatalf("create webhook: %+v, %v", hook, err)
+	}
+	if _, err := c.ListWebhookDeliveries(ctx, "hook", model.WebhookDeliveryQuery{Status: model.DeliveryPending}); err != nil {
+		t.Fatalf("list deliveries: %v", err)
+	}
+	if _, err := c.GetVM(ctx, "missing", "default"); !IsNotFound(err) {
+		t.Fatalf("get missing vm: err = %v, want 404", err)
+	}
+	if _, err := c.ListAuditEvents(ctx, model.AuditQueryRequest{Result: "bogus"}); StatusCode(err) != http.StatusBadRequest {
+		t.Fatalf("invalid audit query: err = %v, want 400", err)
+	}
+	// 审计记录异步写入
+	var export strings.Builder
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		export.Reset()
+		if err := c.ExportAuditEvents(ctx, model.AuditQueryRequest{Action: "POST /pdcpserver/api/users"}, &export); err != nil {
+			t.Fatalf("export audit: %v", err)
+		}
+		if strings.Contains(export.String(), `"alice"`) {
+			break
+		}
+	}
+	if !strings.Contains(export.String(), `"alice"`) {
+		t.Fatalf("exported audit events do not include the user creation: %s", export.String())
+	}
+}
+
+func TestAgentClient(t *testing.T) {
+	srv := newTestServer(t)
+	restclient := resty.New().SetBaseURL(srv.URL + "/pdcplet")
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	node1 := NewAgentClient(restclient, "node1", metrics.AUTH_MODE_HMAC, "")
+	if ack, err := node1.Register(agent.Registration{NodeName: "node1", SessionId: "s1"}); err != nil || ack.SessionId != "s1" {
+		t.Fatalf("register: %+v, %v", ack, err)
+	}
+	if _, err := node1.Heartbeat(agent.Heartbeat{NodeName: "node1", SessionId: "old"}); !IsNotFound(err) {
+		t.Fatalf("heartbeat with old session: err = %v, want 404", err)
+	}
+	if _, err := node1.Heartbeat(agent.Heartbeat{NodeName: "node1", SessionId: "s1"}); err != nil {
+		t.Fatalf("heartbeat: %v", err)
+	}
+
+	set, err := node1.GetRuleSet("")
+	if err != nil || set == nil {
+		t.Fatalf("get rule set: %+v, %v", set, err)
+	}
+	if unchanged, err := node1.GetRuleSet(set.Version); err != nil || unchanged != nil {
+		t.Fatalf("get unchanged rule set: %+v, %v", unchanged, err)
+	}
+	if err := node1.ReportRuleStatus(agent.RuleSetStatus{NodeName: "node1", AppliedVersion: set.Version}); err != nil {
+		t.Fatalf("report rule status: %v", err)
+	}
+
+	ack, err := node1.UploadMetrics(metrics.Upload{Envelopes: []metrics.Envelope{
+		{NodeName: "node1", SessionId: "m1", Sequence: 1, CollectedAt: time.Now()},
+	}})
+	if err != nil || ack.SessionId != "m1" || ack.AckedSequence != 1 {
+		t.Fatalf("upload metrics: %+v, %v", ack, err)
+	}
+
+	nodes, err := c.ListNodes(ctx, model.NodeListRequest{})
+	if err != nil || len(nodes.Items) != 1 || nodes.Items[0].AppliedRuleVersion != set.Version {
+		t.Fatalf("list nodes: %+v, %v", nodes, err)
+	}
+
+	// 从第一条事件之后续传, Backlog中包含node2的上线事件
+	if _, err := NewAgentClient(restclient, "node2", metrics.AUTH_MODE_HMAC, "").
+		Register(agent.Registration{NodeName: "node2", SessionId: "s2"}); err != nil {
+		t.Fatalf("register node2: %v", err)
+	}
+	streamCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var received []model.EventInfo
+	err = c.StreamEvents(streamCtx, model.EventStreamRequest{Types: []model.EventType{model.EventNodeOnline}}, 1,
+		func(info model.EventInfo) error {
+			received = append(received, info)
+			if info.NodeName == "node2" {
+				return ErrStopStream
+			}
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("stream events: %v", err)
+	}
+	if len(received) != 1 || received[0].ID <= 1 || received[0].Type != model.EventNodeOnline {
+		t.Fatalf("unexpected events: %+v", received)
+	}
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pdcplet/pkg/pdcpserver/model"
+)
+
+const (
+	AUDIT_PATH  = API_PREFIX + "/audit"
+	EVENTS_PATH = API_PREFIX + "/events/stream"
+)
+
+// ErrStopStream EventHandler返回该错误时StreamEvents停止接收并返回nil
+var ErrStopStream = errors.New("stop event stream")
+
+// EventHandler 处理事件流中的一条事件
+type EventHandler func(info model.EventInfo) error
+
+func (c *Client) ListAuditEvents(ctx context.Context, req model.AuditQueryRequest) (*model.AuditListResponse, error) {
+	var resp model.AuditListResponse
+	if err := c.do(ctx, http.MethodGet, AUDIT_PATH, queryValues(req), nil, &resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ExportAuditEvents 将符合条件的审计事件以JSON Lines写入w
+func (c *Client) ExportAuditEvents(ctx context.Context, req model.AuditQueryRequest, w io.Writer) error {
+	resp, err := c.openStream(ctx, AUDIT_PATH+"/export", queryValues(req), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// StreamEvents 订阅事件流, 对每条事件调用handler, lastEventID不为0时从该事件之后续传.
+// 服务端关闭连接时返回nil, 调用方可以使用最后收到的事件ID重连
+func (c *Client) StreamEvents(ctx context.Context, req model.EventStreamRequest, lastEventID uint, handler EventHandler) error {
+	header := http.Header{"Accept": {"text/event-stream"}}
+	if lastEventID != 0 {
+		header.Set("Last-Event-ID", strconv.FormatUint(uint64(lastEventID), 10))
+	}
+	resp, err := c.openStream(ctx, EVENTS_PATH, queryValues(req), header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = readEvents(resp.Body, handler)
+	if errors.Is(err, ErrStopStream) {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// readEvents 解析Server-Sent Events, 忽略注释行和id/event字段, 事件内容取自data字段
+func readEvents(r io.Reader, handler EventHandler) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) == 0 {
+				continue
+			}
+			var info model.EventInfo
+			if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &info); err != nil {
+				return fmt.Errorf("decode event: %w", err)
+			}
+			data = data[:0]
+			if err := handler(info); err != nil {
+				return err
+			}
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		if field == "data" {
+			data = append(data, strings.TrimPrefix(value, " "))
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// queryValues 按form标签将查询参数结构体编码为url.Values, 与gin的ShouldBindQuery对应.
+// 忽略零值字段和form:"-"的字段, 时间使用RFC3339格式
+func queryValues(req interface{}) url.Values {
+	values := url.Values{}
+	addQueryValues(values, reflect.ValueOf(req))
+	return values
+}
+
+func addQueryValues(values url.Values, v reflect.Value) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addQueryValues(values, v.Field(i))
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		if fv.Kind() == reflect.Slice {
+			for j := 0; j < fv.Len(); j++ {
+				values.Add(name, formatQueryValue(fv.Index(j)))
+			}
+			continue
+		}
+		if field.Type.Kind() != reflect.Pointer && fv.IsZero() {
+			continue
+		}
+		values.Set(name, formatQueryValue(fv))
+	}
+}
+
+func formatQueryValue(v reflect.Value) string {
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,217 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"pdcplet/pkg/pdcpserver/model"
+)
+
+const (
+	TEMPLATE_PATH = API_PREFIX + "/templates"
+	RULE_PATH     = API_PREFIX + "/rules"
+	USER_PATH     = API_PREFIX + "/users"
+	KEY_PATH      = API_PREFIX + "/keys"
+	WEBHOOK_PATH  = API_PREFIX + "/webhooks"
+	NODE_PATH     = API_PREFIX + "/nodes"
+	METRICS_PATH  = API_PREFIX + "/metrics"
+)
+
+func (c *Client) ListTemplates(ctx context.Context) (*model.VMTemplateListResponse, error) {
+	var resp model.VMTemplateListResponse
+	if err := c.do(ctx, http.MethodGet, TEMPLATE_PATH, nil, nil, &resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetTemplate(ctx context.Context, name string) (*model.VMTemplateInfo, error) {
+	var info model.VMTemplateInfo
+	if err := c.do(ctx, http.MethodGet, TEMPLATE_PATH+"/"+escape(name), nil, nil, &info, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *Client) CreateTemplate(ctx context.Context, req model.VMTemplateRequest) (*model.VMTemplateInfo, error) {
+	var info model.VMTemplateInfo
+	if err := c.do(ctx, http.MethodPost, TEMPLATE_PATH, nil, req, &info, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *Client) UpdateTemplate(ctx context.Context, name string, req model.VMTemplateRequest) (*model.VMTemplateInfo, error) {
+	var info model.VMTemplateInfo
+	if err := c.do(ctx, http.MethodPut, TEMPLATE_PATH+"/"+escape(name), nil, req, &info, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *Client) DeleteTemplate(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, TEMPLATE_PATH+"/"+escape(name), nil, nil, nil, http.StatusNoContent)
+}
+
+func (c *Client) ListRules(ctx context.Context) (*model.RuleListResponse, error) {
+	var resp model.RuleListResponse
+	if err := c.do(ctx, http.MethodGet, RULE_PATH, nil, nil, &resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetRule(ctx context.Context, name string) (*model.RuleInfo, error) {
+	var info model.RuleInfo
+	if err := c.do(ctx, http.MethodGet, RULE_PATH+"/"+escape(name), nil, nil, &info, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *Client) CreateRule(ctx context.Context, req model.RuleRequest) (*model.RuleInfo, error) {
+	var info model.RuleInfo
+	if err := c.do(ctx, http.MethodPost, RULE_PATH, nil, req, &info, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *Client) UpdateRule(ctx context.Context, name string, req model.RuleRequest) (*model.RuleInfo, error) {
+	var info model.RuleInfo
+	if err := c.do(ctx, http.MethodPut, RULE_PATH+"/"+escape(name), nil, req, &info, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *Client) DeleteRule(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, RULE_PATH+"/"+escape(name), nil, nil, nil, http.StatusNoContent)
+}
+
+func (c *Client) ListUsers(ctx context.Context) (*model.UserListResponse, error) {
+	var resp model.UserListResponse
+	if err := c.do(ctx, http.MethodGet, USER_PATH, nil, nil, &resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetUser(ctx context.Context, name string) (*model.UserInfo, error) {
+	var info model.UserInfo
+	if err := c.do(ctx, http.MethodGet, USER_PATH+"/"+escape(name), nil, nil, &info, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *Client) CreateUser(ctx context.Context, req model.UserRequest) (*model.UserInfo, error) {
+	var info model.UserInfo
+	if err := c.do(ctx, http.MethodPost, USER_PATH, nil, req, &info, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *Client) UpdateUser(ctx context.Context, name string, req model.UserRequest) (*model.UserInfo, error) {
+	var info model.UserInfo
+	if err := c.do(ctx, http.MethodPut, USER_PATH+"/"+escape(name), nil, req, &info, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *Client) DeleteUser(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, USER_PATH+"/"+escape(name), nil, nil, nil, http.StatusNoContent)
+}
+
+func (c *Client) ListAPIKeys(ctx context.Context) (*model.APIKeyListResponse, error) {
+	var resp model.APIKeyListResponse
+	if err := c.do(ctx, http.MethodGet, KEY_PATH, nil, nil, &resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CreateAPIKey 创建API Key, 明文Key只在此时返回
+func (c *Client) CreateAPIKey(ctx context.Context, req model.APIKeyRequest) (*model.APIKeyCreateResponse, error) {
+	var resp model.APIKeyCreateResponse
+	if err := c.do(ctx, http.MethodPost, KEY_PATH, nil, req, &resp, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) DeleteAPIKey(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, KEY_PATH+"/"+escape(name), nil, nil, nil, http.StatusNoContent)
+}
+
+func (c *Client) ListWebhooks(ctx context.Context) (*model.WebhookListResponse, error) {
+	var resp model.WebhookListResponse
+	if err := c.do(ctx, http.MethodGet, WEBHOOK_PATH, nil, nil, &resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetWebhook(ctx context.Context, name string) (*model.WebhookInfo, error) {
+	var info model.WebhookInfo
+	if err := c.do(ctx, http.MethodGet, WEBHOOK_PATH+"/"+escape(name), nil, nil, &info, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// CreateWebhook 创建Webhook, 未指定Secret时由pdcpserver生成, 只在此时返回
+func (c *Client) CreateWebhook(ctx context.Context, req model.WebhookRequest) (*model.WebhookCreateResponse, error) {
+	var resp model.WebhookCreateResponse
+	if err := c.do(ctx, http.MethodPost, WEBHOOK_PATH, nil, req, &resp, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdateWebhook(ctx context.Context, name string, req model.WebhookRequest) (*model.WebhookInfo, error) {
+	var info model.WebhookInfo
+	if err := c.do(ctx, http.MethodPut, WEBHOOK_PATH+"/"+escape(name), nil, req, &info, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, WEBHOOK_PATH+"/"+escape(name), nil, nil, nil, http.StatusNoContent)
+}
+
+func (c *Client) ListWebhookDeliveries(ctx context.Context, name string, req model.WebhookDeliveryQuery) (*model.WebhookDeliveryListResponse, error) {
+	var resp model.WebhookDeliveryListResponse
+	path := WEBHOOK_PATH + "/" + escape(name) + "/deliveries"
+	if err := c.do(ctx, http.MethodGet, path, queryValues(req), nil, &resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ListNodes(ctx context.Context, req model.NodeListRequest) (*model.NodeListResponse, error) {
+	var resp model.NodeListResponse
+	if err := c.do(ctx, http.MethodGet, NODE_PATH, queryValues(req), nil, &resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) QueryTraffic(ctx context.Context, req model.MetricsQueryRequest) (*model.MetricsQueryResponse, error) {
+	var resp model.MetricsQueryResponse
+	if err := c.do(ctx, http.MethodGet, METRICS_PATH+"/traffic", queryValues(req), nil, &resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) TopVMs(ctx context.Context, req model.TopVMsRequest) (*model.TopVMsResponse, error) {
+	var resp model.TopVMsResponse
+	if err := c.do(ctx, http.MethodGet, METRICS_PATH+"/top", queryValues(req), nil, &resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"pdcplet/pkg/pdcpserver/model"
+)
+
+const (
+	VM_PATH  = API_PREFIX + "/workload/vm"
+	JOB_PATH = API_PREFIX + "/jobs"
+
+	DEFAULT_JOB_POLL_INTERVAL = 2 * time.Second
+)
+
+func (c *Client) ListVMs(ctx context.Context, req model.VMListRequest) (*model.VMListResponse, error) {
+	var resp model.VMListResponse
+	if err := c.do(ctx, http.MethodGet, VM_PATH, queryValues(req), nil, &resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetVM(ctx context.Context, name, namespace string) (*model.VMInfo, error) {
+	var info model.VMInfo
+	query := queryValues(model.VMGetRequest{Namespace: namespace})
+	if err := c.do(ctx, http.MethodGet, VM_PATH+"/"+escape(name), query, nil, &info, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// CreateVM 提交创建任务, 使用GetJob或WaitJob查询任务结果
+func (c *Client) CreateVM(ctx context.Context, req model.VMCreateRequest) (*model.JobAcceptedResponse, error) {
+	var resp model.JobAcceptedResponse
+	if err := c.do(ctx, http.MethodPost, VM_PATH+"/create", nil, req, &resp, http.StatusAccepted); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) DeleteVM(ctx context.Context, req model.VMDeleteRequest) (*model.JobAcceptedResponse, error) {
+	var resp model.JobAcceptedResponse
+	if err := c.do(ctx, http.MethodPost, VM_PATH+"/delete", nil, req, &resp, http.StatusAccepted); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// OperateVM 提交启动/停止/重启/暂停/恢复任务
+func (c *Client) OperateVM(ctx context.Context, op model.VMOperation, name, namespace string) (*model.JobAcceptedResponse, error) {
+	var resp model.JobAcceptedResponse
+	query := queryValues(model.VMOperationRequest{Namespace: namespace})
+	if err := c.do(ctx, http.MethodPost, VM_PATH+"/"+escape(name)+"/"+string(op), query, nil, &resp, http.StatusAccepted); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) GetJob(ctx context.Context, id string) (*model.JobInfo, error) {
+	var info model.JobInfo
+	if err := c.do(ctx, http.MethodGet, JOB_PATH+"/"+escape(id), nil, nil, &info, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// WaitJob 轮询任务直到成功或失败, interval为0时使用DEFAULT_JOB_POLL_INTERVAL
+func (c *Client) WaitJob(ctx context.Context, id string, interval time.Duration) (*model.JobInfo, error) {
+	if interval <= 0 {
+		interval = DEFAULT_JOB_POLL_INTERVAL
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		info, err := c.GetJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if info.Status == model.JobSucceeded || info.Status == model.JobFailed {
+			return info, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return info, ctx.Err()
+		}
+	}
+}
@@ -1,24 +1,140 @@
 package config
 
-import "pdcplet/pkg/config"
+import (
+	"pdcplet/pkg/config"
+	"time"
+)
 
 // ConfigurationFile represents the structure of the configuration file.
 type ConfigurationFile struct {
-	Version string           `mapstructure:"version"`
-	Log     config.LogConfig `mapstructure:"log"`
-	Listen  ListenConfig     `mapstructure:"listen"`
-	Db      DBConfig         `mapstructure:"db"`
+	Version    string           `mapstructure:"version"`
+	Log        config.LogConfig `mapstructure:"log"`
+	Listen     ListenConfig     `mapstructure:"listen"`
+	Db         DBConfig         `mapstructure:"db"`
+	Metrics    MetricsConfig    `mapstructure:"metrics"`
+	StatusSync StatusSyncConfig `mapstructure:"statusSync"`
+	Lifecycle  LifecycleConfig  `mapstructure:"lifecycle"`
+	Jobs       JobsConfig       `mapstructure:"jobs"`
+	Nodes      NodesConfig      `mapstructure:"nodes"`
+	Events     EventsConfig     `mapstructure:"events"`
+	Webhooks   WebhooksConfig   `mapstructure:"webhooks"`
+	Auth       AuthConfig       `mapstructure:"auth"`
 }
 
 // Module represents a module configuration with its name and parameters
 type ListenConfig struct {
-	Address string `mapstructure:"address"`
-	Port    uint32 `mapstructure:"port"`
+	Address string    `mapstructure:"address"`
+	Port    uint32    `mapstructure:"port"`
+	TLS     TLSConfig `mapstructure:"tls"`
 }
 
+// TLSConfig 启用后以HTTPS提供服务
+type TLSConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	CertFile string `mapstructure:"certFile"`
+	KeyFile  string `mapstructure:"keyFile"`
+}
+
+// DBConfig 数据库配置, 按type选择sqlite3/postgres/mysql中对应的配置
 type DBConfig struct {
-	TypeStr string `mapstructure:"type"`
-	Sqlite3 struct {
-		Database string `mapstructure:"database"`
-	} `mapstructure:"sqlite3"`
+	TypeStr  string       `mapstructure:"type"` // option: sqlite3/postgres/mysql
+	Sqlite3  SQLiteConfig `mapstructure:"sqlite3"`
+	Postgres DSNConfig    `mapstructure:"postgres"`
+	MySQL    DSNConfig    `mapstructure:"mysql"`
+	Pool     DBPoolConfig `mapstructure:"pool"`
+}
+
+type SQLiteConfig struct {
+	Database string `mapstructure:"database"` // 数据库文件路径
+}
+
+type DSNConfig struct {
+	DSN string `mapstructure:"dsn"`
+}
+
+// DBPoolConfig 连接池配置, 为0时使用database/sql的默认值
+type DBPoolConfig struct {
+	MaxOpenConns    int           `mapstructure:"maxOpenConns"`
+	MaxIdleConns    int           `mapstructure:"maxIdleConns"`
+	ConnMaxLifetime time.Duration `mapstructure:"connMaxLifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"connMaxIdleTime"`
+}
+
+// MetricsConfig 指标接收与存储相关配置
+type MetricsConfig struct {
+	AuthMode       string          `mapstructure:"authMode"`  // option: hmac/bearer
+	AuthToken      string          `mapstructure:"authToken"` // 为空时不校验
+	RollupInterval time.Duration   `mapstructure:"rollupInterval"`
+	RollupDelay    time.Duration   `mapstructure:"rollupDelay"` // 降采样等待迟到数据的时长
+	Retention      RetentionConfig `mapstructure:"retention"`
+	MaxBodySize    int64           `mapstructure:"maxBodySize"`   // 上报请求体的最大字节数, 默认metrics.DEFAULT_MAX_UPLOAD_BODY
+	MaxUploadSize  int64           `mapstructure:"maxUploadSize"` // 解压后的最大字节数, 默认metrics.DEFAULT_MAX_UPLOAD_SIZE
+}
+
+// RetentionConfig 各精度指标的保留时长
+type RetentionConfig struct {
+	Raw    time.Duration `mapstructure:"raw"`
+	Minute time.Duration `mapstructure:"minute"`
+	Hour   time.Duration `mapstructure:"hour"`
+}
+
+// StatusSyncConfig VM状态同步相关配置
+type StatusSyncConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	ResyncPeriod time.Duration `mapstructure:"resyncPeriod"`
+}
+
+// LifecycleConfig VM创建/删除reconciler相关配置
+type LifecycleConfig struct {
+	Interval     time.Duration `mapstructure:"interval"`     // 扫描待处理记录的周期
+	MaxAttempts  int           `mapstructure:"maxAttempts"`  // 创建失败的最大重试次数
+	RetryBackoff time.Duration `mapstructure:"retryBackoff"` // 首次重试的等待时长, 之后指数增长
+}
+
+// JobsConfig 异步任务worker池相关配置
+type JobsConfig struct {
+	Workers      int           `mapstructure:"workers"`
+	MaxAttempts  int           `mapstructure:"maxAttempts"`
+	RetryBackoff time.Duration `mapstructure:"retryBackoff"` // 首次重试的等待时长, 之后指数增长
+	PollInterval time.Duration `mapstructure:"pollInterval"` // 检查等待中任务进度的周期
+	WaitTimeout  time.Duration `mapstructure:"waitTimeout"`  // 等待生命周期reconciler完成的最长时长
+}
+
+// NodesConfig pdcplet节点注册相关配置
+type NodesConfig struct {
+	StaleAfter    time.Duration `mapstructure:"staleAfter"`    // 超过该时长未收到心跳的节点标记为Stale
+	CheckInterval time.Duration `mapstructure:"checkInterval"` // 检查节点心跳的周期
+}
+
+// EventsConfig 事件流相关配置
+type EventsConfig struct {
+	Retention     time.Duration `mapstructure:"retention"`     // 事件的保留时长, 客户端断线超过该时长后无法续传
+	PurgeInterval time.Duration `mapstructure:"purgeInterval"` // 清理过期事件的周期
+}
+
+// WebhooksConfig Webhook投递相关配置
+type WebhooksConfig struct {
+	Workers      int           `mapstructure:"workers"`      // 并发投递的数量
+	Timeout      time.Duration `mapstructure:"timeout"`      // 单次投递的超时时长
+	MaxAttempts  int           `mapstructure:"maxAttempts"`  // 投递失败的最大尝试次数
+	RetryBackoff time.Duration `mapstructure:"retryBackoff"` // 首次重试的等待时长, 之后指数增长
+	PollInterval time.Duration `mapstructure:"pollInterval"` // 检查到期重试的周期
+	Retention    time.Duration `mapstructure:"retention"`    // 投递记录的保留时长
+	SecretKey    string        `mapstructure:"secretKey"`    // 加密保存Webhook Secret的密钥, 未配置时不能创建Webhook
+}
+
+// AuthConfig pdcpserver API认证相关配置, pdcplet使用metrics.authToken或agent类型的API Key
+type AuthConfig struct {
+	Enabled bool      `mapstructure:"enabled"` // 为false时API不校验凭据
+	JWT     JWTConfig `mapstructure:"jwt"`
+}
+
+// JWTConfig JWT bearer token的校验配置, hmacSecret与jwksFile/jwksURL至少配置一个
+type JWTConfig struct {
+	HMACSecret string        `mapstructure:"hmacSecret"` // 校验HS256/HS384/HS512签名
+	JWKSFile   string        `mapstructure:"jwksFile"`   // 校验RS*/PS*/ES*签名的公钥, 文件变化后自动重新加载
+	JWKSURL    string        `mapstructure:"jwksURL"`    // 从身份提供方获取JWKS并定期刷新, 与jwksFile互斥
+	Issuer     string        `mapstructure:"issuer"`     // 不为空时校验iss
+	Audience   string        `mapstructure:"audience"`   // 不为空时校验aud
+	Leeway     time.Duration `mapstructure:"leeway"`     // 校验exp/nbf时允许的时钟偏差
 }
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"pdcplet/pkg/pdcpserver/apierror"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyController interface {
+	CreateAPIKeyHandler(c *gin.Context)
+	DeleteAPIKeyHandler(c *gin.Context)
+	GetAPIKeysHandler(c *gin.Context)
+}
+
+type apiKeyController struct {
+	keys service.APIKeyService
+}
+
+func NewAPIKeyController(keys service.APIKeyService) APIKeyController {
+	return &apiKeyController{keys: keys}
+}
+
+// apiKeyErrorStatus 将API Key相关的错误映射为HTTP状态码
+func apiKeyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidAPIKey):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrAPIKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrAPIKeyExists):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// CreateAPIKeyHandler 创建API Key, 响应中的key只返回这一次
+func (controller *apiKeyController) CreateAPIKeyHandler(c *gin.Context) {
+	var req model.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := controller.keys.CreateKey(req)
+	if err != nil {
+		apierror.Respond(c, apiKeyErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+func (controller *apiKeyController) DeleteAPIKeyHandler(c *gin.Context) {
+	if err := controller.keys.DeleteKey(c.Param("name")); err != nil {
+		apierror.Respond(c, apiKeyErrorStatus(err), err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (controller *apiKeyController) GetAPIKeysHandler(c *gin.Context) {
+	resp, err := controller.keys.ListKeys()
+	if err != nil {
+		apierror.Respond(c, apiKeyErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
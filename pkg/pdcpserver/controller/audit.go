@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"pdcplet/pkg/pdcpserver/apierror"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditController interface {
+	GetAuditEventsHandler(c *gin.Context)
+	ExportAuditEventsHandler(c *gin.Context)
+}
+
+type auditController struct {
+	audits service.AuditService
+}
+
+func NewAuditController(audits service.AuditService) AuditController {
+	return &auditController{audits: audits}
+}
+
+func auditErrorStatus(err error) int {
+	if errors.Is(err, service.ErrInvalidAuditQuery) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (controller *auditController) GetAuditEventsHandler(c *gin.Context) {
+	var req model.AuditQueryRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := controller.audits.ListEvents(req)
+	if err != nil {
+		apierror.Respond(c, auditErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ExportAuditEventsHandler 以JSON Lines格式流式导出审计记录
+func (controller *auditController) ExportAuditEventsHandler(c *gin.Context) {
+	var req model.AuditQueryRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+	if !req.From.IsZero() && !req.To.IsZero() && !req.From.Before(req.To) {
+		apierror.Respond(c, http.StatusBadRequest, &model.FieldError{Field: "to", Message: "must be after from"})
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	c.Status(http.StatusOK)
+	if err := controller.audits.Export(req, c.Writer); err != nil {
+		// 响应头已发送, 只能记录日志并中断输出
+		slog.Error("Failed to export audit events", "error", err)
+	}
+}
@@ -1,8 +1,11 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
 
+	"pdcplet/pkg/pdcpserver/apierror"
+	"pdcplet/pkg/pdcpserver/auth"
 	"pdcplet/pkg/pdcpserver/model"
 	"pdcplet/pkg/pdcpserver/service"
 
@@ -13,15 +16,25 @@ type Controller interface {
 	CreateVMHandler(c *gin.Context)
 	DeleteVMHandler(c *gin.Context)
 	GetVMSHandler(c *gin.Context)
+	GetVMHandler(c *gin.Context)
+	StartVMHandler(c *gin.Context)
+	StopVMHandler(c *gin.Context)
+	RestartVMHandler(c *gin.Context)
+	PauseVMHandler(c *gin.Context)
+	UnpauseVMHandler(c *gin.Context)
 }
 
 type defaultController struct {
-	service service.Service
+	service   service.Service
+	jobs      service.JobService
+	templates service.TemplateService
 }
 
-func NewController() Controller {
+func NewController(svc service.Service, jobs service.JobService, templates service.TemplateService) Controller {
 	return &defaultController{
-		service: service.New(),
+		service:   svc,
+		jobs:      jobs,
+		templates: templates,
 	}
 }
 
@@ -30,19 +43,31 @@ func (controller *defaultController) CreateVMHandler(c *gin.Context) {
 	req.Namespace = model.DEFAULT_NAMESPACE // Set default namespace
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Respond(c, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := controller.service.CreateVM(req); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// 提交任务前展开模板, 任务执行时不受模板后续修改的影响
+	resolved, err := controller.templates.Resolve(req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidVMSpec) {
+			apierror.Respond(c, http.StatusBadRequest, err)
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, model.VMCreateResponse{
-		Message: "Created VM successfully",
-		Name:    req.Name,
-	})
+	if !auth.Authorize(c, auth.ActionWrite, resolved.Namespace) {
+		return
+	}
+	// 克隆其他namespace的PVC或在其他namespace中创建VLAN网络同样需要该namespace的写权限
+	for _, namespace := range resolved.ReferencedNamespaces() {
+		if !auth.Authorize(c, auth.ActionWrite, namespace) {
+			return
+		}
+	}
+	controller.submitJob(c, model.JobTypeCreateVM, resolved.Name, resolved.Namespace, resolved)
 }
 
 func (controller *defaultController) DeleteVMHandler(c *gin.Context) {
@@ -50,21 +75,127 @@ func (controller *defaultController) DeleteVMHandler(c *gin.Context) {
 	req.Namespace = model.DEFAULT_NAMESPACE // Set default namespace
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Respond(c, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := controller.service.DeleteVM(req); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !auth.Authorize(c, auth.ActionWrite, req.Namespace) {
 		return
 	}
-
-	c.JSON(http.StatusOK, model.VMDeleteResponse{
-		Message: "Delete VM successfully",
-		Name:    req.Name,
-	})
+	controller.submitJob(c, model.JobTypeDeleteVM, req.Name, req.Namespace, req)
 }
 
 func (controller *defaultController) GetVMSHandler(c *gin.Context) {
+	var req model.VMListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+	if !auth.Authorize(c, auth.ActionRead, req.Namespace) {
+		return
+	}
+	req.Namespaces = auth.VisibleNamespaces(c)
+
+	resp, err := controller.service.ListVMs(req)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidVMCursor) {
+			apierror.Respond(c, http.StatusBadRequest, err)
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (controller *defaultController) GetVMHandler(c *gin.Context) {
+	var req model.VMGetRequest
+	req.Namespace = model.DEFAULT_NAMESPACE // Set default namespace
 
+	if err := c.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !auth.Authorize(c, auth.ActionRead, req.Namespace) {
+		return
+	}
+
+	info, err := controller.service.GetVM(c.Param("name"), req.Namespace)
+	if err != nil {
+		if errors.Is(err, service.ErrVMNotFound) {
+			apierror.Respond(c, http.StatusNotFound, err)
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func (controller *defaultController) StartVMHandler(c *gin.Context) {
+	controller.operateVM(c, model.VMOperationStart)
+}
+
+func (controller *defaultController) StopVMHandler(c *gin.Context) {
+	controller.operateVM(c, model.VMOperationStop)
+}
+
+func (controller *defaultController) RestartVMHandler(c *gin.Context) {
+	controller.operateVM(c, model.VMOperationRestart)
+}
+
+func (controller *defaultController) PauseVMHandler(c *gin.Context) {
+	controller.operateVM(c, model.VMOperationPause)
+}
+
+func (controller *defaultController) UnpauseVMHandler(c *gin.Context) {
+	controller.operateVM(c, model.VMOperationUnpause)
+}
+
+func (controller *defaultController) operateVM(c *gin.Context, op model.VMOperation) {
+	var req model.VMOperationRequest
+	req.Namespace = model.DEFAULT_NAMESPACE // Set default namespace
+
+	if err := c.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+	req.Name = c.Param("name")
+	if !auth.Authorize(c, auth.ActionWrite, req.Namespace) {
+		return
+	}
+
+	controller.submitJob(c, model.JobTypeOf(op), req.Name, req.Namespace, req)
+}
+
+// submitJob 提交异步任务并返回202, 调用方通过任务ID轮询执行结果
+func (controller *defaultController) submitJob(c *gin.Context, jobType model.JobType, name string, namespace string, payload interface{}) {
+	owner := ""
+	if p := auth.FromContext(c); p != nil {
+		owner = p.Subject
+	}
+	job, err := controller.jobs.Submit(jobType, name, namespace, owner, payload)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidVMSpec):
+			apierror.Respond(c, http.StatusBadRequest, err)
+		case errors.Is(err, service.ErrVMExists):
+			apierror.Respond(c, http.StatusConflict, err)
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	location := JOB_ROUTE_PREFIX + "/" + job.ID
+	c.Header("Location", location)
+	c.JSON(http.StatusAccepted, model.JobAcceptedResponse{
+		Message:  string(jobType) + " VM accepted",
+		Name:     name,
+		JobID:    job.ID,
+		Location: location,
+	})
 }
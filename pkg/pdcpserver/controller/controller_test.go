@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pdcplet/pkg/pdcpserver/auth"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreateVMHandlerReferencedNamespaces(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	svc := service.New(nil)
+	ctl := NewController(svc, service.NewJobService(config.JobsConfig{}, svc), service.NewTemplateService())
+	gin.SetMode(gin.TestMode)
+
+	pvcDisk := func(namespace string) string {
+		return `"disks":[{"name":"root","image":"cirros"},{"name":"data","dataVolume":{"source":"pvc","pvcName":"golden",` +
+			`"pvcNamespace":"` + namespace + `","size":"10Gi"}}]`
+	}
+	vlanNetwork := func(networkName string) string {
+		return `"image":"cirros","networks":[{"name":"default"},` +
+			`{"name":"capture","type":"multus","networkName":"` + networkName + `","vlanId":100}]`
+	}
+	tests := []struct {
+		name       string
+		principal  *auth.Principal
+		vm         string
+		body       string
+		wantStatus int
+	}{
+		{name: "pvc in own namespace", principal: &auth.Principal{Role: model.RoleOperator, Namespaces: []string{"team-a"}},
+			vm: "vm1", body: pvcDisk("team-a"), wantStatus: http.StatusAccepted},
+		{name: "pvc in other namespace", principal: &auth.Principal{Role: model.RoleOperator, Namespaces: []string{"team-a"}},
+			vm: "vm2", body: pvcDisk("team-b"), wantStatus: http.StatusForbidden},
+		{name: "pvc in granted namespace", principal: &auth.Principal{Role: model.RoleOperator, Namespaces: []string{"team-a", "team-b"}},
+			vm: "vm3", body: pvcDisk("team-b"), wantStatus: http.StatusAccepted},
+		{name: "pvc in namespace with read access only", principal: &auth.Principal{Role: model.RoleViewer, Namespaces: []string{"team-a"}},
+			vm: "vm4", body: pvcDisk("team-a"), wantStatus: http.StatusForbidden},
+		{name: "network in own namespace", principal: &auth.Principal{Role: model.RoleOperator, Namespaces: []string{"team-a"}},
+			vm: "vm5", body: vlanNetwork("capture-net"), wantStatus: http.StatusAccepted},
+		{name: "vlan network in other namespace", principal: &auth.Principal{Role: model.RoleOperator, Namespaces: []string{"team-a"}},
+			vm: "vm6", body: vlanNetwork("team-b/capture-net"), wantStatus: http.StatusForbidden},
+		{name: "admin", principal: &auth.Principal{Role: model.RoleAdmin},
+			vm: "vm7", body: vlanNetwork("team-b/capture-net"), wantStatus: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.POST("/vm/create", func(c *gin.Context) {
+				c.Set(auth.PRINCIPAL_KEY, tt.principal)
+			}, ctl.CreateVMHandler)
+
+			body := `{"name":"` + tt.vm + `","namespace":"team-a","cpu":1,"memory":"1Gi",` + tt.body + `}`
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/vm/create", strings.NewReader(body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			var count int64
+			database.DB.Model(&model.Job{}).Where("vm_name = ?", tt.vm).Count(&count)
+			if (count == 1) != (tt.wantStatus == http.StatusAccepted) {
+				t.Fatalf("jobs for %s = %d", tt.vm, count)
+			}
+		})
+	}
+}
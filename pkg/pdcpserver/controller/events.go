@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pdcplet/pkg/pdcpserver/apierror"
+	"pdcplet/pkg/pdcpserver/auth"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	HEADER_LAST_EVENT_ID   = "Last-Event-ID"
+	EVENT_KEEPALIVE_PERIOD = 15 * time.Second
+)
+
+type EventController interface {
+	StreamEventsHandler(c *gin.Context)
+}
+
+type eventController struct {
+	events service.EventService
+}
+
+func NewEventController(events service.EventService) EventController {
+	return &eventController{events: events}
+}
+
+// lastEventID 浏览器EventSource重连时携带Last-Event-ID头, 其他客户端也可以使用lastEventId参数
+func lastEventID(c *gin.Context) (uint, bool) {
+	value := c.GetHeader(HEADER_LAST_EVENT_ID)
+	if value == "" {
+		value = c.Query("lastEventId")
+	}
+	if value == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// StreamEventsHandler 以Server-Sent Events推送事件, 事件ID可用于断线续传.
+// 订阅者读取过慢时服务端关闭连接, 客户端应带上最后收到的事件ID重连
+func (controller *eventController) StreamEventsHandler(c *gin.Context) {
+	var req model.EventStreamRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+	lastID, ok := lastEventID(c)
+	if !ok {
+		apierror.Respond(c, http.StatusBadRequest, errors.New("invalid last event id"))
+		return
+	}
+	if !auth.Authorize(c, auth.ActionRead, req.Namespace) {
+		return
+	}
+	req.Namespaces = auth.VisibleNamespaces(c)
+
+	subscription := controller.events.Subscribe(req, lastID)
+	defer subscription.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// 关闭nginx等反向代理的缓冲
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	// 分批推送Backlog, 不一次性加载断开期间的所有事件. 查询失败时断开连接, 客户端带上最后收到的事件ID重连
+	for {
+		backlog, err := subscription.NextBacklog()
+		if err != nil {
+			slog.Error("Failed to read event backlog", "clientIP", c.ClientIP(), "lastEventId", lastID, "error", err)
+			return
+		}
+		if len(backlog) == 0 {
+			break
+		}
+		for _, info := range backlog {
+			controller.render(c, info)
+			lastID = info.ID
+		}
+		c.Writer.Flush()
+	}
+
+	keepalive := time.NewTicker(EVENT_KEEPALIVE_PERIOD)
+	defer keepalive.Stop()
+	for {
+		select {
+		case info, ok := <-subscription.Events:
+			if !ok {
+				slog.Warn("Event stream closed for slow client", "clientIP", c.ClientIP(), "lastEventId", lastID)
+				return
+			}
+			// 订阅后、查询Backlog前发布的事件会重复
+			if info.ID <= lastID {
+				continue
+			}
+			controller.render(c, info)
+			lastID = info.ID
+			c.Writer.Flush()
+		case <-keepalive.C:
+			if _, err := c.Writer.WriteString(": keepalive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+func (controller *eventController) render(c *gin.Context, info model.EventInfo) {
+	c.Render(-1, sse.Event{
+		Id:    strconv.FormatUint(uint64(info.ID), 10),
+		Event: string(info.Type),
+		Data:  info,
+	})
+}
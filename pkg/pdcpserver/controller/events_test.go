@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// racingEventService 订阅后、读取Backlog前发布一条事件, 使其同时出现在Backlog和Events中
+type racingEventService struct {
+	service.EventService
+}
+
+func (s *racingEventService) Subscribe(req model.EventStreamRequest, lastID uint) *service.EventSubscription {
+	subscription := s.EventService.Subscribe(req, lastID)
+	service.PublishEvent(model.EventNodeOnline, "", "", "racing", nil)
+	return subscription
+}
+
+// readEventIDs 读取SSE中的事件ID, 直到收到n个或超时
+func readEventIDs(t *testing.T, scanner *bufio.Scanner, n int) []uint {
+	t.Helper()
+	var ids []uint
+	for len(ids) < n && scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "id:"); ok {
+			id, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				t.Fatalf("invalid event id %q", value)
+			}
+			ids = append(ids, uint(id))
+		}
+	}
+	if len(ids) < n {
+		t.Fatalf("got event ids %v, want %d events: %v", ids, n, scanner.Err())
+	}
+	return ids
+}
+
+func TestStreamEventsHandler(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ctl := NewEventController(&racingEventService{service.NewEventService(config.EventsConfig{})})
+	r.GET("/events/stream", ctl.StreamEventsHandler)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	for _, node := range []string{"node1", "node2", "node3"} {
+		service.PublishEvent(model.EventNodeOnline, "", "", node, nil)
+	}
+	// 已有事件1-3, 每个用例在订阅时和收到事件后各发布一条事件
+	tests := []struct {
+		name   string
+		header string
+		query  string
+		want   []uint
+	}{
+		{name: "resume from Last-Event-ID", header: "1", want: []uint{2, 3, 4, 5}},
+		{name: "resume from lastEventId", query: "?lastEventId=5", want: []uint{6, 7}},
+		{name: "new events only", want: []uint{8, 9}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events/stream"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set(HEADER_LAST_EVENT_ID, tt.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("stream: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+				t.Fatalf("status = %d, content type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+			}
+
+			// 续传时订阅时发布的事件在Backlog和Events中各出现一次, 只推送一次
+			scanner := bufio.NewScanner(resp.Body)
+			ids := readEventIDs(t, scanner, len(tt.want)-1)
+			service.PublishEvent(model.EventNodeOffline, "", "", "node1", nil)
+			ids = append(ids, readEventIDs(t, scanner, 1)...)
+			if !slices.Equal(ids, tt.want) {
+				t.Fatalf("event ids = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamEventsHandlerInvalidLastEventID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/events/stream", NewEventController(service.NewEventService(config.EventsConfig{})).StreamEventsHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/events/stream", nil)
+	req.Header.Set(HEADER_LAST_EVENT_ID, "abc")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"pdcplet/pkg/pdcpserver/apierror"
+	"pdcplet/pkg/pdcpserver/auth"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const JOB_ROUTE_PREFIX = "/pdcpserver/api/jobs"
+
+type JobController interface {
+	GetJobHandler(c *gin.Context)
+}
+
+type jobController struct {
+	jobs service.JobService
+}
+
+func NewJobController(jobs service.JobService) JobController {
+	return &jobController{jobs: jobs}
+}
+
+func (controller *jobController) GetJobHandler(c *gin.Context) {
+	info, err := controller.jobs.GetJob(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, service.ErrJobNotFound) {
+			apierror.Respond(c, http.StatusNotFound, err)
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, err)
+		return
+	}
+	if !auth.Authorize(c, auth.ActionRead, info.Namespace) {
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"pdcplet/pkg/metrics"
+	"pdcplet/pkg/pdcpserver/apierror"
+	"pdcplet/pkg/pdcpserver/auth"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsController interface {
+	IngestMetricsHandler(c *gin.Context)
+	QueryTrafficHandler(c *gin.Context)
+	TopVMsHandler(c *gin.Context)
+}
+
+type defaultMetricsController struct {
+	service service.MetricsService
+	cfg     config.MetricsConfig
+}
+
+func NewMetricsController(svc service.MetricsService, cfg config.MetricsConfig) MetricsController {
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = metrics.DEFAULT_MAX_UPLOAD_BODY
+	}
+	if cfg.MaxUploadSize <= 0 {
+		cfg.MaxUploadSize = metrics.DEFAULT_MAX_UPLOAD_SIZE
+	}
+	return &defaultMetricsController{
+		service: svc,
+		cfg:     cfg,
+	}
+}
+
+func (controller *defaultMetricsController) IngestMetricsHandler(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, controller.cfg.MaxBodySize)
+	body, err := c.GetRawData()
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		apierror.Respond(c, status, err)
+		return
+	}
+
+	upload, err := metrics.Decode(body, c.GetHeader("Content-Encoding") == metrics.CONTENT_ENCODING, controller.cfg.MaxUploadSize)
+	if errors.Is(err, metrics.ErrUploadTooLarge) {
+		apierror.Respond(c, http.StatusRequestEntityTooLarge, err)
+		return
+	} else if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	for _, envelope := range upload.Envelopes {
+		if !auth.AuthorizeNode(c, envelope.NodeName) {
+			return
+		}
+	}
+
+	ack, err := controller.service.Ingest(upload)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ack)
+}
+
+func (controller *defaultMetricsController) QueryTrafficHandler(c *gin.Context) {
+	var req model.MetricsQueryRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+	if !authorizeMetricsQuery(c, req.Namespace) {
+		return
+	}
+
+	resp, err := controller.service.QueryTraffic(req)
+	if err != nil {
+		apierror.Respond(c, metricsQueryErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (controller *defaultMetricsController) TopVMsHandler(c *gin.Context) {
+	var req model.TopVMsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+	if !authorizeMetricsQuery(c, req.Namespace) {
+		return
+	}
+
+	resp, err := controller.service.TopVMs(req)
+	if err != nil {
+		apierror.Respond(c, metricsQueryErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// authorizeMetricsQuery 未指定namespace时查询所有namespace的指标, 只能访问部分namespace的用户必须指定namespace
+func authorizeMetricsQuery(c *gin.Context, namespace string) bool {
+	if namespace == "" {
+		namespace = model.ALL_NAMESPACES
+	}
+	return auth.Authorize(c, auth.ActionRead, namespace)
+}
+
+func metricsQueryErrorStatus(err error) int {
+	if errors.Is(err, service.ErrInvalidMetricsQuery) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pdcplet/pkg/metrics"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func gzipBody(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(s))
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestIngestMetricsHandlerLimits(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	cfg := config.MetricsConfig{MaxBodySize: 1024, MaxUploadSize: 4096}
+	ctl := NewMetricsController(service.NewMetricsService(cfg), cfg)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/pdcplet/metrics/", ctl.IngestMetricsHandler)
+
+	// 空白字符不影响JSON解析, 用于构造指定大小的请求体
+	padded := func(size int) string {
+		const upload = `{"envelopes":[{"node_name":"node1","session_id":"s1","sequence":1,"collected_at":"2026-01-02T03:04:05Z"}]}`
+		return upload + strings.Repeat(" ", size-len(upload))
+	}
+	tests := []struct {
+		name    string
+		body    []byte
+		gzipped bool
+		want    int
+	}{
+		{name: "plain", body: []byte(padded(1024)), want: http.StatusOK},
+		{name: "body too large", body: []byte(padded(1025)), want: http.StatusRequestEntityTooLarge},
+		{name: "gzip", body: gzipBody(t, padded(4096)), gzipped: true, want: http.StatusOK},
+		// 压缩后很小, 解压后超出限制
+		{name: "decompressed too large", body: gzipBody(t, padded(1<<20)), gzipped: true, want: http.StatusRequestEntityTooLarge},
+		{name: "invalid json", body: []byte("{"), want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/pdcplet/metrics/", bytes.NewReader(tt.body))
+			if tt.gzipped {
+				req.Header.Set("Content-Encoding", metrics.CONTENT_ENCODING)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"pdcplet/pkg/agent"
+	"pdcplet/pkg/pdcpserver/apierror"
+	"pdcplet/pkg/pdcpserver/auth"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NodeController interface {
+	RegisterNodeHandler(c *gin.Context)
+	HeartbeatHandler(c *gin.Context)
+	GetNodesHandler(c *gin.Context)
+	GetRuleSetHandler(c *gin.Context)
+	ReportRuleStatusHandler(c *gin.Context)
+	ReportEventsHandler(c *gin.Context)
+}
+
+type nodeController struct {
+	nodes service.NodeService
+	rules service.RuleService
+}
+
+func NewNodeController(nodes service.NodeService, rules service.RuleService) NodeController {
+	return &nodeController{nodes: nodes, rules: rules}
+}
+
+func (controller *nodeController) RegisterNodeHandler(c *gin.Context) {
+	var reg agent.Registration
+	if err := c.ShouldBindJSON(&reg); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !auth.AuthorizeNode(c, reg.NodeName) {
+		return
+	}
+
+	ack, err := controller.nodes.Register(reg)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidNode) {
+			apierror.Respond(c, http.StatusBadRequest, err)
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ack)
+}
+
+func (controller *nodeController) HeartbeatHandler(c *gin.Context) {
+	var hb agent.Heartbeat
+	if err := c.ShouldBindJSON(&hb); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !auth.AuthorizeNode(c, hb.NodeName) {
+		return
+	}
+
+	ack, err := controller.nodes.Heartbeat(hb)
+	if err != nil {
+		if errors.Is(err, service.ErrNodeNotRegistered) {
+			// pdcplet收到404后重新注册
+			apierror.Respond(c, http.StatusNotFound, err)
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ack)
+}
+
+func (controller *nodeController) GetNodesHandler(c *gin.Context) {
+	var req model.NodeListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := controller.nodes.ListNodes(req)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetRuleSetHandler 返回节点上生效的规则集, 请求的version与当前一致时返回304
+func (controller *nodeController) GetRuleSetHandler(c *gin.Context) {
+	nodeName := c.Query("node_name")
+	if nodeName == "" {
+		apierror.Respond(c, http.StatusBadRequest, &model.FieldError{Field: "node_name", Message: "is required"})
+		return
+	}
+
+	if !auth.AuthorizeNode(c, nodeName) {
+		return
+	}
+
+	set, err := controller.rules.EffectiveRules(nodeName)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, err)
+		return
+	}
+	if c.Query("version") == set.Version {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.JSON(http.StatusOK, set)
+}
+
+func (controller *nodeController) ReportRuleStatusHandler(c *gin.Context) {
+	var status agent.RuleSetStatus
+	if err := c.ShouldBindJSON(&status); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !auth.AuthorizeNode(c, status.NodeName) {
+		return
+	}
+
+	if err := controller.nodes.ReportRuleStatus(status); err != nil {
+		if errors.Is(err, service.ErrNodeNotRegistered) {
+			apierror.Respond(c, http.StatusNotFound, err)
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (controller *nodeController) ReportEventsHandler(c *gin.Context) {
+	var events agent.NodeEvents
+	if err := c.ShouldBindJSON(&events); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if !auth.AuthorizeNode(c, events.NodeName) {
+		return
+	}
+
+	ack, err := controller.nodes.ReportEvents(events)
+	if err != nil {
+		if errors.Is(err, service.ErrNodeNotRegistered) {
+			apierror.Respond(c, http.StatusNotFound, err)
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ack)
+}
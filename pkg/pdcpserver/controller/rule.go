@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"pdcplet/pkg/pdcpserver/apierror"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RuleController interface {
+	CreateRuleHandler(c *gin.Context)
+	UpdateRuleHandler(c *gin.Context)
+	DeleteRuleHandler(c *gin.Context)
+	GetRuleHandler(c *gin.Context)
+	GetRulesHandler(c *gin.Context)
+}
+
+type ruleController struct {
+	rules service.RuleService
+}
+
+func NewRuleController(rules service.RuleService) RuleController {
+	return &ruleController{rules: rules}
+}
+
+// ruleErrorStatus 将规则相关的错误映射为HTTP状态码
+func ruleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidRule):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrRuleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrRuleExists), errors.Is(err, service.ErrRuleConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (controller *ruleController) CreateRuleHandler(c *gin.Context) {
+	var req model.RuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	info, err := controller.rules.CreateRule(req)
+	if err != nil {
+		apierror.Respond(c, ruleErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, info)
+}
+
+func (controller *ruleController) UpdateRuleHandler(c *gin.Context) {
+	var req model.RuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	info, err := controller.rules.UpdateRule(c.Param("name"), req)
+	if err != nil {
+		apierror.Respond(c, ruleErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func (controller *ruleController) DeleteRuleHandler(c *gin.Context) {
+	if err := controller.rules.DeleteRule(c.Param("name")); err != nil {
+		apierror.Respond(c, ruleErrorStatus(err), err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (controller *ruleController) GetRuleHandler(c *gin.Context) {
+	info, err := controller.rules.GetRule(c.Param("name"))
+	if err != nil {
+		apierror.Respond(c, ruleErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func (controller *ruleController) GetRulesHandler(c *gin.Context) {
+	resp, err := controller.rules.ListRules()
+	if err != nil {
+		apierror.Respond(c, ruleErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"pdcplet/pkg/pdcpserver/apierror"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TemplateController interface {
+	CreateTemplateHandler(c *gin.Context)
+	UpdateTemplateHandler(c *gin.Context)
+	DeleteTemplateHandler(c *gin.Context)
+	GetTemplateHandler(c *gin.Context)
+	GetTemplatesHandler(c *gin.Context)
+}
+
+type templateController struct {
+	templates service.TemplateService
+}
+
+func NewTemplateController(templates service.TemplateService) TemplateController {
+	return &templateController{templates: templates}
+}
+
+// templateErrorStatus 将模板相关的错误映射为HTTP状态码
+func templateErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidTemplate):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrTemplateNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrTemplateExists):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (controller *templateController) CreateTemplateHandler(c *gin.Context) {
+	var req model.VMTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	info, err := controller.templates.CreateTemplate(req)
+	if err != nil {
+		apierror.Respond(c, templateErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, info)
+}
+
+func (controller *templateController) UpdateTemplateHandler(c *gin.Context) {
+	var req model.VMTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	info, err := controller.templates.UpdateTemplate(c.Param("name"), req)
+	if err != nil {
+		apierror.Respond(c, templateErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func (controller *templateController) DeleteTemplateHandler(c *gin.Context) {
+	if err := controller.templates.DeleteTemplate(c.Param("name")); err != nil {
+		apierror.Respond(c, templateErrorStatus(err), err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (controller *templateController) GetTemplateHandler(c *gin.Context) {
+	info, err := controller.templates.GetTemplate(c.Param("name"))
+	if err != nil {
+		apierror.Respond(c, templateErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func (controller *templateController) GetTemplatesHandler(c *gin.Context) {
+	resp, err := controller.templates.ListTemplates()
+	if err != nil {
+		apierror.Respond(c, templateErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"pdcplet/pkg/pdcpserver/apierror"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UserController interface {
+	CreateUserHandler(c *gin.Context)
+	UpdateUserHandler(c *gin.Context)
+	DeleteUserHandler(c *gin.Context)
+	GetUserHandler(c *gin.Context)
+	GetUsersHandler(c *gin.Context)
+}
+
+type userController struct {
+	users service.UserService
+}
+
+func NewUserController(users service.UserService) UserController {
+	return &userController{users: users}
+}
+
+// userErrorStatus 将用户相关的错误映射为HTTP状态码
+func userErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidUser):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrUserExists):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (controller *userController) CreateUserHandler(c *gin.Context) {
+	var req model.UserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	info, err := controller.users.CreateUser(req)
+	if err != nil {
+		apierror.Respond(c, userErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, info)
+}
+
+func (controller *userController) UpdateUserHandler(c *gin.Context) {
+	var req model.UserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	info, err := controller.users.UpdateUser(c.Param("name"), req)
+	if err != nil {
+		apierror.Respond(c, userErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func (controller *userController) DeleteUserHandler(c *gin.Context) {
+	if err := controller.users.DeleteUser(c.Param("name")); err != nil {
+		apierror.Respond(c, userErrorStatus(err), err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (controller *userController) GetUserHandler(c *gin.Context) {
+	info, err := controller.users.GetUser(c.Param("name"))
+	if err != nil {
+		apierror.Respond(c, userErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func (controller *userController) GetUsersHandler(c *gin.Context) {
+	resp, err := controller.users.ListUsers()
+	if err != nil {
+		apierror.Respond(c, userErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
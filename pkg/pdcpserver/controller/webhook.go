@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"pdcplet/pkg/pdcpserver/apierror"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookController interface {
+	CreateWebhookHandler(c *gin.Context)
+	UpdateWebhookHandler(c *gin.Context)
+	DeleteWebhookHandler(c *gin.Context)
+	GetWebhookHandler(c *gin.Context)
+	GetWebhooksHandler(c *gin.Context)
+	GetWebhookDeliveriesHandler(c *gin.Context)
+}
+
+type webhookController struct {
+	webhooks service.WebhookService
+}
+
+func NewWebhookController(webhooks service.WebhookService) WebhookController {
+	return &webhookController{webhooks: webhooks}
+}
+
+// webhookErrorStatus 将Webhook相关的错误映射为HTTP状态码
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidWebhook):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrWebhookNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrWebhookExists):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrWebhookSecretKey):
+		// 服务端未配置webhooks.secretKey, 无法保存Secret
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (controller *webhookController) CreateWebhookHandler(c *gin.Context) {
+	var req model.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := controller.webhooks.CreateWebhook(req)
+	if err != nil {
+		apierror.Respond(c, webhookErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+func (controller *webhookController) UpdateWebhookHandler(c *gin.Context) {
+	var req model.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	info, err := controller.webhooks.UpdateWebhook(c.Param("name"), req)
+	if err != nil {
+		apierror.Respond(c, webhookErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func (controller *webhookController) DeleteWebhookHandler(c *gin.Context) {
+	if err := controller.webhooks.DeleteWebhook(c.Param("name")); err != nil {
+		apierror.Respond(c, webhookErrorStatus(err), err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (controller *webhookController) GetWebhookHandler(c *gin.Context) {
+	info, err := controller.webhooks.GetWebhook(c.Param("name"))
+	if err != nil {
+		apierror.Respond(c, webhookErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+func (controller *webhookController) GetWebhooksHandler(c *gin.Context) {
+	resp, err := controller.webhooks.ListWebhooks()
+	if err != nil {
+		apierror.Respond(c, webhookErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetWebhookDeliveriesHandler 按ID倒序返回Webhook的投递记录
+func (controller *webhookController) GetWebhookDeliveriesHandler(c *gin.Context) {
+	var req model.WebhookDeliveryQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := controller.webhooks.ListDeliveries(c.Param("name"), req)
+	if err != nil {
+		apierror.Respond(c, webhookErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"pdcplet/pkg/pdcpserver/config"
+
+	"gorm.io/gorm"
+)
+
+// 支持的数据库类型, 对应配置中的db.type
+const (
+	TYPE_SQLITE3  = "sqlite3"
+	TYPE_POSTGRES = "postgres"
+	TYPE_MYSQL    = "mysql"
+)
+
+var DB *gorm.DB
+
+// Init 连接数据库并执行所有未执行的迁移
+func Init(cfg config.DBConfig) error {
+	if err := Open(cfg); err != nil {
+		return err
+	}
+	return MigrateUp(0)
+}
+
+// Open 按db.type连接数据库并设置连接池, 不执行迁移
+func Open(cfg config.DBConfig) error {
+	var dialector gorm.Dialector
+	switch cfg.TypeStr {
+	case TYPE_SQLITE3:
+		if cfg.Sqlite3.Database == "" {
+			return fmt.Errorf("db.sqlite3.database is required")
+		}
+		dialector = openSQLite(cfg.Sqlite3.Database)
+	case TYPE_POSTGRES:
+		if cfg.Postgres.DSN == "" {
+			return fmt.Errorf("db.postgres.dsn is required")
+		}
+		dialector = openPostgres(cfg.Postgres.DSN)
+	case TYPE_MYSQL:
+		var err error
+		if dialector, err = openMySQL(cfg.MySQL.DSN); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported db type %q, option: sqlite3/postgres/mysql", cfg.TypeStr)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return fmt.Errorf("数据库连接失败: %v", err)
+	}
+	if err := configurePool(db, cfg.Pool); err != nil {
+		return err
+	}
+
+	DB = db
+	return nil
+}
+
+func configurePool(db *gorm.DB, cfg config.DBPoolConfig) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if cfg.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	}
+	if cfg.ConnMaxIdleTime > 0 {
+		sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	}
+	return nil
+}
+
+// IsDuplicateKey 判断错误是否为违反唯一约束, 各数据库驱动的错误由对应的dialector转换为gorm.ErrDuplicatedKey
+func IsDuplicateKey(err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	if translator, ok := DB.Dialector.(gorm.ErrorTranslator); ok && err != nil {
+		return errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey)
+	}
+	return false
+}
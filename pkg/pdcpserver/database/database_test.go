@@ -0,0 +1,63 @@
+package database
+
+import (
+	"path/filepath"
+	"pdcplet/pkg/pdcpserver/config"
+	"strings"
+	"testing"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+)
+
+func TestInitRejectsInvalidConfig(t *testing.T) {
+	cases := map[string]config.DBConfig{
+		"unknown type":   {TypeStr: "oracle"},
+		"no sqlite path": {TypeStr: TYPE_SQLITE3},
+		"no postgres":    {TypeStr: TYPE_POSTGRES},
+		"no mysql dsn":   {TypeStr: TYPE_MYSQL},
+		"bad mysql dsn":  {TypeStr: TYPE_MYSQL, MySQL: config.DSNConfig{DSN: "pdcp@tcp(db:3306"}},
+	}
+	for name, cfg := range cases {
+		if err := Init(cfg); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestInitSQLitePool(t *testing.T) {
+	err := Init(config.DBConfig{
+		TypeStr: TYPE_SQLITE3,
+		Sqlite3: config.SQLiteConfig{Database: filepath.Join(t.TempDir(), "pdcpserver.db")},
+		Pool:    config.DBPoolConfig{MaxOpenConns: 4, ConnMaxIdleTime: time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	sqlDB, _ := DB.DB()
+	if got := sqlDB.Stats().MaxOpenConnections; got != 4 {
+		t.Errorf("max open conns = %d, want 4", got)
+	}
+
+	// PRAGMA通过DSN作用于连接池中的每个连接
+	var journalMode string
+	DB.Raw("PRAGMA journal_mode").Scan(&journalMode)
+	if !strings.EqualFold(journalMode, "wal") {
+		t.Errorf("journal_mode = %q, want wal", journalMode)
+	}
+}
+
+func TestOpenMySQLForcesParseTime(t *testing.T) {
+	dialector, err := openMySQL("pdcp:secret@tcp(db:3306)/pdcpserver?charset=utf8mb4")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	cfg, err := mysqldriver.ParseDSN(dialector.(*mysql.Dialector).DSN)
+	if err != nil {
+		t.Fatalf("parse dsn: %v", err)
+	}
+	if !cfg.ParseTime || cfg.Loc != time.UTC || cfg.DBName != "pdcpserver" || cfg.Params["charset"] != "utf8mb4" {
+		t.Errorf("unexpected dsn config: %+v", cfg)
+	}
+}
@@ -0,0 +1,324 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MIGRATION_LOCK_TIMEOUT = 5 * time.Minute  // 等待其他实例完成迁移的最长时间
+	MIGRATION_LOCK_STALE   = 10 * time.Minute // 超过该时间未续期的锁视为持有者已退出
+	MIGRATION_LOCK_RETRY   = time.Second
+)
+
+var (
+	ErrSchemaTooNew     = errors.New("database schema is newer than this pdcpserver supports")
+	ErrMigrationLocked  = errors.New("schema migration is locked by another instance")
+	migrationLockHolder = newMigrationLockHolder()
+)
+
+// SchemaVersion 已执行的迁移, 每个版本一行
+type SchemaVersion struct {
+	Version   uint      `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaVersion) TableName() string { return "schema_version" }
+
+// SchemaMigrationLock 迁移锁, 同一时间只有一个实例执行迁移. 与schema_version一样不属于任何版本,
+// 通过AutoMigrate创建, 只有ID为1的一行
+type SchemaMigrationLock struct {
+	ID       uint      `gorm:"primaryKey;autoIncrement:false"`
+	Holder   string    `gorm:"not null"`
+	LockedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaMigrationLock) TableName() string { return "schema_migration_lock" }
+
+func newMigrationLockHolder() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s/%d/%d", hostname, os.Getpid(), time.Now().UnixNano())
+}
+
+// lockMigrations 获取迁移锁, 锁被其他实例持有时每MIGRATION_LOCK_RETRY重试一次, 超过timeout返回ErrMigrationLocked.
+// 持有期间每MIGRATION_LOCK_STALE/3续期一次, 返回的函数释放锁
+func lockMigrations(timeout time.Duration) (func(), error) {
+	// 多个实例可能同时创建锁表, 创建失败但表已存在时忽略
+	if err := DB.AutoMigrate(&SchemaMigrationLock{}); err != nil && !DB.Migrator().HasTable(&SchemaMigrationLock{}) {
+		return nil, fmt.Errorf("create schema_migration_lock: %w", err)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		// 持有者异常退出后锁不会被释放, 超时未续期的锁直接删除
+		err := DB.Where("id = ? AND locked_at < ?", 1, time.Now().Add(-MIGRATION_LOCK_STALE)).Delete(&SchemaMigrationLock{}).Error
+		if err != nil {
+			return nil, err
+		}
+		lock := SchemaMigrationLock{ID: 1, Holder: migrationLockHolder, LockedAt: time.Now()}
+		res := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&lock)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 1 {
+			break
+		}
+		var holder SchemaMigrationLock
+		DB.Limit(1).Find(&holder, 1)
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: held by %s since %s", ErrMigrationLocked, holder.Holder, holder.LockedAt.Format(time.RFC3339))
+		}
+		slog.Info("Waiting for schema migration lock", "holder", holder.Holder)
+		time.Sleep(MIGRATION_LOCK_RETRY)
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(MIGRATION_LOCK_STALE / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				err := DB.Model(&SchemaMigrationLock{}).Where("id = ? AND holder = ?", 1, migrationLockHolder).
+					Update("LockedAt", time.Now()).Error
+				if err != nil {
+					slog.Error("Failed to renew schema migration lock", "error", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		err := DB.Where("id = ? AND holder = ?", 1, migrationLockHolder).Delete(&SchemaMigrationLock{}).Error
+		if err != nil {
+			slog.Error("Failed to release schema migration lock", "error", err)
+		}
+	}, nil
+}
+
+// Migration 一个版本的表结构变更. Up和Down在同一事务中执行并更新schema_version,
+// MySQL的DDL会隐式提交事务, 失败时需要人工检查
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// migrations 按版本号递增排列, 已发布的迁移不能修改, 表结构变化只能追加新的迁移
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		// 引入版本化迁移之前由AutoMigrate创建的数据库没有schema_version, AutoMigrate只补充缺少的表、列和索引,
+		// 因此对这类数据库执行版本1即可完成接管
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(v1Tables...)
+		},
+		Down: func(tx *gorm.DB) error {
+			tables := slices.Clone(v1Tables)
+			slices.Reverse(tables)
+			return tx.Migrator().DropTable(tables...)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "events",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&v2Event{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v2Event{})
+		},
+	},
+	{
+		Version: 3,
+		Name:    "webhooks",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&v3Webhook{}, &v3WebhookDelivery{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v3WebhookDelivery{}, &v3Webhook{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "job error code",
+		Up: func(tx *gorm.DB) error {
+			for _, t := range v4Columns {
+				for _, column := range t.columns {
+					if err := tx.Migrator().AddColumn(t.table, column); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, t := range v4Columns {
+				for _, column := range t.columns {
+					if err := tx.Migrator().DropColumn(t.table, column); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 5,
+		Name:    "webhook dispatch cursor",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&v5WebhookDispatchCursor{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v5WebhookDispatchCursor{})
+		},
+	},
+	{
+		Version: 6,
+		Name:    "unique live vm name",
+		Up:      v6Up,
+		Down:    v6Down,
+	},
+}
+
+type MigrationStatus struct {
+	Version   uint
+	Name      string
+	AppliedAt *time.Time // 为nil表示未执行
+}
+
+// LatestVersion 当前程序支持的最新版本
+func LatestVersion() uint {
+	return migrations[len(migrations)-1].Version
+}
+
+func appliedVersions() (map[uint]SchemaVersion, error) {
+	if err := DB.AutoMigrate(&SchemaVersion{}); err != nil {
+		return nil, fmt.Errorf("create schema_version: %w", err)
+	}
+	var rows []SchemaVersion
+	if err := DB.Order("version asc").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[uint]SchemaVersion, len(rows))
+	for _, row := range rows {
+		if row.Version > LatestVersion() {
+			return nil, fmt.Errorf("%w: applied version %d, latest known version %d", ErrSchemaTooNew, row.Version, LatestVersion())
+		}
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// MigrationStatuses 返回所有迁移及其执行时间
+func MigrationStatuses() ([]MigrationStatus, error) {
+	applied, err := appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if row, ok := applied[m.Version]; ok {
+			status.AppliedAt = &row.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// MigrateUp 按顺序执行版本不超过target的未执行迁移, target为0时迁移到最新版本.
+// 多个实例同时启动时只有一个执行迁移, 其他实例等待后看到已执行的版本
+func MigrateUp(target uint) error {
+	if target == 0 {
+		target = LatestVersion()
+	}
+	unlock, err := lockMigrations(MIGRATION_LOCK_TIMEOUT)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	applied, err := appliedVersions()
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaVersion{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migrate up to version %d (%s): %w", m.Version, m.Name, err)
+		}
+		slog.Info("Applied schema migration", "version", m.Version, "name", m.Name)
+	}
+	return nil
+}
+
+// MigrateDown 按版本从高到低回滚所有高于target的已执行迁移, target为0时回滚全部迁移并删除所有表
+func MigrateDown(target uint) error {
+	unlock, err := lockMigrations(MIGRATION_LOCK_TIMEOUT)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	applied, err := appliedVersions()
+	if err != nil {
+		return err
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= target {
+			break
+		}
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaVersion{Version: m.Version}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migrate down version %d (%s): %w", m.Version, m.Name, err)
+		}
+		slog.Info("Reverted schema migration", "version", m.Version, "name", m.Name)
+	}
+	return nil
+}
+
+// CurrentVersion 已执行的最高版本, 未执行任何迁移时为0
+func CurrentVersion() (uint, error) {
+	applied, err := appliedVersions()
+	if err != nil {
+		return 0, err
+	}
+	var current uint
+	for version := range applied {
+		current = max(current, version)
+	}
+	return current, nil
+}
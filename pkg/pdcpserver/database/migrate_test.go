@@ -0,0 +1,225 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestDB(t *testing.T) {
+	t.Helper()
+	err := Open(config.DBConfig{TypeStr: TYPE_SQLITE3, Sqlite3: config.SQLiteConfig{Database: filepath.Join(t.TempDir(), "pdcpserver.db")}})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+}
+
+// TestMigrationsMatchModels 修改model后必须追加迁移, 否则该测试失败
+func TestMigrationsMatchModels(t *testing.T) {
+	openTestDB(t)
+	if err := MigrateUp(0); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+
+	models := []interface{}{
+		&model.VirtualMachineRecord{}, &model.VirtualMachineDisk{}, &model.VirtualMachineInterface{},
+		&model.Node{}, &model.DissectionRule{}, &model.TaskMetricSample{}, &model.NicMetricSample{},
+		&model.MetricsUploadCursor{}, &model.MetricsRollupWatermark{}, &model.Job{}, &model.JobEvent{},
+		&model.VMTemplate{}, &model.APIKey{}, &model.User{}, &model.AuditEvent{}, &model.Event{},
+		&model.Webhook{}, &model.WebhookDelivery{}, &model.WebhookDispatchCursor{},
+	}
+	migrator := DB.Migrator()
+	for _, m := range models {
+		stmt := DB.Model(m).Statement
+		if err := stmt.Parse(m); err != nil {
+			t.Fatalf("parse %T: %v", m, err)
+		}
+		if !migrator.HasTable(m) {
+			t.Errorf("table %s is missing", stmt.Schema.Table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !field.IgnoreMigration && !migrator.HasColumn(m, field.DBName) {
+				t.Errorf("column %s.%s is missing", stmt.Schema.Table, field.DBName)
+			}
+		}
+		for _, idx := range stmt.Schema.ParseIndexes() {
+			if !migrator.HasIndex(m, idx.Name) {
+				t.Errorf("index %s on %s is missing", idx.Name, stmt.Schema.Table)
+			}
+		}
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	openTestDB(t)
+	if err := MigrateUp(0); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	if v, _ := CurrentVersion(); v != LatestVersion() {
+		t.Fatalf("current version = %d, want %d", v, LatestVersion())
+	}
+
+	if err := MigrateDown(0); err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+	if DB.Migrator().HasTable(&model.VirtualMachineRecord{}) {
+		t.Fatalf("tables should be dropped after migrating down to 0")
+	}
+	statuses, err := MigrationStatuses()
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	for _, s := range statuses {
+		if s.AppliedAt != nil {
+			t.Errorf("version %d is still applied", s.Version)
+		}
+	}
+
+	// 再次执行不应报错
+	for i := 0; i < 2; i++ {
+		if err := MigrateUp(0); err != nil {
+			t.Fatalf("migrate up again: %v", err)
+		}
+	}
+	if v, _ := CurrentVersion(); v != LatestVersion() {
+		t.Fatalf("current version = %d, want %d", v, LatestVersion())
+	}
+}
+
+// legacyVirtualMachineRecord 引入版本化迁移之前较早版本的表结构, 缺少Owner等列
+type legacyVirtualMachineRecord struct {
+	ID        uint `gorm:"primaryKey;autoIncrement"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Name      string `gorm:"not null;index"`
+	Namespace string `gorm:"not null;default:default;index"`
+	CPU       int    `gorm:"not null"`
+	Memory    string `gorm:"not null"`
+	Status    string `gorm:"not null"`
+}
+
+func (legacyVirtualMachineRecord) TableName() string { return "virtual_machine_records" }
+
+func TestAdoptLegacyDatabase(t *testing.T) {
+	openTestDB(t)
+	if err := DB.AutoMigrate(&legacyVirtualMachineRecord{}); err != nil {
+		t.Fatalf("create legacy table: %v", err)
+	}
+	legacy := legacyVirtualMachineRecord{Name: "vm1", Namespace: "default", CPU: 1, Memory: "1Gi", Status: "Running"}
+	DB.Create(&legacy)
+
+	if err := MigrateUp(0); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	var vmr model.VirtualMachineRecord
+	if err := DB.First(&vmr, legacy.ID).Error; err != nil {
+		t.Fatalf("legacy record lost: %v", err)
+	}
+	if vmr.Name != "vm1" || vmr.Status != model.Running || vmr.Owner != "" {
+		t.Errorf("unexpected record after migration: %+v", vmr)
+	}
+}
+
+func TestRefuseNewerSchema(t *testing.T) {
+	openTestDB(t)
+	if err := MigrateUp(0); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	DB.Create(&SchemaVersion{Version: LatestVersion() + 1, Name: "future", AppliedAt: time.Now()})
+	if err := MigrateUp(0); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("err = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+func TestMigrationLock(t *testing.T) {
+	openTestDB(t)
+	unlock, err := lockMigrations(time.Second)
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if _, err := lockMigrations(0); !errors.Is(err, ErrMigrationLocked) {
+		t.Fatalf("second lock: err = %v, want ErrMigrationLocked", err)
+	}
+	unlock()
+	unlock, err = lockMigrations(0)
+	if err != nil {
+		t.Fatalf("lock after unlock: %v", err)
+	}
+	unlock()
+
+	// 持有者退出后未释放的锁超时后可以被接管
+	DB.Create(&SchemaMigrationLock{ID: 1, Holder: "crashed", LockedAt: time.Now().Add(-MIGRATION_LOCK_STALE - time.Second)})
+	unlock, err = lockMigrations(0)
+	if err != nil {
+		t.Fatalf("take over stale lock: %v", err)
+	}
+	unlock()
+	var count int64
+	DB.Model(&SchemaMigrationLock{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("lock rows after unlock = %d", count)
+	}
+}
+
+func TestConcurrentMigrateUp(t *testing.T) {
+	openTestDB(t)
+	errs := make(chan error, 3)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- MigrateUp(0) }()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("migrate up: %v", err)
+		}
+	}
+	var rows []SchemaVersion
+	DB.Order("version asc").Find(&rows)
+	if len(rows) != len(migrations) {
+		t.Fatalf("schema_version rows = %+v", rows)
+	}
+}
+
+func TestUniqueLiveVMName(t *testing.T) {
+	openTestDB(t)
+	if err := MigrateUp(0); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	create := func(namespace, name string) error {
+		return DB.Create(&model.VirtualMachineRecord{Name: name, Namespace: namespace, CPU: 1, Memory: "1Gi", Status: model.Pending}).Error
+	}
+	if err := create("default", "vm1"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := create("default", "vm1"); !IsDuplicateKey(err) {
+		t.Fatalf("create duplicate: err = %v, want duplicate key", err)
+	}
+	if err := create("team-a", "vm1"); err != nil {
+		t.Fatalf("create in other namespace: %v", err)
+	}
+	// 已删除的记录不占用名称
+	if err := DB.Where("namespace = ? AND name = ?", "default", "vm1").Delete(&model.VirtualMachineRecord{}).Error; err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := create("default", "vm1"); err != nil {
+		t.Fatalf("create after delete: %v", err)
+	}
+	if IsDuplicateKey(nil) || IsDuplicateKey(errors.New("other")) {
+		t.Fatalf("unexpected duplicate key")
+	}
+
+	// 回滚后可以写入重复记录, 此时再次迁移需要先人工处理
+	if err := MigrateDown(5); err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+	if err := create("default", "vm1"); err != nil {
+		t.Fatalf("create duplicate without index: %v", err)
+	}
+	if err := MigrateUp(0); err == nil || !strings.Contains(err.Error(), "duplicate virtual machine records") {
+		t.Fatalf("migrate up with duplicates: err = %v", err)
+	}
+}
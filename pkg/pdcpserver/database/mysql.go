@@ -0,0 +1,24 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// openMySQL 强制开启parseTime并使用UTC, 使DATETIME列能扫描为time.Time且与其他数据库的时间语义一致
+func openMySQL(dsn string) (gorm.Dialector, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("db.mysql.dsn is required")
+	}
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid db.mysql.dsn: %w", err)
+	}
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+	return mysql.Open(cfg.FormatDSN()), nil
+}
@@ -0,0 +1,11 @@
+package database
+
+import (
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// openPostgres dsn支持key=value和postgres://两种格式
+func openPostgres(dsn string) gorm.Dialector {
+	return postgres.Open(dsn)
+}
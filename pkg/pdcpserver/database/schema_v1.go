@@ -0,0 +1,283 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 版本1的表结构快照. 迁移不能引用model中的类型, 否则model变化后早期迁移的结果也会随之变化.
+// 以下类型只用于创建版本1的表, 之后的表结构变化通过新的迁移完成
+
+type v1VirtualMachineRecord struct {
+	ID                 uint `gorm:"primaryKey;autoIncrement"`
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	DeletedAt          gorm.DeletedAt `gorm:"index"`
+	Name               string         `gorm:"not null;index"`
+	Namespace          string         `gorm:"not null;default:default;index"`
+	CPU                int            `gorm:"not null"`
+	Memory             string         `gorm:"not null"`
+	Template           string         `gorm:"not null;default:''"`
+	Owner              string         `gorm:"not null;default:'';index"`
+	Status             string         `gorm:"not null"`
+	Spec               string         `gorm:"type:text"`
+	Attempts           int            `gorm:"not null;default:0"`
+	LastError          string
+	NextAttemptAt      *time.Time `gorm:"index"`
+	Phase              string
+	NodeName           string
+	IPs                string
+	Ready              bool `gorm:"not null;default:false"`
+	LastTransitionTime *time.Time
+}
+
+func (v1VirtualMachineRecord) TableName() string { return "virtual_machine_records" }
+
+type v1VirtualMachineDisk struct {
+	gorm.Model
+	VirtualMachineRecordID uint   `gorm:"not null;index"`
+	VmName                 string `gorm:"not null"`
+	VmNamespace            string `gorm:"not null;index:idx_disk_datavolume"`
+	Name                   string `gorm:"not null"`
+	Type                   string `gorm:"not null"`
+	Bus                    string
+	Image                  string
+	DataVolumeName         string `gorm:"index:idx_disk_datavolume"`
+	Source                 string
+	URL                    string
+	Size                   string
+	StorageClass           string
+	Retention              string
+	Status                 string `gorm:"not null"`
+}
+
+func (v1VirtualMachineDisk) TableName() string { return "virtual_machine_disks" }
+
+type v1VirtualMachineInterface struct {
+	gorm.Model
+	VirtualMachineRecordID uint   `gorm:"not null;index"`
+	VmName                 string `gorm:"not null"`
+	VmNamespace            string `gorm:"not null"`
+	Name                   string `gorm:"not null"`
+	Type                   string `gorm:"not null"`
+	Binding                string `gorm:"not null"`
+	NetworkName            string
+	Mac                    string `gorm:"index:idx_interface_nic,priority:1"`
+	Vid                    int64  `gorm:"not null;default:0;index:idx_interface_nic,priority:2"`
+}
+
+func (v1VirtualMachineInterface) TableName() string { return "virtual_machine_interfaces" }
+
+type v1Node struct {
+	ID                 uint      `gorm:"primaryKey;autoIncrement"`
+	Name               string    `gorm:"size:253;not null;uniqueIndex"`
+	Version            string    `gorm:"not null;default:''"`
+	SessionId          string    `gorm:"not null;default:''"`
+	Modules            []string  `gorm:"serializer:json"`
+	InpplatReachable   bool      `gorm:"not null;default:false"`
+	InpplatError       string    `gorm:"size:1024;not null;default:''"`
+	Status             string    `gorm:"not null;index"`
+	RegisteredAt       time.Time `gorm:"not null"`
+	LastHeartbeatAt    time.Time `gorm:"not null;index"`
+	AppliedRuleVersion string    `gorm:"not null;default:''"`
+	RuleSyncError      string    `gorm:"size:1024;not null;default:''"`
+	RulesSyncedAt      *time.Time
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+func (v1Node) TableName() string { return "nodes" }
+
+type v1DissectionRule struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement"`
+	Name        string `gorm:"size:253;not null;uniqueIndex"`
+	Description string `gorm:"size:1024;not null;default:''"`
+	Protocol    string `gorm:"not null"`
+	Filter      string `gorm:"size:1024;not null;default:''"`
+	Priority    int    `gorm:"not null;default:0"`
+	Enabled     bool   `gorm:"not null;default:true"`
+	VMs         string `gorm:"type:text"`
+	Labels      string `gorm:"type:text"`
+	Version     int64  `gorm:"not null;default:1"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (v1DissectionRule) TableName() string { return "dissection_rules" }
+
+type v1TaskMetricSample struct {
+	ID                     uint      `gorm:"primaryKey;autoIncrement"`
+	Resolution             string    `gorm:"not null;index:idx_task_sample_series,priority:1"`
+	NodeName               string    `gorm:"not null;index:idx_task_sample_series,priority:2"`
+	TaskId                 int       `gorm:"not null;index:idx_task_sample_series,priority:3"`
+	Timestamp              time.Time `gorm:"not null;index:idx_task_sample_series,priority:4"`
+	VmName                 string    `gorm:"index"`
+	VmNamespace            string
+	VirtualMachineRecordID *uint                   `gorm:"index"`
+	VirtualMachineRecord   *v1VirtualMachineRecord `gorm:"constraint:OnDelete:SET NULL"`
+	Samples                int                     `gorm:"not null;default:1"`
+	Sent                   int64                   `gorm:"not null;default:0"`
+	Dropped                int64                   `gorm:"not null;default:0"`
+	Avgbps                 int64                   `gorm:"not null;default:0"`
+	Avgpps                 int64                   `gorm:"not null;default:0"`
+	Realbps                int64                   `gorm:"not null;default:0"`
+	Realpps                int64                   `gorm:"not null;default:0"`
+}
+
+func (v1TaskMetricSample) TableName() string { return "task_metric_samples" }
+
+type v1NicMetricSample struct {
+	ID                     uint      `gorm:"primaryKey;autoIncrement"`
+	Resolution             string    `gorm:"not null;index:idx_nic_sample_series,priority:1"`
+	NodeName               string    `gorm:"not null;index:idx_nic_sample_series,priority:2"`
+	TaskId                 int       `gorm:"not null;index:idx_nic_sample_series,priority:3"`
+	Vid                    int64     `gorm:"not null;index:idx_nic_sample_series,priority:4"`
+	Mac                    string    `gorm:"not null;index:idx_nic_sample_series,priority:5"`
+	Timestamp              time.Time `gorm:"not null;index:idx_nic_sample_series,priority:6"`
+	VmName                 string    `gorm:"index"`
+	VmNamespace            string
+	VirtualMachineRecordID *uint                   `gorm:"index"`
+	VirtualMachineRecord   *v1VirtualMachineRecord `gorm:"constraint:OnDelete:SET NULL"`
+	Samples                int                     `gorm:"not null;default:1"`
+	Sent                   int64                   `gorm:"not null;default:0"`
+	Dropped                int64                   `gorm:"not null;default:0"`
+	Avgbps                 int64                   `gorm:"not null;default:0"`
+	Avgpps                 int64                   `gorm:"not null;default:0"`
+	Realbps                int64                   `gorm:"not null;default:0"`
+	Realpps                int64                   `gorm:"not null;default:0"`
+}
+
+func (v1NicMetricSample) TableName() string { return "nic_metric_samples" }
+
+type v1MetricsUploadCursor struct {
+	NodeName     string `gorm:"primaryKey"`
+	SessionId    string `gorm:"not null"`
+	LastSequence uint64 `gorm:"not null"`
+	UpdatedAt    time.Time
+}
+
+func (v1MetricsUploadCursor) TableName() string { return "metrics_upload_cursors" }
+
+type v1MetricsRollupWatermark struct {
+	Resolution string    `gorm:"primaryKey"`
+	Watermark  time.Time `gorm:"not null"`
+}
+
+func (v1MetricsRollupWatermark) TableName() string { return "metrics_rollup_watermarks" }
+
+type v1JobEvent struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement"`
+	JobID     string `gorm:"not null;index;size:32"`
+	Attempt   int    `gorm:"not null"`
+	Status    string `gorm:"not null"`
+	Message   string
+	CreatedAt time.Time
+}
+
+func (v1JobEvent) TableName() string { return "job_events" }
+
+type v1Job struct {
+	ID                     string `gorm:"primaryKey;size:32"`
+	Type                   string `gorm:"not null;index"`
+	VmName                 string `gorm:"not null;index"`
+	VmNamespace            string `gorm:"not null"`
+	Owner                  string `gorm:"not null;default:''"`
+	Status                 string `gorm:"not null;index"`
+	Progress               string
+	Payload                string `gorm:"type:text"`
+	Result                 string `gorm:"type:text"`
+	Error                  string
+	Attempts               int       `gorm:"not null;default:0"`
+	MaxAttempts            int       `gorm:"not null"`
+	NextRunAt              time.Time `gorm:"index"`
+	StartedAt              *time.Time
+	FinishedAt             *time.Time
+	CreatedAt              time.Time
+	UpdatedAt              time.Time
+	VirtualMachineRecordID *uint
+	Events                 []v1JobEvent `gorm:"foreignKey:JobID;constraint:OnDelete:CASCADE"`
+}
+
+func (v1Job) TableName() string { return "jobs" }
+
+type v1VMTemplate struct {
+	ID               uint   `gorm:"primaryKey;autoIncrement"`
+	Name             string `gorm:"size:253;not null;uniqueIndex"`
+	Description      string `gorm:"size:1024;not null;default:''"`
+	CPU              int    `gorm:"not null"`
+	Memory           string `gorm:"not null"`
+	Disks            string `gorm:"type:text"`
+	Networks         string `gorm:"type:text"`
+	CloudInit        string `gorm:"type:text"`
+	Labels           string `gorm:"type:text"`
+	AllowedOverrides string `gorm:"type:text"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+func (v1VMTemplate) TableName() string { return "vm_templates" }
+
+type v1APIKey struct {
+	ID         uint   `gorm:"primaryKey;autoIncrement"`
+	Name       string `gorm:"size:253;not null;uniqueIndex"`
+	Prefix     string `gorm:"size:32;not null;uniqueIndex"`
+	Hash       string `gorm:"not null"`
+	Kind       string `gorm:"not null"`
+	UserName   string `gorm:"not null;default:'';index"`
+	NodeName   string `gorm:"not null;default:''"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+func (v1APIKey) TableName() string { return "api_keys" }
+
+type v1User struct {
+	ID         uint   `gorm:"primaryKey;autoIncrement"`
+	Name       string `gorm:"size:253;not null;uniqueIndex"`
+	Role       string `gorm:"not null"`
+	Namespaces string `gorm:"type:text"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (v1User) TableName() string { return "users" }
+
+type v1AuditEvent struct {
+	ID              uint      `gorm:"primaryKey;autoIncrement"`
+	Timestamp       time.Time `gorm:"not null;index"`
+	Source          string    `gorm:"not null"`
+	Actor           string    `gorm:"not null;index"`
+	AuthMethod      string    `gorm:"not null;default:''"`
+	Action          string    `gorm:"not null;index"`
+	TargetNamespace string    `gorm:"not null;default:'';index"`
+	TargetName      string    `gorm:"not null;default:''"`
+	PayloadHash     string    `gorm:"not null;default:''"`
+	Result          string    `gorm:"not null;index"`
+	StatusCode      int       `gorm:"not null;default:0"`
+	Error           string    `gorm:"type:text"`
+	LatencyMs       int64     `gorm:"not null;default:0"`
+	ClientIP        string    `gorm:"not null;default:''"`
+}
+
+func (v1AuditEvent) TableName() string { return "audit_events" }
+
+// v1Tables 按依赖顺序排列, 删除时逆序
+var v1Tables = []interface{}{
+	&v1VirtualMachineRecord{},
+	&v1VirtualMachineDisk{},
+	&v1VirtualMachineInterface{},
+	&v1Node{},
+	&v1DissectionRule{},
+	&v1TaskMetricSample{},
+	&v1NicMetricSample{},
+	&v1MetricsUploadCursor{},
+	&v1MetricsRollupWatermark{},
+	&v1Job{},
+	&v1JobEvent{},
+	&v1VMTemplate{},
+	&v1APIKey{},
+	&v1User{},
+	&v1AuditEvent{},
+}
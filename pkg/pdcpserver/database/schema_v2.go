@@ -0,0 +1,17 @@
+package database
+
+import "time"
+
+// 版本2新增的事件表
+
+type v2Event struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	Type      string    `gorm:"not null;index"`
+	Namespace string    `gorm:"not null;default:'';index"`
+	Name      string    `gorm:"not null;default:''"`
+	NodeName  string    `gorm:"not null;default:''"`
+	Data      string    `gorm:"type:text"`
+	CreatedAt time.Time `gorm:"not null;index"`
+}
+
+func (v2Event) TableName() string { return "events" }
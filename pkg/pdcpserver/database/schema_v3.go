@@ -0,0 +1,39 @@
+package database
+
+import "time"
+
+// 版本3新增的Webhook订阅和投递记录表
+
+type v3Webhook struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement"`
+	Name        string `gorm:"size:253;not null;uniqueIndex"`
+	URL         string `gorm:"size:2048;not null"`
+	Description string `gorm:"size:1024;not null;default:''"`
+	EventTypes  string `gorm:"type:text"`
+	Namespace   string `gorm:"not null;default:''"`
+	Secret      string `gorm:"not null"`
+	Enabled     bool   `gorm:"not null"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (v3Webhook) TableName() string { return "webhooks" }
+
+type v3WebhookDelivery struct {
+	ID            uint       `gorm:"primaryKey;autoIncrement"`
+	WebhookID     uint       `gorm:"not null;index"`
+	EventID       uint       `gorm:"not null"`
+	EventType     string     `gorm:"not null"`
+	Payload       string     `gorm:"type:text"`
+	Status        string     `gorm:"not null;index"`
+	Attempts      int        `gorm:"not null;default:0"`
+	NextAttemptAt *time.Time `gorm:"index"`
+	StatusCode    int        `gorm:"not null;default:0"`
+	Error         string     `gorm:"size:1024;not null;default:''"`
+	DurationMs    int64      `gorm:"not null;default:0"`
+	DeliveredAt   *time.Time
+	CreatedAt     time.Time `gorm:"index"`
+	UpdatedAt     time.Time
+}
+
+func (v3WebhookDelivery) TableName() string { return "webhook_deliveries" }
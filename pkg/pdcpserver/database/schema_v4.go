@@ -0,0 +1,25 @@
+package database
+
+// 版本4新增的列: 任务失败原因的错误类型和状态码, VM记录最近一次错误的Kubernetes StatusReason
+
+type v4Job struct {
+	ErrorCode   string `gorm:"not null;default:''"`
+	ErrorStatus int    `gorm:"not null;default:0"`
+}
+
+func (v4Job) TableName() string { return "jobs" }
+
+type v4VirtualMachineRecord struct {
+	LastErrorReason string `gorm:"not null;default:''"`
+}
+
+func (v4VirtualMachineRecord) TableName() string { return "virtual_machine_records" }
+
+// v4Columns 版本4新增的列, 按表分组
+var v4Columns = []struct {
+	table   interface{}
+	columns []string
+}{
+	{&v4Job{}, []string{"ErrorCode", "ErrorStatus"}},
+	{&v4VirtualMachineRecord{}, []string{"LastErrorReason"}},
+}
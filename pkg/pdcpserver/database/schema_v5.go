@@ -0,0 +1,13 @@
+package database
+
+import "time"
+
+// 版本5新增的Webhook投递游标表, 记录最后一个已生成投递记录的事件
+
+type v5WebhookDispatchCursor struct {
+	ID          uint `gorm:"primaryKey;autoIncrement:false"`
+	LastEventID uint `gorm:"not null"`
+	UpdatedAt   time.Time
+}
+
+func (v5WebhookDispatchCursor) TableName() string { return "webhook_dispatch_cursors" }
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// 版本6为未删除的VM记录增加(namespace, name)唯一索引, 防止并发创建同名VM时都通过存在性检查.
+// SQLite和PostgreSQL使用部分索引, MySQL不支持部分索引, 使用未删除时为1、删除后为NULL的生成列,
+// 唯一索引中包含NULL的行互不冲突
+
+const v6LiveNameIndex = "idx_vm_records_live_name"
+
+type v6VirtualMachineRecord struct{}
+
+func (v6VirtualMachineRecord) TableName() string { return "virtual_machine_records" }
+
+// v6CheckDuplicates 已存在同名的未删除记录时无法创建唯一索引, 返回这些记录以便人工处理
+func v6CheckDuplicates(tx *gorm.DB) error {
+	var duplicates []struct {
+		Namespace string
+		Name      string
+		Count     int
+	}
+	err := tx.Table("virtual_machine_records").Select("namespace, name, COUNT(*) AS count").
+		Where("deleted_at IS NULL").Group("namespace, name").Having("COUNT(*) > 1").Scan(&duplicates).Error
+	if err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("duplicate virtual machine records must be deleted before migrating: %+v", duplicates)
+	}
+	return nil
+}
+
+func v6Up(tx *gorm.DB) error {
+	if err := v6CheckDuplicates(tx); err != nil {
+		return err
+	}
+	if tx.Dialector.Name() == TYPE_MYSQL {
+		return tx.Exec("ALTER TABLE virtual_machine_records" +
+			" ADD COLUMN live TINYINT AS (IF(deleted_at IS NULL, 1, NULL)) VIRTUAL," +
+			" ADD UNIQUE INDEX " + v6LiveNameIndex + " (namespace, name, live)").Error
+	}
+	return tx.Exec("CREATE UNIQUE INDEX " + v6LiveNameIndex +
+		" ON virtual_machine_records (namespace, name) WHERE deleted_at IS NULL").Error
+}
+
+func v6Down(tx *gorm.DB) error {
+	if err := tx.Migrator().DropIndex(&v6VirtualMachineRecord{}, v6LiveNameIndex); err != nil {
+		return err
+	}
+	if tx.Dialector.Name() == TYPE_MYSQL {
+		return tx.Migrator().DropColumn(&v6VirtualMachineRecord{}, "live")
+	}
+	return nil
+}
@@ -1,33 +1,25 @@
 package database
 
 import (
-	"fmt"
-	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/config"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-var DB *gorm.DB
+// SQLite的PRAGMA只对执行它的连接生效, 连接池中的每个连接都需要通过DSN参数设置
+const sqliteDSNParams = "?_txlock=immediate" + // 写事务立即加锁, 避免读事务升级为写事务时死锁
+	"&_journal_mode=WAL" + // 启用WAL
+	"&_synchronous=NORMAL" + // 平衡性能与数据安全
+	"&_busy_timeout=5000" + // 设置5秒锁等待超时, 防止SQLITE_BUSY错误
+	"&_foreign_keys=true" + // 执行外键
+	"&_cache_size=1000000000" // 增加SQLite缓存
 
-func InitSQLite(configPath string) error {
-	db, err := gorm.Open(sqlite.Open(configPath+"?_txlock=immediate"), &gorm.Config{})
-	if err != nil {
-		return fmt.Errorf("数据库连接失败: %v", err)
-	}
-
-	db.Exec("PRAGMA journal_mode=WAL;")        // 启用WAL
-	db.Exec("PRAGMA synchronous=NORMAL;")      // 平衡性能与数据安全
-	db.Exec("PRAGMA busy_timeout=5000;")       // 设置5秒锁等待超时
-	db.Exec("PRAGMA cache_size = 1000000000;") // 增加SQLite缓存
-	db.Exec("PRAGMA foreign_keys = true;")     // 执行外键
-	db.Exec("PRAGMA busy_timeout = 5000;")     // 设置一个更大的busy_timeout有助于防止SQLITE_BUSY错误
-
-	// 自动迁移表结构
-	if err := db.AutoMigrate(&model.VirtualMachineRecord{}); err != nil {
-		return fmt.Errorf("表迁移失败: %v", err)
-	}
+func openSQLite(path string) gorm.Dialector {
+	return sqlite.Open(path + sqliteDSNParams)
+}
 
-	DB = db
-	return nil
+// InitSQLite 使用SQLite初始化数据库, 供测试和只使用SQLite的场景调用
+func InitSQLite(path string) error {
+	return Init(config.DBConfig{TypeStr: TYPE_SQLITE3, Sqlite3: config.SQLiteConfig{Database: path}})
 }
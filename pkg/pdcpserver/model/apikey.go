@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+type APIKeyKind string
+
+const (
+	APIKeyUser  APIKeyKind = "user"  // 访问pdcpserver API
+	APIKeyAgent APIKeyKind = "agent" // pdcplet访问/pdcplet下的路由
+)
+
+// APIKey 静态API Key, 只保存Key的SHA-256, 明文只在创建时返回一次
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey;autoIncrement"`
+	Name       string     `gorm:"size:253;not null;uniqueIndex"`
+	Prefix     string     `gorm:"size:32;not null;uniqueIndex"` // Key中的随机前缀, 用于查找
+	Hash       string     `gorm:"not null"`
+	Kind       APIKeyKind `gorm:"not null"`
+	UserName   string     `gorm:"not null;default:'';index"` // user类型的Key所属的用户
+	NodeName   string     `gorm:"not null;default:''"`       // agent类型的Key可以限定节点
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// APIKeyRequest 创建API Key的请求
+type APIKeyRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	Kind      APIKeyKind `json:"kind,omitempty"` // 默认user
+	UserName  string     `json:"user,omitempty"` // user类型的Key所属的用户, 默认与Name相同
+	NodeName  string     `json:"nodeName,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type APIKeyInfo struct {
+	Name       string     `json:"name"`
+	Kind       APIKeyKind `json:"kind"`
+	Prefix     string     `json:"prefix"`
+	UserName   string     `json:"user,omitempty"`
+	NodeName   string     `json:"nodeName,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// APIKeyCreateResponse 创建API Key的结果, Key只返回这一次
+type APIKeyCreateResponse struct {
+	APIKeyInfo
+	Key string `json:"key"`
+}
+
+type APIKeyListResponse struct {
+	Items []APIKeyInfo `json:"items"`
+}
@@ -0,0 +1,68 @@
+package model
+
+import "time"
+
+const (
+	AuditSourceAPI        = "api"
+	AuditSourceReconciler = "reconciler"
+)
+
+const (
+	AuditResultSuccess = "success"
+	AuditResultDenied  = "denied" // 认证失败或无权限
+	AuditResultFailure = "failure"
+)
+
+// AuditEvent 审计记录, 记录所有修改类API调用、被拒绝的请求以及reconciler对KubeVirt的操作
+type AuditEvent struct {
+	ID              uint      `gorm:"primaryKey;autoIncrement"`
+	Timestamp       time.Time `gorm:"not null;index"`
+	Source          string    `gorm:"not null"`
+	Actor           string    `gorm:"not null;index"`
+	AuthMethod      string    `gorm:"not null;default:''"`
+	Action          string    `gorm:"not null;index"` // API为"<HTTP方法> <路由>", reconciler为vm.create等
+	TargetNamespace string    `gorm:"not null;default:'';index"`
+	TargetName      string    `gorm:"not null;default:''"`
+	PayloadHash     string    `gorm:"not null;default:''"` // 请求体的SHA-256, 不保存请求体本身
+	Result          string    `gorm:"not null;index"`
+	StatusCode      int       `gorm:"not null;default:0"`
+	Error           string    `gorm:"type:text"`
+	LatencyMs       int64     `gorm:"not null;default:0"`
+	ClientIP        string    `gorm:"not null;default:''"`
+}
+
+// AuditQueryRequest 审计记录的查询条件, 按ID倒序分页, Cursor为上一页返回的NextCursor
+type AuditQueryRequest struct {
+	Actor     string    `form:"actor"`
+	Action    string    `form:"action"`
+	Namespace string    `form:"namespace"`
+	Name      string    `form:"name"`
+	Result    string    `form:"result" binding:"omitempty,oneof=success denied failure"`
+	Source    string    `form:"source" binding:"omitempty,oneof=api reconciler"`
+	From      time.Time `form:"from"`
+	To        time.Time `form:"to"`
+	Limit     int       `form:"limit" binding:"omitempty,min=1,max=1000"`
+	Cursor    string    `form:"cursor"`
+}
+
+type AuditEventInfo struct {
+	ID          uint      `json:"id"`
+	Timestamp   time.Time `json:"timestamp"`
+	Source      string    `json:"source"`
+	Actor       string    `json:"actor"`
+	AuthMethod  string    `json:"authMethod,omitempty"`
+	Action      string    `json:"action"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	PayloadHash string    `json:"payloadHash,omitempty"`
+	Result      string    `json:"result"`
+	StatusCode  int       `json:"statusCode,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	LatencyMs   int64     `json:"latencyMs"`
+	ClientIP    string    `json:"clientIP,omitempty"`
+}
+
+type AuditListResponse struct {
+	Items      []AuditEventInfo `json:"items"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
@@ -0,0 +1,156 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
+	k8sv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+const (
+	CLOUD_CONFIG_HEADER      = "#cloud-config"
+	CLOUD_INIT_INLINE_LIMIT  = 2048      // KubeVirt限制内联userData/networkData的长度, 超过时改用Secret
+	CLOUD_INIT_MAX_SIZE      = 64 * 1024 // userData/networkData的最大长度
+	CLOUD_INIT_SECRET_SUFFIX = "-cloudinit"
+)
+
+// RenderedCloudInit 合并SSH公钥后最终注入VM的cloud-init数据
+type RenderedCloudInit struct {
+	UserData    string
+	NetworkData string
+}
+
+// NeedsSecret 数据超过内联限制时需要通过Secret引用
+func (c RenderedCloudInit) NeedsSecret() bool {
+	return len(c.UserData) > CLOUD_INIT_INLINE_LIMIT || len(c.NetworkData) > CLOUD_INIT_INLINE_LIMIT
+}
+
+func CloudInitSecretName(vmName string) string {
+	return vmName + CLOUD_INIT_SECRET_SUFFIX
+}
+
+// RenderCloudInit 校验cloud-init数据, 并将SSH公钥合并到#cloud-config的ssh_authorized_keys中
+func RenderCloudInit(spec *CloudInitSpec) (RenderedCloudInit, error) {
+	var rendered RenderedCloudInit
+	if len(spec.UserData) > CLOUD_INIT_MAX_SIZE {
+		return rendered, fmt.Errorf("userData exceeds %d bytes", CLOUD_INIT_MAX_SIZE)
+	}
+	if len(spec.NetworkData) > CLOUD_INIT_MAX_SIZE {
+		return rendered, fmt.Errorf("networkData exceeds %d bytes", CLOUD_INIT_MAX_SIZE)
+	}
+
+	keys := make([]string, 0, len(spec.SSHAuthorizedKeys))
+	for i, key := range spec.SSHAuthorizedKeys {
+		key = strings.TrimSpace(key)
+		if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key)); err != nil {
+			return rendered, fmt.Errorf("invalid ssh public key #%d: %v", i, err)
+		}
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+
+	userData := spec.UserData
+	switch {
+	case userData == "":
+		doc := map[string]interface{}{}
+		if len(keys) > 0 {
+			doc["ssh_authorized_keys"] = keys
+		}
+		b, err := yaml.Marshal(doc)
+		if err != nil {
+			return rendered, err
+		}
+		userData = CLOUD_CONFIG_HEADER + "\n" + string(b)
+	case strings.HasPrefix(userData, CLOUD_CONFIG_HEADER):
+		doc := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(userData), &doc); err != nil {
+			return rendered, fmt.Errorf("malformed #cloud-config userData: %v", err)
+		}
+		if len(keys) > 0 {
+			// 保留userData中已有的公钥
+			existing, ok := doc["ssh_authorized_keys"].([]interface{})
+			if !ok && doc["ssh_authorized_keys"] != nil {
+				return rendered, errors.New("ssh_authorized_keys in userData must be a list")
+			}
+			for _, key := range keys {
+				if !slices.Contains(existing, interface{}(key)) {
+					existing = append(existing, key)
+				}
+			}
+			doc["ssh_authorized_keys"] = existing
+			b, err := yaml.Marshal(doc)
+			if err != nil {
+				return rendered, err
+			}
+			userData = CLOUD_CONFIG_HEADER + "\n" + string(b)
+		}
+	case strings.HasPrefix(userData, "#!"):
+		if len(keys) > 0 {
+			return rendered, errors.New("sshAuthorizedKeys can only be merged into #cloud-config userData")
+		}
+	default:
+		return rendered, errors.New("userData must be a #cloud-config document or a #! script")
+	}
+	if len(userData) > CLOUD_INIT_MAX_SIZE {
+		return rendered, fmt.Errorf("userData exceeds %d bytes", CLOUD_INIT_MAX_SIZE)
+	}
+	rendered.UserData = userData
+
+	if spec.NetworkData != "" {
+		doc := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(spec.NetworkData), &doc); err != nil {
+			return rendered, fmt.Errorf("malformed networkData: %v", err)
+		}
+		rendered.NetworkData = spec.NetworkData
+	}
+	return rendered, nil
+}
+
+// newCloudInitSource 生成cloudInitNoCloud卷, 数据过大时引用同名Secret
+func newCloudInitSource(vmName string, rendered RenderedCloudInit) *kubevirtv1.CloudInitNoCloudSource {
+	source := &kubevirtv1.CloudInitNoCloudSource{}
+	if !rendered.NeedsSecret() {
+		source.UserData = rendered.UserData
+		source.NetworkData = rendered.NetworkData
+		return source
+	}
+
+	ref := &k8sv1.LocalObjectReference{Name: CloudInitSecretName(vmName)}
+	source.UserDataSecretRef = ref
+	if rendered.NetworkData != "" {
+		source.NetworkDataSecretRef = ref
+	}
+	return source
+}
+
+// NewCloudInitSecret 返回保存cloud-init数据的Secret, 数据可以内联时返回nil
+func NewCloudInitSecret(req VMCreateRequest) (*k8sv1.Secret, error) {
+	if req.CloudInit == nil {
+		return nil, nil
+	}
+	rendered, err := RenderCloudInit(req.CloudInit)
+	if err != nil || !rendered.NeedsSecret() {
+		return nil, err
+	}
+
+	secret := &k8sv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      CloudInitSecretName(req.Name),
+			Namespace: req.Namespace,
+			Labels:    map[string]string{"kubevirt.io/vm": req.Name},
+		},
+		Type: k8sv1.SecretTypeOpaque,
+		Data: map[string][]byte{"userdata": []byte(rendered.UserData)},
+	}
+	if rendered.NetworkData != "" {
+		secret.Data["networkdata"] = []byte(rendered.NetworkData)
+	}
+	return secret, nil
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSSHKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl user@host"
+
+func TestRenderCloudInitMergesKeys(t *testing.T) {
+	rendered, err := RenderCloudInit(&CloudInitSpec{
+		UserData:          "#cloud-config\nusers:\n  - default\nssh_authorized_keys:\n  - ssh-rsa existing\n",
+		SSHAuthorizedKeys: []string{testSSHKey, testSSHKey},
+	})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if !strings.HasPrefix(rendered.UserData, CLOUD_CONFIG_HEADER) {
+		t.Errorf("missing header: %q", rendered.UserData)
+	}
+	if !strings.Contains(rendered.UserData, "ssh-rsa existing") || strings.Count(rendered.UserData, "ssh-ed25519") != 1 {
+		t.Errorf("keys not merged: %q", rendered.UserData)
+	}
+
+	rendered, err = RenderCloudInit(&CloudInitSpec{SSHAuthorizedKeys: []string{testSSHKey}})
+	if err != nil || !strings.Contains(rendered.UserData, "ssh-ed25519") {
+		t.Errorf("keys only: %q, %v", rendered.UserData, err)
+	}
+}
+
+func TestRenderCloudInitRejects(t *testing.T) {
+	cases := map[string]CloudInitSpec{
+		"bad key":         {SSHAuthorizedKeys: []string{"not-a-key"}},
+		"bad yaml":        {UserData: "#cloud-config\nusers: [\n"},
+		"keys and script": {UserData: "#!/bin/sh\necho hi\n", SSHAuthorizedKeys: []string{testSSHKey}},
+		"unknown format":  {UserData: "echo hi"},
+		"bad networkData": {NetworkData: "version: [\n"},
+		"too large":       {UserData: "#!/bin/sh\n" + strings.Repeat("x", CLOUD_INIT_MAX_SIZE)},
+	}
+	for name, spec := range cases {
+		if _, err := RenderCloudInit(&spec); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
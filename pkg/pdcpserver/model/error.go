@@ -0,0 +1,42 @@
+package model
+
+// ErrorCode 错误响应中的错误类型, 与HTTP状态码对应, 名称与Kubernetes的StatusReason一致
+type ErrorCode string
+
+const (
+	ErrorBadRequest         ErrorCode = "BadRequest"
+	ErrorUnauthorized       ErrorCode = "Unauthorized"
+	ErrorForbidden          ErrorCode = "Forbidden"
+	ErrorNotFound           ErrorCode = "NotFound"
+	ErrorAlreadyExists      ErrorCode = "AlreadyExists"
+	ErrorConflict           ErrorCode = "Conflict"
+	ErrorInvalid            ErrorCode = "Invalid" // 422, Kubernetes拒绝了请求中的对象
+	ErrorTooManyRequests    ErrorCode = "TooManyRequests"
+	ErrorInternal           ErrorCode = "InternalError"
+	ErrorServiceUnavailable ErrorCode = "ServiceUnavailable"
+	ErrorTimeout            ErrorCode = "Timeout"
+)
+
+// ErrorResponse 所有API返回错误时的响应体
+type ErrorResponse struct {
+	Code      ErrorCode     `json:"code"`
+	Message   string        `json:"message"`
+	Details   []ErrorDetail `json:"details,omitempty"`
+	RequestID string        `json:"requestId,omitempty"`
+}
+
+// ErrorDetail 请求中一个字段的错误, Field为JSON或查询参数的路径, 如disks[0].name
+type ErrorDetail struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// FieldError 校验请求时发现的字段错误, 包装在service的错误中时会作为details返回
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventVMStatus    EventType = "vm.status"
+	EventNodeOnline  EventType = "node.online"
+	EventNodeOffline EventType = "node.offline"
+	EventTaskCreated EventType = "task.created"
+	EventTaskClosed  EventType = "task.closed"
+	EventAlert       EventType = "alert"
+)
+
+var EventTypes = []EventType{EventVMStatus, EventNodeOnline, EventNodeOffline, EventTaskCreated, EventTaskClosed, EventAlert}
+
+// Event 推送给订阅者的状态变化, ID单调递增, 作为SSE的事件ID用于断线续传.
+// 节点事件的Namespace为空, 只推送给可以访问所有namespace的用户
+type Event struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	Type      EventType `gorm:"not null;index"`
+	Namespace string    `gorm:"not null;default:'';index"`
+	Name      string    `gorm:"not null;default:''"` // VM名称
+	NodeName  string    `gorm:"not null;default:''"`
+	Data      string    `gorm:"type:text"` // 与Type对应的JSON
+	CreatedAt time.Time `gorm:"not null;index"`
+}
+
+// VMStatusEventData vm.status事件的内容
+type VMStatusEventData struct {
+	From  VirtualMachineStatus `json:"from,omitempty"` // 新建的VM为空
+	To    VirtualMachineStatus `json:"to"`
+	Phase string               `json:"phase,omitempty"`
+	Error string               `json:"error,omitempty"`
+}
+
+// NodeEventData node.online/node.offline事件的内容
+type NodeEventData struct {
+	From NodeStatus `json:"from,omitempty"`
+	To   NodeStatus `json:"to"`
+}
+
+// TaskEventData task.created/task.closed事件的内容, Time为pdcplet上发生的时间
+type TaskEventData struct {
+	TaskId int       `json:"taskId"`
+	Time   time.Time `json:"time"`
+}
+
+// EventStreamRequest 事件流的过滤条件, Types为空时订阅所有类型
+type EventStreamRequest struct {
+	Namespace string      `form:"namespace"`
+	Name      string      `form:"name"`
+	Types     []EventType `form:"type"`
+	// Namespaces 调用方可以访问的namespace, 由controller根据权限设置, 为nil时不限制
+	Namespaces []string `form:"-"`
+}
+
+type EventInfo struct {
+	ID        uint            `json:"id"`
+	Type      EventType       `json:"type"`
+	Namespace string          `json:"namespace,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	NodeName  string          `json:"nodeName,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Time      time.Time       `json:"time"`
+}
@@ -0,0 +1,99 @@
+package model
+
+import (
+	"time"
+)
+
+type JobType string
+
+const (
+	JobTypeCreateVM JobType = "create"
+	JobTypeDeleteVM JobType = "delete"
+)
+
+// JobTypeOf 返回VM生命周期操作对应的任务类型
+func JobTypeOf(op VMOperation) JobType {
+	return JobType(op)
+}
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "Queued"
+	JobRunning   JobStatus = "Running"
+	JobWaiting   JobStatus = "Waiting" // 已提交给KubeVirt, 等待生命周期reconciler完成
+	JobSucceeded JobStatus = "Succeeded"
+	JobFailed    JobStatus = "Failed"
+)
+
+// Job 异步执行的VM操作, 持久化在数据库中以便重启后继续执行
+type Job struct {
+	ID          string    `gorm:"primaryKey;size:32"`
+	Type        JobType   `gorm:"not null;index"`
+	VmName      string    `gorm:"not null;index"`
+	VmNamespace string    `gorm:"not null"`
+	Owner       string    `gorm:"not null;default:''"` // 提交任务的用户, 未启用认证时为空
+	Status      JobStatus `gorm:"not null;index"`
+	Progress    string
+	Payload     string `gorm:"type:text"` // 操作请求的JSON
+	Result      string `gorm:"type:text"` // 操作结果的JSON
+	Error       string
+	ErrorCode   ErrorCode `gorm:"not null;default:''"` // 与同步接口返回相同错误时一致的错误类型和HTTP状态码
+	ErrorStatus int       `gorm:"not null;default:0"`
+	Attempts    int       `gorm:"not null;default:0"`
+	MaxAttempts int       `gorm:"not null"`
+	NextRunAt   time.Time `gorm:"index"`
+	StartedAt   *time.Time
+	FinishedAt  *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+
+	// VirtualMachineRecordID 创建/删除任务关联的记录, 用于跟踪生命周期reconciler的进度
+	VirtualMachineRecordID *uint
+	Events                 []JobEvent `gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// JobEvent 任务的状态变化与错误历史
+type JobEvent struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement"`
+	JobID     string    `gorm:"not null;index;size:32"`
+	Attempt   int       `gorm:"not null"`
+	Status    JobStatus `gorm:"not null"`
+	Message   string
+	CreatedAt time.Time
+}
+
+type JobEventInfo struct {
+	Attempt   int       `json:"attempt"`
+	Status    JobStatus `json:"status"`
+	Message   string    `json:"message,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type JobInfo struct {
+	ID          string         `json:"id"`
+	Type        JobType        `json:"type"`
+	VmName      string         `json:"vm"`
+	Namespace   string         `json:"namespace"`
+	Owner       string         `json:"owner,omitempty"`
+	Status      JobStatus      `json:"status"`
+	Progress    string         `json:"progress,omitempty"`
+	Result      interface{}    `json:"result,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	Code        ErrorCode      `json:"code,omitempty"`       // 失败原因的错误类型, 与ErrorResponse.Code一致
+	HTTPStatus  int            `json:"httpStatus,omitempty"` // 同步执行该操作时返回的HTTP状态码
+	Attempts    int            `json:"attempts"`
+	MaxAttempts int            `json:"maxAttempts"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	StartedAt   *time.Time     `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time     `json:"finishedAt,omitempty"`
+	Events      []JobEventInfo `json:"events"`
+}
+
+// JobAcceptedResponse 提交异步任务后返回, 通过Location轮询任务状态
+type JobAcceptedResponse struct {
+	Message  string `json:"message"`
+	Name     string `json:"name"`
+	JobID    string `json:"jobId"`
+	Location string `json:"location"`
+}
@@ -0,0 +1,79 @@
+package model
+
+import "time"
+
+type MetricsResolution string
+
+const (
+	ResolutionRaw    MetricsResolution = "raw"
+	ResolutionMinute MetricsResolution = "1m"
+	ResolutionHour   MetricsResolution = "1h"
+)
+
+// Duration 返回该精度下一个采样点覆盖的时长, raw精度返回0
+func (r MetricsResolution) Duration() time.Duration {
+	switch r {
+	case ResolutionMinute:
+		return time.Minute
+	case ResolutionHour:
+		return time.Hour
+	default:
+		return 0
+	}
+}
+
+// TrafficCounters 与inpplat.BaseMetric对应的流量指标, Sent/Dropped为累计计数
+type TrafficCounters struct {
+	Sent    int64 `gorm:"not null;default:0"`
+	Dropped int64 `gorm:"not null;default:0"`
+	Avgbps  int64 `gorm:"not null;default:0"`
+	Avgpps  int64 `gorm:"not null;default:0"`
+	Realbps int64 `gorm:"not null;default:0"`
+	Realpps int64 `gorm:"not null;default:0"`
+}
+
+// TaskMetricSample 单个inpplat任务的总流量采样
+type TaskMetricSample struct {
+	ID                     uint              `gorm:"primaryKey;autoIncrement"`
+	Resolution             MetricsResolution `gorm:"not null;index:idx_task_sample_series,priority:1"`
+	NodeName               string            `gorm:"not null;index:idx_task_sample_series,priority:2"`
+	TaskId                 int               `gorm:"not null;index:idx_task_sample_series,priority:3"`
+	Timestamp              time.Time         `gorm:"not null;index:idx_task_sample_series,priority:4"`
+	VmName                 string            `gorm:"index"`
+	VmNamespace            string
+	VirtualMachineRecordID *uint                 `gorm:"index"`
+	VirtualMachineRecord   *VirtualMachineRecord `gorm:"constraint:OnDelete:SET NULL"`
+	Samples                int                   `gorm:"not null;default:1"` // 聚合的原始采样点数量
+	TrafficCounters
+}
+
+// NicMetricSample 单个inpplat任务下某个网卡的流量采样
+type NicMetricSample struct {
+	ID                     uint              `gorm:"primaryKey;autoIncrement"`
+	Resolution             MetricsResolution `gorm:"not null;index:idx_nic_sample_series,priority:1"`
+	NodeName               string            `gorm:"not null;index:idx_nic_sample_series,priority:2"`
+	TaskId                 int               `gorm:"not null;index:idx_nic_sample_series,priority:3"`
+	Vid                    int64             `gorm:"not null;index:idx_nic_sample_series,priority:4"`
+	Mac                    string            `gorm:"not null;index:idx_nic_sample_series,priority:5"`
+	Timestamp              time.Time         `gorm:"not null;index:idx_nic_sample_series,priority:6"`
+	VmName                 string            `gorm:"index"`
+	VmNamespace            string
+	VirtualMachineRecordID *uint                 `gorm:"index"`
+	VirtualMachineRecord   *VirtualMachineRecord `gorm:"constraint:OnDelete:SET NULL"`
+	Samples                int                   `gorm:"not null;default:1"`
+	TrafficCounters
+}
+
+// MetricsUploadCursor 记录每个pdcplet最近一次上报的序号, 用于识别重复和缺失的上报
+type MetricsUploadCursor struct {
+	NodeName     string `gorm:"primaryKey"`
+	SessionId    string `gorm:"not null"`
+	LastSequence uint64 `gorm:"not null"`
+	UpdatedAt    time.Time
+}
+
+// MetricsRollupWatermark 记录每个精度已完成降采样的时间点
+type MetricsRollupWatermark struct {
+	Resolution MetricsResolution `gorm:"primaryKey"`
+	Watermark  time.Time         `gorm:"not null"`
+}
@@ -0,0 +1,91 @@
+package model
+
+import "time"
+
+const (
+	MetricsLevelTask = "task"
+	MetricsLevelNic  = "nic"
+)
+
+const (
+	AggregationSum  = "sum"
+	AggregationAvg  = "avg"
+	AggregationMax  = "max"
+	AggregationRate = "rate" // 累计计数在每个step内的每秒增量
+)
+
+const (
+	TopByDropped = "dropped"
+	TopByBps     = "bps"
+)
+
+// MetricsQueryRequest 流量指标查询参数, 时间格式为RFC3339
+type MetricsQueryRequest struct {
+	VmName      string    `form:"vm"`
+	Namespace   string    `form:"namespace"`
+	NodeName    string    `form:"node"`
+	Mac         string    `form:"mac"`
+	Vid         *int64    `form:"vid"`
+	Level       string    `form:"level" binding:"omitempty,oneof=task nic"`
+	Metric      string    `form:"metric" binding:"required,oneof=sent dropped avgbps avgpps realbps realpps"`
+	Aggregation string    `form:"agg" binding:"omitempty,oneof=sum avg max rate"`
+	Step        string    `form:"step"`
+	Resolution  string    `form:"resolution" binding:"omitempty,oneof=raw 1m 1h"`
+	From        time.Time `form:"from"`
+	To          time.Time `form:"to"`
+}
+
+type MetricsPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+type MetricsSeriesLabels struct {
+	NodeName  string `json:"node"`
+	TaskId    int    `json:"task_id"`
+	VmName    string `json:"vm,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Vid       *int64 `json:"vid,omitempty"`
+	Mac       string `json:"mac,omitempty"`
+}
+
+type MetricsSeries struct {
+	Labels MetricsSeriesLabels `json:"labels"`
+	Points []MetricsPoint      `json:"points"`
+}
+
+type MetricsQueryResponse struct {
+	Metric      string            `json:"metric"`
+	Level       string            `json:"level"`
+	Aggregation string            `json:"aggregation"`
+	Resolution  MetricsResolution `json:"resolution"`
+	Step        string            `json:"step"`
+	From        time.Time         `json:"from"`
+	To          time.Time         `json:"to"`
+	Series      []MetricsSeries   `json:"series"`
+}
+
+// TopVMsRequest 按丢包数或带宽排序VM的查询参数
+type TopVMsRequest struct {
+	By        string    `form:"by" binding:"required,oneof=dropped bps"`
+	Limit     int       `form:"limit" binding:"omitempty,min=1,max=1000"`
+	Namespace string    `form:"namespace"`
+	NodeName  string    `form:"node"`
+	From      time.Time `form:"from"`
+	To        time.Time `form:"to"`
+}
+
+type TopVMEntry struct {
+	VmName    string   `json:"vm"`
+	Namespace string   `json:"namespace"`
+	Nodes     []string `json:"nodes"`
+	Value     float64  `json:"value"`
+}
+
+type TopVMsResponse struct {
+	By         string            `json:"by"`
+	Resolution MetricsResolution `json:"resolution"`
+	From       time.Time         `json:"from"`
+	To         time.Time         `json:"to"`
+	Items      []TopVMEntry      `json:"items"`
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"time"
+)
+
+type NodeStatus string
+
+const (
+	NodeReady    NodeStatus = "Ready"
+	NodeDegraded NodeStatus = "Degraded" // 心跳正常但inpplat不可达
+	NodeStale    NodeStatus = "Stale"    // 超过StaleAfter未收到心跳
+)
+
+// Node 注册到pdcpserver的pdcplet节点
+type Node struct {
+	ID               uint       `gorm:"primaryKey;autoIncrement"`
+	Name             string     `gorm:"size:253;not null;uniqueIndex"`
+	Version          string     `gorm:"not null;default:''"`
+	SessionId        string     `gorm:"not null;default:''"`
+	Modules          []string   `gorm:"serializer:json"`
+	InpplatReachable bool       `gorm:"not null;default:false"`
+	InpplatError     string     `gorm:"size:1024;not null;default:''"`
+	Status           NodeStatus `gorm:"not null;index"`
+	RegisteredAt     time.Time  `gorm:"not null"`
+	LastHeartbeatAt  time.Time  `gorm:"not null;index"`
+
+	// 以下字段由pdcplet下发规则后上报
+	AppliedRuleVersion string `gorm:"not null;default:''"`
+	RuleSyncError      string `gorm:"size:1024;not null;default:''"`
+	RulesSyncedAt      *time.Time
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+type NodeInfo struct {
+	Name             string     `json:"name"`
+	Version          string     `json:"version"`
+	Modules          []string   `json:"modules"`
+	Status           NodeStatus `json:"status"`
+	InpplatReachable bool       `json:"inpplatReachable"`
+	InpplatError     string     `json:"inpplatError,omitempty"`
+	RegisteredAt     time.Time  `json:"registeredAt"`
+	LastHeartbeatAt  time.Time  `json:"lastHeartbeatAt"`
+
+	AppliedRuleVersion string     `json:"appliedRuleVersion,omitempty"`
+	RuleSyncError      string     `json:"ruleSyncError,omitempty"`
+	RulesSyncedAt      *time.Time `json:"rulesSyncedAt,omitempty"`
+}
+
+type NodeListRequest struct {
+	Status string `form:"status" binding:"omitempty,oneof=Ready Degraded Stale"`
+}
+
+type NodeListResponse struct {
+	Items []NodeInfo `json:"items"`
+}
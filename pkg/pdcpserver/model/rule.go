@@ -0,0 +1,50 @@
+package model
+
+import "time"
+
+// DissectionRule 集中管理的解析规则, 通过VMs或Labels绑定到VM, 由pdcplet下发到inpplat
+type DissectionRule struct {
+	ID          uint              `gorm:"primaryKey;autoIncrement"`
+	Name        string            `gorm:"size:253;not null;uniqueIndex"`
+	Description string            `gorm:"size:1024;not null;default:''"`
+	Protocol    string            `gorm:"not null"`
+	Filter      string            `gorm:"size:1024;not null;default:''"`
+	Priority    int               `gorm:"not null;default:0"`
+	Enabled     bool              `gorm:"not null;default:true"`
+	VMs         []string          `gorm:"type:text;serializer:json"` // <namespace>/<name>
+	Labels      map[string]string `gorm:"type:text;serializer:json"` // 匹配VM创建时指定的labels
+	Version     int64             `gorm:"not null;default:1"`        // 每次更新加1
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// RuleRequest 创建或更新规则的请求, 更新时忽略Name. Version不为0时必须与当前版本一致
+type RuleRequest struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Protocol    string            `json:"protocol" binding:"required"`
+	Filter      string            `json:"filter,omitempty"`
+	Priority    int               `json:"priority" binding:"min=0,max=1000"`
+	Enabled     *bool             `json:"enabled,omitempty"` // 默认true
+	VMs         []string          `json:"vms,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Version     int64             `json:"version,omitempty"`
+}
+
+type RuleInfo struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Protocol    string            `json:"protocol"`
+	Filter      string            `json:"filter,omitempty"`
+	Priority    int               `json:"priority"`
+	Enabled     bool              `json:"enabled"`
+	VMs         []string          `json:"vms"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Version     int64             `json:"version"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+}
+
+type RuleListResponse struct {
+	Items []RuleInfo `json:"items"`
+}
@@ -0,0 +1,64 @@
+package model
+
+import "time"
+
+// 模板中可以被创建请求覆盖的字段
+const (
+	OverrideCPU       = "cpu"
+	OverrideMemory    = "memory"
+	OverrideDisks     = "disks" // 包括image
+	OverrideNetworks  = "networks"
+	OverrideCloudInit = "cloudInit"
+	OverrideLabels    = "labels" // 与模板中的labels合并
+)
+
+var TemplateOverrideFields = []string{
+	OverrideCPU, OverrideMemory, OverrideDisks, OverrideNetworks, OverrideCloudInit, OverrideLabels,
+}
+
+// VMTemplate 由管理员维护的VM模板(flavor)
+type VMTemplate struct {
+	ID               uint              `gorm:"primaryKey;autoIncrement"`
+	Name             string            `gorm:"size:253;not null;uniqueIndex"`
+	Description      string            `gorm:"size:1024;not null;default:''"`
+	CPU              int               `gorm:"not null"`
+	Memory           string            `gorm:"not null"`
+	Disks            []DiskSpec        `gorm:"type:text;serializer:json"`
+	Networks         []NetworkSpec     `gorm:"type:text;serializer:json"`
+	CloudInit        *CloudInitSpec    `gorm:"type:text;serializer:json"`
+	Labels           map[string]string `gorm:"type:text;serializer:json"`
+	AllowedOverrides []string          `gorm:"type:text;serializer:json"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// VMTemplateRequest 创建或更新模板的请求, 更新时忽略Name
+type VMTemplateRequest struct {
+	Name             string            `json:"name"`
+	Description      string            `json:"description"`
+	CPU              int               `json:"cpu" binding:"min=1"`
+	Memory           string            `json:"memory" binding:"required"`
+	Disks            []DiskSpec        `json:"disks" binding:"required,min=1"`
+	Networks         []NetworkSpec     `json:"networks,omitempty"`
+	CloudInit        *CloudInitSpec    `json:"cloudInit,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	AllowedOverrides []string          `json:"allowedOverrides,omitempty"`
+}
+
+type VMTemplateInfo struct {
+	Name             string            `json:"name"`
+	Description      string            `json:"description,omitempty"`
+	CPU              int               `json:"cpu"`
+	Memory           string            `json:"memory"`
+	Disks            []DiskSpec        `json:"disks"`
+	Networks         []NetworkSpec     `json:"networks,omitempty"`
+	CloudInit        *CloudInitSpec    `json:"cloudInit,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	AllowedOverrides []string          `json:"allowedOverrides"`
+	CreatedAt        time.Time         `json:"createdAt"`
+	UpdatedAt        time.Time         `json:"updatedAt"`
+}
+
+type VMTemplateListResponse struct {
+	Items []VMTemplateInfo `json:"items"`
+}
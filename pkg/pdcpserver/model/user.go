@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+type Role string
+
+const (
+	RoleAdmin    Role = "admin"    // 管理所有资源, 包括用户、API Key、模板和规则
+	RoleOperator Role = "operator" // 管理授权namespace中的VM
+	RoleViewer   Role = "viewer"   // 查看授权namespace中的VM
+)
+
+// ALL_NAMESPACES 授权所有namespace
+const ALL_NAMESPACES = "*"
+
+// User pdcpserver的用户, API Key和JWT的sub对应到用户以确定角色和可访问的namespace
+type User struct {
+	ID         uint     `gorm:"primaryKey;autoIncrement"`
+	Name       string   `gorm:"size:253;not null;uniqueIndex"`
+	Role       Role     `gorm:"not null"`
+	Namespaces []string `gorm:"type:text;serializer:json"` // admin忽略该字段
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// UserRequest 创建或更新用户的请求, 更新时忽略Name
+type UserRequest struct {
+	Name       string   `json:"name"`
+	Role       Role     `json:"role" binding:"required"`
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+type UserInfo struct {
+	Name       string    `json:"name"`
+	Role       Role      `json:"role"`
+	Namespaces []string  `json:"namespaces"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+type UserListResponse struct {
+	Items []UserInfo `json:"items"`
+}
@@ -0,0 +1,173 @@
+package model
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	cdiv1 "kubevirt.io/containerized-data-importer-api/pkg/apis/core/v1beta1"
+)
+
+const (
+	DiskTypeContainerDisk = "containerDisk"
+	DiskTypeDataVolume    = "dataVolume"
+)
+
+type DiskStatus string
+
+const (
+	DiskActive   DiskStatus = "Active"
+	DiskRetained DiskStatus = "Retained" // VM已删除, DataVolume按保留策略保留
+)
+
+// VirtualMachineDisk 记录VM的磁盘. 删除VM时retain策略的磁盘标记为Retained, 其余随VM记录一起软删除
+type VirtualMachineDisk struct {
+	gorm.Model
+	VirtualMachineRecordID uint   `gorm:"not null;index"`
+	VmName                 string `gorm:"not null"`
+	VmNamespace            string `gorm:"not null;index:idx_disk_datavolume"`
+	Name                   string `gorm:"not null"`
+	Type                   string `gorm:"not null"`
+	Bus                    string
+	Image                  string
+	DataVolumeName         string `gorm:"index:idx_disk_datavolume"`
+	Source                 string
+	URL                    string
+	Size                   string
+	StorageClass           string
+	Retention              string
+	Status                 DiskStatus `gorm:"not null"`
+}
+
+// DiskInfo VM磁盘的查询结果
+type DiskInfo struct {
+	Name           string     `json:"name"`
+	Type           string     `json:"type"`
+	Bus            string     `json:"bus,omitempty"`
+	Image          string     `json:"image,omitempty"`
+	DataVolumeName string     `json:"dataVolumeName,omitempty"`
+	Source         string     `json:"source,omitempty"`
+	Size           string     `json:"size,omitempty"`
+	StorageClass   string     `json:"storageClass,omitempty"`
+	Retention      string     `json:"retention,omitempty"`
+	Status         DiskStatus `json:"status"`
+}
+
+func DataVolumeName(vmName string, diskName string) string {
+	return vmName + "-" + diskName
+}
+
+// RetentionPolicy 返回磁盘的保留策略, 未指定时为delete
+func (dv *DataVolumeSpec) RetentionPolicy() string {
+	if dv.Retention == "" {
+		return RetentionDelete
+	}
+	return dv.Retention
+}
+
+// NewVirtualMachineDisks 根据创建请求生成磁盘记录
+func NewVirtualMachineDisks(vmrID uint, req VMCreateRequest) []VirtualMachineDisk {
+	var disks []VirtualMachineDisk
+	for _, d := range req.DiskSpecs() {
+		disk := VirtualMachineDisk{
+			VirtualMachineRecordID: vmrID,
+			VmName:                 req.Name,
+			VmNamespace:            req.Namespace,
+			Name:                   d.Name,
+			Type:                   DiskTypeContainerDisk,
+			Bus:                    d.Bus,
+			Image:                  d.Image,
+			Status:                 DiskActive,
+		}
+		if dv := d.DataVolume; dv != nil {
+			disk.Type = DiskTypeDataVolume
+			disk.DataVolumeName = DataVolumeName(req.Name, d.Name)
+			disk.Source = dv.Source
+			disk.URL = dv.URL
+			if dv.Source == DataVolumeSourcePVC {
+				pvcNamespace := dv.PVCNamespace
+				if pvcNamespace == "" {
+					pvcNamespace = req.Namespace
+				}
+				disk.URL = pvcNamespace + "/" + dv.PVCName
+			}
+			disk.Size = dv.Size
+			disk.StorageClass = dv.StorageClass
+			disk.Retention = dv.RetentionPolicy()
+		}
+		disks = append(disks, disk)
+	}
+	return disks
+}
+
+func NewDiskInfo(disk VirtualMachineDisk) DiskInfo {
+	return DiskInfo{
+		Name:           disk.Name,
+		Type:           disk.Type,
+		Bus:            disk.Bus,
+		Image:          disk.Image,
+		DataVolumeName: disk.DataVolumeName,
+		Source:         disk.Source,
+		Size:           disk.Size,
+		StorageClass:   disk.StorageClass,
+		Retention:      disk.Retention,
+		Status:         disk.Status,
+	}
+}
+
+// newDataVolumeTemplate 生成VM的dataVolumeTemplate, DataVolume由KubeVirt创建并以VM为owner
+func newDataVolumeTemplate(vmName string, namespace string, d DiskSpec) (kubevirtv1.DataVolumeTemplateSpec, error) {
+	dv := d.DataVolume
+	size, err := resource.ParseQuantity(dv.Size)
+	if err != nil {
+		return kubevirtv1.DataVolumeTemplateSpec{}, fmt.Errorf("invalid size %q of disk %q: %v", dv.Size, d.Name, err)
+	}
+
+	source := &cdiv1.DataVolumeSource{}
+	switch dv.Source {
+	case DataVolumeSourceHTTP:
+		source.HTTP = &cdiv1.DataVolumeSourceHTTP{URL: dv.URL}
+	case DataVolumeSourceRegistry:
+		url := dv.URL
+		source.Registry = &cdiv1.DataVolumeSourceRegistry{URL: &url}
+	case DataVolumeSourcePVC:
+		pvcNamespace := dv.PVCNamespace
+		if pvcNamespace == "" {
+			pvcNamespace = namespace
+		}
+		source.PVC = &cdiv1.DataVolumeSourcePVC{Namespace: pvcNamespace, Name: dv.PVCName}
+	case DataVolumeSourceBlank:
+		source.Blank = &cdiv1.DataVolumeBlankImage{}
+	default:
+		return kubevirtv1.DataVolumeTemplateSpec{}, fmt.Errorf("unsupported source %q of disk %q", dv.Source, d.Name)
+	}
+
+	accessMode := k8sv1.ReadWriteOnce
+	if dv.AccessMode != "" {
+		accessMode = k8sv1.PersistentVolumeAccessMode(dv.AccessMode)
+	}
+	pvc := &k8sv1.PersistentVolumeClaimSpec{
+		AccessModes: []k8sv1.PersistentVolumeAccessMode{accessMode},
+		Resources: k8sv1.ResourceRequirements{
+			Requests: k8sv1.ResourceList{k8sv1.ResourceStorage: size},
+		},
+	}
+	if dv.StorageClass != "" {
+		storageClass := dv.StorageClass
+		pvc.StorageClassName = &storageClass
+	}
+
+	return kubevirtv1.DataVolumeTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   DataVolumeName(vmName, d.Name),
+			Labels: map[string]string{"kubevirt.io/vm": vmName},
+		},
+		Spec: cdiv1.DataVolumeSpec{
+			Source: source,
+			PVC:    pvc,
+		},
+	}, nil
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"net"
+
+	"gorm.io/gorm"
+)
+
+// VirtualMachineInterface 记录VM的网络接口, Mac和Vid用于与pdcplet上报的NIC指标匹配.
+// 未指定MAC时由KubeVirt分配, 状态同步时从VMI中回填
+type VirtualMachineInterface struct {
+	gorm.Model
+	VirtualMachineRecordID uint   `gorm:"not null;index"`
+	VmName                 string `gorm:"not null"`
+	VmNamespace            string `gorm:"not null"`
+	Name                   string `gorm:"not null"`
+	Type                   string `gorm:"not null"`
+	Binding                string `gorm:"not null"`
+	NetworkName            string
+	Mac                    string `gorm:"index:idx_interface_nic,priority:1"`
+	Vid                    int64  `gorm:"not null;default:0;index:idx_interface_nic,priority:2"`
+}
+
+// InterfaceInfo VM网络接口的查询结果
+type InterfaceInfo struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Binding     string `json:"binding"`
+	NetworkName string `json:"networkName,omitempty"`
+	MacAddress  string `json:"macAddress,omitempty"`
+	VlanID      int64  `json:"vlanId,omitempty"`
+}
+
+// NewVirtualMachineInterfaces 根据创建请求生成网络接口记录
+func NewVirtualMachineInterfaces(vmrID uint, req VMCreateRequest) []VirtualMachineInterface {
+	var ifaces []VirtualMachineInterface
+	for _, n := range req.Networks {
+		ifaces = append(ifaces, VirtualMachineInterface{
+			VirtualMachineRecordID: vmrID,
+			VmName:                 req.Name,
+			VmNamespace:            req.Namespace,
+			Name:                   n.Name,
+			Type:                   n.NetworkType(),
+			Binding:                n.BindingMethod(),
+			NetworkName:            n.NetworkName,
+			Mac:                    NormalizeMac(n.MacAddress),
+			Vid:                    n.VlanID,
+		})
+	}
+	return ifaces
+}
+
+func NewInterfaceInfo(iface VirtualMachineInterface) InterfaceInfo {
+	return InterfaceInfo{
+		Name:        iface.Name,
+		Type:        iface.Type,
+		Binding:     iface.Binding,
+		NetworkName: iface.NetworkName,
+		MacAddress:  iface.Mac,
+		VlanID:      iface.Vid,
+	}
+}
+
+// NormalizeMac 统一为小写冒号分隔的格式, 与NIC指标中的mac一致
+func NormalizeMac(mac string) string {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return mac
+	}
+	return hw.String()
+}
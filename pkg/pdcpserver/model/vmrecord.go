@@ -1,6 +1,8 @@
 package model
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -8,22 +10,52 @@ type VirtualMachineStatus string
 
 const (
 	StatusNotSet VirtualMachineStatus = ""
+	Pending      VirtualMachineStatus = "Pending" // 记录已写入, 等待在KubeVirt中创建
 	CreateFailed VirtualMachineStatus = "CreateFailed"
 	Created      VirtualMachineStatus = "Created"
 	Starting     VirtualMachineStatus = "Starting"
 	Running      VirtualMachineStatus = "Running"
 	Paused       VirtualMachineStatus = "Paused"
 	Stopped      VirtualMachineStatus = "Stopped"
+	Deleting     VirtualMachineStatus = "Deleting" // 等待从KubeVirt中删除
 	MarkDeleted  VirtualMachineStatus = "MarkDeleted"
 	Ready        VirtualMachineStatus = "Ready"
 	NotReady     VirtualMachineStatus = "NotReady"
 )
 
+// RecordIDAnnotation 记录在KubeVirt VM上的VirtualMachineRecord ID, 用于识别VM是否由该记录创建
+const RecordIDAnnotation = "pdcpserver/record-id"
+
+// VirtualMachineRecord 未删除的记录在namespace内名称唯一, 由迁移版本6创建的部分唯一索引保证
 type VirtualMachineRecord struct {
-	gorm.Model
-	ID     uint                 `gorm:"primaryKey;autoIncrement"`
-	Name   string               `gorm:"not null"`
-	CPU    int                  `gorm:"not null"`
-	Memory string               `gorm:"not null"`
-	Status VirtualMachineStatus `gorm:"not null"`
+	ID        uint `gorm:"primaryKey;autoIncrement"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt       `gorm:"index"`
+	Name      string               `gorm:"not null;index"`
+	Namespace string               `gorm:"not null;default:default;index"`
+	CPU       int                  `gorm:"not null"`
+	Memory    string               `gorm:"not null"`
+	Template  string               `gorm:"not null;default:''"`       // 创建时引用的模板
+	Owner     string               `gorm:"not null;default:'';index"` // 创建VM的用户, 未启用认证时为空
+	Status    VirtualMachineStatus `gorm:"not null"`
+
+	// 以下字段由生命周期reconciler使用
+	Spec            string `gorm:"type:text"` // VMCreateRequest的JSON, 用于在KubeVirt中创建VM
+	Attempts        int    `gorm:"not null;default:0"`
+	LastError       string
+	LastErrorReason string     `gorm:"not null;default:''"` // LastError的Kubernetes StatusReason, 用于任务失败时映射状态码
+	NextAttemptAt   *time.Time `gorm:"index"`
+
+	// 以下字段由状态同步从KubeVirt中获取
+	Phase              string
+	NodeName           string
+	IPs                string // 逗号分隔
+	Ready              bool   `gorm:"not null;default:false"`
+	LastTransitionTime *time.Time
+}
+
+// CreateAbandoned 创建失败且生命周期reconciler已不再重试
+func (vmr *VirtualMachineRecord) CreateAbandoned() bool {
+	return vmr.Status == CreateFailed && vmr.NextAttemptAt == nil
 }
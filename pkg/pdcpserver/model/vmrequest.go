@@ -1,6 +1,10 @@
 package model
 
 import (
+	"fmt"
+	"slices"
+	"time"
+
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -13,21 +17,154 @@ const (
 
 var runningDefault bool = false
 
+const (
+	BOOT_DISK_NAME       = "boot-disk"
+	CLOUD_INIT_DISK_NAME = "cloudinitdisk"
+)
+
+// VMCreateRequest 创建VM的请求. 指定Template时, 其余非空字段覆盖模板中允许覆盖的字段
 type VMCreateRequest struct {
-	Name      string `json:"name" binding:"required"`
-	Namespace string `json:"namespace"`
-	Memory    string `json:"memory" binding:"required"`
-	CPU       int    `json:"cpu" binding:"min=1"`
-	Image     string `json:"image" binding:"required"`
+	Name      string            `json:"name" binding:"required"`
+	Namespace string            `json:"namespace"`
+	Template  string            `json:"template,omitempty"`
+	Memory    string            `json:"memory"`
+	CPU       int               `json:"cpu" binding:"omitempty,min=1"`
+	Image     string            `json:"image,omitempty"` // 只有一个containerDisk启动盘时的简写, 与Disks互斥
+	Disks     []DiskSpec        `json:"disks,omitempty"`
+	Networks  []NetworkSpec     `json:"networks,omitempty"`
+	CloudInit *CloudInitSpec    `json:"cloudInit,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
 }
 
-type VMCreateResponse struct {
-	Message string `json:"message"`
-	Name    string `json:"name"`
+// DiskSpecs 返回VM的所有磁盘, 未指定Disks时由Image生成启动盘
+func (req VMCreateRequest) DiskSpecs() []DiskSpec {
+	if len(req.Disks) > 0 || req.Image == "" {
+		return req.Disks
+	}
+	return []DiskSpec{{Name: BOOT_DISK_NAME, Image: req.Image}}
 }
 
-func NewKubeVirtVM(req VMCreateRequest) *kubevirtv1.VirtualMachine {
-	return &kubevirtv1.VirtualMachine{
+// ReferencedNamespaces 返回请求引用的VM所在namespace以外的namespace: 克隆来源PVC的namespace和multus网络的namespace,
+// 调用方需要同时拥有这些namespace的写权限
+func (req VMCreateRequest) ReferencedNamespaces() []string {
+	var namespaces []string
+	add := func(namespace string) {
+		if namespace != "" && namespace != req.Namespace && !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	for _, d := range req.DiskSpecs() {
+		if d.DataVolume != nil && d.DataVolume.Source == DataVolumeSourcePVC {
+			add(d.DataVolume.PVCNamespace)
+		}
+	}
+	for _, n := range req.Networks {
+		if n.NetworkType() == NetworkTypeMultus {
+			namespace, _ := SplitNetworkName(n.NetworkName, req.Namespace)
+			add(namespace)
+		}
+	}
+	return namespaces
+}
+
+// NewKubeVirtVM 根据创建请求生成KubeVirt VM, cloud-init数据过大时需要同时创建NewCloudInitSecret返回的Secret
+func NewKubeVirtVM(req VMCreateRequest) (*kubevirtv1.VirtualMachine, error) {
+	memory, err := resource.ParseQuantity(req.Memory)
+	if err != nil {
+		return nil, fmt.Errorf("invalid memory %q: %v", req.Memory, err)
+	}
+
+	templateLabels := map[string]string{"kubevirt.io/vm": req.Name}
+	for k, v := range req.Labels {
+		templateLabels[k] = v
+	}
+
+	var disks []kubevirtv1.Disk
+	var volumes []kubevirtv1.Volume
+	var dataVolumes []kubevirtv1.DataVolumeTemplateSpec
+	for _, d := range req.DiskSpecs() {
+		bus := d.Bus
+		if bus == "" {
+			bus = DiskBusVirtio
+		}
+		disks = append(disks, kubevirtv1.Disk{
+			Name: d.Name,
+			DiskDevice: kubevirtv1.DiskDevice{
+				Disk: &kubevirtv1.DiskTarget{Bus: kubevirtv1.DiskBus(bus)},
+			},
+		})
+		if d.DataVolume == nil {
+			volumes = append(volumes, kubevirtv1.Volume{
+				Name: d.Name,
+				VolumeSource: kubevirtv1.VolumeSource{
+					ContainerDisk: &kubevirtv1.ContainerDiskSource{
+						Image: d.Image,
+					},
+				},
+			})
+			continue
+		}
+		// 接管的DataVolume已存在, 直接引用, 创建VM后由reconciler将VM设为其owner
+		dataVolumeName := DataVolumeName(req.Name, d.Name)
+		if d.DataVolume.Source != DataVolumeSourceRetained {
+			dataVolume, err := newDataVolumeTemplate(req.Name, req.Namespace, d)
+			if err != nil {
+				return nil, err
+			}
+			dataVolumes = append(dataVolumes, dataVolume)
+		}
+		volumes = append(volumes, kubevirtv1.Volume{
+			Name: d.Name,
+			VolumeSource: kubevirtv1.VolumeSource{
+				DataVolume: &kubevirtv1.DataVolumeSource{
+					Name: dataVolumeName,
+				},
+			},
+		})
+	}
+	if req.CloudInit != nil {
+		rendered, err := RenderCloudInit(req.CloudInit)
+		if err != nil {
+			return nil, err
+		}
+		disks = append(disks, kubevirtv1.Disk{
+			Name: CLOUD_INIT_DISK_NAME,
+			DiskDevice: kubevirtv1.DiskDevice{
+				Disk: &kubevirtv1.DiskTarget{Bus: DiskBusVirtio},
+			},
+		})
+		volumes = append(volumes, kubevirtv1.Volume{
+			Name: CLOUD_INIT_DISK_NAME,
+			VolumeSource: kubevirtv1.VolumeSource{
+				CloudInitNoCloud: newCloudInitSource(req.Name, rendered),
+			},
+		})
+	}
+
+	var interfaces []kubevirtv1.Interface
+	var networks []kubevirtv1.Network
+	for _, n := range req.Networks {
+		iface := kubevirtv1.Interface{Name: n.Name, MacAddress: n.MacAddress}
+		switch n.BindingMethod() {
+		case NetworkBindingBridge:
+			iface.InterfaceBindingMethod.Bridge = &kubevirtv1.InterfaceBridge{}
+		case NetworkBindingSRIOV:
+			iface.InterfaceBindingMethod.SRIOV = &kubevirtv1.InterfaceSRIOV{}
+		default:
+			iface.InterfaceBindingMethod.Masquerade = &kubevirtv1.InterfaceMasquerade{}
+		}
+		interfaces = append(interfaces, iface)
+
+		network := kubevirtv1.Network{Name: n.Name}
+		if n.NetworkType() == NetworkTypeMultus {
+			network.NetworkSource.Multus = &kubevirtv1.MultusNetwork{NetworkName: n.MultusNetworkName()}
+		} else {
+			network.NetworkSource.Pod = &kubevirtv1.PodNetwork{}
+		}
+		networks = append(networks, network)
+	}
+
+	vm := &kubevirtv1.VirtualMachine{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "VirtualMachine",
 			APIVersion: "kubevirt.io/v1",
@@ -35,42 +172,35 @@ func NewKubeVirtVM(req VMCreateRequest) *kubevirtv1.VirtualMachine {
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      req.Name,
 			Namespace: req.Namespace,
+			Labels:    req.Labels,
 		},
 		Spec: kubevirtv1.VirtualMachineSpec{
-			Running: &runningDefault,
+			Running:             &runningDefault,
+			DataVolumeTemplates: dataVolumes,
 			Template: &kubevirtv1.VirtualMachineInstanceTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{"kubevirt.io/vm": req.Name},
+					Labels: templateLabels,
 				},
 				Spec: kubevirtv1.VirtualMachineInstanceSpec{
 					Domain: kubevirtv1.DomainSpec{
 						Devices: kubevirtv1.Devices{
-							Disks: []kubevirtv1.Disk{{
-								Name: "boot-disk",
-								DiskDevice: kubevirtv1.DiskDevice{
-									Disk: &kubevirtv1.DiskTarget{Bus: "virtio"},
-								},
-							}},
+							Disks:      disks,
+							Interfaces: interfaces,
 						},
 						Resources: kubevirtv1.ResourceRequirements{
 							Requests: map[v1.ResourceName]resource.Quantity{
-								"memory": resource.MustParse(req.Memory),
+								"memory": memory,
 							},
 						},
 						CPU: &kubevirtv1.CPU{Cores: uint32(req.CPU)},
 					},
-					Volumes: []kubevirtv1.Volume{{
-						Name: "boot-disk",
-						VolumeSource: kubevirtv1.VolumeSource{
-							ContainerDisk: &kubevirtv1.ContainerDiskSource{
-								Image: req.Image,
-							},
-						},
-					}},
+					Networks: networks,
+					Volumes:  volumes,
 				},
 			},
 		},
 	}
+	return vm, nil
 }
 
 type VMDeleteRequest struct {
@@ -78,7 +208,99 @@ type VMDeleteRequest struct {
 	Namespace string `json:"namespace"`
 }
 
-type VMDeleteResponse struct {
-	Message string `json:"message"`
-	Name    string `json:"name"`
+// VMListRequest VM列表查询参数, 指定cursor时忽略offset
+type VMListRequest struct {
+	Namespace     string    `form:"namespace"`
+	Status        string    `form:"status"`
+	NamePrefix    string    `form:"namePrefix"`
+	CreatedAfter  time.Time `form:"createdAfter"`
+	CreatedBefore time.Time `form:"createdBefore"`
+	SortBy        string    `form:"sortBy" binding:"omitempty,oneof=name created_at status"`
+	Order         string    `form:"order" binding:"omitempty,oneof=asc desc"`
+	Limit         int       `form:"limit" binding:"omitempty,min=1,max=500"`
+	Offset        int       `form:"offset" binding:"omitempty,min=0"`
+	Cursor        string    `form:"cursor"`
+	Live          bool      `form:"live"` // 是否合并KubeVirt中的实时状态
+
+	// Namespaces 调用方可访问的namespace, 由controller根据权限设置, nil表示不限制
+	Namespaces []string `form:"-"`
+}
+
+// VMLiveStatus KubeVirt中VM/VMI的实时状态
+type VMLiveStatus struct {
+	PrintableStatus string   `json:"printableStatus,omitempty"`
+	Ready           bool     `json:"ready"`
+	Phase           string   `json:"phase,omitempty"`
+	NodeName        string   `json:"nodeName,omitempty"`
+	IPs             []string `json:"ips,omitempty"`
+	Error           string   `json:"error,omitempty"`
+}
+
+type VMInfo struct {
+	Name       string               `json:"name"`
+	Namespace  string               `json:"namespace"`
+	CPU        int                  `json:"cpu"`
+	Memory     string               `json:"memory"`
+	Template   string               `json:"template,omitempty"`
+	Owner      string               `json:"owner,omitempty"`
+	Status     VirtualMachineStatus `json:"status"`
+	Phase      string               `json:"phase,omitempty"`
+	NodeName   string               `json:"nodeName,omitempty"`
+	IPs        []string             `json:"ips,omitempty"`
+	Ready      bool                 `json:"ready"`
+	LastError  string               `json:"lastError,omitempty"`
+	Disks      []DiskInfo           `json:"disks,omitempty"`      // 仅在查询单个VM时返回
+	Interfaces []InterfaceInfo      `json:"interfaces,omitempty"` // 仅在查询单个VM时返回
+	CreatedAt  time.Time            `json:"createdAt"`
+	UpdatedAt  time.Time            `json:"updatedAt"`
+
+	LastTransitionTime *time.Time    `json:"lastTransitionTime,omitempty"`
+	Live               *VMLiveStatus `json:"live,omitempty"`
+}
+
+type VMListResponse struct {
+	Items      []VMInfo `json:"items"`
+	Total      int64    `json:"total"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+}
+
+type VMGetRequest struct {
+	Namespace string `form:"namespace"`
+}
+
+type VMOperation string
+
+const (
+	VMOperationStart   VMOperation = "start"
+	VMOperationStop    VMOperation = "stop"
+	VMOperationRestart VMOperation = "restart"
+	VMOperationPause   VMOperation = "pause"
+	VMOperationUnpause VMOperation = "unpause"
+)
+
+// TargetStatus 返回操作成功后VirtualMachineRecord应处于的状态
+func (op VMOperation) TargetStatus() VirtualMachineStatus {
+	switch op {
+	case VMOperationStart, VMOperationRestart:
+		return Starting
+	case VMOperationStop:
+		return Stopped
+	case VMOperationPause:
+		return Paused
+	case VMOperationUnpause:
+		return Running
+	default:
+		return StatusNotSet
+	}
+}
+
+type VMOperationRequest struct {
+	Name      string `json:"-"`
+	Namespace string `form:"namespace"`
+}
+
+type VMOperationResponse struct {
+	Message string               `json:"message"`
+	Name    string               `json:"name"`
+	Status  VirtualMachineStatus `json:"status"`
 }
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNewKubeVirtVMNetworks(t *testing.T) {
+	req := VMCreateRequest{Name: "vm1", Namespace: "default", Memory: "1Gi", CPU: 1, Image: "cirros",
+		Networks: []NetworkSpec{
+			{Name: "default"},
+			{Name: "capture", Type: NetworkTypeMultus, NetworkName: "pdcp/capture-net", Binding: NetworkBindingSRIOV,
+				MacAddress: "02:00:00:00:00:01", VlanID: 100},
+			{Name: "mirror", Type: NetworkTypeMultus, NetworkName: "mirror-net"},
+		},
+	}
+	vm, err := NewKubeVirtVM(req)
+	if err != nil {
+		t.Fatalf("new vm: %v", err)
+	}
+
+	spec := vm.Spec.Template.Spec
+	// 指定VLAN的接口连接到派生的VLAN网络
+	if len(spec.Networks) != 3 || spec.Networks[0].Pod == nil || spec.Networks[1].Multus == nil ||
+		spec.Networks[1].Multus.NetworkName != "pdcp/capture-net-vlan100" || spec.Networks[2].Multus.NetworkName != "mirror-net" {
+		t.Fatalf("unexpected networks: %+v", spec.Networks)
+	}
+	ifaces := spec.Domain.Devices.Interfaces
+	if ifaces[0].Masquerade == nil || ifaces[1].SRIOV == nil || ifaces[1].MacAddress != "02:00:00:00:00:01" {
+		t.Fatalf("unexpected interfaces: %+v", ifaces)
+	}
+
+	records := NewVirtualMachineInterfaces(1, req)
+	if records[1].Mac != "02:00:00:00:00:01" || records[1].Vid != 100 || records[1].Binding != NetworkBindingSRIOV ||
+		records[1].NetworkName != "pdcp/capture-net" {
+		t.Errorf("unexpected interface record: %+v", records[1])
+	}
+}
+
+func TestReferencedNamespaces(t *testing.T) {
+	pvc := func(namespace string) DiskSpec {
+		return DiskSpec{Name: "data", DataVolume: &DataVolumeSpec{Source: DataVolumeSourcePVC, PVCName: "golden", PVCNamespace: namespace, Size: "10Gi"}}
+	}
+	multus := func(networkName string, vlanID int64) NetworkSpec {
+		return NetworkSpec{Name: "capture", Type: NetworkTypeMultus, NetworkName: networkName, VlanID: vlanID}
+	}
+	tests := []struct {
+		name     string
+		disks    []DiskSpec
+		networks []NetworkSpec
+		want     []string
+	}{
+		{name: "image only", want: nil},
+		{name: "pvc in vm namespace", disks: []DiskSpec{pvc("")}, want: nil},
+		{name: "pvc in other namespace", disks: []DiskSpec{pvc("team-b")}, want: []string{"team-b"}},
+		// http导入的DataVolume不引用其他namespace
+		{name: "http source", disks: []DiskSpec{{Name: "data", DataVolume: &DataVolumeSpec{Source: DataVolumeSourceHTTP, PVCNamespace: "team-b"}}}},
+		{name: "multus in vm namespace", networks: []NetworkSpec{multus("capture-net", 100)}, want: nil},
+		{name: "vlan in other namespace", networks: []NetworkSpec{multus("team-b/capture-net", 100)}, want: []string{"team-b"}},
+		{name: "multus in other namespace", networks: []NetworkSpec{multus("team-c/capture-net", 0)}, want: []string{"team-c"}},
+		{name: "deduplicated", disks: []DiskSpec{pvc("team-b"), pvc("team-a"), pvc("team-b")},
+			networks: []NetworkSpec{{Name: "default"}, multus("team-b/capture-net", 100), multus("team-c/mirror-net", 0)},
+			want:     []string{"team-b", "team-c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := VMCreateRequest{Name: "vm1", Namespace: "team-a", Image: "cirros", Disks: tt.disks, Networks: tt.networks}
+			if got := req.ReferencedNamespaces(); !slices.Equal(got, tt.want) {
+				t.Fatalf("namespaces = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	DiskBusVirtio = "virtio"
+	DiskBusSata   = "sata"
+	DiskBusScsi   = "scsi"
+)
+
+const (
+	NetworkTypePod    = "pod"
+	NetworkTypeMultus = "multus"
+)
+
+const (
+	NetworkBindingMasquerade = "masquerade" // 仅用于pod网络
+	NetworkBindingBridge     = "bridge"
+	NetworkBindingSRIOV      = "sriov" // 仅用于multus网络
+)
+
+const (
+	DataVolumeSourceHTTP     = "http"
+	DataVolumeSourceRegistry = "registry"
+	DataVolumeSourcePVC      = "pvc"
+	DataVolumeSourceBlank    = "blank"
+	DataVolumeSourceRetained = "retained" // 接管同名VM删除后保留的DataVolume, 不再导入数据
+)
+
+const (
+	RetentionDelete = "delete" // 删除VM时一并删除DataVolume和PVC
+	RetentionRetain = "retain" // 删除VM时保留DataVolume和PVC
+)
+
+// DiskSpec VM的磁盘, 第一个磁盘作为启动盘. Image与DataVolume必须且只能指定一个
+type DiskSpec struct {
+	Name       string          `json:"name"`
+	Bus        string          `json:"bus,omitempty"`   // option: virtio/sata/scsi, 默认virtio
+	Image      string          `json:"image,omitempty"` // containerDisk镜像, 数据不持久化
+	DataVolume *DataVolumeSpec `json:"dataVolume,omitempty"`
+}
+
+// DataVolumeSpec 由CDI创建的持久化磁盘, DataVolume名称为<vm>-<disk>
+type DataVolumeSpec struct {
+	Source       string `json:"source"`                 // option: http/registry/pvc/blank/retained
+	URL          string `json:"url,omitempty"`          // http/registry导入的地址, registry以docker://开头
+	PVCName      string `json:"pvcName,omitempty"`      // pvc克隆的源PVC
+	PVCNamespace string `json:"pvcNamespace,omitempty"` // 源PVC的namespace, 默认与VM相同
+	Size         string `json:"size,omitempty"`         // retained以外的来源必填
+	StorageClass string `json:"storageClass,omitempty"` // 默认使用集群默认StorageClass
+	AccessMode   string `json:"accessMode,omitempty"`   // 默认ReadWriteOnce
+	Retention    string `json:"retention,omitempty"`    // option: delete/retain, 默认delete
+}
+
+// NetworkSpec VM的网络接口. 指定VlanID的multus接口连接到以NetworkName为模板、设置了VLAN的NetworkAttachmentDefinition,
+// VlanID同时用于与NIC指标的vid匹配
+type NetworkSpec struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`        // option: pod/multus, 默认pod
+	Binding     string `json:"binding,omitempty"`     // option: masquerade/bridge/sriov, pod默认masquerade, multus默认bridge
+	NetworkName string `json:"networkName,omitempty"` // multus: NetworkAttachmentDefinition名称, 格式为<name>或<namespace>/<name>
+	MacAddress  string `json:"macAddress,omitempty"`
+	VlanID      int64  `json:"vlanId,omitempty"` // 仅用于multus网络
+}
+
+// NetworkType 返回接口的网络类型, 未指定时为pod
+func (n NetworkSpec) NetworkType() string {
+	if n.Type == "" {
+		return NetworkTypePod
+	}
+	return n.Type
+}
+
+// MultusNetworkName 返回VM实际连接的NetworkAttachmentDefinition, 指定VlanID时为派生的VLAN网络
+func (n NetworkSpec) MultusNetworkName() string {
+	if n.VlanID > 0 {
+		return VlanNetworkName(n.NetworkName, n.VlanID)
+	}
+	return n.NetworkName
+}
+
+// VlanNetworkName 派生的VLAN网络的名称, 与模板位于同一namespace
+func VlanNetworkName(networkName string, vlanID int64) string {
+	return fmt.Sprintf("%s-vlan%d", networkName, vlanID)
+}
+
+// SplitNetworkName 将<namespace>/<name>格式的网络名称拆分, 未指定namespace时使用defaultNamespace
+func SplitNetworkName(networkName string, defaultNamespace string) (string, string) {
+	if namespace, name, found := strings.Cut(networkName, "/"); found {
+		return namespace, name
+	}
+	return defaultNamespace, networkName
+}
+
+// BindingMethod 返回接口的绑定方式, 未指定时pod网络为masquerade, multus网络为bridge
+func (n NetworkSpec) BindingMethod() string {
+	if n.Binding != "" {
+		return n.Binding
+	}
+	if n.NetworkType() == NetworkTypeMultus {
+		return NetworkBindingBridge
+	}
+	return NetworkBindingMasquerade
+}
+
+// CloudInitSpec 以cloudInitNoCloud卷注入的初始化配置, SSH公钥会合并到#cloud-config中
+type CloudInitSpec struct {
+	UserData          string   `json:"userData,omitempty"`
+	NetworkData       string   `json:"networkData,omitempty"`
+	SSHAuthorizedKeys []string `json:"sshAuthorizedKeys,omitempty"`
+}
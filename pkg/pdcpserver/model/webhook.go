@@ -0,0 +1,115 @@
+package model
+
+import "time"
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "Pending" // 等待投递或重试
+	DeliverySucceeded WebhookDeliveryStatus = "Succeeded"
+	DeliveryFailed    WebhookDeliveryStatus = "Failed" // 达到最大尝试次数或不可重试的错误
+)
+
+// Webhook 事件的外部订阅, 事件以签名的JSON POST到URL
+type Webhook struct {
+	ID          uint        `gorm:"primaryKey;autoIncrement"`
+	Name        string      `gorm:"size:253;not null;uniqueIndex"`
+	URL         string      `gorm:"size:2048;not null"`
+	Description string      `gorm:"size:1024;not null;default:''"`
+	EventTypes  []EventType `gorm:"type:text;serializer:json"` // 为空时订阅所有事件
+	Namespace   string      `gorm:"not null;default:''"`       // 为空时不限制
+	Secret      string      `gorm:"not null"`                  // 计算签名的HMAC密钥, 以webhooks.secretKey加密保存
+	Enabled     bool        `gorm:"not null"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// WebhookDelivery 一个事件向一个Webhook的投递, 重试时更新同一条记录
+type WebhookDelivery struct {
+	ID            uint                  `gorm:"primaryKey;autoIncrement"`
+	WebhookID     uint                  `gorm:"not null;index"`
+	EventID       uint                  `gorm:"not null"`
+	EventType     EventType             `gorm:"not null"`
+	Payload       string                `gorm:"type:text"` // 重试时发送相同的内容
+	Status        WebhookDeliveryStatus `gorm:"not null;index"`
+	Attempts      int                   `gorm:"not null;default:0"`
+	NextAttemptAt *time.Time            `gorm:"index"`
+	StatusCode    int                   `gorm:"not null;default:0"` // 最后一次尝试的响应码, 未收到响应时为0
+	Error         string                `gorm:"size:1024;not null;default:''"`
+	DurationMs    int64                 `gorm:"not null;default:0"`
+	DeliveredAt   *time.Time
+	CreatedAt     time.Time `gorm:"index"`
+	UpdatedAt     time.Time
+}
+
+// WebhookDispatchCursor 最后一个已生成投递记录的事件, 只有ID为1的一行. 与投递记录在同一事务中更新,
+// 重启后从该事件之后继续生成投递记录
+type WebhookDispatchCursor struct {
+	ID          uint `gorm:"primaryKey;autoIncrement:false"`
+	LastEventID uint `gorm:"not null"`
+	UpdatedAt   time.Time
+}
+
+// WebhookRequest 创建或更新Webhook的请求, 更新时忽略Name. Secret为空时创建时自动生成, 更新时保持不变
+type WebhookRequest struct {
+	Name        string      `json:"name"`
+	URL         string      `json:"url" binding:"required"`
+	Description string      `json:"description"`
+	EventTypes  []EventType `json:"eventTypes,omitempty"`
+	Namespace   string      `json:"namespace,omitempty"`
+	Secret      string      `json:"secret,omitempty"`
+	Enabled     *bool       `json:"enabled,omitempty"` // 默认true
+}
+
+type WebhookInfo struct {
+	Name        string      `json:"name"`
+	URL         string      `json:"url"`
+	Description string      `json:"description,omitempty"`
+	EventTypes  []EventType `json:"eventTypes"`
+	Namespace   string      `json:"namespace,omitempty"`
+	Enabled     bool        `json:"enabled"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	UpdatedAt   time.Time   `json:"updatedAt"`
+}
+
+// WebhookCreateResponse 创建Webhook的结果, 自动生成的Secret只返回这一次
+type WebhookCreateResponse struct {
+	WebhookInfo
+	Secret string `json:"secret,omitempty"`
+}
+
+type WebhookListResponse struct {
+	Items []WebhookInfo `json:"items"`
+}
+
+// WebhookPayload 投递的请求体
+type WebhookPayload struct {
+	Webhook string    `json:"webhook"`
+	Event   EventInfo `json:"event"`
+}
+
+// WebhookDeliveryQuery 投递记录的查询条件, 按ID倒序分页, Cursor为上一页返回的NextCursor
+type WebhookDeliveryQuery struct {
+	Status WebhookDeliveryStatus `form:"status"`
+	Limit  int                   `form:"limit" binding:"omitempty,min=1,max=1000"`
+	Cursor string                `form:"cursor"`
+}
+
+type WebhookDeliveryInfo struct {
+	ID            uint                  `json:"id"`
+	EventID       uint                  `json:"eventId"`
+	EventType     EventType             `json:"eventType"`
+	Status        WebhookDeliveryStatus `json:"status"`
+	Attempts      int                   `json:"attempts"`
+	StatusCode    int                   `json:"statusCode,omitempty"`
+	Error         string                `json:"error,omitempty"`
+	DurationMs    int64                 `json:"durationMs"`
+	NextAttemptAt *time.Time            `json:"nextAttemptAt,omitempty"`
+	DeliveredAt   *time.Time            `json:"deliveredAt,omitempty"`
+	CreatedAt     time.Time             `json:"createdAt"`
+}
+
+type WebhookDeliveryListResponse struct {
+	Items      []WebhookDeliveryInfo `json:"items"`
+	NextCursor string                `json:"nextCursor,omitempty"`
+}
@@ -0,0 +1,370 @@
+// Package openapi 根据路由表和请求/响应结构体生成OpenAPI 3文档
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pdcplet/pkg/pdcpserver/model"
+)
+
+const OPENAPI_VERSION = "3.0.3"
+
+// Operation 一个API操作, Path使用gin的路由格式, 如/templates/:name
+type Operation struct {
+	Method      string
+	Path        string
+	Tag         string
+	Summary     string
+	Query       interface{} // 以form标签绑定的查询参数结构体
+	Body        interface{} // JSON请求体
+	Response    interface{} // JSON响应体, 为nil时没有响应体
+	Status      int         // 成功时的响应码, 默认200
+	ContentType string      // 响应体的类型, 默认application/json
+	Agent       bool        // pdcplet访问的路由, 使用pdcplet的凭据
+}
+
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security,omitempty"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem 以小写的HTTP方法为key
+type PathItem map[string]*OperationObject
+
+type OperationObject struct {
+	OperationID string                `json:"operationId"`
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+// 认证方式的名称
+const (
+	SECURITY_API_KEY = "apiKey"
+	SECURITY_BEARER  = "bearer"
+	SECURITY_AGENT   = "agentSignature"
+)
+
+var (
+	pathParamPattern = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+	timeType         = reflect.TypeOf(time.Time{})
+	rawMessageType   = reflect.TypeOf(json.RawMessage{})
+)
+
+// OpenAPIPath 将gin路由转换为OpenAPI路径, 如/templates/:name转换为/templates/{name}
+func OpenAPIPath(path string) string {
+	return pathParamPattern.ReplaceAllString(path, "{$1}")
+}
+
+// Build 生成文档, 结构体以"包名.类型名"登记到components.schemas
+func Build(info Info, operations []Operation) *Document {
+	b := &builder{schemas: map[string]*Schema{}}
+	doc := &Document{
+		OpenAPI: OPENAPI_VERSION,
+		Info:    info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: b.schemas,
+			SecuritySchemes: map[string]SecurityScheme{
+				SECURITY_API_KEY: {Type: "apiKey", In: "header", Name: "X-API-Key"},
+				SECURITY_BEARER:  {Type: "http", Scheme: "bearer", Description: "JWT or API key"},
+				SECURITY_AGENT: {Type: "apiKey", In: "header", Name: "X-Pdcp-Signature",
+					Description: "HMAC-SHA256 with the shared pdcplet token over the method, path, sorted query, X-Pdcp-Timestamp and SHA256 of the body"},
+			},
+		},
+		Security: []map[string][]string{{SECURITY_API_KEY: {}}, {SECURITY_BEARER: {}}},
+	}
+	errorSchema := b.schema(reflect.TypeOf(model.ErrorResponse{}))
+
+	for _, op := range operations {
+		path := OpenAPIPath(op.Path)
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = PathItem{}
+			doc.Paths[path] = item
+		}
+
+		obj := &OperationObject{
+			OperationID: operationID(op),
+			Summary:     op.Summary,
+			Responses:   map[string]Response{},
+		}
+		if op.Tag != "" {
+			obj.Tags = []string{op.Tag}
+		}
+		if op.Agent {
+			obj.Security = []map[string][]string{{SECURITY_AGENT: {}}, {SECURITY_BEARER: {}}}
+		}
+		for _, match := range pathParamPattern.FindAllStringSubmatch(op.Path, -1) {
+			obj.Parameters = append(obj.Parameters, Parameter{Name: match[1], In: "path", Required: true,
+				Schema: &Schema{Type: "string"}})
+		}
+		if op.Query != nil {
+			obj.Parameters = append(obj.Parameters, b.queryParameters(reflect.TypeOf(op.Query))...)
+		}
+		if op.Body != nil {
+			obj.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+				"application/json": {Schema: b.schema(reflect.TypeOf(op.Body))},
+			}}
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		resp := Response{Description: http.StatusText(status)}
+		if op.Response != nil {
+			contentType := op.ContentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			resp.Content = map[string]MediaType{contentType: {Schema: b.schema(reflect.TypeOf(op.Response))}}
+		}
+		obj.Responses[strconv.Itoa(status)] = resp
+		obj.Responses["default"] = Response{Description: "Error",
+			Content: map[string]MediaType{"application/json": {Schema: errorSchema}}}
+
+		item[strings.ToLower(op.Method)] = obj
+	}
+	return doc
+}
+
+// operationID 由方法和路径生成, 如GET /pdcpserver/api/templates/:name生成get_templates_name
+func operationID(op Operation) string {
+	path := strings.TrimPrefix(op.Path, "/pdcpserver/api")
+	var parts []string
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '.' || r == '-' }) {
+		parts = append(parts, strings.TrimPrefix(part, ":"))
+	}
+	return strings.ToLower(op.Method) + "_" + strings.Join(parts, "_")
+}
+
+type builder struct {
+	schemas map[string]*Schema
+}
+
+func schemaName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	return pkg[strings.LastIndex(pkg, "/")+1:] + "." + t.Name()
+}
+
+// schema 返回类型的Schema, 命名的结构体返回对components的引用
+func (b *builder) schema(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Pointer {
+		s := b.schema(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name := schemaName(t)
+		if _, ok := b.schemas[name]; !ok {
+			// 先占位, 避免递归类型无限展开
+			b.schemas[name] = &Schema{}
+			*b.schemas[name] = *b.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		// interface{}等任意JSON值
+		return &Schema{}
+	}
+}
+
+func (b *builder) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	b.addFields(s, t)
+	return s
+}
+
+// addFields 按encoding/json的规则添加字段, 匿名嵌入的结构体展开到上层
+func (b *builder) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.addFields(s, ft)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := b.schema(field.Type)
+		applyBinding(prop, field.Tag.Get("binding"))
+		s.Properties[name] = prop
+		if bindingRequired(field.Tag.Get("binding")) && !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// queryParameters 将form标签的字段转换为查询参数, 嵌入的结构体展开
+func (b *builder) queryParameters(t reflect.Type) []Parameter {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var params []Parameter
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			params = append(params, b.queryParameters(field.Type)...)
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		schema := b.schema(field.Type)
+		applyBinding(schema, field.Tag.Get("binding"))
+		params = append(params, Parameter{Name: name, In: "query", Required: bindingRequired(field.Tag.Get("binding")),
+			Schema: schema})
+	}
+	return params
+}
+
+func bindingRequired(binding string) bool {
+	for _, rule := range strings.Split(binding, ",") {
+		if rule == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyBinding 将gin binding中的oneof/min/max转换为enum/minimum/maximum
+func applyBinding(s *Schema, binding string) {
+	if s.Ref != "" {
+		return
+	}
+	for _, rule := range strings.Split(binding, ",") {
+		key, value, ok := strings.Cut(rule, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "oneof":
+			s.Enum = strings.Fields(value)
+		case "min", "max":
+			var n float64
+			if err := json.Unmarshal([]byte(value), &n); err != nil || (s.Type != "integer" && s.Type != "number") {
+				continue
+			}
+			if key == "min" {
+				s.Minimum = &n
+			} else {
+				s.Maximum = &n
+			}
+		}
+	}
+}
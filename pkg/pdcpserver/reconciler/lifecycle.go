@@ -0,0 +1,366 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"pdcplet/pkg/kubevirt"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+	"strconv"
+	"time"
+
+	k8sv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+const (
+	DEFAULT_LIFECYCLE_INTERVAL  = 30 * time.Second
+	DEFAULT_MAX_CREATE_ATTEMPTS = 5
+	DEFAULT_RETRY_BACKOFF       = 10 * time.Second
+	MAX_RETRY_BACKOFF           = 10 * time.Minute
+)
+
+// reconciler写入审计记录时使用的调用方和操作
+const (
+	LIFECYCLE_AUDIT_ACTOR = "system:lifecycle-reconciler"
+	SYNC_AUDIT_ACTOR      = "system:status-syncer"
+	AUDIT_ACTION_CREATE   = "vm.create"
+	AUDIT_ACTION_DELETE   = "vm.delete"
+	AUDIT_ACTION_VANISHED = "vm.vanished" // VM在KubeVirt中被带外删除
+)
+
+// LifecycleReconciler 根据VirtualMachineRecord驱动KubeVirt中VM的创建与删除.
+// 记录先以Pending/Deleting状态写入数据库, 再由reconciler异步在KubeVirt中执行, 失败时按指数退避重试
+type LifecycleReconciler interface {
+	Run(ctx context.Context)
+	// Trigger 通知reconciler立即处理待处理的记录
+	Trigger()
+}
+
+type lifecycleReconciler struct {
+	client       kubevirt.VMClient
+	interval     time.Duration
+	maxAttempts  int
+	retryBackoff time.Duration
+	trigger      chan struct{}
+}
+
+func NewLifecycleReconciler(client kubevirt.VMClient, cfg config.LifecycleConfig) LifecycleReconciler {
+	r := &lifecycleReconciler{
+		client:       client,
+		interval:     cfg.Interval,
+		maxAttempts:  cfg.MaxAttempts,
+		retryBackoff: cfg.RetryBackoff,
+		trigger:      make(chan struct{}, 1),
+	}
+	if r.interval <= 0 {
+		r.interval = DEFAULT_LIFECYCLE_INTERVAL
+	}
+	if r.maxAttempts <= 0 {
+		r.maxAttempts = DEFAULT_MAX_CREATE_ATTEMPTS
+	}
+	if r.retryBackoff <= 0 {
+		r.retryBackoff = DEFAULT_RETRY_BACKOFF
+	}
+	return r
+}
+
+func (r *lifecycleReconciler) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (r *lifecycleReconciler) Run(ctx context.Context) {
+	slog.Info("VM lifecycle reconciler started")
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.reconcileOnce(); err != nil {
+			slog.Error("Failed to reconcile VM lifecycle", "errMsg", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-r.trigger:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reconcileOnce 按ID顺序处理所有到期的待创建和待删除记录
+func (r *lifecycleReconciler) reconcileOnce() error {
+	var vmrs []model.VirtualMachineRecord
+	err := database.DB.
+		Where("(status IN ? AND attempts < ?) OR status = ?",
+			[]model.VirtualMachineStatus{model.Pending, model.CreateFailed}, r.maxAttempts, model.Deleting).
+		Where("next_attempt_at IS NULL OR next_attempt_at <= ?", time.Now()).
+		Order("id asc").Find(&vmrs).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range vmrs {
+		vmr := &vmrs[i]
+		var err error
+		if vmr.Status == model.Deleting {
+			err = r.delete(vmr)
+		} else {
+			err = r.create(vmr)
+		}
+		if err != nil {
+			slog.Error("Failed to update VirtualMachineRecord", "VmName", vmr.Name, "Namespace", vmr.Namespace, "errMsg", err)
+		}
+	}
+	return nil
+}
+
+func (r *lifecycleReconciler) create(vmr *model.VirtualMachineRecord) error {
+	start := time.Now()
+	vm, secret, err := newKubeVirtObjects(vmr)
+	if err != nil {
+		// 无法恢复的错误, 不再重试
+		slog.Error("Invalid spec of VirtualMachineRecord", "VmName", vmr.Name, "Namespace", vmr.Namespace, "errMsg", err)
+		recordAudit(LIFECYCLE_AUDIT_ACTOR, AUDIT_ACTION_CREATE, vmr, start, err)
+		return r.transition(vmr, map[string]interface{}{
+			"Status":          model.CreateFailed,
+			"Attempts":        r.maxAttempts,
+			"LastError":       fmt.Sprintf("invalid spec: %v", err),
+			"LastErrorReason": string(k8smetav1.StatusReasonInvalid),
+			"NextAttemptAt":   nil,
+		})
+	}
+
+	err = r.createObjects(vmr, vm, secret)
+	recordAudit(LIFECYCLE_AUDIT_ACTOR, AUDIT_ACTION_CREATE, vmr, start, err)
+	if err != nil {
+		attempts := vmr.Attempts + 1
+		slog.Error("Failed to create Kubevirt VirtualMachine", "error", err, "VmName", vmr.Name, "Namespace", vmr.Namespace,
+			"attempts", attempts, "maxAttempts", r.maxAttempts)
+		// 达到最大重试次数后NextAttemptAt置空, 表示不再重试
+		var nextAttemptAt *time.Time
+		if attempts < r.maxAttempts {
+			t := time.Now().Add(r.backoff(attempts))
+			nextAttemptAt = &t
+		}
+		return r.transition(vmr, map[string]interface{}{
+			"Status":          model.CreateFailed,
+			"Attempts":        attempts,
+			"LastError":       err.Error(),
+			"LastErrorReason": string(apierrors.ReasonForError(err)),
+			"NextAttemptAt":   nextAttemptAt,
+		})
+	}
+
+	slog.Info("Created Kubevirt VirtualMachine", "VmName", vmr.Name, "Namespace", vmr.Namespace)
+	now := time.Now()
+	return r.transition(vmr, map[string]interface{}{
+		"Status":             model.Created,
+		"Attempts":           0,
+		"LastError":          "",
+		"LastErrorReason":    "",
+		"NextAttemptAt":      nil,
+		"LastTransitionTime": &now,
+	})
+}
+
+// newKubeVirtObjects 根据记录中保存的创建请求生成VM和可选的cloud-init Secret
+func newKubeVirtObjects(vmr *model.VirtualMachineRecord) (*kubevirtv1.VirtualMachine, *k8sv1.Secret, error) {
+	var req model.VMCreateRequest
+	if err := json.Unmarshal([]byte(vmr.Spec), &req); err != nil {
+		return nil, nil, err
+	}
+	vm, err := model.NewKubeVirtVM(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	secret, err := model.NewCloudInitSecret(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if vm.Annotations == nil {
+		vm.Annotations = make(map[string]string)
+	}
+	vm.Annotations[model.RecordIDAnnotation] = strconv.FormatUint(uint64(vmr.ID), 10)
+	return vm, secret, nil
+}
+
+// createObjects 创建VLAN网络和VM, 再接管保留的DataVolume并创建以VM为owner的cloud-init Secret, VM删除时Secret由垃圾回收删除
+func (r *lifecycleReconciler) createObjects(vmr *model.VirtualMachineRecord, vm *kubevirtv1.VirtualMachine, secret *k8sv1.Secret) error {
+	if err := r.createVlanNetworks(vmr); err != nil {
+		return err
+	}
+	created, err := r.client.CreateVM(vm)
+	if apierrors.IsAlreadyExists(err) {
+		// 上一次创建可能已成功但未来得及更新记录
+		createErr := err
+		var owned bool
+		created, owned, err = r.ownedBy(vmr, false)
+		if err == nil && !owned {
+			err = fmt.Errorf("virtual machine %s/%s is not managed by pdcpserver: %w", vmr.Namespace, vmr.Name, createErr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	owner := k8smetav1.OwnerReference{
+		APIVersion: kubevirtv1.GroupVersion.String(),
+		Kind:       "VirtualMachine",
+		Name:       created.Name,
+		UID:        created.UID,
+	}
+	if err := r.adoptRetainedDataVolumes(vmr, owner); err != nil {
+		return err
+	}
+	if secret == nil {
+		return nil
+	}
+	secret.OwnerReferences = []k8smetav1.OwnerReference{owner}
+	if err := r.client.CreateSecret(secret); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+func (r *lifecycleReconciler) delete(vmr *model.VirtualMachineRecord) error {
+	start := time.Now()
+	_, owned, err := r.ownedBy(vmr, true)
+	if err == nil && owned {
+		err = r.orphanRetainedDataVolumes(vmr)
+		if err == nil {
+			err = r.client.DeleteVM(vmr.Name, vmr.Namespace)
+		}
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		recordAudit(LIFECYCLE_AUDIT_ACTOR, AUDIT_ACTION_DELETE, vmr, start, err)
+		attempts := vmr.Attempts + 1
+		slog.Error("Failed to delete Kubevirt VirtualMachine", "error", err, "VmName", vmr.Name, "Namespace", vmr.Namespace,
+			"attempts", attempts)
+		nextAttemptAt := time.Now().Add(r.backoff(attempts))
+		return r.transition(vmr, map[string]interface{}{
+			"Attempts":        attempts,
+			"LastError":       err.Error(),
+			"LastErrorReason": string(apierrors.ReasonForError(err)),
+			"NextAttemptAt":   &nextAttemptAt,
+		})
+	}
+
+	slog.Info("Deleted Kubevirt VirtualMachine", "VmName", vmr.Name, "Namespace", vmr.Namespace)
+	recordAudit(LIFECYCLE_AUDIT_ACTOR, AUDIT_ACTION_DELETE, vmr, start, nil)
+	return finalizeRecord(vmr)
+}
+
+// orphanRetainedDataVolumes 删除VM前解除retain策略的DataVolume与VM的owner关系
+func (r *lifecycleReconciler) orphanRetainedDataVolumes(vmr *model.VirtualMachineRecord) error {
+	var disks []model.VirtualMachineDisk
+	err := database.DB.Where("virtual_machine_record_id = ? AND type = ? AND retention = ?",
+		vmr.ID, model.DiskTypeDataVolume, model.RetentionRetain).Find(&disks).Error
+	if err != nil {
+		return err
+	}
+	for _, disk := range disks {
+		err := r.client.OrphanDataVolume(disk.DataVolumeName, disk.VmNamespace)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// createVlanNetworks 为指定VlanID的multus接口创建VLAN网络, 网络可被多个VM共用, 不随VM删除
+func (r *lifecycleReconciler) createVlanNetworks(vmr *model.VirtualMachineRecord) error {
+	var ifaces []model.VirtualMachineInterface
+	err := database.DB.Where("virtual_machine_record_id = ? AND type = ? AND vid > 0", vmr.ID, model.NetworkTypeMultus).
+		Find(&ifaces).Error
+	if err != nil {
+		return err
+	}
+	for _, iface := range ifaces {
+		namespace, source := model.SplitNetworkName(iface.NetworkName, vmr.Namespace)
+		if err := r.client.CreateVlanNetwork(namespace, source, model.VlanNetworkName(source, iface.Vid), iface.Vid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adoptRetainedDataVolumes 将以retained来源接管的DataVolume的owner设为VM
+func (r *lifecycleReconciler) adoptRetainedDataVolumes(vmr *model.VirtualMachineRecord, owner k8smetav1.OwnerReference) error {
+	var disks []model.VirtualMachineDisk
+	err := database.DB.Where("virtual_machine_record_id = ? AND type = ? AND source = ?",
+		vmr.ID, model.DiskTypeDataVolume, model.DataVolumeSourceRetained).Find(&disks).Error
+	if err != nil {
+		return err
+	}
+	for _, disk := range disks {
+		if err := r.client.AdoptDataVolume(disk.DataVolumeName, disk.VmNamespace, owner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ownedBy 判断KubeVirt中的同名VM是否由该记录创建, allowLegacy为true时没有注解的VM视为早期版本创建
+func (r *lifecycleReconciler) ownedBy(vmr *model.VirtualMachineRecord, allowLegacy bool) (*kubevirtv1.VirtualMachine, bool, error) {
+	vm, err := r.client.GetVM(vmr.Name, vmr.Namespace)
+	if err != nil {
+		return nil, false, err
+	}
+	id, ok := vm.Annotations[model.RecordIDAnnotation]
+	if !ok {
+		return vm, allowLegacy, nil
+	}
+	return vm, id == strconv.FormatUint(uint64(vmr.ID), 10), nil
+}
+
+// transition 仅当记录状态未被并发修改时更新, 避免覆盖期间发起的删除. 状态变化时发布事件
+func (r *lifecycleReconciler) transition(vmr *model.VirtualMachineRecord, updates map[string]interface{}) error {
+	res := database.DB.Model(&model.VirtualMachineRecord{}).
+		Where("id = ? AND status = ?", vmr.ID, vmr.Status).
+		Updates(updates)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return res.Error
+	}
+	if status, ok := updates["Status"].(model.VirtualMachineStatus); ok {
+		lastError, _ := updates["LastError"].(string)
+		service.PublishVMStatus(vmr, status, lastError)
+	}
+	return nil
+}
+
+// recordAudit 记录reconciler对KubeVirt的一次操作, err为nil表示成功
+func recordAudit(actor string, action string, vmr *model.VirtualMachineRecord, start time.Time, err error) {
+	event := model.AuditEvent{
+		Timestamp:       start,
+		Source:          model.AuditSourceReconciler,
+		Actor:           actor,
+		Action:          action,
+		TargetNamespace: vmr.Namespace,
+		TargetName:      vmr.Name,
+		Result:          model.AuditResultSuccess,
+		LatencyMs:       time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		event.Result = model.AuditResultFailure
+		event.Error = err.Error()
+	}
+	service.RecordAudit(event)
+}
+
+func (r *lifecycleReconciler) backoff(attempts int) time.Duration {
+	d := r.retryBackoff
+	for i := 1; i < attempts && d < MAX_RETRY_BACKOFF; i++ {
+		d *= 2
+	}
+	return min(d, MAX_RETRY_BACKOFF)
+}
@@ -0,0 +1,378 @@
+package reconciler
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"strings"
+	"testing"
+	"time"
+
+	k8sv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+var vmResource = schema.GroupResource{Group: "kubevirt.io", Resource: "virtualmachines"}
+
+// fakeVMClient 基于map的KubeVirt VM客户端, createErrs中的错误依次在CreateVM时返回
+type fakeVMClient struct {
+	vms        map[string]*kubevirtv1.VirtualMachine
+	createErrs []error
+	deletes    int
+	secrets    map[string]*k8sv1.Secret
+	orphaned   []string
+	adopted    map[string]types.UID // DataVolume -> owner VM的UID
+	vlans      map[string]int64     // namespace/source/target -> vlanID
+}
+
+func newFakeVMClient() *fakeVMClient {
+	return &fakeVMClient{
+		vms:     make(map[string]*kubevirtv1.VirtualMachine),
+		secrets: make(map[string]*k8sv1.Secret),
+		adopted: make(map[string]types.UID),
+		vlans:   make(map[string]int64),
+	}
+}
+
+func (f *fakeVMClient) CreateVM(vm *kubevirtv1.VirtualMachine) (*kubevirtv1.VirtualMachine, error) {
+	if len(f.createErrs) > 0 {
+		err := f.createErrs[0]
+		f.createErrs = f.createErrs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	key := vm.Namespace + "/" + vm.Name
+	if _, ok := f.vms[key]; ok {
+		return nil, apierrors.NewAlreadyExists(vmResource, vm.Name)
+	}
+	vm.UID = types.UID("uid-" + vm.Name)
+	f.vms[key] = vm
+	return vm, nil
+}
+
+func (f *fakeVMClient) CreateSecret(secret *k8sv1.Secret) error {
+	key := secret.Namespace + "/" + secret.Name
+	if _, ok := f.secrets[key]; ok {
+		return apierrors.NewAlreadyExists(schema.GroupResource{Resource: "secrets"}, secret.Name)
+	}
+	f.secrets[key] = secret
+	return nil
+}
+
+func (f *fakeVMClient) GetVM(name string, namespace string) (*kubevirtv1.VirtualMachine, error) {
+	vm, ok := f.vms[namespace+"/"+name]
+	if !ok {
+		return nil, apierrors.NewNotFound(vmResource, name)
+	}
+	return vm, nil
+}
+
+func (f *fakeVMClient) DeleteVM(name string, namespace string) error {
+	key := namespace + "/" + name
+	if _, ok := f.vms[key]; !ok {
+		return apierrors.NewNotFound(vmResource, name)
+	}
+	f.deletes++
+	delete(f.vms, key)
+	return nil
+}
+
+func (f *fakeVMClient) OrphanDataVolume(name string, namespace string) error {
+	f.orphaned = append(f.orphaned, namespace+"/"+name)
+	return nil
+}
+
+func (f *fakeVMClient) AdoptDataVolume(name string, namespace string, owner metav1.OwnerReference) error {
+	f.adopted[namespace+"/"+name] = owner.UID
+	return nil
+}
+
+func (f *fakeVMClient) CreateVlanNetwork(namespace string, source string, target string, vlanID int64) error {
+	f.vlans[namespace+"/"+source+"/"+target] = vlanID
+	return nil
+}
+
+func setupLifecycleTest(t *testing.T) (*fakeVMClient, *lifecycleReconciler) {
+	t.Helper()
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	client := newFakeVMClient()
+	r := NewLifecycleReconciler(client, config.LifecycleConfig{MaxAttempts: 2, RetryBackoff: time.Millisecond})
+	return client, r.(*lifecycleReconciler)
+}
+
+func createPendingRecord(t *testing.T, name string) model.VirtualMachineRecord {
+	t.Helper()
+	req := model.VMCreateRequest{Name: name, Namespace: "default", Memory: "1Gi", CPU: 1, Image: "cirros"}
+	spec, _ := json.Marshal(req)
+	vmr := model.VirtualMachineRecord{
+		Name: name, Namespace: "default", CPU: 1, Memory: "1Gi", Status: model.Pending, Spec: string(spec),
+	}
+	if err := database.DB.Create(&vmr).Error; err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+	return vmr
+}
+
+func reloadRecord(t *testing.T, id uint) model.VirtualMachineRecord {
+	t.Helper()
+	var vmr model.VirtualMachineRecord
+	if err := database.DB.Unscoped().First(&vmr, id).Error; err != nil {
+		t.Fatalf("reload record: %v", err)
+	}
+	return vmr
+}
+
+func TestLifecycleCreate(t *testing.T) {
+	client, r := setupLifecycleTest(t)
+	vmr := createPendingRecord(t, "vm1")
+
+	if err := r.reconcileOnce(); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if got := reloadRecord(t, vmr.ID).Status; got != model.Created {
+		t.Fatalf("status = %s, want %s", got, model.Created)
+	}
+	vm, err := client.GetVM("vm1", "default")
+	if err != nil {
+		t.Fatalf("vm not created: %v", err)
+	}
+	if vm.Annotations[model.RecordIDAnnotation] != "1" {
+		t.Errorf("record id annotation = %q", vm.Annotations[model.RecordIDAnnotation])
+	}
+
+	var event model.AuditEvent
+	if err := database.DB.Where("action = ?", AUDIT_ACTION_CREATE).First(&event).Error; err != nil {
+		t.Fatalf("audit event not recorded: %v", err)
+	}
+	if event.Source != model.AuditSourceReconciler || event.TargetName != "vm1" || event.Result != model.AuditResultSuccess {
+		t.Errorf("unexpected audit event: %+v", event)
+	}
+}
+
+func TestLifecycleCreateRetry(t *testing.T) {
+	client, r := setupLifecycleTest(t)
+	client.createErrs = []error{errors.New("apiserver unavailable")}
+	vmr := createPendingRecord(t, "vm1")
+
+	r.reconcileOnce()
+	got := reloadRecord(t, vmr.ID)
+	if got.Status != model.CreateFailed || got.Attempts != 1 || got.LastError == "" || got.NextAttemptAt == nil {
+		t.Fatalf("unexpected record after failure: status=%s attempts=%d lastError=%q", got.Status, got.Attempts, got.LastError)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	r.reconcileOnce()
+	got = reloadRecord(t, vmr.ID)
+	if got.Status != model.Created || got.Attempts != 0 || got.LastError != "" {
+		t.Fatalf("unexpected record after retry: status=%s attempts=%d lastError=%q", got.Status, got.Attempts, got.LastError)
+	}
+}
+
+func TestLifecycleCreateGiveUp(t *testing.T) {
+	client, r := setupLifecycleTest(t)
+	client.createErrs = []error{errors.New("e1"), errors.New("e2"), nil}
+	vmr := createPendingRecord(t, "vm1")
+
+	for i := 0; i < 3; i++ {
+		r.reconcileOnce()
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := reloadRecord(t, vmr.ID); !got.CreateAbandoned() || got.Attempts != 2 {
+		t.Fatalf("status=%s attempts=%d, want CreateFailed after 2 attempts", got.Status, got.Attempts)
+	}
+	if len(client.vms) != 0 {
+		t.Errorf("vm created after max attempts")
+	}
+}
+
+func TestLifecycleCreateAlreadyExists(t *testing.T) {
+	client, r := setupLifecycleTest(t)
+	vmr := createPendingRecord(t, "vm1")
+
+	// 上一次创建成功但更新记录前进程退出
+	vm, _ := model.NewKubeVirtVM(model.VMCreateRequest{Name: "vm1", Namespace: "default", Memory: "1Gi", CPU: 1})
+	vm.Annotations = map[string]string{model.RecordIDAnnotation: "1"}
+	client.vms["default/vm1"] = vm
+
+	r.reconcileOnce()
+	if got := reloadRecord(t, vmr.ID).Status; got != model.Created {
+		t.Fatalf("status = %s, want %s", got, model.Created)
+	}
+
+	// 不属于该记录的同名VM
+	other := createPendingRecord(t, "vm2")
+	client.vms["default/vm2"], _ = model.NewKubeVirtVM(model.VMCreateRequest{Name: "vm2", Namespace: "default", Memory: "1Gi", CPU: 1})
+	r.reconcileOnce()
+	got := reloadRecord(t, other.ID)
+	if got.Status != model.CreateFailed || got.LastErrorReason != string(metav1.StatusReasonAlreadyExists) {
+		t.Fatalf("status = %s reason = %q, want %s with reason AlreadyExists", got.Status, got.LastErrorReason, model.CreateFailed)
+	}
+}
+
+func TestLifecycleCreateCloudInitSecret(t *testing.T) {
+	client, r := setupLifecycleTest(t)
+	req := model.VMCreateRequest{
+		Name: "vm1", Namespace: "default", Memory: "1Gi", CPU: 1, Image: "cirros",
+		CloudInit: &model.CloudInitSpec{UserData: "#!/bin/sh\n# " + strings.Repeat("x", model.CLOUD_INIT_INLINE_LIMIT)},
+	}
+	spec, _ := json.Marshal(req)
+	vmr := model.VirtualMachineRecord{Name: "vm1", Namespace: "default", CPU: 1, Memory: "1Gi", Status: model.Pending, Spec: string(spec)}
+	if err := database.DB.Create(&vmr).Error; err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+
+	r.reconcileOnce()
+	if got := reloadRecord(t, vmr.ID).Status; got != model.Created {
+		t.Fatalf("status = %s, want %s", got, model.Created)
+	}
+	secret, ok := client.secrets["default/"+model.CloudInitSecretName("vm1")]
+	if !ok {
+		t.Fatalf("cloud-init secret not created")
+	}
+	if len(secret.OwnerReferences) != 1 || secret.OwnerReferences[0].UID != client.vms["default/vm1"].UID {
+		t.Errorf("secret not owned by vm: %+v", secret.OwnerReferences)
+	}
+	for _, volume := range client.vms["default/vm1"].Spec.Template.Spec.Volumes {
+		if volume.CloudInitNoCloud != nil && volume.CloudInitNoCloud.UserDataSecretRef == nil {
+			t.Errorf("oversized userData should reference the secret")
+		}
+	}
+}
+
+func TestLifecycleDelete(t *testing.T) {
+	client, r := setupLifecycleTest(t)
+	vmr := createPendingRecord(t, "vm1")
+	r.reconcileOnce()
+
+	database.DB.Model(&vmr).Update("Status", model.Deleting)
+	r.reconcileOnce()
+
+	if _, err := client.GetVM("vm1", "default"); !apierrors.IsNotFound(err) {
+		t.Fatalf("vm not deleted: %v", err)
+	}
+	got := reloadRecord(t, vmr.ID)
+	if got.Status != model.MarkDeleted || !got.DeletedAt.Valid {
+		t.Fatalf("status=%s deleted=%v, want soft deleted MarkDeleted", got.Status, got.DeletedAt.Valid)
+	}
+}
+
+func TestLifecycleDeleteRetainsDataVolumes(t *testing.T) {
+	client, r := setupLifecycleTest(t)
+	req := model.VMCreateRequest{Name: "vm1", Namespace: "default", Memory: "1Gi", CPU: 1, Disks: []model.DiskSpec{
+		{Name: "root", DataVolume: &model.DataVolumeSpec{Source: model.DataVolumeSourceHTTP, URL: "http://example.com/disk.img", Size: "10Gi"}},
+		{Name: "data", DataVolume: &model.DataVolumeSpec{Source: model.DataVolumeSourceBlank, Size: "20Gi", Retention: model.RetentionRetain}},
+	}}
+	spec, _ := json.Marshal(req)
+	vmr := model.VirtualMachineRecord{Name: "vm1", Namespace: "default", CPU: 1, Memory: "1Gi", Status: model.Pending, Spec: string(spec)}
+	database.DB.Create(&vmr)
+	disks := model.NewVirtualMachineDisks(vmr.ID, req)
+	database.DB.Create(&disks)
+
+	r.reconcileOnce()
+	vm := client.vms["default/vm1"]
+	if vm == nil || len(vm.Spec.DataVolumeTemplates) != 2 || vm.Spec.Template.Spec.Volumes[1].DataVolume.Name != "vm1-data" {
+		t.Fatalf("data volumes not in vm: %+v", vm)
+	}
+
+	database.DB.Model(&vmr).Update("Status", model.Deleting)
+	r.reconcileOnce()
+	if len(client.orphaned) != 1 || client.orphaned[0] != "default/vm1-data" {
+		t.Fatalf("orphaned = %v, want [default/vm1-data]", client.orphaned)
+	}
+
+	var remaining []model.VirtualMachineDisk
+	database.DB.Where("virtual_machine_record_id = ?", vmr.ID).Find(&remaining)
+	if len(remaining) != 1 || remaining[0].Name != "data" || remaining[0].Status != model.DiskRetained {
+		t.Fatalf("remaining disks = %+v, want only retained data disk", remaining)
+	}
+}
+
+func TestLifecycleAdoptRetainedDataVolume(t *testing.T) {
+	client, r := setupLifecycleTest(t)
+	req := model.VMCreateRequest{Name: "vm1", Namespace: "default", Memory: "1Gi", CPU: 1, Disks: []model.DiskSpec{
+		{Name: "root", Image: "cirros"},
+		{Name: "data", DataVolume: &model.DataVolumeSpec{Source: model.DataVolumeSourceRetained, Retention: model.RetentionRetain}},
+	}}
+	spec, _ := json.Marshal(req)
+	vmr := model.VirtualMachineRecord{Name: "vm1", Namespace: "default", CPU: 1, Memory: "1Gi", Status: model.Pending, Spec: string(spec)}
+	database.DB.Create(&vmr)
+	disks := model.NewVirtualMachineDisks(vmr.ID, req)
+	database.DB.Create(&disks)
+
+	r.reconcileOnce()
+	vm := client.vms["default/vm1"]
+	if vm == nil || len(vm.Spec.DataVolumeTemplates) != 0 || vm.Spec.Template.Spec.Volumes[1].DataVolume.Name != "vm1-data" {
+		t.Fatalf("retained data volume not referenced by vm: %+v", vm)
+	}
+	if uid, ok := client.adopted["default/vm1-data"]; !ok || uid != vm.UID {
+		t.Fatalf("adopted = %v, want default/vm1-data owned by %s", client.adopted, vm.UID)
+	}
+	if got := reloadRecord(t, vmr.ID); got.Status != model.Created {
+		t.Fatalf("status = %s, want %s", got.Status, model.Created)
+	}
+
+	// 接管的DataVolume删除时按新的保留策略解除owner
+	database.DB.Model(&vmr).Update("Status", model.Deleting)
+	r.reconcileOnce()
+	if len(client.orphaned) != 1 || client.orphaned[0] != "default/vm1-data" {
+		t.Fatalf("orphaned = %v, want [default/vm1-data]", client.orphaned)
+	}
+}
+
+func TestLifecycleCreateVlanNetworks(t *testing.T) {
+	client, r := setupLifecycleTest(t)
+	req := model.VMCreateRequest{Name: "vm1", Namespace: "default", Memory: "1Gi", CPU: 1, Image: "cirros", Networks: []model.NetworkSpec{
+		{Name: "default"},
+		{Name: "capture", Type: model.NetworkTypeMultus, NetworkName: "pdcp/capture-net", VlanID: 100},
+		{Name: "local", Type: model.NetworkTypeMultus, NetworkName: "local-net", VlanID: 200},
+		{Name: "mirror", Type: model.NetworkTypeMultus, NetworkName: "mirror-net"},
+	}}
+	spec, _ := json.Marshal(req)
+	vmr := model.VirtualMachineRecord{Name: "vm1", Namespace: "default", CPU: 1, Memory: "1Gi", Status: model.Pending, Spec: string(spec)}
+	database.DB.Create(&vmr)
+	ifaces := model.NewVirtualMachineInterfaces(vmr.ID, req)
+	database.DB.Create(&ifaces)
+
+	r.reconcileOnce()
+	want := map[string]int64{"pdcp/capture-net/capture-net-vlan100": 100, "default/local-net/local-net-vlan200": 200}
+	if len(client.vlans) != len(want) {
+		t.Fatalf("vlan networks = %v, want %v", client.vlans, want)
+	}
+	for key, vlan := range want {
+		if client.vlans[key] != vlan {
+			t.Fatalf("vlan networks = %v, want %v", client.vlans, want)
+		}
+	}
+	networks := client.vms["default/vm1"].Spec.Template.Spec.Networks
+	if networks[1].Multus.NetworkName != "pdcp/capture-net-vlan100" || networks[2].Multus.NetworkName != "local-net-vlan200" {
+		t.Fatalf("unexpected networks: %+v", networks)
+	}
+}
+
+func TestLifecycleDeleteBeforeCreate(t *testing.T) {
+	client, r := setupLifecycleTest(t)
+	client.createErrs = []error{errors.New("apiserver unavailable")}
+	vmr := createPendingRecord(t, "vm1")
+	r.reconcileOnce()
+
+	database.DB.Model(&vmr).Update("Status", model.Deleting)
+	time.Sleep(5 * time.Millisecond)
+	r.reconcileOnce()
+
+	if client.deletes != 0 || len(client.vms) != 0 {
+		t.Fatalf("unexpected vms in kubevirt: %v", client.vms)
+	}
+	if got := reloadRecord(t, vmr.ID); got.Status != model.MarkDeleted {
+		t.Fatalf("status = %s, want %s", got.Status, model.MarkDeleted)
+	}
+}
@@ -0,0 +1,329 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/service"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	k8sv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	k8smetav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+	"kubevirt.io/client-go/kubecli"
+)
+
+const (
+	DEFAULT_RESYNC_PERIOD = 10 * time.Minute
+)
+
+// StatusSyncer 通过VM和VMI的Informer, 将KubeVirt中的实时状态同步到VirtualMachineRecord
+type StatusSyncer interface {
+	Run(ctx context.Context)
+}
+
+type statusSyncer struct {
+	kubevirtClient kubecli.KubevirtClient
+	vmInformer     cache.SharedIndexInformer
+	vmiInformer    cache.SharedIndexInformer
+	queue          workqueue.RateLimitingInterface
+	resyncPeriod   time.Duration
+}
+
+func NewStatusSyncer(kubevirtClient kubecli.KubevirtClient, resyncPeriod time.Duration) StatusSyncer {
+	if resyncPeriod <= 0 {
+		resyncPeriod = DEFAULT_RESYNC_PERIOD
+	}
+
+	vmInformer := cache.NewSharedIndexInformer(
+		cache.NewListWatchFromClient(kubevirtClient.RestClient(), "virtualmachines", k8sv1.NamespaceAll, fields.Everything()),
+		&kubevirtv1.VirtualMachine{},
+		resyncPeriod,
+		cache.Indexers{},
+	)
+	vmiInformer := cache.NewSharedIndexInformer(
+		cache.NewListWatchFromClient(kubevirtClient.RestClient(), "virtualmachineinstances", k8sv1.NamespaceAll, fields.Everything()),
+		&kubevirtv1.VirtualMachineInstance{},
+		resyncPeriod,
+		cache.Indexers{},
+	)
+
+	s := &statusSyncer{
+		kubevirtClient: kubevirtClient,
+		vmInformer:     vmInformer,
+		vmiInformer:    vmiInformer,
+		queue:          workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		resyncPeriod:   resyncPeriod,
+	}
+
+	// VM和VMI同名, 统一以namespace/name作为队列的key
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    s.enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) { s.enqueue(newObj) },
+		DeleteFunc: s.enqueue,
+	}
+	vmInformer.AddEventHandler(handler)
+	vmiInformer.AddEventHandler(handler)
+	return s
+}
+
+func (s *statusSyncer) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		slog.Error("Failed to get key of object", "errMsg", err)
+		return
+	}
+	s.queue.Add(key)
+}
+
+func (s *statusSyncer) Run(ctx context.Context) {
+	go s.vmInformer.Run(ctx.Done())
+	go s.vmiInformer.Run(ctx.Done())
+
+	if !cache.WaitForCacheSync(ctx.Done(), s.vmInformer.HasSynced, s.vmiInformer.HasSynced) {
+		slog.Error("WaitForCacheSync timeout")
+		return
+	}
+	slog.Info("VM status syncer started")
+
+	go s.resyncRecords(ctx)
+
+	go func() {
+		<-ctx.Done()
+		s.queue.ShutDown()
+	}()
+
+	for {
+		key, quit := s.queue.Get()
+		if quit {
+			return
+		}
+		if err := s.sync(key.(string)); err != nil {
+			slog.Error("Failed to sync VM status", "key", key, "errMsg", err)
+			s.queue.AddRateLimited(key)
+		} else {
+			s.queue.Forget(key)
+		}
+		s.queue.Done(key)
+	}
+}
+
+// resyncRecords 周期性地将所有记录入队, 以发现pdcpserver停止期间在集群外被删除的VM
+func (s *statusSyncer) resyncRecords(ctx context.Context) {
+	ticker := time.NewTicker(s.resyncPeriod)
+	defer ticker.Stop()
+
+	for {
+		var vmrs []model.VirtualMachineRecord
+		if err := database.DB.Select("name", "namespace").Find(&vmrs).Error; err != nil {
+			slog.Error("Failed to list VirtualMachineRecords", "errMsg", err)
+		}
+		for _, vmr := range vmrs {
+			s.queue.Add(vmr.Namespace + "/" + vmr.Name)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *statusSyncer) sync(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil
+	}
+
+	var vmr model.VirtualMachineRecord
+	err = database.DB.Where("name = ? AND namespace = ?", name, namespace).Order("id desc").First(&vmr).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 不是通过pdcpserver创建的VM
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	switch vmr.Status {
+	case model.Pending, model.CreateFailed, model.Deleting:
+		// 由生命周期reconciler负责
+		return nil
+	}
+
+	vmObj, vmExists, err := s.vmInformer.GetStore().GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !vmExists {
+		// Informer可能落后于刚创建的VM, 删除记录前向apiserver确认
+		_, err := s.kubevirtClient.VirtualMachine(namespace).Get(name, &k8smetav1.GetOptions{})
+		if err == nil {
+			return nil
+		} else if !apierrors.IsNotFound(err) {
+			return err
+		}
+		return finalizeRecord(&vmr)
+	}
+	if vmr.Status == model.MarkDeleted {
+		return nil
+	}
+
+	var vmi *kubevirtv1.VirtualMachineInstance
+	if vmiObj, vmiExists, err := s.vmiInformer.GetStore().GetByKey(key); err != nil {
+		return err
+	} else if vmiExists {
+		vmi = vmiObj.(*kubevirtv1.VirtualMachineInstance)
+		if err := syncInterfaceMacs(&vmr, vmi); err != nil {
+			return err
+		}
+	}
+
+	updates := liveStatus(vmObj.(*kubevirtv1.VirtualMachine), vmi)
+	if updates.Status == vmr.Status && updates.Phase == vmr.Phase && updates.NodeName == vmr.NodeName &&
+		updates.IPs == vmr.IPs && updates.Ready == vmr.Ready {
+		return nil
+	}
+	columns := []string{"Status", "Phase", "NodeName", "IPs", "Ready"}
+	if updates.Status != vmr.Status {
+		slog.Info("VM status changed", "VmName", name, "Namespace", namespace, "from", vmr.Status, "to", updates.Status)
+		now := time.Now()
+		updates.LastTransitionTime = &now
+		columns = append(columns, "LastTransitionTime")
+	}
+	// 状态未被并发修改时才更新, 避免覆盖期间发起的删除
+	from := vmr
+	res := database.DB.Model(&vmr).Where("status = ?", vmr.Status).Select(columns).Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		from.Phase, from.NodeName = updates.Phase, updates.NodeName
+		service.PublishVMStatus(&from, updates.Status, "")
+	}
+	return nil
+}
+
+// syncInterfaceMacs 将VMI中各接口实际的MAC写入接口记录
+func syncInterfaceMacs(vmr *model.VirtualMachineRecord, vmi *kubevirtv1.VirtualMachineInstance) error {
+	for _, iface := range vmi.Status.Interfaces {
+		if iface.Name == "" || iface.MAC == "" {
+			continue
+		}
+		mac := model.NormalizeMac(iface.MAC)
+		err := database.DB.Model(&model.VirtualMachineInterface{}).
+			Where("virtual_machine_record_id = ? AND name = ? AND mac <> ?", vmr.ID, iface.Name, mac).
+			Update("Mac", mac).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finalizeRecord KubeVirt中的VM已不存在, 将记录标记为删除并软删除
+func finalizeRecord(vmr *model.VirtualMachineRecord) error {
+	if vmr.Status != model.MarkDeleted && vmr.Status != model.Deleting {
+		slog.Warn("VM was deleted out of band", "VmName", vmr.Name, "Namespace", vmr.Namespace, "status", vmr.Status)
+		recordAudit(SYNC_AUDIT_ACTOR, AUDIT_ACTION_VANISHED, vmr, time.Now(), nil)
+	}
+	from := *vmr
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := finalizeDisks(tx, vmr); err != nil {
+			return err
+		}
+		if err := tx.Where("virtual_machine_record_id = ?", vmr.ID).Delete(&model.VirtualMachineInterface{}).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		err := tx.Model(vmr).Updates(map[string]interface{}{
+			"Status":             model.MarkDeleted,
+			"Ready":              false,
+			"LastTransitionTime": &now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(vmr).Error
+	})
+	if err != nil {
+		return err
+	}
+	service.PublishVMStatus(&from, model.MarkDeleted, "")
+	return nil
+}
+
+// finalizeDisks retain策略的DataVolume磁盘标记为Retained, 其余磁盘记录随VM记录软删除.
+// 只有经生命周期reconciler删除的VM才会解除DataVolume的owner关系, 带外删除时DataVolume已被垃圾回收
+func finalizeDisks(tx *gorm.DB, vmr *model.VirtualMachineRecord) error {
+	if vmr.Status != model.Deleting {
+		return tx.Where("virtual_machine_record_id = ?", vmr.ID).Delete(&model.VirtualMachineDisk{}).Error
+	}
+	retained := tx.Model(&model.VirtualMachineDisk{}).
+		Where("virtual_machine_record_id = ? AND type = ? AND retention = ?", vmr.ID, model.DiskTypeDataVolume, model.RetentionRetain)
+	if err := retained.Update("Status", model.DiskRetained).Error; err != nil {
+		return err
+	}
+	return tx.Where("virtual_machine_record_id = ? AND status <> ?", vmr.ID, model.DiskRetained).
+		Delete(&model.VirtualMachineDisk{}).Error
+}
+
+// liveStatus 根据VM和VMI计算VirtualMachineRecord应有的状态
+func liveStatus(vm *kubevirtv1.VirtualMachine, vmi *kubevirtv1.VirtualMachineInstance) model.VirtualMachineRecord {
+	var vmr model.VirtualMachineRecord
+	if vmi == nil {
+		vmr.Status = model.Stopped
+		if vm.Status.PrintableStatus == kubevirtv1.VirtualMachineStatusStarting ||
+			vm.Status.PrintableStatus == kubevirtv1.VirtualMachineStatusProvisioning {
+			vmr.Status = model.Starting
+		}
+		return vmr
+	}
+
+	vmr.Phase = string(vmi.Status.Phase)
+	vmr.NodeName = vmi.Status.NodeName
+	var ips []string
+	for _, iface := range vmi.Status.Interfaces {
+		if len(iface.IPs) > 0 {
+			ips = append(ips, iface.IPs...)
+		} else if iface.IP != "" {
+			ips = append(ips, iface.IP)
+		}
+	}
+	vmr.IPs = strings.Join(ips, ",")
+
+	paused := false
+	for _, cond := range vmi.Status.Conditions {
+		switch cond.Type {
+		case kubevirtv1.VirtualMachineInstanceReady:
+			vmr.Ready = cond.Status == k8sv1.ConditionTrue
+		case kubevirtv1.VirtualMachineInstancePaused:
+			paused = cond.Status == k8sv1.ConditionTrue
+		}
+	}
+
+	switch vmi.Status.Phase {
+	case kubevirtv1.Running:
+		switch {
+		case paused:
+			vmr.Status = model.Paused
+		case vmr.Ready:
+			vmr.Status = model.Ready
+		default:
+			vmr.Status = model.NotReady
+		}
+	case kubevirtv1.Succeeded, kubevirtv1.Failed:
+		vmr.Status = model.Stopped
+	default:
+		vmr.Status = model.Starting
+	}
+	return vmr
+}
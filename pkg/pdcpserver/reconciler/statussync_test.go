@@ -0,0 +1,195 @@
+package reconciler
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"slices"
+	"testing"
+
+	k8sv1 "k8s.io/api/core/v1"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+func TestLiveStatus(t *testing.T) {
+	vm := func(status kubevirtv1.VirtualMachinePrintableStatus) *kubevirtv1.VirtualMachine {
+		return &kubevirtv1.VirtualMachine{Status: kubevirtv1.VirtualMachineStatus{PrintableStatus: status}}
+	}
+	condition := func(typ kubevirtv1.VirtualMachineInstanceConditionType, status k8sv1.ConditionStatus) kubevirtv1.VirtualMachineInstanceCondition {
+		return kubevirtv1.VirtualMachineInstanceCondition{Type: typ, Status: status}
+	}
+	vmi := func(phase kubevirtv1.VirtualMachineInstancePhase, conditions ...kubevirtv1.VirtualMachineInstanceCondition) *kubevirtv1.VirtualMachineInstance {
+		return &kubevirtv1.VirtualMachineInstance{Status: kubevirtv1.VirtualMachineInstanceStatus{
+			Phase:      phase,
+			NodeName:   "node1",
+			Conditions: conditions,
+			Interfaces: []kubevirtv1.VirtualMachineInstanceNetworkInterface{
+				{Name: "default", IP: "10.0.0.1", IPs: []string{"10.0.0.1", "fd00::1"}},
+				{Name: "capture", IP: "192.168.1.10"}, // 只有IP时使用IP
+				{Name: "mirror"},
+			},
+		}}
+	}
+	ready := condition(kubevirtv1.VirtualMachineInstanceReady, k8sv1.ConditionTrue)
+	notReady := condition(kubevirtv1.VirtualMachineInstanceReady, k8sv1.ConditionFalse)
+	paused := condition(kubevirtv1.VirtualMachineInstancePaused, k8sv1.ConditionTrue)
+	unpaused := condition(kubevirtv1.VirtualMachineInstancePaused, k8sv1.ConditionFalse)
+	const ips = "10.0.0.1,fd00::1,192.168.1.10"
+
+	tests := []struct {
+		name string
+		vm   *kubevirtv1.VirtualMachine
+		vmi  *kubevirtv1.VirtualMachineInstance
+		want model.VirtualMachineRecord
+	}{
+		{name: "stopped", vm: vm(kubevirtv1.VirtualMachineStatusStopped), want: model.VirtualMachineRecord{Status: model.Stopped}},
+		{name: "starting without vmi", vm: vm(kubevirtv1.VirtualMachineStatusStarting), want: model.VirtualMachineRecord{Status: model.Starting}},
+		{name: "provisioning", vm: vm(kubevirtv1.VirtualMachineStatusProvisioning), want: model.VirtualMachineRecord{Status: model.Starting}},
+		{name: "stopping without vmi", vm: vm(kubevirtv1.VirtualMachineStatusStopping), want: model.VirtualMachineRecord{Status: model.Stopped}},
+		{name: "scheduling", vm: vm(kubevirtv1.VirtualMachineStatusStarting), vmi: vmi(kubevirtv1.Scheduling),
+			want: model.VirtualMachineRecord{Status: model.Starting, Phase: "Scheduling", NodeName: "node1", IPs: ips}},
+		{name: "running ready", vm: vm(kubevirtv1.VirtualMachineStatusRunning), vmi: vmi(kubevirtv1.Running, ready, unpaused),
+			want: model.VirtualMachineRecord{Status: model.Ready, Phase: "Running", NodeName: "node1", IPs: ips, Ready: true}},
+		{name: "running not ready", vm: vm(kubevirtv1.VirtualMachineStatusRunning), vmi: vmi(kubevirtv1.Running, notReady),
+			want: model.VirtualMachineRecord{Status: model.NotReady, Phase: "Running", NodeName: "node1", IPs: ips}},
+		{name: "running without conditions", vm: vm(kubevirtv1.VirtualMachineStatusRunning), vmi: vmi(kubevirtv1.Running),
+			want: model.VirtualMachineRecord{Status: model.NotReady, Phase: "Running", NodeName: "node1", IPs: ips}},
+		// 暂停优先于Ready
+		{name: "paused", vm: vm(kubevirtv1.VirtualMachineStatusPaused), vmi: vmi(kubevirtv1.Running, ready, paused),
+			want: model.VirtualMachineRecord{Status: model.Paused, Phase: "Running", NodeName: "node1", IPs: ips, Ready: true}},
+		{name: "succeeded", vm: vm(kubevirtv1.VirtualMachineStatusStopping), vmi: vmi(kubevirtv1.Succeeded),
+			want: model.VirtualMachineRecord{Status: model.Stopped, Phase: "Succeeded", NodeName: "node1", IPs: ips}},
+		{name: "failed", vm: vm(kubevirtv1.VirtualMachineStatusCrashLoopBackOff), vmi: vmi(kubevirtv1.Failed),
+			want: model.VirtualMachineRecord{Status: model.Stopped, Phase: "Failed", NodeName: "node1", IPs: ips}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := liveStatus(tt.vm, tt.vmi)
+			if got.Status != tt.want.Status || got.Phase != tt.want.Phase || got.NodeName != tt.want.NodeName ||
+				got.IPs != tt.want.IPs || got.Ready != tt.want.Ready {
+				t.Fatalf("liveStatus = {Status:%s Phase:%s NodeName:%s IPs:%s Ready:%v}, want {Status:%s Phase:%s NodeName:%s IPs:%s Ready:%v}",
+					got.Status, got.Phase, got.NodeName, got.IPs, got.Ready,
+					tt.want.Status, tt.want.Phase, tt.want.NodeName, tt.want.IPs, tt.want.Ready)
+			}
+		})
+	}
+}
+
+func TestFinalizeRecord(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       model.VirtualMachineStatus
+		wantDisks    []string // 保留的磁盘记录
+		wantVanished bool     // 是否记录带外删除的审计
+		wantEvent    bool
+	}{
+		// 生命周期reconciler删除时保留retain策略的DataVolume
+		{name: "deleting", status: model.Deleting, wantDisks: []string{"data"}, wantEvent: true},
+		// 带外删除时DataVolume已随VM被垃圾回收
+		{name: "deleted out of band", status: model.Running, wantVanished: true, wantEvent: true},
+		{name: "stopped out of band", status: model.Stopped, wantVanished: true, wantEvent: true},
+		// 已标记删除但软删除失败的记录再次处理
+		{name: "mark deleted", status: model.MarkDeleted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+				t.Fatalf("init sqlite: %v", err)
+			}
+			vmr := model.VirtualMachineRecord{Name: "vm1", Namespace: "default", CPU: 1, Memory: "1Gi", Status: tt.status, Ready: true}
+			database.DB.Create(&vmr)
+			disks := []model.VirtualMachineDisk{
+				{Name: "root", Type: model.DiskTypeContainerDisk},
+				{Name: "data", Type: model.DiskTypeDataVolume, Retention: model.RetentionRetain},
+				{Name: "scratch", Type: model.DiskTypeDataVolume, Retention: model.RetentionDelete},
+			}
+			for i := range disks {
+				disks[i].VirtualMachineRecordID, disks[i].VmName, disks[i].VmNamespace = vmr.ID, vmr.Name, vmr.Namespace
+				disks[i].DataVolumeName = model.DataVolumeName(vmr.Name, disks[i].Name)
+				disks[i].Status = model.DiskActive
+			}
+			database.DB.Create(&disks)
+			ifaces := model.NewVirtualMachineInterfaces(vmr.ID, model.VMCreateRequest{Name: "vm1", Namespace: "default"})
+			database.DB.Create(&ifaces)
+
+			if err := finalizeRecord(&vmr); err != nil {
+				t.Fatalf("finalize: %v", err)
+			}
+
+			var got model.VirtualMachineRecord
+			if err := database.DB.Unscoped().First(&got, vmr.ID).Error; err != nil {
+				t.Fatalf("get record: %v", err)
+			}
+			if !got.DeletedAt.Valid || got.Status != model.MarkDeleted || got.Ready || got.LastTransitionTime == nil {
+				t.Fatalf("finalized record = %+v", got)
+			}
+			var remaining []model.VirtualMachineDisk
+			database.DB.Where("virtual_machine_record_id = ?", vmr.ID).Order("id").Find(&remaining)
+			names := []string{}
+			for _, disk := range remaining {
+				if disk.Status != model.DiskRetained {
+					t.Fatalf("remaining disk %s status = %s", disk.Name, disk.Status)
+				}
+				names = append(names, disk.Name)
+			}
+			if !slices.Equal(names, tt.wantDisks) {
+				t.Fatalf("remaining disks = %v, want %v", names, tt.wantDisks)
+			}
+			var count int64
+			database.DB.Model(&model.VirtualMachineInterface{}).Where("virtual_machine_record_id = ?", vmr.ID).Count(&count)
+			if count != 0 {
+				t.Fatalf("interfaces = %d, want 0", count)
+			}
+
+			var audits []model.AuditEvent
+			database.DB.Where("action = ?", AUDIT_ACTION_VANISHED).Find(&audits)
+			if (len(audits) == 1) != tt.wantVanished || len(audits) > 1 {
+				t.Fatalf("vanished audits = %+v", audits)
+			}
+			if tt.wantVanished && (audits[0].Actor != SYNC_AUDIT_ACTOR || audits[0].TargetName != "vm1") {
+				t.Fatalf("vanished audit = %+v", audits[0])
+			}
+			var events []model.Event
+			database.DB.Where("type = ?", model.EventVMStatus).Find(&events)
+			if (len(events) == 1) != tt.wantEvent || len(events) > 1 {
+				t.Fatalf("events = %+v", events)
+			}
+			var data model.VMStatusEventData
+			if tt.wantEvent && (json.Unmarshal([]byte(events[0].Data), &data) != nil || data.From != tt.status || data.To != model.MarkDeleted) {
+				t.Fatalf("event = %+v", events[0])
+			}
+		})
+	}
+}
+
+func TestSyncInterfaceMacs(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	req := model.VMCreateRequest{Name: "vm1", Namespace: "default", Networks: []model.NetworkSpec{
+		{Name: "default"},
+		{Name: "capture", Type: model.NetworkTypeMultus, NetworkName: "capture-net", MacAddress: "02:00:00:00:00:01"},
+	}}
+	vmr := model.VirtualMachineRecord{Name: "vm1", Namespace: "default"}
+	database.DB.Create(&vmr)
+	ifaces := model.NewVirtualMachineInterfaces(vmr.ID, req)
+	database.DB.Create(&ifaces)
+
+	vmi := &kubevirtv1.VirtualMachineInstance{Status: kubevirtv1.VirtualMachineInstanceStatus{
+		Interfaces: []kubevirtv1.VirtualMachineInstanceNetworkInterface{
+			{Name: "default", MAC: "52:54:00:AB:CD:EF"},
+			{Name: "capture", MAC: "02:00:00:00:00:01"},
+			{Name: "", MAC: "52:54:00:00:00:09"}, // 客户机内部的接口
+		},
+	}}
+	if err := syncInterfaceMacs(&vmr, vmi); err != nil {
+		t.Fatalf("sync macs: %v", err)
+	}
+
+	var got []model.VirtualMachineInterface
+	database.DB.Where("virtual_machine_record_id = ?", vmr.ID).Order("id").Find(&got)
+	if len(got) != 2 || got[0].Mac != "52:54:00:ab:cd:ef" || got[1].Mac != "02:00:00:00:00:01" {
+		t.Fatalf("interfaces = %+v", got)
+	}
+}
@@ -0,0 +1,164 @@
+package router
+
+import (
+	"net/http"
+
+	"pdcplet/pkg/agent"
+	"pdcplet/pkg/metrics"
+	"pdcplet/pkg/pdcpserver/controller"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/openapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	OPENAPI_ROUTE = "/pdcpserver/api/openapi.json"
+	API_VERSION   = "v1"
+)
+
+// ruleSetQuery pdcplet拉取规则的查询参数, version与当前版本相同时返回304
+type ruleSetQuery struct {
+	NodeName string `form:"node_name" binding:"required"`
+	Version  string `form:"version"`
+}
+
+// eventStreamQuery 事件流的查询参数, 也可以使用Last-Event-ID头续传
+type eventStreamQuery struct {
+	model.EventStreamRequest
+	LastEventID uint `form:"lastEventId"`
+}
+
+// Operations pdcpserver的全部路由, 新增路由时需要同时登记, 测试会校验与gin注册的路由一致
+var Operations = []openapi.Operation{
+	// 虚拟机
+	{Method: http.MethodGet, Path: "/pdcpserver/api/workload/vm", Tag: "vm", Summary: "List virtual machines",
+		Query: model.VMListRequest{}, Response: model.VMListResponse{}},
+	{Method: http.MethodGet, Path: "/pdcpserver/api/workload/vm/:name", Tag: "vm", Summary: "Get a virtual machine",
+		Query: model.VMGetRequest{}, Response: model.VMInfo{}},
+	{Method: http.MethodPost, Path: "/pdcpserver/api/workload/vm/:name/start", Tag: "vm", Summary: "Start a virtual machine",
+		Query: model.VMOperationRequest{}, Response: model.JobAcceptedResponse{}, Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/pdcpserver/api/workload/vm/:name/stop", Tag: "vm", Summary: "Stop a virtual machine",
+		Query: model.VMOperationRequest{}, Response: model.JobAcceptedResponse{}, Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/pdcpserver/api/workload/vm/:name/restart", Tag: "vm", Summary: "Restart a virtual machine",
+		Query: model.VMOperationRequest{}, Response: model.JobAcceptedResponse{}, Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/pdcpserver/api/workload/vm/:name/pause", Tag: "vm", Summary: "Pause a virtual machine",
+		Query: model.VMOperationRequest{}, Response: model.JobAcceptedResponse{}, Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/pdcpserver/api/workload/vm/:name/unpause", Tag: "vm", Summary: "Unpause a virtual machine",
+		Query: model.VMOperationRequest{}, Response: model.JobAcceptedResponse{}, Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/pdcpserver/api/workload/vm/create", Tag: "vm", Summary: "Create a virtual machine",
+		Body: model.VMCreateRequest{}, Response: model.JobAcceptedResponse{}, Status: http.StatusAccepted},
+	{Method: http.MethodPost, Path: "/pdcpserver/api/workload/vm/delete", Tag: "vm", Summary: "Delete a virtual machine",
+		Body: model.VMDeleteRequest{}, Response: model.JobAcceptedResponse{}, Status: http.StatusAccepted},
+	{Method: http.MethodGet, Path: controller.JOB_ROUTE_PREFIX + "/:id", Tag: "vm", Summary: "Get an asynchronous job",
+		Response: model.JobInfo{}},
+
+	// 模板
+	{Method: http.MethodGet, Path: "/pdcpserver/api/templates", Tag: "templates", Summary: "List VM templates",
+		Response: model.VMTemplateListResponse{}},
+	{Method: http.MethodGet, Path: "/pdcpserver/api/templates/:name", Tag: "templates", Summary: "Get a VM template",
+		Response: model.VMTemplateInfo{}},
+	{Method: http.MethodPost, Path: "/pdcpserver/api/templates", Tag: "templates", Summary: "Create a VM template",
+		Body: model.VMTemplateRequest{}, Response: model.VMTemplateInfo{}, Status: http.StatusCreated},
+	{Method: http.MethodPut, Path: "/pdcpserver/api/templates/:name", Tag: "templates", Summary: "Update a VM template",
+		Body: model.VMTemplateRequest{}, Response: model.VMTemplateInfo{}},
+	{Method: http.MethodDelete, Path: "/pdcpserver/api/templates/:name", Tag: "templates", Summary: "Delete a VM template",
+		Status: http.StatusNoContent},
+
+	// 流量规则
+	{Method: http.MethodGet, Path: "/pdcpserver/api/rules", Tag: "rules", Summary: "List traffic rules",
+		Response: model.RuleListResponse{}},
+	{Method: http.MethodGet, Path: "/pdcpserver/api/rules/:name", Tag: "rules", Summary: "Get a traffic rule",
+		Response: model.RuleInfo{}},
+	{Method: http.MethodPost, Path: "/pdcpserver/api/rules", Tag: "rules", Summary: "Create a traffic rule",
+		Body: model.RuleRequest{}, Response: model.RuleInfo{}, Status: http.StatusCreated},
+	{Method: http.MethodPut, Path: "/pdcpserver/api/rules/:name", Tag: "rules", Summary: "Update a traffic rule",
+		Body: model.RuleRequest{}, Response: model.RuleInfo{}},
+	{Method: http.MethodDelete, Path: "/pdcpserver/api/rules/:name", Tag: "rules", Summary: "Delete a traffic rule",
+		Status: http.StatusNoContent},
+
+	// API Key
+	{Method: http.MethodGet, Path: "/pdcpserver/api/keys", Tag: "keys", Summary: "List API keys",
+		Response: model.APIKeyListResponse{}},
+	{Method: http.MethodPost, Path: "/pdcpserver/api/keys", Tag: "keys", Summary: "Create an API key",
+		Body: model.APIKeyRequest{}, Response: model.APIKeyCreateResponse{}, Status: http.StatusCreated},
+	{Method: http.MethodDelete, Path: "/pdcpserver/api/keys/:name", Tag: "keys", Summary: "Revoke an API key",
+		Status: http.StatusNoContent},
+
+	// 用户
+	{Method: http.MethodGet, Path: "/pdcpserver/api/users", Tag: "users", Summary: "List users",
+		Response: model.UserListResponse{}},
+	{Method: http.MethodGet, Path: "/pdcpserver/api/users/:name", Tag: "users", Summary: "Get a user",
+		Response: model.UserInfo{}},
+	{Method: http.MethodPost, Path: "/pdcpserver/api/users", Tag: "users", Summary: "Create a user",
+		Body: model.UserRequest{}, Response: model.UserInfo{}, Status: http.StatusCreated},
+	{Method: http.MethodPut, Path: "/pdcpserver/api/users/:name", Tag: "users", Summary: "Update a user",
+		Body: model.UserRequest{}, Response: model.UserInfo{}},
+	{Method: http.MethodDelete, Path: "/pdcpserver/api/users/:name", Tag: "users", Summary: "Delete a user",
+		Status: http.StatusNoContent},
+
+	// 审计
+	{Method: http.MethodGet, Path: "/pdcpserver/api/audit", Tag: "audit", Summary: "Query audit events",
+		Query: model.AuditQueryRequest{}, Response: model.AuditListResponse{}},
+	{Method: http.MethodGet, Path: "/pdcpserver/api/audit/export", Tag: "audit", Summary: "Export audit events as JSON lines",
+		Query: model.AuditQueryRequest{}, Response: model.AuditEventInfo{}, ContentType: "application/x-ndjson"},
+
+	// 事件与Webhook
+	{Method: http.MethodGet, Path: "/pdcpserver/api/events/stream", Tag: "events", Summary: "Stream events as Server-Sent Events",
+		Query: eventStreamQuery{}, Response: model.EventInfo{}, ContentType: "text/event-stream"},
+	{Method: http.MethodGet, Path: "/pdcpserver/api/webhooks", Tag: "webhooks", Summary: "List webhooks",
+		Response: model.WebhookListResponse{}},
+	{Method: http.MethodGet, Path: "/pdcpserver/api/webhooks/:name", Tag: "webhooks", Summary: "Get a webhook",
+		Response: model.WebhookInfo{}},
+	{Method: http.MethodGet, Path: "/pdcpserver/api/webhooks/:name/deliveries", Tag: "webhooks", Summary: "List webhook deliveries",
+		Query: model.WebhookDeliveryQuery{}, Response: model.WebhookDeliveryListResponse{}},
+	{Method: http.MethodPost, Path: "/pdcpserver/api/webhooks", Tag: "webhooks", Summary: "Create a webhook",
+		Body: model.WebhookRequest{}, Response: model.WebhookCreateResponse{}, Status: http.StatusCreated},
+	{Method: http.MethodPut, Path: "/pdcpserver/api/webhooks/:name", Tag: "webhooks", Summary: "Update a webhook",
+		Body: model.WebhookRequest{}, Response: model.WebhookInfo{}},
+	{Method: http.MethodDelete, Path: "/pdcpserver/api/webhooks/:name", Tag: "webhooks", Summary: "Delete a webhook",
+		Status: http.StatusNoContent},
+
+	// 节点与监控数据
+	{Method: http.MethodGet, Path: "/pdcpserver/api/nodes", Tag: "nodes", Summary: "List pdcplet nodes",
+		Query: model.NodeListRequest{}, Response: model.NodeListResponse{}},
+	{Method: http.MethodGet, Path: "/pdcpserver/api/metrics/traffic", Tag: "metrics", Summary: "Query VM traffic series",
+		Query: model.MetricsQueryRequest{}, Response: model.MetricsQueryResponse{}},
+	{Method: http.MethodGet, Path: "/pdcpserver/api/metrics/top", Tag: "metrics", Summary: "Top VMs by traffic",
+		Query: model.TopVMsRequest{}, Response: model.TopVMsResponse{}},
+
+	// pdcplet
+	{Method: http.MethodPost, Path: "/pdcplet" + metrics.UPLOAD_METRICS_ROUTE, Tag: "agent", Summary: "Upload metrics",
+		Body: metrics.Upload{}, Response: metrics.Ack{}, Agent: true},
+	{Method: http.MethodPost, Path: "/pdcplet" + agent.REGISTER_ROUTE, Tag: "agent", Summary: "Register a node",
+		Body: agent.Registration{}, Response: agent.Ack{}, Agent: true},
+	{Method: http.MethodPost, Path: "/pdcplet" + agent.HEARTBEAT_ROUTE, Tag: "agent", Summary: "Node heartbeat",
+		Body: agent.Heartbeat{}, Response: agent.Ack{}, Agent: true},
+	{Method: http.MethodGet, Path: "/pdcplet" + agent.RULES_ROUTE, Tag: "agent", Summary: "Fetch the effective rule set",
+		Query: ruleSetQuery{}, Response: agent.RuleSet{}, Agent: true},
+	{Method: http.MethodPost, Path: "/pdcplet" + agent.RULES_STATUS_ROUTE, Tag: "agent", Summary: "Report rule set status",
+		Body: agent.RuleSetStatus{}, Status: http.StatusNoContent, Agent: true},
+	{Method: http.MethodPost, Path: "/pdcplet" + agent.EVENTS_ROUTE, Tag: "agent", Summary: "Report node events",
+		Body: agent.NodeEvents{}, Response: agent.Ack{}, Agent: true},
+
+	{Method: http.MethodGet, Path: OPENAPI_ROUTE, Tag: "meta", Summary: "OpenAPI document of this API",
+		Response: map[string]interface{}{}},
+}
+
+// Document 由Operations生成的OpenAPI文档
+func Document() *openapi.Document {
+	return openapi.Build(openapi.Info{
+		Title:       "pdcpserver API",
+		Description: "Virtual machine, traffic rule and pdcplet node management",
+		Version:     API_VERSION,
+	}, Operations)
+}
+
+func RegisterOpenAPIRoutes(r *gin.Engine) {
+
+	doc := Document()
+
+	r.GET(OPENAPI_ROUTE, func(c *gin.Context) {
+		c.JSON(http.StatusOK, doc)
+	})
+}
@@ -1,19 +1,164 @@
 package router
 
 import (
+	"pdcplet/pkg/agent"
+	"pdcplet/pkg/pdcpserver/auth"
+	"pdcplet/pkg/pdcpserver/config"
 	"pdcplet/pkg/pdcpserver/controller"
+	"pdcplet/pkg/pdcpserver/service"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterVMRoutes(r *gin.Engine) {
+func RegisterVMRoutes(r *gin.Engine, svc service.Service, jobs service.JobService, templates service.TemplateService) {
 
-	ctl := controller.NewController()
+	ctl := controller.NewController(svc, jobs, templates)
 
 	vmGroup := r.Group("/pdcpserver/api/workload/vm")
 	{
 		vmGroup.GET("", ctl.GetVMSHandler)
+		vmGroup.GET("/:name", ctl.GetVMHandler)
+		vmGroup.POST("/:name/start", ctl.StartVMHandler)
+		vmGroup.POST("/:name/stop", ctl.StopVMHandler)
+		vmGroup.POST("/:name/restart", ctl.RestartVMHandler)
+		vmGroup.POST("/:name/pause", ctl.PauseVMHandler)
+		vmGroup.POST("/:name/unpause", ctl.UnpauseVMHandler)
 		vmGroup.POST("/create", ctl.CreateVMHandler)
 		vmGroup.POST("/delete", ctl.DeleteVMHandler)
 	}
 }
+
+func RegisterTemplateRoutes(r *gin.Engine, templates service.TemplateService) {
+
+	ctl := controller.NewTemplateController(templates)
+
+	templateGroup := r.Group("/pdcpserver/api/templates", auth.Require(auth.ActionRead))
+	{
+		templateGroup.GET("", ctl.GetTemplatesHandler)
+		templateGroup.GET("/:name", ctl.GetTemplateHandler)
+		templateGroup.POST("", auth.Require(auth.ActionAdmin), ctl.CreateTemplateHandler)
+		templateGroup.PUT("/:name", auth.Require(auth.ActionAdmin), ctl.UpdateTemplateHandler)
+		templateGroup.DELETE("/:name", auth.Require(auth.ActionAdmin), ctl.DeleteTemplateHandler)
+	}
+}
+
+func RegisterRuleRoutes(r *gin.Engine, rules service.RuleService) {
+
+	ctl := controller.NewRuleController(rules)
+
+	ruleGroup := r.Group("/pdcpserver/api/rules", auth.Require(auth.ActionRead))
+	{
+		ruleGroup.GET("", ctl.GetRulesHandler)
+		ruleGroup.GET("/:name", ctl.GetRuleHandler)
+		ruleGroup.POST("", auth.Require(auth.ActionAdmin), ctl.CreateRuleHandler)
+		ruleGroup.PUT("/:name", auth.Require(auth.ActionAdmin), ctl.UpdateRuleHandler)
+		ruleGroup.DELETE("/:name", auth.Require(auth.ActionAdmin), ctl.DeleteRuleHandler)
+	}
+}
+
+func RegisterAPIKeyRoutes(r *gin.Engine, keys service.APIKeyService) {
+
+	ctl := controller.NewAPIKeyController(keys)
+
+	keyGroup := r.Group("/pdcpserver/api/keys", auth.Require(auth.ActionAdmin))
+	{
+		keyGroup.GET("", ctl.GetAPIKeysHandler)
+		keyGroup.POST("", ctl.CreateAPIKeyHandler)
+		keyGroup.DELETE("/:name", ctl.DeleteAPIKeyHandler)
+	}
+}
+
+func RegisterUserRoutes(r *gin.Engine, users service.UserService) {
+
+	ctl := controller.NewUserController(users)
+
+	userGroup := r.Group("/pdcpserver/api/users", auth.Require(auth.ActionAdmin))
+	{
+		userGroup.GET("", ctl.GetUsersHandler)
+		userGroup.GET("/:name", ctl.GetUserHandler)
+		userGroup.POST("", ctl.CreateUserHandler)
+		userGroup.PUT("/:name", ctl.UpdateUserHandler)
+		userGroup.DELETE("/:name", ctl.DeleteUserHandler)
+	}
+}
+
+func RegisterAuditRoutes(r *gin.Engine, audits service.AuditService) {
+
+	ctl := controller.NewAuditController(audits)
+
+	auditGroup := r.Group("/pdcpserver/api/audit", auth.Require(auth.ActionAdmin))
+	{
+		auditGroup.GET("", ctl.GetAuditEventsHandler)
+		auditGroup.GET("/export", ctl.ExportAuditEventsHandler)
+	}
+}
+
+func RegisterEventRoutes(r *gin.Engine, events service.EventService) {
+
+	ctl := controller.NewEventController(events)
+
+	eventGroup := r.Group("/pdcpserver/api/events", auth.Require(auth.ActionRead))
+	{
+		eventGroup.GET("/stream", ctl.StreamEventsHandler)
+	}
+}
+
+func RegisterWebhookRoutes(r *gin.Engine, webhooks service.WebhookService) {
+
+	ctl := controller.NewWebhookController(webhooks)
+
+	webhookGroup := r.Group("/pdcpserver/api/webhooks", auth.Require(auth.ActionAdmin))
+	{
+		webhookGroup.GET("", ctl.GetWebhooksHandler)
+		webhookGroup.GET("/:name", ctl.GetWebhookHandler)
+		webhookGroup.GET("/:name/deliveries", ctl.GetWebhookDeliveriesHandler)
+		webhookGroup.POST("", ctl.CreateWebhookHandler)
+		webhookGroup.PUT("/:name", ctl.UpdateWebhookHandler)
+		webhookGroup.DELETE("/:name", ctl.DeleteWebhookHandler)
+	}
+}
+
+func RegisterJobRoutes(r *gin.Engine, jobs service.JobService) {
+
+	ctl := controller.NewJobController(jobs)
+
+	jobGroup := r.Group(controller.JOB_ROUTE_PREFIX)
+	{
+		jobGroup.GET("/:id", ctl.GetJobHandler)
+	}
+}
+
+func RegisterMetricsRoutes(r *gin.Engine, svc service.MetricsService, cfg config.MetricsConfig) {
+
+	ctl := controller.NewMetricsController(svc, cfg)
+
+	pdcpletGroup := r.Group("/pdcplet")
+	{
+		pdcpletGroup.POST("/metrics/", ctl.IngestMetricsHandler)
+	}
+
+	metricsGroup := r.Group("/pdcpserver/api/metrics")
+	{
+		metricsGroup.GET("/traffic", ctl.QueryTrafficHandler)
+		metricsGroup.GET("/top", ctl.TopVMsHandler)
+	}
+}
+
+func RegisterNodeRoutes(r *gin.Engine, nodes service.NodeService, rules service.RuleService) {
+
+	ctl := controller.NewNodeController(nodes, rules)
+
+	pdcpletGroup := r.Group("/pdcplet")
+	{
+		pdcpletGroup.POST(agent.REGISTER_ROUTE, ctl.RegisterNodeHandler)
+		pdcpletGroup.POST(agent.HEARTBEAT_ROUTE, ctl.HeartbeatHandler)
+		pdcpletGroup.GET(agent.RULES_ROUTE, ctl.GetRuleSetHandler)
+		pdcpletGroup.POST(agent.RULES_STATUS_ROUTE, ctl.ReportRuleStatusHandler)
+		pdcpletGroup.POST(agent.EVENTS_ROUTE, ctl.ReportEventsHandler)
+	}
+
+	nodeGroup := r.Group("/pdcpserver/api/nodes", auth.Require(auth.ActionRead))
+	{
+		nodeGroup.GET("", ctl.GetNodesHandler)
+	}
+}
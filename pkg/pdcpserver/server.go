@@ -1,9 +1,17 @@
 package pdcpserver
 
 import (
+	"context"
 	"log/slog"
+	"net/http"
+	"pdcplet/pkg/kubevirt"
+	"pdcplet/pkg/pdcpserver/apierror"
+	"pdcplet/pkg/pdcpserver/auth"
+	"pdcplet/pkg/pdcpserver/config"
 	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/reconciler"
 	"pdcplet/pkg/pdcpserver/router"
+	"pdcplet/pkg/pdcpserver/service"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -11,32 +19,193 @@ import (
 
 type PdcpServer interface {
 	Start() error
+	// Handler 返回注册了全部路由的http.Handler, 不启动后台任务, 用于嵌入其他服务或测试
+	Handler() http.Handler
 }
 
 type pdcpServer struct {
-	address string
-	port    uint32
-	engine  *gin.Engine
+	address         string
+	port            uint32
+	engine          *gin.Engine
+	auditService    service.AuditService
+	metricsConfig   config.MetricsConfig
+	metricsService  service.MetricsService
+	syncConfig      config.StatusSyncConfig
+	lifecycleConfig config.LifecycleConfig
+	lifecycle       reconciler.LifecycleReconciler
+	jobsConfig      config.JobsConfig
+	jobService      service.JobService
+	nodesConfig     config.NodesConfig
+	nodeService     service.NodeService
+	eventsConfig    config.EventsConfig
+	eventService    service.EventService
+	webhooksConfig  config.WebhooksConfig
+	webhookService  service.WebhookService
+	authConfig      config.AuthConfig
+	tlsConfig       config.TLSConfig
 }
 
-func New(address string, port uint32, sqlite3Path string) PdcpServer {
+// Option 基于选项模式, 配置pdcpServer的可选项
+type Option func(s *pdcpServer)
 
-	if err := database.InitSQLite(sqlite3Path); err != nil {
-		slog.Error("Failed to init sqlite3 database", "error", err, "sqlite3Path", sqlite3Path)
-		panic(err)
+// WithMetricsConfig 设置指标接收与存储的配置
+func WithMetricsConfig(cfg config.MetricsConfig) Option {
+	return func(s *pdcpServer) {
+		s.metricsConfig = cfg
+	}
+}
+
+// WithStatusSyncConfig 设置VM状态同步的配置
+func WithStatusSyncConfig(cfg config.StatusSyncConfig) Option {
+	return func(s *pdcpServer) {
+		s.syncConfig = cfg
+	}
+}
+
+// WithLifecycleConfig 设置VM创建/删除reconciler的配置
+func WithLifecycleConfig(cfg config.LifecycleConfig) Option {
+	return func(s *pdcpServer) {
+		s.lifecycleConfig = cfg
+	}
+}
+
+// WithJobsConfig 设置异步任务worker池的配置
+func WithJobsConfig(cfg config.JobsConfig) Option {
+	return func(s *pdcpServer) {
+		s.jobsConfig = cfg
+	}
+}
+
+// WithNodesConfig 设置pdcplet节点注册的配置
+func WithNodesConfig(cfg config.NodesConfig) Option {
+	return func(s *pdcpServer) {
+		s.nodesConfig = cfg
+	}
+}
+
+// WithEventsConfig 设置事件流的配置
+func WithEventsConfig(cfg config.EventsConfig) Option {
+	return func(s *pdcpServer) {
+		s.eventsConfig = cfg
+	}
+}
+
+// WithWebhooksConfig 设置Webhook投递的配置
+func WithWebhooksConfig(cfg config.WebhooksConfig) Option {
+	return func(s *pdcpServer) {
+		s.webhooksConfig = cfg
 	}
+}
 
-	r := gin.Default()
+// WithAuthConfig 设置API认证的配置
+func WithAuthConfig(cfg config.AuthConfig) Option {
+	return func(s *pdcpServer) {
+		s.authConfig = cfg
+	}
+}
 
-	router.RegisterVMRoutes(r)
+// WithTLSConfig 设置HTTPS的证书, 未启用时使用HTTP
+func WithTLSConfig(cfg config.TLSConfig) Option {
+	return func(s *pdcpServer) {
+		s.tlsConfig = cfg
+	}
+}
 
-	return &pdcpServer{
+func New(address string, port uint32, dbConfig config.DBConfig, opts ...Option) PdcpServer {
+
+	if err := database.Init(dbConfig); err != nil {
+		slog.Error("Failed to init database", "error", err, "dbType", dbConfig.TypeStr)
+		panic(err)
+	}
+
+	s := &pdcpServer{
 		address: address,
 		port:    port,
-		engine:  r,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	r := gin.New()
+	// 请求ID在审计和认证之前分配, 使所有错误响应都带有请求ID
+	r.Use(gin.Logger(), apierror.Recovery(), apierror.Middleware())
+	r.NoRoute(apierror.NoRoute)
+
+	s.auditService = service.NewAuditService()
+	// 审计记录由请求产生, 写入协程随路由一起启动, 只使用Handler时也会写入
+	go s.auditService.Run(context.Background())
+	// 审计中间件在认证之前注册, 以记录认证失败的请求
+	r.Use(auth.AuditMiddleware(s.auditService))
+
+	apiKeyService := service.NewAPIKeyService()
+	userService := service.NewUserService()
+	authMiddleware, err := auth.NewMiddleware(s.authConfig, s.metricsConfig, apiKeyService, userService)
+	if err != nil {
+		slog.Error("Failed to init authentication", "error", err)
+		panic(err)
+	}
+	r.Use(authMiddleware)
+	router.RegisterAPIKeyRoutes(r, apiKeyService)
+	router.RegisterUserRoutes(r, userService)
+	router.RegisterAuditRoutes(r, s.auditService)
+
+	var notify func()
+	if client := kubevirt.Client(); client != nil {
+		s.lifecycle = reconciler.NewLifecycleReconciler(kubevirt.NewVMClient(client), s.lifecycleConfig)
+		notify = s.lifecycle.Trigger
+	}
+	vmService := service.New(notify)
+	s.jobService = service.NewJobService(s.jobsConfig, vmService)
+	templateService := service.NewTemplateService()
+	router.RegisterVMRoutes(r, vmService, s.jobService, templateService)
+	router.RegisterTemplateRoutes(r, templateService)
+	router.RegisterJobRoutes(r, s.jobService)
+
+	s.metricsService = service.NewMetricsService(s.metricsConfig)
+	router.RegisterMetricsRoutes(r, s.metricsService, s.metricsConfig)
+
+	ruleService := service.NewRuleService()
+	router.RegisterRuleRoutes(r, ruleService)
+	s.nodeService = service.NewNodeService(s.nodesConfig)
+	router.RegisterNodeRoutes(r, s.nodeService, ruleService)
+	s.eventService = service.NewEventService(s.eventsConfig)
+	router.RegisterEventRoutes(r, s.eventService)
+	s.webhookService = service.NewWebhookService(s.webhooksConfig)
+	router.RegisterWebhookRoutes(r, s.webhookService)
+	router.RegisterOpenAPIRoutes(r)
+
+	s.engine = r
+	return s
+}
+
+func (s *pdcpServer) Handler() http.Handler {
+	return s.engine
 }
 
 func (s *pdcpServer) Start() error {
-	return s.engine.Run(s.address + ":" + strconv.FormatUint(uint64(s.port), 10))
+	go s.metricsService.RunMaintenance(context.Background())
+	go s.jobService.Run(context.Background())
+	go s.nodeService.Run(context.Background())
+	go s.eventService.Run(context.Background())
+	go s.webhookService.Run(context.Background())
+
+	if s.lifecycle != nil {
+		go s.lifecycle.Run(context.Background())
+	} else {
+		slog.Error("KubeVirt client is not available, VM creation and deletion will stay pending")
+	}
+
+	if s.syncConfig.Enabled {
+		if client := kubevirt.Client(); client != nil {
+			go reconciler.NewStatusSyncer(client, s.syncConfig.ResyncPeriod).Run(context.Background())
+		} else {
+			slog.Error("KubeVirt client is not available, VM status sync disabled")
+		}
+	}
+
+	address := s.address + ":" + strconv.FormatUint(uint64(s.port), 10)
+	if s.tlsConfig.Enabled {
+		return s.engine.RunTLS(address, s.tlsConfig.CertFile, s.tlsConfig.KeyFile)
+	}
+	return s.engine.Run(address)
 }
@@ -0,0 +1,408 @@
+package pdcpserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"pdcplet/pkg/agent"
+	"pdcplet/pkg/internal/inpplat"
+	"pdcplet/pkg/metrics"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/controller"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"pdcplet/pkg/pdcpserver/openapi"
+	"pdcplet/pkg/pdcpserver/router"
+	"pdcplet/pkg/pdcpserver/service"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestServer(t *testing.T) *pdcpServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	return New("127.0.0.1", 0, config.DBConfig{TypeStr: database.TYPE_SQLITE3,
+		Sqlite3: config.SQLiteConfig{Database: filepath.Join(t.TempDir(), "pdcpserver.db")}},
+		WithWebhooksConfig(config.WebhooksConfig{SecretKey: "test-secret-key"})).(*pdcpServer)
+}
+
+// TestOperationsMatchRoutes 路由表与gin注册的路由必须一一对应
+func TestOperationsMatchRoutes(t *testing.T) {
+	s := newTestServer(t)
+
+	registered := map[string]bool{}
+	for _, route := range s.engine.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+	documented := map[string]bool{}
+	for _, op := range router.Operations {
+		key := op.Method + " " + op.Path
+		if documented[key] {
+			t.Errorf("operation %s documented twice", key)
+		}
+		documented[key] = true
+		if !registered[key] {
+			t.Errorf("operation %s is documented but not registered", key)
+		}
+	}
+	for key := range registered {
+		if !documented[key] {
+			t.Errorf("route %s is registered but missing from router.Operations", key)
+		}
+	}
+}
+
+// collectRefs 返回文档中引用的全部schema
+func collectRefs(v interface{}, refs map[string]bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if ref, ok := value.(string); ok && key == "$ref" {
+				refs[ref] = true
+				continue
+			}
+			collectRefs(value, refs)
+		}
+	case []interface{}:
+		for _, value := range v {
+			collectRefs(value, refs)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	s := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, router.OPENAPI_ROUTE, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d, body %s", router.OPENAPI_ROUTE, w.Code, w.Body)
+	}
+
+	var doc openapi.Document
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("decode document: %v", err)
+	}
+	if doc.OpenAPI != openapi.OPENAPI_VERSION {
+		t.Fatalf("openapi = %q", doc.OpenAPI)
+	}
+	operationIDs := map[string]bool{}
+	for _, route := range s.engine.Routes() {
+		op := doc.Paths[openapi.OpenAPIPath(route.Path)][strings.ToLower(route.Method)]
+		if op == nil {
+			t.Errorf("route %s %s missing from document", route.Method, route.Path)
+			continue
+		}
+		if operationIDs[op.OperationID] {
+			t.Errorf("duplicate operationId %s", op.OperationID)
+		}
+		operationIDs[op.OperationID] = true
+	}
+
+	create := doc.Paths["/pdcpserver/api/templates"]["post"]
+	if _, ok := create.Responses["201"]; !ok || create.RequestBody == nil {
+		t.Fatalf("unexpected create template operation: %+v", create)
+	}
+	var nameParam bool
+	for _, param := range doc.Paths["/pdcpserver/api/workload/vm/{name}"]["get"].Parameters {
+		nameParam = nameParam || (param.Name == "name" && param.In == "path" && param.Required)
+	}
+	if !nameParam {
+		t.Fatalf("path parameter name missing from get vm operation")
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+		t.Fatalf("decode document: %v", err)
+	}
+	refs := map[string]bool{}
+	collectRefs(raw, refs)
+	for ref := range refs {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("unresolved reference %s", ref)
+		}
+	}
+	if len(refs) == 0 || doc.Components.Schemas["model.VMCreateRequest"] == nil {
+		t.Fatalf("request schemas missing from components")
+	}
+}
+
+// validateSchema 校验JSON值是否符合文档中的schema, 返回第一个不符合的位置
+func validateSchema(doc *openapi.Document, schema *openapi.Schema, value interface{}, path string) error {
+	if schema.Ref != "" {
+		resolved, ok := doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			return fmt.Errorf("%s: unresolved reference %s", path, schema.Ref)
+		}
+		schema = resolved
+	}
+	if value == nil {
+		if schema.Nullable || schema.Type == "" {
+			return nil
+		}
+		return fmt.Errorf("%s: null is not allowed for %s", path, schema.Type)
+	}
+
+	switch schema.Type {
+	case "":
+		return nil
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: want object, got %T", path, value)
+		}
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: required property %s missing", path, name)
+			}
+		}
+		for name, v := range obj {
+			prop, ok := schema.Properties[name]
+			if !ok {
+				prop = schema.AdditionalProperties
+			}
+			if prop == nil {
+				return fmt.Errorf("%s: undocumented property %s", path, name)
+			}
+			if err := validateSchema(doc, prop, v, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: want array, got %T", path, value)
+		}
+		for i, v := range items {
+			if err := validateSchema(doc, schema.Items, v, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: want string, got %T", path, value)
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				return fmt.Errorf("%s: invalid date-time %q", path, s)
+			}
+		}
+		if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, s) {
+			return fmt.Errorf("%s: %q not in %v", path, s, schema.Enum)
+		}
+	case "integer", "number":
+		n, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("%s: want %s, got %T", path, schema.Type, value)
+		}
+		if schema.Type == "integer" && n != math.Trunc(n) {
+			return fmt.Errorf("%s: want integer, got %v", path, n)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: want boolean, got %T", path, value)
+		}
+	default:
+		return fmt.Errorf("%s: unknown type %s", path, schema.Type)
+	}
+	return nil
+}
+
+// readSSEData 读取事件流中的第一条事件
+func readSSEData(body io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data:"); ok {
+			return []string{strings.TrimSpace(data)}, nil
+		}
+	}
+	return nil, fmt.Errorf("no event in stream: %v", scanner.Err())
+}
+
+// TestOperationsConformance 依次调用每个操作, 校验实际的响应码、Content-Type和响应体与文档一致
+func TestOperationsConformance(t *testing.T) {
+	s := newTestServer(t)
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+	doc := router.Document()
+
+	vm := model.VirtualMachineRecord{Name: "vm1", Namespace: "default", CPU: 1, Memory: "1Gi", Status: model.Stopped,
+		Spec: `{"name":"vm1","namespace":"default","cpu":1,"memory":"1Gi","image":"cirros"}`}
+	if err := database.DB.Create(&vm).Error; err != nil {
+		t.Fatalf("create vm record: %v", err)
+	}
+	service.PublishEvent(model.EventNodeOnline, "", "", "node1", nil)
+	service.PublishEvent(model.EventNodeOffline, "", "", "node1", nil)
+
+	upload, _ := json.Marshal(metrics.Upload{Envelopes: []metrics.Envelope{{NodeName: "node1", SessionId: "s1", Sequence: 1,
+		CollectedAt: time.Now(), Metrics: []inpplat.ForwardMetrics{{TaskId: 1}}}}})
+	api := "/pdcpserver/api"
+	// 按顺序执行, 后面的请求依赖前面创建的资源. {job}替换为最近一次返回的任务ID
+	cases := []struct {
+		op   string // router.Operations中的"方法 路由"
+		url  string
+		body string
+	}{
+		{op: "GET " + router.OPENAPI_ROUTE, url: router.OPENAPI_ROUTE},
+		{op: "POST " + api + "/workload/vm/create", url: api + "/workload/vm/create",
+			body: `{"name":"vm2","namespace":"default","cpu":1,"memory":"1Gi","image":"cirros"}`},
+		{op: "GET " + controller.JOB_ROUTE_PREFIX + "/:id", url: controller.JOB_ROUTE_PREFIX + "/{job}"},
+		{op: "GET " + api + "/workload/vm", url: api + "/workload/vm?namespace=default&limit=10"},
+		{op: "GET " + api + "/workload/vm/:name", url: api + "/workload/vm/vm1?namespace=default"},
+		{op: "POST " + api + "/workload/vm/:name/start", url: api + "/workload/vm/vm1/start?namespace=default"},
+		{op: "POST " + api + "/workload/vm/:name/stop", url: api + "/workload/vm/vm1/stop?namespace=default"},
+		{op: "POST " + api + "/workload/vm/:name/restart", url: api + "/workload/vm/vm1/restart?namespace=default"},
+		{op: "POST " + api + "/workload/vm/:name/pause", url: api + "/workload/vm/vm1/pause?namespace=default"},
+		{op: "POST " + api + "/workload/vm/:name/unpause", url: api + "/workload/vm/vm1/unpause?namespace=default"},
+		{op: "POST " + api + "/workload/vm/delete", url: api + "/workload/vm/delete", body: `{"name":"vm1","namespace":"default"}`},
+
+		{op: "POST " + api + "/templates", url: api + "/templates",
+			body: `{"name":"small","cpu":1,"memory":"1Gi","disks":[{"name":"root","image":"cirros"}]}`},
+		{op: "GET " + api + "/templates", url: api + "/templates"},
+		{op: "GET " + api + "/templates/:name", url: api + "/templates/small"},
+		{op: "PUT " + api + "/templates/:name", url: api + "/templates/small",
+			body: `{"name":"small","cpu":2,"memory":"1Gi","disks":[{"name":"root","image":"cirros"}]}`},
+		{op: "DELETE " + api + "/templates/:name", url: api + "/templates/small"},
+
+		{op: "POST " + api + "/rules", url: api + "/rules", body: `{"name":"http","protocol":"http"}`},
+		{op: "GET " + api + "/rules", url: api + "/rules"},
+		{op: "GET " + api + "/rules/:name", url: api + "/rules/http"},
+		{op: "PUT " + api + "/rules/:name", url: api + "/rules/http", body: `{"name":"http","protocol":"http","priority":10}`},
+
+		{op: "POST " + api + "/users", url: api + "/users", body: `{"name":"alice","role":"viewer","namespaces":["ns1"]}`},
+		{op: "GET " + api + "/users", url: api + "/users"},
+		{op: "GET " + api + "/users/:name", url: api + "/users/alice"},
+		{op: "PUT " + api + "/users/:name", url: api + "/users/alice", body: `{"name":"alice","role":"operator"}`},
+		{op: "POST " + api + "/keys", url: api + "/keys", body: `{"name":"alice"}`},
+		{op: "GET " + api + "/keys", url: api + "/keys"},
+		{op: "DELETE " + api + "/keys/:name", url: api + "/keys/alice"},
+		{op: "DELETE " + api + "/users/:name", url: api + "/users/alice"},
+
+		{op: "POST " + api + "/webhooks", url: api + "/webhooks", body: `{"name":"hook","url":"http://127.0.0.1:1"}`},
+		{op: "GET " + api + "/webhooks", url: api + "/webhooks"},
+		{op: "GET " + api + "/webhooks/:name", url: api + "/webhooks/hook"},
+		{op: "PUT " + api + "/webhooks/:name", url: api + "/webhooks/hook", body: `{"name":"hook","url":"http://127.0.0.1:2"}`},
+		{op: "GET " + api + "/webhooks/:name/deliveries", url: api + "/webhooks/hook/deliveries?status=pending"},
+		{op: "DELETE " + api + "/webhooks/:name", url: api + "/webhooks/hook"},
+
+		{op: "POST /pdcplet" + agent.REGISTER_ROUTE, url: "/pdcplet" + agent.REGISTER_ROUTE,
+			body: `{"node_name":"node1","version":"v1","session_id":"s1","modules":["vmimetrics"],"inpplat_reachable":true}`},
+		{op: "POST /pdcplet" + agent.HEARTBEAT_ROUTE, url: "/pdcplet" + agent.HEARTBEAT_ROUTE,
+			body: `{"node_name":"node1","session_id":"s1","inpplat_reachable":true}`},
+		{op: "GET /pdcplet" + agent.RULES_ROUTE, url: "/pdcplet" + agent.RULES_ROUTE + "?node_name=node1"},
+		{op: "POST /pdcplet" + agent.RULES_STATUS_ROUTE, url: "/pdcplet" + agent.RULES_STATUS_ROUTE,
+			body: `{"node_name":"node1","applied_version":"1"}`},
+		{op: "POST /pdcplet" + agent.EVENTS_ROUTE, url: "/pdcplet" + agent.EVENTS_ROUTE,
+			body: `{"node_name":"node1","session_id":"s1","events":[]}`},
+		{op: "POST /pdcplet" + metrics.UPLOAD_METRICS_ROUTE, url: "/pdcplet" + metrics.UPLOAD_METRICS_ROUTE, body: string(upload)},
+		{op: "GET " + api + "/nodes", url: api + "/nodes"},
+		{op: "GET " + api + "/metrics/traffic", url: api + "/metrics/traffic?metric=sent"},
+		{op: "GET " + api + "/metrics/top", url: api + "/metrics/top?by=bps"},
+
+		{op: "GET " + api + "/events/stream", url: api + "/events/stream?lastEventId=1"},
+		{op: "GET " + api + "/audit", url: api + "/audit"},
+		{op: "GET " + api + "/audit/export", url: api + "/audit/export"},
+		{op: "DELETE " + api + "/rules/:name", url: api + "/rules/http"},
+	}
+
+	operations := map[string]openapi.Operation{}
+	for _, op := range router.Operations {
+		operations[op.Method+" "+op.Path] = op
+	}
+	covered := map[string]bool{}
+	jobID := ""
+	for _, c := range cases {
+		op, ok := operations[c.op]
+		if !ok {
+			t.Fatalf("case %s does not match any operation", c.op)
+		}
+		covered[c.op] = true
+		t.Run(c.op, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			var body io.Reader
+			if c.body != "" {
+				body = strings.NewReader(c.body)
+			}
+			req, _ := http.NewRequestWithContext(ctx, op.Method, srv.URL+strings.ReplaceAll(c.url, "{job}", jobID), body)
+			if c.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request: %v", err)
+			}
+			defer resp.Body.Close()
+
+			status := op.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if resp.StatusCode != status {
+				data, _ := io.ReadAll(resp.Body)
+				t.Fatalf("status = %d, want %d, body %s", resp.StatusCode, status, data)
+			}
+			documented := doc.Paths[openapi.OpenAPIPath(op.Path)][strings.ToLower(op.Method)].Responses[strconv.Itoa(status)]
+			if len(documented.Content) == 0 {
+				if data, _ := io.ReadAll(resp.Body); len(data) != 0 {
+					t.Fatalf("undocumented response body %s", data)
+				}
+				return
+			}
+
+			var contentType string
+			var schema *openapi.Schema
+			for ct, media := range documented.Content {
+				contentType, schema = ct, media.Schema
+			}
+			if got, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";"); got != contentType {
+				t.Fatalf("content type = %q, want %q", got, contentType)
+			}
+			// 流式响应中的每一条记录都应符合schema
+			var payloads []string
+			switch contentType {
+			case "text/event-stream":
+				payloads, err = readSSEData(resp.Body)
+			case "application/x-ndjson":
+				data, _ := io.ReadAll(resp.Body)
+				payloads = strings.Split(strings.TrimSpace(string(data)), "\n")
+			default:
+				data, _ := io.ReadAll(resp.Body)
+				payloads = []string{string(data)}
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, payload := range payloads {
+				var value interface{}
+				if err := json.Unmarshal([]byte(payload), &value); err != nil {
+					t.Fatalf("decode response %q: %v", payload, err)
+				}
+				if err := validateSchema(doc, schema, value, "response"); err != nil {
+					t.Fatalf("response does not match schema: %v\n%s", err, payload)
+				}
+				if accepted, ok := value.(map[string]interface{}); ok && accepted["jobId"] != nil {
+					jobID = accepted["jobId"].(string)
+				}
+			}
+		})
+	}
+	for key := range operations {
+		if !covered[key] {
+			t.Errorf("operation %s has no conformance case", key)
+		}
+	}
+}
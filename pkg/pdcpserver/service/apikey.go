@@ -0,0 +1,181 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// API Key的格式为pdcp_<prefix>_<secret>
+const API_KEY_PREFIX = "pdcp_"
+
+// 距上次记录超过该时长才更新LastUsedAt, 避免每个请求都写库
+const API_KEY_TOUCH_INTERVAL = time.Minute
+
+var (
+	ErrAPIKeyNotFound    = errors.New("api key not found")
+	ErrAPIKeyExists      = errors.New("api key already exists")
+	ErrInvalidAPIKey     = errors.New("invalid api key request")
+	ErrInvalidCredential = errors.New("invalid credential")
+)
+
+// APIKeyService 管理静态API Key并校验请求携带的Key
+type APIKeyService interface {
+	CreateKey(req model.APIKeyRequest) (*model.APIKeyCreateResponse, error)
+	DeleteKey(name string) error
+	ListKeys() (*model.APIKeyListResponse, error)
+	// Authenticate 校验Key, 不存在、不匹配或已过期时返回ErrInvalidCredential
+	Authenticate(key string) (*model.APIKey, error)
+}
+
+type apiKeyService struct{}
+
+func NewAPIKeyService() APIKeyService {
+	return &apiKeyService{}
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func newAPIKeyInfo(key model.APIKey) model.APIKeyInfo {
+	return model.APIKeyInfo{
+		Name:       key.Name,
+		Kind:       key.Kind,
+		Prefix:     key.Prefix,
+		UserName:   key.UserName,
+		NodeName:   key.NodeName,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+func (s *apiKeyService) CreateKey(req model.APIKeyRequest) (*model.APIKeyCreateResponse, error) {
+	if errs := validation.IsDNS1123Label(req.Name); len(errs) > 0 {
+		return nil, fmt.Errorf("%w: invalid name %q: %s", ErrInvalidAPIKey, req.Name, strings.Join(errs, "; "))
+	}
+	switch req.Kind {
+	case "":
+		req.Kind = model.APIKeyUser
+	case model.APIKeyUser, model.APIKeyAgent:
+	default:
+		return nil, fmt.Errorf("%w: unsupported kind %q", ErrInvalidAPIKey, req.Kind)
+	}
+	if req.NodeName != "" && req.Kind != model.APIKeyAgent {
+		return nil, fmt.Errorf("%w: nodeName is only allowed for agent keys", ErrInvalidAPIKey)
+	}
+	if req.UserName != "" && req.Kind != model.APIKeyUser {
+		return nil, fmt.Errorf("%w: user is only allowed for user keys", ErrInvalidAPIKey)
+	}
+	if req.Kind == model.APIKeyUser && req.UserName == "" {
+		req.UserName = req.Name
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expiresAt must be in the future", ErrInvalidAPIKey)
+	}
+
+	random := make([]byte, 6+32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	prefix := hex.EncodeToString(random[:6])
+	plaintext := API_KEY_PREFIX + prefix + "_" + base64.RawURLEncoding.EncodeToString(random[6:])
+
+	key := model.APIKey{
+		Name:      req.Name,
+		Prefix:    prefix,
+		Hash:      hashAPIKey(plaintext),
+		Kind:      req.Kind,
+		UserName:  req.UserName,
+		NodeName:  req.NodeName,
+		ExpiresAt: req.ExpiresAt,
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.APIKey{}).Where("name = ?", req.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAPIKeyExists
+		}
+		if key.Kind == model.APIKeyUser {
+			if _, err := getUser(tx, key.UserName); err != nil {
+				return fmt.Errorf("%w: user %q: %v", ErrInvalidAPIKey, key.UserName, err)
+			}
+		}
+		return tx.Create(&key).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.APIKeyCreateResponse{APIKeyInfo: newAPIKeyInfo(key), Key: plaintext}, nil
+}
+
+func (s *apiKeyService) DeleteKey(name string) error {
+	res := database.DB.Where("name = ?", name).Delete(&model.APIKey{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (s *apiKeyService) ListKeys() (*model.APIKeyListResponse, error) {
+	var keys []model.APIKey
+	if err := database.DB.Order("name asc").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	resp := &model.APIKeyListResponse{Items: make([]model.APIKeyInfo, 0, len(keys))}
+	for _, key := range keys {
+		resp.Items = append(resp.Items, newAPIKeyInfo(key))
+	}
+	return resp, nil
+}
+
+func (s *apiKeyService) Authenticate(plaintext string) (*model.APIKey, error) {
+	rest, ok := strings.CutPrefix(plaintext, API_KEY_PREFIX)
+	if !ok {
+		return nil, ErrInvalidCredential
+	}
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, ErrInvalidCredential
+	}
+
+	var key model.APIKey
+	err := database.DB.Where("prefix = ?", prefix).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidCredential
+	} else if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPIKey(plaintext)), []byte(key.Hash)) != 1 {
+		return nil, ErrInvalidCredential
+	}
+	now := time.Now()
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, fmt.Errorf("%w: api key %s expired", ErrInvalidCredential, key.Name)
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > API_KEY_TOUCH_INTERVAL {
+		// 更新失败不影响认证结果
+		database.DB.Model(&key).Update("LastUsedAt", &now)
+	}
+	return &key, nil
+}
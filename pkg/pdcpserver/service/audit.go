@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DEFAULT_AUDIT_LIMIT = 100
+	AUDIT_EXPORT_BATCH  = 500
+	AUDIT_QUEUE_SIZE    = 1024 // 等待写入的审计记录, 队列满时Record同步写入
+	AUDIT_WRITE_BATCH   = 100
+)
+
+var ErrInvalidAuditQuery = errors.New("invalid audit query")
+
+// AuditService 写入和查询审计记录
+type AuditService interface {
+	// Record 将审计记录加入队列, 由Run异步写入, 写入失败只记录日志, 不影响调用方
+	Record(event model.AuditEvent)
+	// Run 批量写入队列中的审计记录, ctx结束时写完已入队的记录后返回
+	Run(ctx context.Context)
+	ListEvents(req model.AuditQueryRequest) (*model.AuditListResponse, error)
+	// Export 按时间顺序将符合条件的记录以JSON Lines格式写入w, 忽略Limit和Cursor
+	Export(req model.AuditQueryRequest, w io.Writer) error
+}
+
+type auditService struct {
+	queue chan model.AuditEvent
+}
+
+func NewAuditService() AuditService {
+	return &auditService{queue: make(chan model.AuditEvent, AUDIT_QUEUE_SIZE)}
+}
+
+// RecordAudit 写入一条审计记录, 供reconciler等不持有AuditService的调用方使用
+func RecordAudit(event model.AuditEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	if err := database.DB.Create(&event).Error; err != nil {
+		slog.Error("Failed to write audit event", "actor", event.Actor, "action", event.Action,
+			"namespace", event.TargetNamespace, "name", event.TargetName, "result", event.Result, "error", err)
+	}
+}
+
+func (s *auditService) Record(event model.AuditEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	select {
+	case s.queue <- event:
+	default:
+		// 写入跟不上时退回同步写入, 不丢弃审计记录
+		RecordAudit(event)
+	}
+}
+
+func (s *auditService) Run(ctx context.Context) {
+	for {
+		select {
+		case event := <-s.queue:
+			writeAuditEvents(s.batch(event))
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-s.queue:
+					writeAuditEvents(s.batch(event))
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// batch 从队列中取出最多AUDIT_WRITE_BATCH条记录, 不等待新的记录
+func (s *auditService) batch(first model.AuditEvent) []model.AuditEvent {
+	events := []model.AuditEvent{first}
+	for len(events) < AUDIT_WRITE_BATCH {
+		select {
+		case event := <-s.queue:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+	return events
+}
+
+func writeAuditEvents(events []model.AuditEvent) {
+	if err := database.DB.Create(&events).Error; err != nil {
+		slog.Error("Failed to write audit events", "count", len(events), "error", err)
+	}
+}
+
+func newAuditEventInfo(event model.AuditEvent) model.AuditEventInfo {
+	return model.AuditEventInfo{
+		ID:          event.ID,
+		Timestamp:   event.Timestamp,
+		Source:      event.Source,
+		Actor:       event.Actor,
+		AuthMethod:  event.AuthMethod,
+		Action:      event.Action,
+		Namespace:   event.TargetNamespace,
+		Name:        event.TargetName,
+		PayloadHash: event.PayloadHash,
+		Result:      event.Result,
+		StatusCode:  event.StatusCode,
+		Error:       event.Error,
+		LatencyMs:   event.LatencyMs,
+		ClientIP:    event.ClientIP,
+	}
+}
+
+// auditFilter 按查询条件过滤, 除时间范围外均为精确匹配
+func auditFilter(req model.AuditQueryRequest) *gorm.DB {
+	query := database.DB.Model(&model.AuditEvent{})
+	if req.Actor != "" {
+		query = query.Where("actor = ?", req.Actor)
+	}
+	if req.Action != "" {
+		query = query.Where("action = ?", req.Action)
+	}
+	if req.Namespace != "" {
+		query = query.Where("target_namespace = ?", req.Namespace)
+	}
+	if req.Name != "" {
+		query = query.Where("target_name = ?", req.Name)
+	}
+	if req.Result != "" {
+		query = query.Where("result = ?", req.Result)
+	}
+	if req.Source != "" {
+		query = query.Where("source = ?", req.Source)
+	}
+	if !req.From.IsZero() {
+		query = query.Where("timestamp >= ?", req.From)
+	}
+	if !req.To.IsZero() {
+		query = query.Where("timestamp < ?", req.To)
+	}
+	return query
+}
+
+func (s *auditService) ListEvents(req model.AuditQueryRequest) (*model.AuditListResponse, error) {
+	if !req.From.IsZero() && !req.To.IsZero() && !req.From.Before(req.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidAuditQuery)
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DEFAULT_AUDIT_LIMIT
+	}
+
+	query := auditFilter(req)
+	if req.Cursor != "" {
+		cursor, err := strconv.ParseUint(req.Cursor, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid cursor %q", ErrInvalidAuditQuery, req.Cursor)
+		}
+		query = query.Where("id < ?", cursor)
+	}
+
+	// 多查一条用于判断是否还有下一页
+	var events []model.AuditEvent
+	if err := query.Order("id desc").Limit(limit + 1).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	resp := &model.AuditListResponse{Items: make([]model.AuditEventInfo, 0, min(len(events), limit))}
+	if len(events) > limit {
+		events = events[:limit]
+		resp.NextCursor = strconv.FormatUint(uint64(events[limit-1].ID), 10)
+	}
+	for _, event := range events {
+		resp.Items = append(resp.Items, newAuditEventInfo(event))
+	}
+	return resp, nil
+}
+
+func (s *auditService) Export(req model.AuditQueryRequest, w io.Writer) error {
+	if !req.From.IsZero() && !req.To.IsZero() && !req.From.Before(req.To) {
+		return fmt.Errorf("%w: from must be before to", ErrInvalidAuditQuery)
+	}
+	encoder := json.NewEncoder(w)
+	var events []model.AuditEvent
+	// FindInBatches按主键顺序分批读取, 避免一次加载全部记录
+	return auditFilter(req).FindInBatches(&events, AUDIT_EXPORT_BATCH, func(tx *gorm.DB, batch int) error {
+		for _, event := range events {
+			if err := encoder.Encode(newAuditEventInfo(event)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
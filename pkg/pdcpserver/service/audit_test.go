@@ -0,0 +1,114 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"testing"
+	"time"
+)
+
+func TestAuditListAndExport(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	s := NewAuditService()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		result := model.AuditResultSuccess
+		if i%2 == 1 {
+			result = model.AuditResultDenied
+		}
+		s.Record(model.AuditEvent{
+			Timestamp:  base.Add(time.Duration(i) * time.Minute),
+			Source:     model.AuditSourceAPI,
+			Actor:      "alice",
+			Action:     "POST /pdcpserver/api/workload/vm/create",
+			TargetName: fmt.Sprintf("vm%d", i),
+			Result:     result,
+		})
+	}
+	// Run退出前写完已入队的记录
+	cancel()
+	<-done
+	RecordAudit(model.AuditEvent{Source: model.AuditSourceReconciler, Actor: "system:lifecycle-reconciler",
+		Action: "vm.create", TargetName: "vm0", Result: model.AuditResultSuccess})
+
+	page, err := s.ListEvents(model.AuditQueryRequest{Actor: "alice", Limit: 2})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(page.Items) != 2 || page.Items[0].Name != "vm4" || page.NextCursor == "" {
+		t.Fatalf("first page = %+v", page)
+	}
+	page, _ = s.ListEvents(model.AuditQueryRequest{Actor: "alice", Limit: 2, Cursor: page.NextCursor})
+	if len(page.Items) != 2 || page.Items[0].Name != "vm2" {
+		t.Fatalf("second page = %+v", page)
+	}
+
+	page, _ = s.ListEvents(model.AuditQueryRequest{Result: model.AuditResultDenied})
+	if len(page.Items) != 2 || page.NextCursor != "" {
+		t.Fatalf("denied events = %+v", page)
+	}
+	page, _ = s.ListEvents(model.AuditQueryRequest{From: base.Add(90 * time.Second), To: base.Add(210 * time.Second)})
+	if len(page.Items) != 2 || page.Items[0].Name != "vm3" || page.Items[1].Name != "vm2" {
+		t.Fatalf("events in time range = %+v", page)
+	}
+	if _, err := s.ListEvents(model.AuditQueryRequest{Cursor: "x"}); !errors.Is(err, ErrInvalidAuditQuery) {
+		t.Fatalf("invalid cursor: err = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.Export(model.AuditQueryRequest{Name: "vm0"}, &buf); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	var lines []model.AuditEventInfo
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var info model.AuditEventInfo
+		if err := json.Unmarshal(scanner.Bytes(), &info); err != nil {
+			t.Fatalf("invalid jsonl line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, info)
+	}
+	if len(lines) != 2 || lines[0].Source != model.AuditSourceAPI || lines[1].Source != model.AuditSourceReconciler {
+		t.Fatalf("exported events = %+v", lines)
+	}
+}
+
+func TestAuditRecordQueueFull(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	s := NewAuditService()
+	for i := 0; i <= AUDIT_QUEUE_SIZE; i++ {
+		s.Record(model.AuditEvent{Source: model.AuditSourceAPI, Actor: "alice", Action: "POST /rules",
+			TargetName: fmt.Sprintf("rule%d", i), Result: model.AuditResultSuccess})
+	}
+	// 队列满后的记录同步写入
+	var count int64
+	database.DB.Model(&model.AuditEvent{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("written before run = %d, want 1", count)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.Run(ctx)
+	database.DB.Model(&model.AuditEvent{}).Count(&count)
+	if count != AUDIT_QUEUE_SIZE+1 {
+		t.Fatalf("written after run = %d, want %d", count, AUDIT_QUEUE_SIZE+1)
+	}
+}
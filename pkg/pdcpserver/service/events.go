@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"slices"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DEFAULT_EVENT_RETENTION      = 24 * time.Hour
+	DEFAULT_EVENT_PURGE_INTERVAL = 10 * time.Minute
+	EVENT_SUBSCRIBER_BUFFER      = 256 // 订阅者未及时读取的事件数超过该值时断开订阅
+	EVENT_BACKLOG_BATCH          = 500
+)
+
+// EventService 发布状态变化事件并提供订阅, 事件持久化后客户端可以从断开处续传
+type EventService interface {
+	// Subscribe 订阅符合条件的事件. lastID大于0时可通过NextBacklog分批读取之后已发生的事件
+	Subscribe(req model.EventStreamRequest, lastID uint) *EventSubscription
+	// Run 周期性地清理超过保留时长的事件, 直到ctx结束
+	Run(ctx context.Context)
+}
+
+// EventSubscription 一个订阅. 订阅者读取过慢时Events被关闭, 应以最后收到的事件ID重新订阅
+type EventSubscription struct {
+	Events <-chan model.EventInfo
+
+	subscriber   *eventSubscriber
+	backlogAfter uint // 下一批Backlog从该ID之后查询
+	backlogDone  bool
+}
+
+// NextBacklog 按ID顺序返回下一批已持久化的事件, 每批最多EVENT_BACKLOG_BATCH条, 返回空时已读完.
+// 读取期间发布的事件可能同时出现在Backlog和Events中, 由调用方按ID去重
+func (s *EventSubscription) NextBacklog() ([]model.EventInfo, error) {
+	if s.backlogDone {
+		return nil, nil
+	}
+	var events []model.Event
+	err := eventFilter(s.subscriber.req).Where("id > ?", s.backlogAfter).
+		Order("id asc").Limit(EVENT_BACKLOG_BATCH).Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(events) < EVENT_BACKLOG_BATCH {
+		s.backlogDone = true
+	}
+	batch := make([]model.EventInfo, 0, len(events))
+	for _, event := range events {
+		batch = append(batch, newEventInfo(event))
+		s.backlogAfter = event.ID
+	}
+	return batch, nil
+}
+
+// Close 取消订阅
+func (s *EventSubscription) Close() {
+	eventHub.unsubscribe(s.subscriber)
+}
+
+type eventSubscriber struct {
+	req model.EventStreamRequest
+	ch  chan model.EventInfo
+}
+
+// eventBroker 将新发布的事件分发给进程内的订阅者
+type eventBroker struct {
+	// publishMu 保证事件按ID顺序分发, 订阅者据此丢弃Backlog中已有的事件
+	publishMu   sync.Mutex
+	mu          sync.Mutex
+	subscribers map[*eventSubscriber]struct{}
+}
+
+var eventHub = &eventBroker{subscribers: make(map[*eventSubscriber]struct{})}
+
+func (b *eventBroker) subscribe(req model.EventStreamRequest) *eventSubscriber {
+	sub := &eventSubscriber{req: req, ch: make(chan model.EventInfo, EVENT_SUBSCRIBER_BUFFER)}
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub
+}
+
+func (b *eventBroker) unsubscribe(sub *eventSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+func (b *eventBroker) broadcast(info model.EventInfo) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers {
+		if !eventMatches(sub.req, info) {
+			continue
+		}
+		select {
+		case sub.ch <- info:
+		default:
+			slog.Warn("Event subscriber is too slow, close subscription", "eventId", info.ID)
+			delete(b.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// PublishEvent 写入一条事件并分发给订阅者, 写入失败只记录日志, 不影响调用方
+func PublishEvent(typ model.EventType, namespace string, name string, nodeName string, data interface{}) {
+	event := model.Event{Type: typ, Namespace: namespace, Name: name, NodeName: nodeName, CreatedAt: time.Now()}
+	if data != nil {
+		b, err := json.Marshal(data)
+		if err != nil {
+			slog.Error("Failed to marshal event data", "type", typ, "error", err)
+			return
+		}
+		event.Data = string(b)
+	}
+
+	eventHub.publishMu.Lock()
+	defer eventHub.publishMu.Unlock()
+	if err := database.DB.Create(&event).Error; err != nil {
+		slog.Error("Failed to write event", "type", typ, "namespace", namespace, "name", name,
+			"nodeName", nodeName, "error", err)
+		return
+	}
+	eventHub.broadcast(newEventInfo(event))
+}
+
+// PublishVMStatus 发布VM状态变化事件, 状态未变化时忽略
+func PublishVMStatus(vmr *model.VirtualMachineRecord, to model.VirtualMachineStatus, errMsg string) {
+	if vmr.Status == to {
+		return
+	}
+	PublishEvent(model.EventVMStatus, vmr.Namespace, vmr.Name, vmr.NodeName,
+		model.VMStatusEventData{From: vmr.Status, To: to, Phase: vmr.Phase, Error: errMsg})
+}
+
+func newEventInfo(event model.Event) model.EventInfo {
+	info := model.EventInfo{
+		ID:        event.ID,
+		Type:      event.Type,
+		Namespace: event.Namespace,
+		Name:      event.Name,
+		NodeName:  event.NodeName,
+		Time:      event.CreatedAt,
+	}
+	if event.Data != "" {
+		info.Data = json.RawMessage(event.Data)
+	}
+	return info
+}
+
+// eventMatches 与eventFilter的条件一致. Namespaces不为nil时不推送没有namespace的节点事件
+func eventMatches(req model.EventStreamRequest, info model.EventInfo) bool {
+	if len(req.Types) > 0 && !slices.Contains(req.Types, info.Type) {
+		return false
+	}
+	if req.Namespace != "" && info.Namespace != req.Namespace {
+		return false
+	}
+	if req.Name != "" && info.Name != req.Name {
+		return false
+	}
+	if req.Namespaces != nil && !slices.Contains(req.Namespaces, info.Namespace) {
+		return false
+	}
+	return true
+}
+
+func eventFilter(req model.EventStreamRequest) *gorm.DB {
+	query := database.DB.Model(&model.Event{})
+	if len(req.Types) > 0 {
+		query = query.Where("type IN ?", req.Types)
+	}
+	if req.Namespace != "" {
+		query = query.Where("namespace = ?", req.Namespace)
+	}
+	if req.Name != "" {
+		query = query.Where("name = ?", req.Name)
+	}
+	if req.Namespaces != nil {
+		if len(req.Namespaces) == 0 {
+			return query.Where("1 = 0")
+		}
+		query = query.Where("namespace IN ?", req.Namespaces)
+	}
+	return query
+}
+
+type eventService struct {
+	cfg config.EventsConfig
+}
+
+func NewEventService(cfg config.EventsConfig) EventService {
+	if cfg.Retention <= 0 {
+		cfg.Retention = DEFAULT_EVENT_RETENTION
+	}
+	if cfg.PurgeInterval <= 0 {
+		cfg.PurgeInterval = DEFAULT_EVENT_PURGE_INTERVAL
+	}
+	return &eventService{cfg: cfg}
+}
+
+func (s *eventService) Subscribe(req model.EventStreamRequest, lastID uint) *EventSubscription {
+	return subscribeEvents(req, lastID)
+}
+
+// latestEventID 返回最新事件的ID, 没有事件时返回0
+func latestEventID() (uint, error) {
+	var ids []uint
+	if err := database.DB.Model(&model.Event{}).Order("id desc").Limit(1).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return ids[0], nil
+}
+
+// subscribeEvents lastID为0时只订阅新发布的事件
+func subscribeEvents(req model.EventStreamRequest, lastID uint) *EventSubscription {
+	subscription := subscribeEventsAfter(req, lastID)
+	subscription.backlogDone = lastID == 0
+	return subscription
+}
+
+// subscribeEventsAfter 订阅新发布的事件, Backlog中为ID大于lastID的事件, lastID为0时为所有保留的事件
+func subscribeEventsAfter(req model.EventStreamRequest, lastID uint) *EventSubscription {
+	// 先订阅再查询Backlog, 不会遗漏查询期间发布的事件
+	sub := eventHub.subscribe(req)
+	return &EventSubscription{Events: sub.ch, subscriber: sub, backlogAfter: lastID}
+}
+
+func (s *eventService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.purge(time.Now()); err != nil {
+			slog.Error("Failed to purge events", "error", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *eventService) purge(now time.Time) error {
+	res := database.DB.Where("created_at < ?", now.Add(-s.cfg.Retention)).Delete(&model.Event{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		slog.Debug("Purged expired events", "count", res.RowsAffected, "retention", s.cfg.Retention)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"path/filepath"
+	"pdcplet/pkg/agent"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"testing"
+	"time"
+)
+
+func receiveEvent(t *testing.T, sub *EventSubscription) model.EventInfo {
+	t.Helper()
+	select {
+	case info, ok := <-sub.Events:
+		if !ok {
+			t.Fatalf("subscription closed")
+		}
+		return info
+	case <-time.After(time.Second):
+		t.Fatalf("no event received")
+	}
+	return model.EventInfo{}
+}
+
+// readBacklog 读取订阅的所有Backlog
+func readBacklog(t *testing.T, sub *EventSubscription) []model.EventInfo {
+	t.Helper()
+	var backlog []model.EventInfo
+	for {
+		batch, err := sub.NextBacklog()
+		if err != nil {
+			t.Fatalf("read backlog: %v", err)
+		}
+		if len(batch) == 0 {
+			return backlog
+		}
+		backlog = append(backlog, batch...)
+	}
+}
+
+func TestEventSubscribeAndResume(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	s := NewEventService(config.EventsConfig{}).(*eventService)
+
+	sub := s.Subscribe(model.EventStreamRequest{Namespace: "ns1"}, 0)
+	defer sub.Close()
+	restricted := s.Subscribe(model.EventStreamRequest{Namespaces: []string{"ns2"}}, 0)
+	defer restricted.Close()
+
+	vmr := &model.VirtualMachineRecord{Name: "vm1", Namespace: "ns1", Status: model.Created}
+	PublishVMStatus(vmr, model.Created, "")
+	PublishVMStatus(vmr, model.Ready, "")
+	PublishEvent(model.EventNodeOnline, "", "", "node1", model.NodeEventData{To: model.NodeReady})
+	PublishEvent(model.EventTaskCreated, "ns2", "vm2", "node1", model.TaskEventData{TaskId: 7})
+
+	first := receiveEvent(t, sub)
+	if first.Type != model.EventVMStatus || first.Name != "vm1" || string(first.Data) != `{"from":"Created","to":"Ready"}` {
+		t.Fatalf("unexpected event: %+v, data %s", first, first.Data)
+	}
+	if info := receiveEvent(t, restricted); info.Type != model.EventTaskCreated || info.Namespace != "ns2" {
+		t.Fatalf("restricted subscriber got %+v", info)
+	}
+	select {
+	case info := <-sub.Events:
+		t.Fatalf("unexpected event for ns1: %+v", info)
+	default:
+	}
+
+	// 从第一条事件之后续传
+	if backlog := readBacklog(t, sub); len(backlog) != 0 {
+		t.Fatalf("subscription without last event id got backlog: %+v", backlog)
+	}
+	resumed := s.Subscribe(model.EventStreamRequest{}, first.ID)
+	defer resumed.Close()
+	if backlog := readBacklog(t, resumed); len(backlog) != 2 || backlog[0].Type != model.EventNodeOnline ||
+		backlog[1].Type != model.EventTaskCreated {
+		t.Fatalf("unexpected backlog: %+v", backlog)
+	}
+	resumed = s.Subscribe(model.EventStreamRequest{Namespaces: []string{}}, first.ID)
+	defer resumed.Close()
+	if backlog := readBacklog(t, resumed); len(backlog) != 0 {
+		t.Fatalf("backlog visible to principal without namespaces: %+v", backlog)
+	}
+
+	if err := s.purge(time.Now().Add(DEFAULT_EVENT_RETENTION + time.Minute)); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	resumed = s.Subscribe(model.EventStreamRequest{}, first.ID-1)
+	defer resumed.Close()
+	if backlog := readBacklog(t, resumed); len(backlog) != 0 {
+		t.Fatalf("expired events not purged: %+v", backlog)
+	}
+}
+
+// TestEventBacklogBatches Backlog按批读取, 每批不超过EVENT_BACKLOG_BATCH条
+func TestEventBacklogBatches(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	s := NewEventService(config.EventsConfig{})
+	events := make([]model.Event, EVENT_BACKLOG_BATCH+3)
+	for i := range events {
+		events[i] = model.Event{Type: model.EventTaskCreated, Namespace: "ns1", Name: "vm1", CreatedAt: time.Now()}
+	}
+	if err := database.DB.CreateInBatches(&events, 100).Error; err != nil {
+		t.Fatalf("create events: %v", err)
+	}
+
+	sub := s.Subscribe(model.EventStreamRequest{}, events[0].ID)
+	defer sub.Close()
+	var sizes []int
+	lastID := events[0].ID
+	for {
+		batch, err := sub.NextBacklog()
+		if err != nil {
+			t.Fatalf("read backlog: %v", err)
+		}
+		if len(batch) == 0 {
+			break
+		}
+		sizes = append(sizes, len(batch))
+		for _, info := range batch {
+			if info.ID <= lastID {
+				t.Fatalf("backlog out of order: %d after %d", info.ID, lastID)
+			}
+			lastID = info.ID
+		}
+	}
+	if len(sizes) != 2 || sizes[0] != EVENT_BACKLOG_BATCH || sizes[1] != 2 || lastID != events[len(events)-1].ID {
+		t.Fatalf("batch sizes = %v, last id = %d", sizes, lastID)
+	}
+}
+
+func TestNodeEvents(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	events := NewEventService(config.EventsConfig{})
+	sub := events.Subscribe(model.EventStreamRequest{}, 0)
+	defer sub.Close()
+	nodes := NewNodeService(config.NodesConfig{StaleAfter: time.Minute}).(*nodeService)
+
+	reg := agent.Registration{NodeName: "node1", SessionId: "s1", InpplatStatus: agent.InpplatStatus{InpplatReachable: true}}
+	if _, err := nodes.Register(reg); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if info := receiveEvent(t, sub); info.Type != model.EventNodeOnline || info.NodeName != "node1" {
+		t.Fatalf("unexpected event: %+v", info)
+	}
+	if err := nodes.markStale(time.Now().Add(2 * time.Minute)); err != nil {
+		t.Fatalf("mark stale: %v", err)
+	}
+	if info := receiveEvent(t, sub); info.Type != model.EventNodeOffline {
+		t.Fatalf("unexpected event: %+v", info)
+	}
+	if _, err := nodes.Heartbeat(agent.Heartbeat{NodeName: "node1", SessionId: "s1",
+		InpplatStatus: agent.InpplatStatus{InpplatReachable: true}}); err != nil {
+		t.Fatalf("heartbeat: %v", err)
+	}
+	if info := receiveEvent(t, sub); info.Type != model.EventNodeOnline ||
+		string(info.Data) != `{"from":"Stale","to":"Ready"}` {
+		t.Fatalf("unexpected event: %+v, data %s", info, info.Data)
+	}
+
+	// 节点只能上报运行在该节点上的VM的事件
+	database.DB.Create(&[]model.VirtualMachineRecord{
+		{Name: "vm1", Namespace: "ns1", CPU: 1, Memory: "1Gi", Status: model.Running, NodeName: "node1"},
+		{Name: "vm1", Namespace: "ns2", CPU: 1, Memory: "1Gi", Status: model.Running, NodeName: "node2"},
+		{Name: "vm2", Namespace: "ns1", CPU: 1, Memory: "1Gi", Status: model.Running, NodeName: "node2"},
+	})
+	report := agent.NodeEvents{NodeName: "node1", SessionId: "s1", Events: []agent.NodeEvent{
+		{Type: agent.EventTaskCreated, Namespace: "ns1", VmiName: "vm1", TaskId: 3},
+		{Type: "unknown"},
+		{Type: agent.EventTaskClosed, Namespace: "ns2", VmiName: "vm1", TaskId: 4},
+		{Type: agent.EventAlert, Namespace: "ns1", VmiName: "vm2",
+			Alert: &agent.AlertInfo{Rule: "forged", Metric: "rx_bps", State: "firing"}},
+		{Type: agent.EventTaskClosed, Namespace: "ns1", VmiName: "unknown", TaskId: 5},
+		{Type: agent.EventAlert, Namespace: "ns1", VmiName: "vm1",
+			Alert: &agent.AlertInfo{Rule: "high-rx", Metric: "rx_bps", State: "firing", Value: 200, Threshold: 100}},
+	}}
+	if _, err := nodes.ReportEvents(report); err != nil {
+		t.Fatalf("report events: %v", err)
+	}
+	if info := receiveEvent(t, sub); info.Type != model.EventTaskCreated || info.Namespace != "ns1" || info.Name != "vm1" {
+		t.Fatalf("unexpected event: %+v", info)
+	}
+	if info := receiveEvent(t, sub); info.Type != model.EventAlert || info.NodeName != "node1" {
+		t.Fatalf("unexpected event: %+v", info)
+	}
+	select {
+	case info := <-sub.Events:
+		t.Fatalf("event of VM on another node published: %+v", info)
+	default:
+	}
+
+	report.SessionId = "old"
+	if _, err := nodes.ReportEvents(report); err != ErrNodeNotRegistered {
+		t.Fatalf("report with old session: err = %v, want ErrNodeNotRegistered", err)
+	}
+}
@@ -0,0 +1,522 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"pdcplet/pkg/pdcpserver/apierror"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	DEFAULT_JOB_WORKERS       = 4
+	DEFAULT_JOB_MAX_ATTEMPTS  = 3
+	DEFAULT_JOB_RETRY_BACKOFF = 5 * time.Second
+	DEFAULT_JOB_POLL_INTERVAL = 2 * time.Second
+	DEFAULT_JOB_WAIT_TIMEOUT  = 30 * time.Minute
+	MAX_JOB_RETRY_BACKOFF     = 5 * time.Minute
+)
+
+var (
+	ErrJobNotFound    = errors.New("job not found")
+	ErrVMCreateFailed = errors.New("virtual machine creation failed")
+)
+
+// JobService 以异步任务执行VM操作, 任务状态持久化在数据库中
+type JobService interface {
+	// Submit 提交任务, owner为提交任务的用户
+	Submit(jobType model.JobType, name string, namespace string, owner string, payload interface{}) (*model.Job, error)
+	GetJob(id string) (*model.JobInfo, error)
+	Run(ctx context.Context)
+}
+
+// jobOutcome 一次任务执行的结果, waiting为true时任务在pollInterval后再次执行
+type jobOutcome struct {
+	result   interface{}
+	waiting  bool
+	progress string
+	recordID *uint
+}
+
+type jobHandler func(job *model.Job) (jobOutcome, error)
+
+// permanentJobError 不需要重试的错误
+type permanentJobError struct {
+	error
+}
+
+func (e permanentJobError) Unwrap() error {
+	return e.error
+}
+
+// jobErrorStatus 返回任务失败原因对应的HTTP状态码, 与同步接口返回相同错误时一致
+func jobErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidVMSpec):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrVMNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrVMExists), errors.Is(err, ErrVMNotOperable):
+		return http.StatusConflict
+	default:
+		return apierror.Status(err)
+	}
+}
+
+func isPermanentJobError(err error) bool {
+	var permanent permanentJobError
+	return errors.As(err, &permanent) ||
+		errors.Is(err, ErrVMNotFound) ||
+		errors.Is(err, ErrVMExists) ||
+		errors.Is(err, ErrVMNotOperable) ||
+		errors.Is(err, ErrInvalidVMSpec)
+}
+
+type jobService struct {
+	cfg      config.JobsConfig
+	vms      Service
+	handlers map[model.JobType]jobHandler
+	wake     chan struct{}
+}
+
+func NewJobService(cfg config.JobsConfig, vms Service) JobService {
+	if cfg.Workers <= 0 {
+		cfg.Workers = DEFAULT_JOB_WORKERS
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DEFAULT_JOB_MAX_ATTEMPTS
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DEFAULT_JOB_RETRY_BACKOFF
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DEFAULT_JOB_POLL_INTERVAL
+	}
+	if cfg.WaitTimeout <= 0 {
+		cfg.WaitTimeout = DEFAULT_JOB_WAIT_TIMEOUT
+	}
+
+	s := &jobService{
+		cfg:  cfg,
+		vms:  vms,
+		wake: make(chan struct{}, cfg.Workers),
+	}
+	s.handlers = map[model.JobType]jobHandler{
+		model.JobTypeCreateVM: s.runCreateVM,
+		model.JobTypeDeleteVM: s.runDeleteVM,
+	}
+	for op := range vmOperations {
+		s.handlers[model.JobTypeOf(op)] = s.runOperateVM(op)
+	}
+	return s
+}
+
+func newJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s *jobService) Submit(jobType model.JobType, name string, namespace string, owner string, payload interface{}) (*model.Job, error) {
+	if _, ok := s.handlers[jobType]; !ok {
+		return nil, fmt.Errorf("unsupported job type: %s", jobType)
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	job := &model.Job{
+		ID:          newJobID(),
+		Type:        jobType,
+		VmName:      name,
+		VmNamespace: namespace,
+		Owner:       owner,
+		Status:      model.JobQueued,
+		Payload:     string(b),
+		MaxAttempts: s.cfg.MaxAttempts,
+		NextRunAt:   time.Now(),
+		Events:      []model.JobEvent{{Attempt: 0, Status: model.JobQueued}},
+	}
+	// 检查与写入在同一事务中, 避免同时提交的同名创建任务都通过检查
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if jobType == model.JobTypeCreateVM {
+			if err := checkCreateJob(tx, b); err != nil {
+				return err
+			}
+		}
+		return tx.Create(job).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Job submitted", "jobId", job.ID, "type", jobType, "VmName", name, "Namespace", namespace, "owner", owner)
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// checkCreateJob 提交创建任务前校验请求, VM已存在或已有未完成的创建任务时返回ErrVMExists,
+// 使这些错误同步返回给调用方而不是在任务中失败
+func checkCreateJob(tx *gorm.DB, payload []byte) error {
+	var req model.VMCreateRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidVMSpec, err)
+	}
+	if err := ValidateVMCreateRequest(req); err != nil {
+		return err
+	}
+
+	var count int64
+	if err := tx.Model(&model.VirtualMachineRecord{}).
+		Where("name = ? AND namespace = ?", req.Name, req.Namespace).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		err := tx.Model(&model.Job{}).
+			Where("type = ? AND vm_name = ? AND vm_namespace = ? AND status IN ?", model.JobTypeCreateVM, req.Name, req.Namespace,
+				[]model.JobStatus{model.JobQueued, model.JobRunning, model.JobWaiting}).Count(&count).Error
+		if err != nil {
+			return err
+		}
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %s/%s", ErrVMExists, req.Namespace, req.Name)
+	}
+	return nil
+}
+
+func (s *jobService) GetJob(id string) (*model.JobInfo, error) {
+	var job model.Job
+	err := database.DB.Preload("Events", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id asc")
+	}).First(&job, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrJobNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	info := &model.JobInfo{
+		ID:          job.ID,
+		Type:        job.Type,
+		VmName:      job.VmName,
+		Namespace:   job.VmNamespace,
+		Owner:       job.Owner,
+		Status:      job.Status,
+		Progress:    job.Progress,
+		Error:       job.Error,
+		Code:        job.ErrorCode,
+		HTTPStatus:  job.ErrorStatus,
+		Attempts:    job.Attempts,
+		MaxAttempts: job.MaxAttempts,
+		CreatedAt:   job.CreatedAt,
+		StartedAt:   job.StartedAt,
+		FinishedAt:  job.FinishedAt,
+		Events:      make([]model.JobEventInfo, 0, len(job.Events)),
+	}
+	if job.Result != "" {
+		info.Result = json.RawMessage(job.Result)
+	}
+	for _, event := range job.Events {
+		info.Events = append(info.Events, model.JobEventInfo{
+			Attempt:   event.Attempt,
+			Status:    event.Status,
+			Message:   event.Message,
+			Timestamp: event.CreatedAt,
+		})
+	}
+	return info, nil
+}
+
+// Run 启动worker池, 阻塞直到ctx结束
+func (s *jobService) Run(ctx context.Context) {
+	// 上次退出时正在执行的任务重新排队
+	err := database.DB.Model(&model.Job{}).Where("status = ?", model.JobRunning).
+		Updates(map[string]interface{}{"Status": model.JobQueued, "NextRunAt": time.Now()}).Error
+	if err != nil {
+		slog.Error("Failed to requeue interrupted jobs", "errMsg", err)
+	}
+
+	slog.Info("Job workers started", "workers", s.cfg.Workers)
+	var wg sync.WaitGroup
+	for i := 0; i < s.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.worker(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *jobService) worker(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			job, prev, err := s.claim()
+			if err != nil {
+				slog.Error("Failed to claim job", "errMsg", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			s.execute(job, prev)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// claim 取出一个到期的任务并标记为Running. 同一VM的任务按提交顺序串行执行
+func (s *jobService) claim() (*model.Job, model.JobStatus, error) {
+	var job model.Job
+	var prev model.JobStatus
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var jobs []model.Job
+		err := tx.Where("status IN ? AND next_run_at <= ?", []model.JobStatus{model.JobQueued, model.JobWaiting}, time.Now()).
+			Where("NOT EXISTS (SELECT 1 FROM jobs AS j WHERE j.vm_name = jobs.vm_name AND j.vm_namespace = jobs.vm_namespace"+
+				" AND j.status IN ? AND (j.created_at < jobs.created_at OR (j.created_at = jobs.created_at AND j.id < jobs.id)))",
+				[]model.JobStatus{model.JobQueued, model.JobRunning, model.JobWaiting}).
+			Order("next_run_at asc").Limit(1).Find(&jobs).Error
+		if err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		job = jobs[0]
+
+		prev = job.Status
+		now := time.Now()
+		updates := map[string]interface{}{"Status": model.JobRunning}
+		if job.StartedAt == nil {
+			job.StartedAt = &now
+			updates["StartedAt"] = &now
+		}
+		res := tx.Model(&model.Job{}).Where("id = ? AND status = ?", job.ID, prev).Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		job.Status = model.JobRunning
+		return nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, prev, nil
+	} else if err != nil {
+		return nil, prev, err
+	}
+	return &job, prev, nil
+}
+
+func (s *jobService) execute(job *model.Job, prev model.JobStatus) {
+	attempt := job.Attempts + 1
+	outcome, err := s.handlers[job.Type](job)
+	if err == nil && outcome.waiting && time.Since(*job.StartedAt) > s.cfg.WaitTimeout {
+		err = permanentJobError{fmt.Errorf("timed out after %s: %s", s.cfg.WaitTimeout, outcome.progress)}
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{}
+	if outcome.recordID != nil {
+		updates["VirtualMachineRecordID"] = outcome.recordID
+	}
+	var event *model.JobEvent
+
+	switch {
+	case err != nil:
+		status := jobErrorStatus(err)
+		updates["Error"] = err.Error()
+		updates["ErrorCode"] = apierror.Code(status, err)
+		updates["ErrorStatus"] = status
+		if isPermanentJobError(err) || attempt >= job.MaxAttempts {
+			updates["Status"] = model.JobFailed
+			updates["Attempts"] = attempt
+			updates["FinishedAt"] = &now
+			event = &model.JobEvent{Attempt: attempt, Status: model.JobFailed, Message: err.Error()}
+			slog.Error("Job failed", "jobId", job.ID, "type", job.Type, "attempt", attempt, "errMsg", err)
+		} else {
+			updates["Status"] = model.JobQueued
+			updates["Attempts"] = attempt
+			updates["NextRunAt"] = now.Add(s.backoff(attempt))
+			event = &model.JobEvent{Attempt: attempt, Status: model.JobQueued, Message: "retrying: " + err.Error()}
+			slog.Warn("Job attempt failed, will retry", "jobId", job.ID, "type", job.Type, "attempt", attempt, "errMsg", err)
+		}
+	case outcome.waiting:
+		updates["Status"] = model.JobWaiting
+		updates["Progress"] = outcome.progress
+		updates["NextRunAt"] = now.Add(s.cfg.PollInterval)
+		if prev != model.JobWaiting || outcome.progress != job.Progress {
+			event = &model.JobEvent{Attempt: attempt, Status: model.JobWaiting, Message: outcome.progress}
+		}
+	default:
+		result, _ := json.Marshal(outcome.result)
+		updates["Status"] = model.JobSucceeded
+		updates["Progress"] = ""
+		updates["Result"] = string(result)
+		updates["Error"] = ""
+		updates["ErrorCode"] = ""
+		updates["ErrorStatus"] = 0
+		updates["FinishedAt"] = &now
+		event = &model.JobEvent{Attempt: attempt, Status: model.JobSucceeded}
+		slog.Info("Job succeeded", "jobId", job.ID, "type", job.Type, "VmName", job.VmName, "Namespace", job.VmNamespace)
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Job{}).Where("id = ? AND status = ?", job.ID, model.JobRunning).Updates(updates).Error; err != nil {
+			return err
+		}
+		if event == nil {
+			return nil
+		}
+		event.JobID = job.ID
+		return tx.Create(event).Error
+	})
+	if err != nil {
+		slog.Error("Failed to update job", "jobId", job.ID, "errMsg", err)
+	}
+}
+
+func (s *jobService) backoff(attempt int) time.Duration {
+	d := s.cfg.RetryBackoff
+	for i := 1; i < attempt && d < MAX_JOB_RETRY_BACKOFF; i++ {
+		d *= 2
+	}
+	return min(d, MAX_JOB_RETRY_BACKOFF)
+}
+
+func decodeJobPayload(job *model.Job, v interface{}) error {
+	if err := json.Unmarshal([]byte(job.Payload), v); err != nil {
+		return permanentJobError{fmt.Errorf("invalid job payload: %w", err)}
+	}
+	return nil
+}
+
+func loadJobRecord(id uint) (*model.VirtualMachineRecord, error) {
+	var vmr model.VirtualMachineRecord
+	if err := database.DB.Unscoped().First(&vmr, id).Error; err != nil {
+		return nil, err
+	}
+	return &vmr, nil
+}
+
+// recordError 还原生命周期reconciler记录的错误, 保留Kubernetes的StatusReason以便映射状态码
+func recordError(vmr *model.VirtualMachineRecord) error {
+	if vmr.LastErrorReason == "" {
+		return errors.New(vmr.LastError)
+	}
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Reason:  metav1.StatusReason(vmr.LastErrorReason),
+		Message: vmr.LastError,
+	}}
+}
+
+// runCreateVM 写入待创建的记录, 之后等待生命周期reconciler在KubeVirt中完成创建
+func (s *jobService) runCreateVM(job *model.Job) (jobOutcome, error) {
+	if job.VirtualMachineRecordID == nil {
+		var req model.VMCreateRequest
+		if err := decodeJobPayload(job, &req); err != nil {
+			return jobOutcome{}, err
+		}
+		id, err := s.vms.CreateVM(req, job.Owner, job.ID)
+		if err != nil {
+			return jobOutcome{}, err
+		}
+		return jobOutcome{waiting: true, recordID: &id, progress: "waiting for KubeVirt to create the VM"}, nil
+	}
+
+	vmr, err := loadJobRecord(*job.VirtualMachineRecordID)
+	if err != nil {
+		return jobOutcome{}, err
+	}
+	switch {
+	case vmr.DeletedAt.Valid || vmr.Status == model.Deleting || vmr.Status == model.MarkDeleted:
+		return jobOutcome{}, permanentJobError{errors.New("virtual machine was deleted before creation completed")}
+	case vmr.CreateAbandoned():
+		return jobOutcome{}, permanentJobError{fmt.Errorf("%w: %w", ErrVMCreateFailed, recordError(vmr))}
+	case vmr.Status == model.Pending:
+		return jobOutcome{waiting: true, progress: "waiting for KubeVirt to create the VM"}, nil
+	case vmr.Status == model.CreateFailed:
+		return jobOutcome{waiting: true, progress: fmt.Sprintf("creation attempt %d failed, retrying: %s", vmr.Attempts, vmr.LastError)}, nil
+	}
+	return jobOutcome{result: newVMInfo(*vmr)}, nil
+}
+
+// runDeleteVM 将记录标记为待删除, 之后等待生命周期reconciler从KubeVirt中删除
+func (s *jobService) runDeleteVM(job *model.Job) (jobOutcome, error) {
+	if job.VirtualMachineRecordID == nil {
+		var req model.VMDeleteRequest
+		if err := decodeJobPayload(job, &req); err != nil {
+			return jobOutcome{}, err
+		}
+		id, err := s.vms.DeleteVM(req)
+		if err != nil {
+			return jobOutcome{}, err
+		}
+		return jobOutcome{waiting: true, recordID: &id, progress: "waiting for KubeVirt to delete the VM"}, nil
+	}
+
+	vmr, err := loadJobRecord(*job.VirtualMachineRecordID)
+	if err != nil {
+		return jobOutcome{}, err
+	}
+	if !vmr.DeletedAt.Valid {
+		progress := "waiting for KubeVirt to delete the VM"
+		if vmr.LastError != "" {
+			progress = fmt.Sprintf("deletion attempt %d failed, retrying: %s", vmr.Attempts, vmr.LastError)
+		}
+		return jobOutcome{waiting: true, progress: progress}, nil
+	}
+	return jobOutcome{result: model.VMOperationResponse{
+		Message: "Delete VM successfully",
+		Name:    vmr.Name,
+		Status:  vmr.Status,
+	}}, nil
+}
+
+func (s *jobService) runOperateVM(op model.VMOperation) jobHandler {
+	return func(job *model.Job) (jobOutcome, error) {
+		var req model.VMOperationRequest
+		if err := decodeJobPayload(job, &req); err != nil {
+			return jobOutcome{}, err
+		}
+		req.Name = job.VmName
+
+		status, err := s.vms.OperateVM(op, req)
+		if err != nil {
+			return jobOutcome{}, err
+		}
+		return jobOutcome{result: model.VMOperationResponse{
+			Message: string(op) + " VM successfully",
+			Name:    req.Name,
+			Status:  status,
+		}}, nil
+	}
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// fakeService 创建和删除只写入记录, 不与KubeVirt交互; operateErrs中的错误依次在OperateVM时返回
+type fakeService struct {
+	Service
+	operateErrs []error
+	operated    int
+}
+
+func (f *fakeService) OperateVM(op model.VMOperation, req model.VMOperationRequest) (model.VirtualMachineStatus, error) {
+	f.operated++
+	if len(f.operateErrs) > 0 {
+		err := f.operateErrs[0]
+		f.operateErrs = f.operateErrs[1:]
+		return model.StatusNotSet, err
+	}
+	return op.TargetStatus(), nil
+}
+
+func setupJobTest(t *testing.T) (*fakeService, *jobService) {
+	t.Helper()
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	vms := &fakeService{Service: New(nil)}
+	s := NewJobService(config.JobsConfig{MaxAttempts: 3, RetryBackoff: time.Millisecond, PollInterval: time.Millisecond}, vms)
+	return vms, s.(*jobService)
+}
+
+// runJobs 执行所有到期的任务, 直到没有可执行的任务
+func runJobs(t *testing.T, s *jobService) {
+	t.Helper()
+	for i := 0; i < 10; i++ {
+		for {
+			job, prev, err := s.claim()
+			if err != nil {
+				t.Fatalf("claim: %v", err)
+			}
+			if job == nil {
+				break
+			}
+			s.execute(job, prev)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func getJob(t *testing.T, s *jobService, id string) *model.JobInfo {
+	t.Helper()
+	info, err := s.GetJob(id)
+	if err != nil {
+		t.Fatalf("get job: %v", err)
+	}
+	return info
+}
+
+func TestJobRetry(t *testing.T) {
+	vms, s := setupJobTest(t)
+	vms.operateErrs = []error{errors.New("apiserver unavailable")}
+
+	job, err := s.Submit(model.JobTypeOf(model.VMOperationStart), "vm1", "default", "", model.VMOperationRequest{Namespace: "default"})
+	if err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	runJobs(t, s)
+
+	info := getJob(t, s, job.ID)
+	if info.Status != model.JobSucceeded || info.Attempts != 1 || vms.operated != 2 {
+		t.Fatalf("status=%s attempts=%d operated=%d", info.Status, info.Attempts, vms.operated)
+	}
+	// Queued -> Queued(retrying) -> Succeeded
+	if len(info.Events) != 3 || info.Events[1].Message == "" {
+		t.Fatalf("unexpected events: %+v", info.Events)
+	}
+}
+
+func TestJobPermanentFailure(t *testing.T) {
+	vms, s := setupJobTest(t)
+	vms.operateErrs = []error{ErrVMNotFound}
+
+	job, _ := s.Submit(model.JobTypeOf(model.VMOperationStop), "vm1", "default", "", model.VMOperationRequest{Namespace: "default"})
+	runJobs(t, s)
+
+	info := getJob(t, s, job.ID)
+	if info.Status != model.JobFailed || info.Error != ErrVMNotFound.Error() || vms.operated != 1 {
+		t.Fatalf("status=%s error=%q operated=%d", info.Status, info.Error, vms.operated)
+	}
+}
+
+func TestJobCreateWaitsForReconciler(t *testing.T) {
+	vms, s := setupJobTest(t)
+
+	create, _ := s.Submit(model.JobTypeCreateVM, "vm1", "default", "", model.VMCreateRequest{Name: "vm1", Namespace: "default", Memory: "1Gi", CPU: 1, Image: "cirros"})
+	start, _ := s.Submit(model.JobTypeOf(model.VMOperationStart), "vm1", "default", "", model.VMOperationRequest{Namespace: "default"})
+	runJobs(t, s)
+
+	if info := getJob(t, s, create.ID); info.Status != model.JobWaiting {
+		t.Fatalf("create status = %s, want %s", info.Status, model.JobWaiting)
+	}
+	// 同一VM的任务串行执行
+	if info := getJob(t, s, start.ID); info.Status != model.JobQueued || vms.operated != 0 {
+		t.Fatalf("start status = %s operated = %d, want queued", info.Status, vms.operated)
+	}
+
+	// 模拟生命周期reconciler完成创建
+	database.DB.Model(&model.VirtualMachineRecord{}).Where("name = ?", "vm1").Update("Status", model.Created)
+	runJobs(t, s)
+
+	if info := getJob(t, s, create.ID); info.Status != model.JobSucceeded || info.Result == nil {
+		t.Fatalf("create status = %s result = %v", info.Status, info.Result)
+	}
+	if info := getJob(t, s, start.ID); info.Status != model.JobSucceeded {
+		t.Fatalf("start status = %s", info.Status)
+	}
+}
+
+func TestJobCreateAbandoned(t *testing.T) {
+	_, s := setupJobTest(t)
+
+	job, _ := s.Submit(model.JobTypeCreateVM, "vm1", "default", "", model.VMCreateRequest{Name: "vm1", Namespace: "default", Memory: "1Gi", CPU: 1, Image: "cirros"})
+	runJobs(t, s)
+
+	database.DB.Model(&model.VirtualMachineRecord{}).Where("name = ?", "vm1").
+		Updates(map[string]interface{}{"Status": model.CreateFailed, "LastError": "quota exceeded", "NextAttemptAt": nil})
+	runJobs(t, s)
+
+	info := getJob(t, s, job.ID)
+	if info.Status != model.JobFailed || !strings.Contains(info.Error, "quota exceeded") {
+		t.Fatalf("status=%s error=%q", info.Status, info.Error)
+	}
+}
+
+func TestJobSubmitCreateConflict(t *testing.T) {
+	_, s := setupJobTest(t)
+	req := model.VMCreateRequest{Name: "vm1", Namespace: "default", Memory: "1Gi", CPU: 1, Image: "cirros"}
+
+	if _, err := s.Submit(model.JobTypeCreateVM, "vm1", "default", "", req); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	// 已有未完成的创建任务
+	if _, err := s.Submit(model.JobTypeCreateVM, "vm1", "default", "", req); !errors.Is(err, ErrVMExists) {
+		t.Fatalf("submit duplicate job err = %v, want ErrVMExists", err)
+	}
+	runJobs(t, s)
+	// 记录已存在
+	if _, err := s.Submit(model.JobTypeCreateVM, "vm1", "default", "", req); !errors.Is(err, ErrVMExists) {
+		t.Fatalf("submit existing vm err = %v, want ErrVMExists", err)
+	}
+	if _, err := s.Submit(model.JobTypeCreateVM, "Bad_Name", "default", "", model.VMCreateRequest{Name: "Bad_Name", Namespace: "default", Memory: "1Gi", CPU: 1, Image: "cirros"}); !errors.Is(err, ErrInvalidVMSpec) {
+		t.Fatalf("submit invalid vm err = %v, want ErrInvalidVMSpec", err)
+	}
+}
+
+// 同时提交的同名创建任务只有一个成功
+func TestJobSubmitCreateConcurrent(t *testing.T) {
+	_, s := setupJobTest(t)
+	req := model.VMCreateRequest{Name: "vm1", Namespace: "default", Memory: "1Gi", CPU: 1, Image: "cirros"}
+
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := s.Submit(model.JobTypeCreateVM, "vm1", "default", "", req)
+			errs <- err
+		}()
+	}
+	submitted := 0
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err == nil {
+			submitted++
+		} else if !errors.Is(err, ErrVMExists) {
+			t.Fatalf("submit: err = %v, want ErrVMExists", err)
+		}
+	}
+	var count int64
+	database.DB.Model(&model.Job{}).Where("vm_name = ?", "vm1").Count(&count)
+	if submitted != 1 || count != 1 {
+		t.Fatalf("submitted = %d, jobs = %d, want 1", submitted, count)
+	}
+}
+
+func TestJobCreateRetryAfterCrash(t *testing.T) {
+	_, s := setupJobTest(t)
+
+	job, _ := s.Submit(model.JobTypeCreateVM, "vm1", "default", "", model.VMCreateRequest{Name: "vm1", Namespace: "default", Memory: "1Gi", CPU: 1, Image: "cirros"})
+	claimed, _, err := s.claim()
+	if err != nil || claimed == nil {
+		t.Fatalf("claim: job=%v err=%v", claimed, err)
+	}
+	// 写入记录后在保存任务结果前退出
+	if _, err := s.runCreateVM(claimed); err != nil {
+		t.Fatalf("run create: %v", err)
+	}
+	database.DB.Model(&model.Job{}).Where("id = ?", job.ID).Update("Status", model.JobQueued)
+	runJobs(t, s)
+
+	info := getJob(t, s, job.ID)
+	if info.Status != model.JobWaiting || info.Error != "" {
+		t.Fatalf("status=%s error=%q, want waiting", info.Status, info.Error)
+	}
+}
+
+func TestJobErrorCode(t *testing.T) {
+	vmResource := schema.GroupResource{Group: "kubevirt.io", Resource: "virtualmachines"}
+	tests := []struct {
+		name   string
+		err    error
+		code   model.ErrorCode
+		status int
+	}{
+		{"already exists", apierrors.NewAlreadyExists(vmResource, "vm1"), model.ErrorAlreadyExists, http.StatusConflict},
+		{"kubernetes not found", apierrors.NewNotFound(vmResource, "vm1"), model.ErrorNotFound, http.StatusNotFound},
+		{"record not found", ErrVMNotFound, model.ErrorNotFound, http.StatusNotFound},
+		{"not operable", ErrVMNotOperable, model.ErrorConflict, http.StatusConflict},
+		{"unknown", errors.New("connection refused"), model.ErrorInternal, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vms, s := setupJobTest(t)
+			vms.operateErrs = []error{tt.err, tt.err, tt.err}
+
+			job, _ := s.Submit(model.JobTypeOf(model.VMOperationStart), "vm1", "default", "", model.VMOperationRequest{Namespace: "default"})
+			runJobs(t, s)
+
+			info := getJob(t, s, job.ID)
+			if info.Status != model.JobFailed || info.Code != tt.code || info.HTTPStatus != tt.status {
+				t.Fatalf("status=%s code=%s httpStatus=%d, want Failed %s %d", info.Status, info.Code, info.HTTPStatus, tt.code, tt.status)
+			}
+		})
+	}
+}
+
+func TestJobCreateAbandonedErrorCode(t *testing.T) {
+	_, s := setupJobTest(t)
+
+	job, _ := s.Submit(model.JobTypeCreateVM, "vm1", "default", "", model.VMCreateRequest{Name: "vm1", Namespace: "default", Memory: "1Gi", CPU: 1, Image: "cirros"})
+	runJobs(t, s)
+
+	// 生命周期reconciler发现KubeVirt中已有不属于pdcpserver的同名VM
+	database.DB.Model(&model.VirtualMachineRecord{}).Where("name = ?", "vm1").Updates(map[string]interface{}{
+		"Status": model.CreateFailed, "LastError": "virtual machine default/vm1 is not managed by pdcpserver",
+		"LastErrorReason": "AlreadyExists", "NextAttemptAt": nil,
+	})
+	runJobs(t, s)
+
+	info := getJob(t, s, job.ID)
+	if info.Status != model.JobFailed || info.Code != model.ErrorAlreadyExists || info.HTTPStatus != http.StatusConflict {
+		t.Fatalf("status=%s code=%s httpStatus=%d", info.Status, info.Code, info.HTTPStatus)
+	}
+	if !strings.Contains(info.Error, "not managed by pdcpserver") {
+		t.Errorf("error = %q", info.Error)
+	}
+}
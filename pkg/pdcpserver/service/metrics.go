@@ -0,0 +1,448 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"pdcplet/pkg/metrics"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DEFAULT_ROLLUP_INTERVAL   = time.Minute
+	DEFAULT_ROLLUP_DELAY      = 10 * time.Minute // pdcplet会重发未确认的上报, 降采样需要等待迟到的数据
+	DEFAULT_RETENTION_RAW     = 24 * time.Hour
+	DEFAULT_RETENTION_MINUTE  = 7 * 24 * time.Hour
+	DEFAULT_RETENTION_HOUR    = 90 * 24 * time.Hour
+	METRICS_INSERT_BATCH_SIZE = 50  // SQLite单条语句最多999个参数, 每行约18列
+	MAX_REPORTED_GAPS         = 100 // Ack中最多返回的缺失序号数量
+)
+
+type MetricsService interface {
+	Ingest(upload metrics.Upload) (metrics.Ack, error)
+	QueryTraffic(req model.MetricsQueryRequest) (*model.MetricsQueryResponse, error)
+	TopVMs(req model.TopVMsRequest) (*model.TopVMsResponse, error)
+	RunMaintenance(ctx context.Context)
+}
+
+type metricsService struct {
+	cfg config.MetricsConfig
+}
+
+func NewMetricsService(cfg config.MetricsConfig) MetricsService {
+	if cfg.RollupInterval <= 0 {
+		cfg.RollupInterval = DEFAULT_ROLLUP_INTERVAL
+	}
+	if cfg.RollupDelay <= 0 {
+		cfg.RollupDelay = DEFAULT_ROLLUP_DELAY
+	}
+	if cfg.Retention.Raw <= 0 {
+		cfg.Retention.Raw = DEFAULT_RETENTION_RAW
+	}
+	if cfg.Retention.Minute <= 0 {
+		cfg.Retention.Minute = DEFAULT_RETENTION_MINUTE
+	}
+	if cfg.Retention.Hour <= 0 {
+		cfg.Retention.Hour = DEFAULT_RETENTION_HOUR
+	}
+	return &metricsService{cfg: cfg}
+}
+
+// Ingest 在一个事务内保存一次上报的所有Envelope, 并根据上报游标识别重复和缺失的序号
+func (s *metricsService) Ingest(upload metrics.Upload) (metrics.Ack, error) {
+	if len(upload.Envelopes) == 0 {
+		return metrics.Ack{}, fmt.Errorf("metrics upload has no envelope")
+	}
+	envelopes := append([]metrics.Envelope(nil), upload.Envelopes...)
+	sort.Slice(envelopes, func(i, j int) bool { return envelopes[i].Sequence < envelopes[j].Sequence })
+
+	ack := metrics.Ack{
+		NodeName:  envelopes[0].NodeName,
+		SessionId: envelopes[0].SessionId,
+	}
+	if ack.NodeName == "" {
+		return ack, fmt.Errorf("metrics upload has no node name")
+	}
+	for _, env := range envelopes {
+		if env.NodeName != ack.NodeName || env.SessionId != ack.SessionId {
+			return ack, fmt.Errorf("metrics upload mixes envelopes from different nodes or sessions")
+		}
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var cursor model.MetricsUploadCursor
+		err := tx.First(&cursor, "node_name = ?", ack.NodeName).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			cursor = model.MetricsUploadCursor{NodeName: ack.NodeName}
+		} else if err != nil {
+			return err
+		}
+		if cursor.SessionId != ack.SessionId {
+			// pdcplet重启后序号重新计数
+			cursor.SessionId = ack.SessionId
+			cursor.LastSequence = 0
+		}
+
+		resolver := newVmRecordResolver(tx)
+		var taskSamples []model.TaskMetricSample
+		var nicSamples []model.NicMetricSample
+		for _, env := range envelopes {
+			if env.Sequence <= cursor.LastSequence {
+				ack.Duplicates = append(ack.Duplicates, env.Sequence)
+				continue
+			}
+			for seq := cursor.LastSequence + 1; seq < env.Sequence && len(ack.Gaps) < MAX_REPORTED_GAPS; seq++ {
+				ack.Gaps = append(ack.Gaps, seq)
+			}
+			tasks, nics, err := newRawSamples(env, resolver)
+			if err != nil {
+				return err
+			}
+			taskSamples = append(taskSamples, tasks...)
+			nicSamples = append(nicSamples, nics...)
+			cursor.LastSequence = env.Sequence
+		}
+
+		if len(taskSamples) > 0 {
+			if err := tx.CreateInBatches(taskSamples, METRICS_INSERT_BATCH_SIZE).Error; err != nil {
+				return err
+			}
+		}
+		if len(nicSamples) > 0 {
+			if err := tx.CreateInBatches(nicSamples, METRICS_INSERT_BATCH_SIZE).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Save(&cursor).Error; err != nil {
+			return err
+		}
+		ack.AckedSequence = cursor.LastSequence
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to ingest metrics", "error", err, "NodeName", ack.NodeName)
+		return metrics.Ack{}, err
+	}
+	if len(ack.Duplicates) > 0 || len(ack.Gaps) > 0 {
+		slog.Warn("Irregular metrics sequences", "NodeName", ack.NodeName, "duplicates", ack.Duplicates, "gaps", ack.Gaps)
+	}
+	return ack, nil
+}
+
+func newRawSamples(env metrics.Envelope, resolver *vmRecordResolver) ([]model.TaskMetricSample, []model.NicMetricSample, error) {
+	refs := make(map[int]metrics.TaskRef, len(env.Tasks))
+	for _, ref := range env.Tasks {
+		refs[ref.TaskId] = ref
+	}
+
+	// SQLite以字符串保存时间, 统一使用UTC保证按时间比较的正确性
+	collectedAt := env.CollectedAt.UTC()
+	tasks := make([]model.TaskMetricSample, 0, len(env.Metrics))
+	var nics []model.NicMetricSample
+	for _, m := range env.Metrics {
+		ref := refs[m.TaskId]
+		vmrId, err := resolver.resolve(ref.Namespace, ref.VmiName)
+		if err != nil {
+			return nil, nil, err
+		}
+		tasks = append(tasks, model.TaskMetricSample{
+			Resolution:             model.ResolutionRaw,
+			NodeName:               env.NodeName,
+			TaskId:                 m.TaskId,
+			Timestamp:              collectedAt,
+			VmName:                 ref.VmiName,
+			VmNamespace:            ref.Namespace,
+			VirtualMachineRecordID: vmrId,
+			Samples:                1,
+			TrafficCounters:        model.TrafficCounters(m.Total),
+		})
+		for _, nic := range m.Nics {
+			nics = append(nics, model.NicMetricSample{
+				Resolution:             model.ResolutionRaw,
+				NodeName:               env.NodeName,
+				TaskId:                 m.TaskId,
+				Vid:                    nic.Vid,
+				Mac:                    nic.Mac,
+				Timestamp:              collectedAt,
+				VmName:                 ref.VmiName,
+				VmNamespace:            ref.Namespace,
+				VirtualMachineRecordID: vmrId,
+				Samples:                1,
+				TrafficCounters:        model.TrafficCounters(nic.BaseMetric),
+			})
+		}
+	}
+	return tasks, nics, nil
+}
+
+type vmRecordKey struct {
+	namespace string
+	name      string
+}
+
+// vmRecordResolver 在一次上报内缓存VM的namespace和名称到VirtualMachineRecord的映射
+type vmRecordResolver struct {
+	tx    *gorm.DB
+	cache map[vmRecordKey]*uint
+}
+
+func newVmRecordResolver(tx *gorm.DB) *vmRecordResolver {
+	return &vmRecordResolver{tx: tx, cache: make(map[vmRecordKey]*uint)}
+}
+
+// resolve 返回namespace下同名VM最近的记录, 不同namespace中的同名VM对应不同的记录
+func (r *vmRecordResolver) resolve(namespace string, vmName string) (*uint, error) {
+	if vmName == "" {
+		return nil, nil
+	}
+	key := vmRecordKey{namespace: namespace, name: vmName}
+	if id, ok := r.cache[key]; ok {
+		return id, nil
+	}
+	var vmrs []model.VirtualMachineRecord
+	err := r.tx.Select("id").Where("namespace = ? AND name = ?", namespace, vmName).
+		Order("id desc").Limit(1).Find(&vmrs).Error
+	if err != nil {
+		return nil, err
+	}
+	var id *uint
+	if len(vmrs) > 0 {
+		id = &vmrs[0].ID
+	}
+	r.cache[key] = id
+	return id, nil
+}
+
+// RunMaintenance 周期性地执行降采样和过期数据清理, 直到ctx结束
+func (s *metricsService) RunMaintenance(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.RollupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.maintain(time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *metricsService) maintain(now time.Time) {
+	minuteWatermark, err := s.rollup(model.ResolutionRaw, model.ResolutionMinute, now.Add(-s.cfg.RollupDelay))
+	if err != nil {
+		slog.Error("Failed to rollup metrics", "error", err, "resolution", model.ResolutionMinute)
+		return
+	}
+	// 小时精度只基于已经完成的分钟精度数据
+	if _, err := s.rollup(model.ResolutionMinute, model.ResolutionHour, minuteWatermark); err != nil {
+		slog.Error("Failed to rollup metrics", "error", err, "resolution", model.ResolutionHour)
+	}
+	s.purge(now)
+}
+
+// rollup 将src精度在until之前的完整时间段聚合为dst精度, 返回dst精度新的水位
+func (s *metricsService) rollup(src, dst model.MetricsResolution, until time.Time) (time.Time, error) {
+	step := dst.Duration()
+	cutoff := until.UTC().Truncate(step)
+
+	var wm model.MetricsRollupWatermark
+	err := database.DB.First(&wm, "resolution = ?", dst).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		var first []model.TaskMetricSample
+		if err := database.DB.Where("resolution = ?", src).Order("timestamp asc").Limit(1).Find(&first).Error; err != nil {
+			return time.Time{}, err
+		}
+		if len(first) == 0 {
+			return cutoff, nil
+		}
+		wm = model.MetricsRollupWatermark{Resolution: dst, Watermark: first[0].Timestamp.Truncate(step)}
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	// 每次最多处理100个dst周期, 避免单个事务过大
+	for start := wm.Watermark; start.Before(cutoff); start = wm.Watermark {
+		end := start.Add(100 * step)
+		if end.After(cutoff) {
+			end = cutoff
+		}
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := rollupTaskSamples(tx, src, dst, start, end); err != nil {
+				return err
+			}
+			if err := rollupNicSamples(tx, src, dst, start, end); err != nil {
+				return err
+			}
+			wm.Watermark = end
+			return tx.Save(&wm).Error
+		})
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return wm.Watermark, nil
+}
+
+type counterAggregator struct {
+	samples                          int
+	sent, dropped                    int64
+	avgbps, avgpps, realbps, realpps int64
+	vmName, vmNamespace              string
+	vmrId                            *uint
+}
+
+func (a *counterAggregator) add(c model.TrafficCounters, samples int, vmName, vmNamespace string, vmrId *uint) {
+	if samples <= 0 {
+		samples = 1
+	}
+	// Sent/Dropped为累计计数取最大值, 速率按采样点数加权平均
+	a.sent = max(a.sent, c.Sent)
+	a.dropped = max(a.dropped, c.Dropped)
+	a.avgbps += c.Avgbps * int64(samples)
+	a.avgpps += c.Avgpps * int64(samples)
+	a.realbps += c.Realbps * int64(samples)
+	a.realpps += c.Realpps * int64(samples)
+	a.samples += samples
+	if vmName != "" {
+		a.vmName, a.vmNamespace = vmName, vmNamespace
+	}
+	if vmrId != nil {
+		a.vmrId = vmrId
+	}
+}
+
+func (a *counterAggregator) counters() model.TrafficCounters {
+	n := int64(a.samples)
+	return model.TrafficCounters{
+		Sent:    a.sent,
+		Dropped: a.dropped,
+		Avgbps:  a.avgbps / n,
+		Avgpps:  a.avgpps / n,
+		Realbps: a.realbps / n,
+		Realpps: a.realpps / n,
+	}
+}
+
+type taskSeriesKey struct {
+	nodeName  string
+	taskId    int
+	timestamp time.Time
+}
+
+func rollupTaskSamples(tx *gorm.DB, src, dst model.MetricsResolution, start, end time.Time) error {
+	var rows []model.TaskMetricSample
+	if err := tx.Where("resolution = ? AND timestamp >= ? AND timestamp < ?", src, start.UTC(), end.UTC()).Find(&rows).Error; err != nil {
+		return err
+	}
+
+	groups := make(map[taskSeriesKey]*counterAggregator)
+	var keys []taskSeriesKey
+	for _, row := range rows {
+		key := taskSeriesKey{nodeName: row.NodeName, taskId: row.TaskId, timestamp: row.Timestamp.Truncate(dst.Duration())}
+		agg, ok := groups[key]
+		if !ok {
+			agg = &counterAggregator{}
+			groups[key] = agg
+			keys = append(keys, key)
+		}
+		agg.add(row.TrafficCounters, row.Samples, row.VmName, row.VmNamespace, row.VirtualMachineRecordID)
+	}
+
+	samples := make([]model.TaskMetricSample, 0, len(keys))
+	for _, key := range keys {
+		agg := groups[key]
+		samples = append(samples, model.TaskMetricSample{
+			Resolution:             dst,
+			NodeName:               key.nodeName,
+			TaskId:                 key.taskId,
+			Timestamp:              key.timestamp,
+			VmName:                 agg.vmName,
+			VmNamespace:            agg.vmNamespace,
+			VirtualMachineRecordID: agg.vmrId,
+			Samples:                agg.samples,
+			TrafficCounters:        agg.counters(),
+		})
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(samples, METRICS_INSERT_BATCH_SIZE).Error
+}
+
+type nicSeriesKey struct {
+	taskSeriesKey
+	vid int64
+	mac string
+}
+
+func rollupNicSamples(tx *gorm.DB, src, dst model.MetricsResolution, start, end time.Time) error {
+	var rows []model.NicMetricSample
+	if err := tx.Where("resolution = ? AND timestamp >= ? AND timestamp < ?", src, start.UTC(), end.UTC()).Find(&rows).Error; err != nil {
+		return err
+	}
+
+	groups := make(map[nicSeriesKey]*counterAggregator)
+	var keys []nicSeriesKey
+	for _, row := range rows {
+		key := nicSeriesKey{
+			taskSeriesKey: taskSeriesKey{nodeName: row.NodeName, taskId: row.TaskId, timestamp: row.Timestamp.Truncate(dst.Duration())},
+			vid:           row.Vid,
+			mac:           row.Mac,
+		}
+		agg, ok := groups[key]
+		if !ok {
+			agg = &counterAggregator{}
+			groups[key] = agg
+			keys = append(keys, key)
+		}
+		agg.add(row.TrafficCounters, row.Samples, row.VmName, row.VmNamespace, row.VirtualMachineRecordID)
+	}
+
+	samples := make([]model.NicMetricSample, 0, len(keys))
+	for _, key := range keys {
+		agg := groups[key]
+		samples = append(samples, model.NicMetricSample{
+			Resolution:             dst,
+			NodeName:               key.nodeName,
+			TaskId:                 key.taskId,
+			Vid:                    key.vid,
+			Mac:                    key.mac,
+			Timestamp:              key.timestamp,
+			VmName:                 agg.vmName,
+			VmNamespace:            agg.vmNamespace,
+			VirtualMachineRecordID: agg.vmrId,
+			Samples:                agg.samples,
+			TrafficCounters:        agg.counters(),
+		})
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(samples, METRICS_INSERT_BATCH_SIZE).Error
+}
+
+// purge 删除超过保留时长的各精度数据
+func (s *metricsService) purge(now time.Time) {
+	retentions := map[model.MetricsResolution]time.Duration{
+		model.ResolutionRaw:    s.cfg.Retention.Raw,
+		model.ResolutionMinute: s.cfg.Retention.Minute,
+		model.ResolutionHour:   s.cfg.Retention.Hour,
+	}
+	for resolution, retention := range retentions {
+		before := now.UTC().Add(-retention)
+		if err := database.DB.Where("resolution = ? AND timestamp < ?", resolution, before).Delete(&model.TaskMetricSample{}).Error; err != nil {
+			slog.Error("Failed to purge task metrics", "error", err, "resolution", resolution)
+		}
+		if err := database.DB.Where("resolution = ? AND timestamp < ?", resolution, before).Delete(&model.NicMetricSample{}).Error; err != nil {
+			slog.Error("Failed to purge nic metrics", "error", err, "resolution", resolution)
+		}
+	}
+}
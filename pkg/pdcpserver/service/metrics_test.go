@@ -0,0 +1,243 @@
+package service
+
+import (
+	"path/filepath"
+	"pdcplet/pkg/internal/inpplat"
+	"pdcplet/pkg/metrics"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"slices"
+	"testing"
+	"time"
+)
+
+func setupMetricsTest(t *testing.T) *metricsService {
+	t.Helper()
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	return NewMetricsService(config.MetricsConfig{RollupDelay: time.Minute}).(*metricsService)
+}
+
+func newTestEnvelope(session string, seq uint64, collectedAt time.Time, sent int64) metrics.Envelope {
+	return metrics.Envelope{
+		NodeName:    "node1",
+		SessionId:   session,
+		Sequence:    seq,
+		CollectedAt: collectedAt,
+		Tasks:       []metrics.TaskRef{{TaskId: 1, Namespace: "team-a", VmiName: "vm1"}},
+		Metrics: []inpplat.ForwardMetrics{{
+			TaskId: 1,
+			Total:  inpplat.BaseMetric{Sent: sent, Avgbps: sent * 10},
+			Nics:   []inpplat.NicMetric{{Vid: 100, Mac: "52:54:00:00:00:01", BaseMetric: inpplat.BaseMetric{Sent: sent}}},
+		}},
+	}
+}
+
+func TestIngestSequences(t *testing.T) {
+	s := setupMetricsTest(t)
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		session    string
+		seqs       []uint64
+		acked      uint64
+		duplicates []uint64
+		gaps       []uint64
+	}{
+		{name: "first upload", session: "s1", seqs: []uint64{2, 1}, acked: 2},
+		{name: "resend with new", session: "s1", seqs: []uint64{2, 3}, acked: 3, duplicates: []uint64{2}},
+		{name: "gap", session: "s1", seqs: []uint64{6}, acked: 6, gaps: []uint64{4, 5}},
+		{name: "restarted", session: "s2", seqs: []uint64{1}, acked: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upload metrics.Upload
+			for _, seq := range tt.seqs {
+				upload.Envelopes = append(upload.Envelopes, newTestEnvelope(tt.session, seq, now, 1))
+			}
+			ack, err := s.Ingest(upload)
+			if err != nil {
+				t.Fatalf("ingest: %v", err)
+			}
+			if ack.AckedSequence != tt.acked || !slices.Equal(ack.Duplicates, tt.duplicates) || !slices.Equal(ack.Gaps, tt.gaps) {
+				t.Fatalf("ack = %+v, want acked %d duplicates %v gaps %v", ack, tt.acked, tt.duplicates, tt.gaps)
+			}
+		})
+	}
+
+	var count int64
+	database.DB.Model(&model.TaskMetricSample{}).Count(&count)
+	if count != 5 {
+		t.Errorf("task samples = %d, want 5 without duplicates", count)
+	}
+}
+
+func TestIngestInvalid(t *testing.T) {
+	s := setupMetricsTest(t)
+	now := time.Now()
+
+	other := newTestEnvelope("s1", 2, now, 1)
+	other.NodeName = "node2"
+	noNode := newTestEnvelope("s1", 1, now, 1)
+	noNode.NodeName = ""
+
+	tests := []struct {
+		name   string
+		upload metrics.Upload
+	}{
+		{"empty", metrics.Upload{}},
+		{"no node", metrics.Upload{Envelopes: []metrics.Envelope{noNode}}},
+		{"mixed nodes", metrics.Upload{Envelopes: []metrics.Envelope{newTestEnvelope("s1", 1, now, 1), other}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Ingest(tt.upload); err == nil {
+				t.Fatalf("ingest should fail")
+			}
+		})
+	}
+}
+
+func TestIngestResolvesRecordByNamespace(t *testing.T) {
+	s := setupMetricsTest(t)
+	// 不同namespace中的同名VM, team-b的记录较新
+	teamA := model.VirtualMachineRecord{Name: "vm1", Namespace: "team-a", CPU: 1, Memory: "1Gi", Status: model.Running}
+	teamB := model.VirtualMachineRecord{Name: "vm1", Namespace: "team-b", CPU: 1, Memory: "1Gi", Status: model.Running}
+	database.DB.Create(&teamA)
+	database.DB.Create(&teamB)
+
+	unknown := newTestEnvelope("s1", 2, time.Now(), 1)
+	unknown.Tasks[0].Namespace = "team-c"
+	if _, err := s.Ingest(metrics.Upload{Envelopes: []metrics.Envelope{newTestEnvelope("s1", 1, time.Now(), 1), unknown}}); err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+
+	var tasks []model.TaskMetricSample
+	database.DB.Order("id asc").Find(&tasks)
+	if len(tasks) != 2 {
+		t.Fatalf("task samples = %d, want 2", len(tasks))
+	}
+	if tasks[0].VirtualMachineRecordID == nil || *tasks[0].VirtualMachineRecordID != teamA.ID {
+		t.Errorf("record of team-a/vm1 = %v, want %d", tasks[0].VirtualMachineRecordID, teamA.ID)
+	}
+	if tasks[1].VirtualMachineRecordID != nil {
+		t.Errorf("record of team-c/vm1 = %d, want nil", *tasks[1].VirtualMachineRecordID)
+	}
+
+	var nic model.NicMetricSample
+	database.DB.First(&nic)
+	if nic.VirtualMachineRecordID == nil || *nic.VirtualMachineRecordID != teamA.ID {
+		t.Errorf("nic record = %v, want %d", nic.VirtualMachineRecordID, teamA.ID)
+	}
+}
+
+func TestRollup(t *testing.T) {
+	s := setupMetricsTest(t)
+	base := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	// 03:00:00、03:00:30、03:01:00各一个采样
+	var upload metrics.Upload
+	for i, sent := range []int64{10, 30, 50} {
+		upload.Envelopes = append(upload.Envelopes, newTestEnvelope("s1", uint64(i+1), base.Add(time.Duration(i)*30*time.Second), sent))
+	}
+	if _, err := s.Ingest(upload); err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		resolution model.MetricsResolution
+		until      time.Time
+		watermark  time.Time
+		points     map[time.Time]model.TrafficCounters // 时间点 -> 聚合后的计数
+		samples    map[time.Time]int
+	}{
+		{
+			name:       "minute waits for complete periods",
+			resolution: model.ResolutionMinute,
+			until:      base.Add(90 * time.Second),
+			watermark:  base.Add(time.Minute),
+			points:     map[time.Time]model.TrafficCounters{base: {Sent: 30, Avgbps: 200}},
+			samples:    map[time.Time]int{base: 2},
+		},
+		{
+			name:       "minute",
+			resolution: model.ResolutionMinute,
+			until:      base.Add(2 * time.Minute),
+			watermark:  base.Add(2 * time.Minute),
+			points: map[time.Time]model.TrafficCounters{
+				base:                  {Sent: 30, Avgbps: 200},
+				base.Add(time.Minute): {Sent: 50, Avgbps: 500},
+			},
+			samples: map[time.Time]int{base: 2, base.Add(time.Minute): 1},
+		},
+		{
+			name:       "hour weighted by samples",
+			resolution: model.ResolutionHour,
+			until:      base.Add(time.Hour),
+			watermark:  base.Add(time.Hour),
+			points:     map[time.Time]model.TrafficCounters{base: {Sent: 50, Avgbps: 300}},
+			samples:    map[time.Time]int{base: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := model.ResolutionRaw
+			if tt.resolution == model.ResolutionHour {
+				src = model.ResolutionMinute
+			}
+			watermark, err := s.rollup(src, tt.resolution, tt.until)
+			if err != nil {
+				t.Fatalf("rollup: %v", err)
+			}
+			if !watermark.Equal(tt.watermark) {
+				t.Errorf("watermark = %s, want %s", watermark, tt.watermark)
+			}
+
+			var tasks []model.TaskMetricSample
+			database.DB.Where("resolution = ?", tt.resolution).Order("timestamp asc").Find(&tasks)
+			if len(tasks) != len(tt.points) {
+				t.Fatalf("%s samples = %d, want %d", tt.resolution, len(tasks), len(tt.points))
+			}
+			for _, task := range tasks {
+				want, ok := tt.points[task.Timestamp.UTC()]
+				if !ok || task.Sent != want.Sent || task.Avgbps != want.Avgbps || task.Samples != tt.samples[task.Timestamp.UTC()] {
+					t.Errorf("sample at %s = sent %d avgbps %d samples %d, want %+v samples %d", task.Timestamp, task.Sent,
+						task.Avgbps, task.Samples, want, tt.samples[task.Timestamp.UTC()])
+				}
+				if task.VmName != "vm1" || task.VmNamespace != "team-a" {
+					t.Errorf("sample lost vm: %s/%s", task.VmNamespace, task.VmName)
+				}
+			}
+
+			var nics int64
+			database.DB.Model(&model.NicMetricSample{}).Where("resolution = ?", tt.resolution).Count(&nics)
+			if int(nics) != len(tt.points) {
+				t.Errorf("%s nic samples = %d, want %d", tt.resolution, nics, len(tt.points))
+			}
+		})
+	}
+}
+
+func TestPurge(t *testing.T) {
+	s := setupMetricsTest(t)
+	now := time.Now().UTC()
+
+	samples := []model.TaskMetricSample{
+		{Resolution: model.ResolutionRaw, NodeName: "node1", TaskId: 1, Timestamp: now.Add(-2 * DEFAULT_RETENTION_RAW)},
+		{Resolution: model.ResolutionRaw, NodeName: "node1", TaskId: 1, Timestamp: now.Add(-time.Hour)},
+		{Resolution: model.ResolutionMinute, NodeName: "node1", TaskId: 1, Timestamp: now.Add(-2 * DEFAULT_RETENTION_RAW)},
+		{Resolution: model.ResolutionHour, NodeName: "node1", TaskId: 1, Timestamp: now.Add(-2 * DEFAULT_RETENTION_HOUR)},
+	}
+	database.DB.Create(&samples)
+	s.purge(now)
+
+	var left []model.TaskMetricSample
+	database.DB.Order("id asc").Find(&left)
+	if len(left) != 2 || left[0].ID != samples[1].ID || left[1].ID != samples[2].ID {
+		t.Fatalf("samples left after purge: %+v", left)
+	}
+}
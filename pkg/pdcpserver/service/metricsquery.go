@@ -0,0 +1,349 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"slices"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DEFAULT_QUERY_WINDOW = time.Hour
+	DEFAULT_QUERY_STEP   = time.Minute
+	DEFAULT_TOP_LIMIT    = 10
+	MAX_QUERY_POINTS     = 11000  // 单个series最多返回的点数
+	MAX_QUERY_SAMPLES    = 500000 // 单次查询最多读取的采样行数
+)
+
+var ErrInvalidMetricsQuery = errors.New("invalid metrics query")
+
+var counterFields = map[string]func(c model.TrafficCounters) int64{
+	"sent":    func(c model.TrafficCounters) int64 { return c.Sent },
+	"dropped": func(c model.TrafficCounters) int64 { return c.Dropped },
+	"avgbps":  func(c model.TrafficCounters) int64 { return c.Avgbps },
+	"avgpps":  func(c model.TrafficCounters) int64 { return c.Avgpps },
+	"realbps": func(c model.TrafficCounters) int64 { return c.Realbps },
+	"realpps": func(c model.TrafficCounters) int64 { return c.Realpps },
+}
+
+// chooseResolution 选择不比step更粗的最粗精度
+func chooseResolution(step time.Duration) model.MetricsResolution {
+	switch {
+	case step >= time.Hour:
+		return model.ResolutionHour
+	case step >= time.Minute:
+		return model.ResolutionMinute
+	default:
+		return model.ResolutionRaw
+	}
+}
+
+func normalizeTimeRange(from, to time.Time) (time.Time, time.Time, error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-DEFAULT_QUERY_WINDOW)
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("%w: from must be before to", ErrInvalidMetricsQuery)
+	}
+	return from.UTC(), to.UTC(), nil
+}
+
+type querySample struct {
+	labels    model.MetricsSeriesLabels
+	timestamp time.Time
+	value     int64
+}
+
+func (s *metricsService) QueryTraffic(req model.MetricsQueryRequest) (*model.MetricsQueryResponse, error) {
+	from, to, err := normalizeTimeRange(req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+
+	step := DEFAULT_QUERY_STEP
+	if req.Step != "" {
+		if step, err = time.ParseDuration(req.Step); err != nil || step <= 0 {
+			return nil, fmt.Errorf("%w: step %q is not a positive duration", ErrInvalidMetricsQuery, req.Step)
+		}
+	}
+	if to.Sub(from)/step > MAX_QUERY_POINTS {
+		return nil, fmt.Errorf("%w: too many points, increase step or narrow the time range", ErrInvalidMetricsQuery)
+	}
+
+	level := req.Level
+	if level == "" {
+		level = model.MetricsLevelTask
+		if req.Mac != "" || req.Vid != nil {
+			level = model.MetricsLevelNic
+		}
+	}
+	aggregation := req.Aggregation
+	if aggregation == "" {
+		aggregation = model.AggregationAvg
+	}
+	resolution := model.MetricsResolution(req.Resolution)
+	if resolution == "" {
+		resolution = chooseResolution(step)
+	}
+	field := counterFields[req.Metric]
+
+	samples, err := s.loadSamples(req, level, resolution, from, to, field)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.MetricsQueryResponse{
+		Metric:      req.Metric,
+		Level:       level,
+		Aggregation: aggregation,
+		Resolution:  resolution,
+		Step:        step.String(),
+		From:        from,
+		To:          to,
+		Series:      buildSeries(samples, from.Truncate(step), step, aggregation), // 点的时间戳按step对齐
+	}, nil
+}
+
+func (s *metricsService) loadSamples(req model.MetricsQueryRequest, level string, resolution model.MetricsResolution,
+	from, to time.Time, field func(c model.TrafficCounters) int64) ([]querySample, error) {
+
+	filter := func(db *gorm.DB) *gorm.DB {
+		db = db.Where("resolution = ? AND timestamp >= ? AND timestamp < ?", resolution, from, to)
+		if req.VmName != "" {
+			db = db.Where("vm_name = ?", req.VmName)
+		}
+		if req.Namespace != "" {
+			db = db.Where("vm_namespace = ?", req.Namespace)
+		}
+		if req.NodeName != "" {
+			db = db.Where("node_name = ?", req.NodeName)
+		}
+		return db.Order("timestamp asc").Limit(MAX_QUERY_SAMPLES + 1)
+	}
+
+	var samples []querySample
+	if level == model.MetricsLevelNic {
+		db := database.DB.Scopes(filter)
+		if req.Mac != "" {
+			db = db.Where("mac = ?", req.Mac)
+		}
+		if req.Vid != nil {
+			db = db.Where("vid = ?", *req.Vid)
+		}
+		var rows []model.NicMetricSample
+		if err := db.Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			vid := row.Vid
+			samples = append(samples, querySample{
+				labels: model.MetricsSeriesLabels{
+					NodeName: row.NodeName, TaskId: row.TaskId, VmName: row.VmName, Namespace: row.VmNamespace,
+					Vid: &vid, Mac: row.Mac,
+				},
+				timestamp: row.Timestamp,
+				value:     field(row.TrafficCounters),
+			})
+		}
+	} else {
+		var rows []model.TaskMetricSample
+		if err := database.DB.Scopes(filter).Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			samples = append(samples, querySample{
+				labels: model.MetricsSeriesLabels{
+					NodeName: row.NodeName, TaskId: row.TaskId, VmName: row.VmName, Namespace: row.VmNamespace,
+				},
+				timestamp: row.Timestamp,
+				value:     field(row.TrafficCounters),
+			})
+		}
+	}
+
+	if len(samples) > MAX_QUERY_SAMPLES {
+		return nil, fmt.Errorf("%w: too many samples, use a coarser resolution or narrow the time range", ErrInvalidMetricsQuery)
+	}
+	return samples, nil
+}
+
+type seriesKey struct {
+	nodeName string
+	taskId   int
+	vid      int64
+	mac      string
+}
+
+type bucketAccumulator struct {
+	sum   float64
+	max   float64
+	last  float64
+	count int
+}
+
+// buildSeries 按series分组, 并在每个step内聚合采样点
+func buildSeries(samples []querySample, from time.Time, step time.Duration, aggregation string) []model.MetricsSeries {
+	type seriesState struct {
+		labels  model.MetricsSeriesLabels
+		buckets map[int64]*bucketAccumulator
+	}
+	states := make(map[seriesKey]*seriesState)
+	var keys []seriesKey
+
+	for _, sample := range samples {
+		key := seriesKey{nodeName: sample.labels.NodeName, taskId: sample.labels.TaskId, mac: sample.labels.Mac, vid: -1}
+		if sample.labels.Vid != nil {
+			key.vid = *sample.labels.Vid
+		}
+		state, ok := states[key]
+		if !ok {
+			state = &seriesState{labels: sample.labels, buckets: make(map[int64]*bucketAccumulator)}
+			states[key] = state
+			keys = append(keys, key)
+		}
+		if sample.labels.VmName != "" {
+			state.labels.VmName, state.labels.Namespace = sample.labels.VmName, sample.labels.Namespace
+		}
+
+		idx := int64(sample.timestamp.Sub(from) / step)
+		acc, ok := state.buckets[idx]
+		if !ok {
+			acc = &bucketAccumulator{max: float64(sample.value)}
+			state.buckets[idx] = acc
+		}
+		v := float64(sample.value)
+		acc.sum += v
+		acc.max = max(acc.max, v)
+		acc.last = v // samples按时间升序
+		acc.count++
+	}
+
+	series := make([]model.MetricsSeries, 0, len(keys))
+	for _, key := range keys {
+		state := states[key]
+		idxs := make([]int64, 0, len(state.buckets))
+		for idx := range state.buckets {
+			idxs = append(idxs, idx)
+		}
+		sort.Slice(idxs, func(i, j int) bool { return idxs[i] < idxs[j] })
+
+		points := make([]model.MetricsPoint, 0, len(idxs))
+		for i, idx := range idxs {
+			acc := state.buckets[idx]
+			point := model.MetricsPoint{Timestamp: from.Add(time.Duration(idx) * step)}
+			switch aggregation {
+			case model.AggregationSum:
+				point.Value = acc.sum
+			case model.AggregationMax:
+				point.Value = acc.max
+			case model.AggregationRate:
+				if i == 0 {
+					continue
+				}
+				prev := state.buckets[idxs[i-1]]
+				delta := acc.last - prev.last
+				if delta < 0 {
+					// 计数器被重置
+					delta = acc.last
+				}
+				point.Value = delta / (time.Duration(idx-idxs[i-1]) * step).Seconds()
+			default:
+				point.Value = acc.sum / float64(acc.count)
+			}
+			points = append(points, point)
+		}
+		series = append(series, model.MetricsSeries{Labels: state.labels, Points: points})
+	}
+	return series
+}
+
+// TopVMs 按时间范围内的丢包增量或平均实时带宽对VM排序
+func (s *metricsService) TopVMs(req model.TopVMsRequest) (*model.TopVMsResponse, error) {
+	from, to, err := normalizeTimeRange(req.From, req.To)
+	if err != nil {
+		return nil, err
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DEFAULT_TOP_LIMIT
+	}
+
+	// 时间范围越大使用越粗的精度, 每个task大约保留数百个采样点
+	resolution := chooseResolution(to.Sub(from) / 300)
+
+	var valueExpr string
+	switch req.By {
+	case model.TopByDropped:
+		valueExpr = "MAX(dropped) - MIN(dropped)"
+	case model.TopByBps:
+		valueExpr = "AVG(realbps)"
+	default:
+		return nil, fmt.Errorf("%w: unsupported top by %q", ErrInvalidMetricsQuery, req.By)
+	}
+
+	type taskValue struct {
+		VmName      string
+		VmNamespace string
+		NodeName    string
+		Value       float64
+	}
+	var rows []taskValue
+	db := database.DB.Model(&model.TaskMetricSample{}).
+		Select("vm_name, vm_namespace, node_name, task_id, "+valueExpr+" AS value").
+		Where("resolution = ? AND timestamp >= ? AND timestamp < ? AND vm_name <> ''", resolution, from, to)
+	if req.Namespace != "" {
+		db = db.Where("vm_namespace = ?", req.Namespace)
+	}
+	if req.NodeName != "" {
+		db = db.Where("node_name = ?", req.NodeName)
+	}
+	if err := db.Group("vm_name, vm_namespace, node_name, task_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	// 同一个VM可能对应多个task(如迁移或重建), 按VM累加
+	type vmKey struct{ name, namespace string }
+	entries := make(map[vmKey]*model.TopVMEntry)
+	for _, row := range rows {
+		key := vmKey{row.VmName, row.VmNamespace}
+		entry, ok := entries[key]
+		if !ok {
+			entry = &model.TopVMEntry{VmName: row.VmName, Namespace: row.VmNamespace}
+			entries[key] = entry
+		}
+		entry.Value += row.Value
+		if !slices.Contains(entry.Nodes, row.NodeName) {
+			entry.Nodes = append(entry.Nodes, row.NodeName)
+		}
+	}
+
+	items := make([]model.TopVMEntry, 0, len(entries))
+	for _, entry := range entries {
+		items = append(items, *entry)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Value != items[j].Value {
+			return items[i].Value > items[j].Value
+		}
+		return items[i].VmName < items[j].VmName
+	})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+
+	return &model.TopVMsResponse{
+		By:         req.By,
+		Resolution: resolution,
+		From:       from,
+		To:         to,
+		Items:      items,
+	}, nil
+}
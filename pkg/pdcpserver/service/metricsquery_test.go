@@ -0,0 +1,162 @@
+package service
+
+import (
+	"errors"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"slices"
+	"testing"
+	"time"
+)
+
+type testPoint struct {
+	offset time.Duration // 相对from的时间
+	value  float64
+}
+
+func TestBuildSeries(t *testing.T) {
+	from := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	vid := int64(100)
+	task1 := model.MetricsSeriesLabels{NodeName: "node1", TaskId: 1}
+	nic := model.MetricsSeriesLabels{NodeName: "node1", TaskId: 1, Vid: &vid, Mac: "52:54:00:00:00:01"}
+	sample := func(labels model.MetricsSeriesLabels, offset time.Duration, value int64) querySample {
+		return querySample{labels: labels, timestamp: from.Add(offset), value: value}
+	}
+	// task1在第0个step有两个点, 第1个step为空, 第2个step有一个点
+	samples := []querySample{
+		sample(task1, 0, 10),
+		sample(nic, 10*time.Second, 5),
+		sample(task1, 30*time.Second, 30),
+		sample(task1, 2*time.Minute, 90),
+	}
+
+	tests := []struct {
+		name        string
+		samples     []querySample
+		aggregation string
+		want        map[int][]testPoint // TaskId或NIC series的序号 -> 点
+	}{
+		{name: "avg", samples: samples, aggregation: model.AggregationAvg,
+			want: map[int][]testPoint{0: {{0, 20}, {2 * time.Minute, 90}}, 1: {{0, 5}}}},
+		{name: "default is avg", samples: samples,
+			want: map[int][]testPoint{0: {{0, 20}, {2 * time.Minute, 90}}, 1: {{0, 5}}}},
+		{name: "sum", samples: samples, aggregation: model.AggregationSum,
+			want: map[int][]testPoint{0: {{0, 40}, {2 * time.Minute, 90}}, 1: {{0, 5}}}},
+		{name: "max", samples: samples, aggregation: model.AggregationMax,
+			want: map[int][]testPoint{0: {{0, 30}, {2 * time.Minute, 90}}, 1: {{0, 5}}}},
+		// rate使用每个step的最后一个值, 第一个step没有上一个值, 跳过空的step时按间隔计算
+		{name: "rate", samples: samples, aggregation: model.AggregationRate,
+			want: map[int][]testPoint{0: {{2 * time.Minute, 0.5}}, 1: {}}},
+		{name: "rate after counter reset", aggregation: model.AggregationRate,
+			samples: []querySample{sample(task1, 0, 600), sample(task1, time.Minute, 60)},
+			want:    map[int][]testPoint{0: {{time.Minute, 1}}}},
+		{name: "no samples", aggregation: model.AggregationAvg, want: map[int][]testPoint{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series := buildSeries(tt.samples, from, time.Minute, tt.aggregation)
+			if len(series) != len(tt.want) {
+				t.Fatalf("series = %+v, want %d series", series, len(tt.want))
+			}
+			for i, s := range series {
+				// series按首次出现的顺序排列
+				if i == 1 && (s.Labels.Vid == nil || *s.Labels.Vid != vid || s.Labels.Mac != nic.Mac) {
+					t.Fatalf("series %d labels = %+v", i, s.Labels)
+				}
+				got := make([]testPoint, 0, len(s.Points))
+				for _, p := range s.Points {
+					got = append(got, testPoint{p.Timestamp.Sub(from), p.Value})
+				}
+				if !slices.Equal(got, tt.want[i]) {
+					t.Fatalf("series %d points = %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTopVMs(t *testing.T) {
+	s := setupMetricsTest(t)
+	now := time.Now().UTC()
+	// vm1在node1和node2上各有一个task, 按VM累加
+	samples := []struct {
+		node, vm, namespace string
+		taskId              int
+		offset              time.Duration
+		dropped, realbps    int64
+	}{
+		{"node1", "vm1", "team-a", 1, -50 * time.Minute, 100, 1000},
+		{"node1", "vm1", "team-a", 1, -10 * time.Minute, 150, 3000},
+		{"node2", "vm1", "team-a", 2, -20 * time.Minute, 0, 500},
+		{"node2", "vm1", "team-a", 2, -5 * time.Minute, 20, 500},
+		{"node1", "vm2", "team-b", 3, -30 * time.Minute, 10, 9000},
+		{"node1", "vm2", "team-b", 3, -15 * time.Minute, 110, 9000},
+		{"node2", "vm3", "team-a", 4, -30 * time.Minute, 5, 100},
+		// 超出时间范围或没有VM的采样不参与排序
+		{"node1", "vm3", "team-a", 4, -2 * time.Hour, 0, 100000},
+		{"node1", "", "", 5, -10 * time.Minute, 0, 100000},
+	}
+	for _, sample := range samples {
+		row := model.TaskMetricSample{
+			Resolution: model.ResolutionRaw, NodeName: sample.node, TaskId: sample.taskId, Timestamp: now.Add(sample.offset),
+			VmName: sample.vm, VmNamespace: sample.namespace, Samples: 1,
+			TrafficCounters: model.TrafficCounters{Dropped: sample.dropped, Realbps: sample.realbps},
+		}
+		if err := database.DB.Create(&row).Error; err != nil {
+			t.Fatalf("create sample: %v", err)
+		}
+	}
+
+	type entry struct {
+		vm    string
+		value float64
+		nodes []string
+	}
+	tests := []struct {
+		name    string
+		req     model.TopVMsRequest
+		want    []entry
+		wantErr error
+	}{
+		{name: "by dropped", req: model.TopVMsRequest{By: model.TopByDropped},
+			want: []entry{{"vm2", 100, []string{"node1"}}, {"vm1", 70, []string{"node1", "node2"}}, {"vm3", 0, []string{"node2"}}}},
+		{name: "by bps", req: model.TopVMsRequest{By: model.TopByBps},
+			want: []entry{{"vm2", 9000, []string{"node1"}}, {"vm1", 2500, []string{"node1", "node2"}}, {"vm3", 100, []string{"node2"}}}},
+		{name: "limit", req: model.TopVMsRequest{By: model.TopByBps, Limit: 1},
+			want: []entry{{"vm2", 9000, []string{"node1"}}}},
+		{name: "namespace", req: model.TopVMsRequest{By: model.TopByDropped, Namespace: "team-a"},
+			want: []entry{{"vm1", 70, []string{"node1", "node2"}}, {"vm3", 0, []string{"node2"}}}},
+		{name: "node", req: model.TopVMsRequest{By: model.TopByBps, NodeName: "node2"},
+			want: []entry{{"vm1", 500, []string{"node2"}}, {"vm3", 100, []string{"node2"}}}},
+		{name: "empty range", req: model.TopVMsRequest{By: model.TopByBps, From: now.Add(-4 * time.Hour), To: now.Add(-3 * time.Hour)},
+			want: []entry{}},
+		{name: "unsupported by", req: model.TopVMsRequest{By: "sent"}, wantErr: ErrInvalidMetricsQuery},
+		{name: "from after to", req: model.TopVMsRequest{By: model.TopByBps, From: now, To: now.Add(-time.Hour)},
+			wantErr: ErrInvalidMetricsQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.TopVMs(tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if resp.Resolution != model.ResolutionRaw || resp.By != tt.req.By {
+				t.Fatalf("response = %+v", resp)
+			}
+			got := make([]entry, 0, len(resp.Items))
+			for _, item := range resp.Items {
+				nodes := slices.Clone(item.Nodes)
+				slices.Sort(nodes)
+				got = append(got, entry{item.VmName, item.Value, nodes})
+			}
+			if !slices.EqualFunc(got, tt.want, func(a, b entry) bool {
+				return a.vm == b.vm && a.value == b.value && slices.Equal(a.nodes, b.nodes)
+			}) {
+				t.Fatalf("items = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"pdcplet/pkg/agent"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DEFAULT_NODE_STALE_AFTER    = 45 * time.Second
+	DEFAULT_NODE_CHECK_INTERVAL = 15 * time.Second
+	MAX_NODE_ERROR_LENGTH       = 1024 // 与Node表中错误信息列的长度一致
+)
+
+var (
+	ErrNodeNotRegistered = errors.New("node is not registered or session changed")
+	ErrInvalidNode       = errors.New("invalid node registration")
+)
+
+// NodeService 维护pdcplet节点的注册信息和心跳
+type NodeService interface {
+	Register(reg agent.Registration) (*agent.Ack, error)
+	Heartbeat(hb agent.Heartbeat) (*agent.Ack, error)
+	ListNodes(req model.NodeListRequest) (*model.NodeListResponse, error)
+	ReportRuleStatus(status agent.RuleSetStatus) error
+	// ReportEvents 发布pdcplet上报的任务和告警事件, 节点未注册或SessionId不一致时返回ErrNodeNotRegistered
+	ReportEvents(events agent.NodeEvents) (*agent.Ack, error)
+	// Run 周期性地将超时未发送心跳的节点标记为Stale, 直到ctx结束
+	Run(ctx context.Context)
+}
+
+type nodeService struct {
+	cfg config.NodesConfig
+}
+
+func NewNodeService(cfg config.NodesConfig) NodeService {
+	if cfg.StaleAfter <= 0 {
+		cfg.StaleAfter = DEFAULT_NODE_STALE_AFTER
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = DEFAULT_NODE_CHECK_INTERVAL
+	}
+	return &nodeService{cfg: cfg}
+}
+
+func nodeStatus(status agent.InpplatStatus) model.NodeStatus {
+	if status.InpplatReachable {
+		return model.NodeReady
+	}
+	return model.NodeDegraded
+}
+
+// Register 新增或覆盖节点的注册信息, pdcplet重启后以新的SessionId重新注册
+func (s *nodeService) Register(reg agent.Registration) (*agent.Ack, error) {
+	if reg.NodeName == "" || reg.SessionId == "" {
+		return nil, fmt.Errorf("%w: node_name and session_id are required", ErrInvalidNode)
+	}
+
+	// 首次注册或从Stale恢复时发布node.online事件
+	var previous model.Node
+	if err := database.DB.Select("status").Where("name = ?", reg.NodeName).Limit(1).Find(&previous).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	node := model.Node{
+		Name:             reg.NodeName,
+		Version:          reg.Version,
+		SessionId:        reg.SessionId,
+		Modules:          reg.Modules,
+		InpplatReachable: reg.InpplatReachable,
+		InpplatError:     truncateNodeError(reg.InpplatError),
+		Status:           nodeStatus(reg.InpplatStatus),
+		RegisteredAt:     now,
+		LastHeartbeatAt:  now,
+	}
+	err := database.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"version", "session_id", "modules", "inpplat_reachable",
+			"inpplat_error", "status", "registered_at", "last_heartbeat_at", "updated_at"}),
+	}).Create(&node).Error
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Node registered", "nodeName", reg.NodeName, "version", reg.Version, "sessionId", reg.SessionId,
+		"modules", reg.Modules, "inpplatReachable", reg.InpplatReachable)
+	if previous.Status == "" || previous.Status == model.NodeStale {
+		PublishEvent(model.EventNodeOnline, "", "", reg.NodeName, model.NodeEventData{From: previous.Status, To: node.Status})
+	}
+	return &agent.Ack{NodeName: reg.NodeName, SessionId: reg.SessionId, ReceivedAt: now}, nil
+}
+
+// Heartbeat 更新节点的心跳时间, 节点未注册或SessionId不一致时返回ErrNodeNotRegistered.
+// Stale节点恢复心跳时发布node.online事件
+func (s *nodeService) Heartbeat(hb agent.Heartbeat) (*agent.Ack, error) {
+	now := time.Now()
+	status := nodeStatus(hb.InpplatStatus)
+	var online bool
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var node model.Node
+		err := tx.Select("status").Where("name = ? AND session_id = ?", hb.NodeName, hb.SessionId).Take(&node).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNodeNotRegistered
+		} else if err != nil {
+			return err
+		}
+		res := tx.Model(&model.Node{}).
+			Where("name = ? AND session_id = ?", hb.NodeName, hb.SessionId).
+			Updates(map[string]interface{}{
+				"InpplatReachable": hb.InpplatReachable,
+				"InpplatError":     truncateNodeError(hb.InpplatError),
+				"Status":           status,
+				"LastHeartbeatAt":  now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNodeNotRegistered
+		}
+		online = node.Status == model.NodeStale
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if online {
+		slog.Info("Node is back online", "nodeName", hb.NodeName)
+		PublishEvent(model.EventNodeOnline, "", "", hb.NodeName, model.NodeEventData{From: model.NodeStale, To: status})
+	}
+	return &agent.Ack{NodeName: hb.NodeName, SessionId: hb.SessionId, ReceivedAt: now}, nil
+}
+
+func (s *nodeService) ListNodes(req model.NodeListRequest) (*model.NodeListResponse, error) {
+	query := database.DB.Model(&model.Node{})
+	if req.Status != "" {
+		query = query.Where("status = ?", req.Status)
+	}
+	var nodes []model.Node
+	if err := query.Order("name asc").Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+
+	resp := &model.NodeListResponse{Items: make([]model.NodeInfo, 0, len(nodes))}
+	for _, node := range nodes {
+		modules := node.Modules
+		if modules == nil {
+			modules = []string{}
+		}
+		resp.Items = append(resp.Items, model.NodeInfo{
+			Name:             node.Name,
+			Version:          node.Version,
+			Modules:          modules,
+			Status:           node.Status,
+			InpplatReachable: node.InpplatReachable,
+			InpplatError:     node.InpplatError,
+			RegisteredAt:     node.RegisteredAt,
+			LastHeartbeatAt:  node.LastHeartbeatAt,
+
+			AppliedRuleVersion: node.AppliedRuleVersion,
+			RuleSyncError:      node.RuleSyncError,
+			RulesSyncedAt:      node.RulesSyncedAt,
+		})
+	}
+	return resp, nil
+}
+
+// ReportRuleStatus 记录pdcplet下发规则集的结果
+func (s *nodeService) ReportRuleStatus(status agent.RuleSetStatus) error {
+	now := time.Now()
+	res := database.DB.Model(&model.Node{}).Where("name = ?", status.NodeName).
+		Updates(map[string]interface{}{
+			"AppliedRuleVersion": status.AppliedVersion,
+			"RuleSyncError":      truncateNodeError(status.Error),
+			"RulesSyncedAt":      &now,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNodeNotRegistered
+	}
+	if status.Error != "" {
+		slog.Warn("Node failed to apply rules", "nodeName", status.NodeName, "appliedVersion", status.AppliedVersion,
+			"error", status.Error)
+	}
+	return nil
+}
+
+// nodeEventTypes pdcplet上报的事件类型对应的事件
+var nodeEventTypes = map[string]model.EventType{
+	agent.EventTaskCreated: model.EventTaskCreated,
+	agent.EventTaskClosed:  model.EventTaskClosed,
+	agent.EventAlert:       model.EventAlert,
+}
+
+func (s *nodeService) ReportEvents(events agent.NodeEvents) (*agent.Ack, error) {
+	var count int64
+	err := database.DB.Model(&model.Node{}).
+		Where("name = ? AND session_id = ?", events.NodeName, events.SessionId).Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrNodeNotRegistered
+	}
+	vms, err := vmsOnNode(events.NodeName, events.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, event := range events.Events {
+		typ, ok := nodeEventTypes[event.Type]
+		if !ok {
+			slog.Warn("Ignore unknown node event", "nodeName", events.NodeName, "type", event.Type)
+			continue
+		}
+		if _, ok := vms[vmRecordKey{event.Namespace, event.VmiName}]; !ok {
+			slog.Warn("Ignore node event of VM not running on the node", "nodeName", events.NodeName,
+				"type", event.Type, "namespace", event.Namespace, "vmiName", event.VmiName)
+			continue
+		}
+		var data interface{} = model.TaskEventData{TaskId: event.TaskId, Time: event.Time}
+		if typ == model.EventAlert {
+			if event.Alert == nil {
+				slog.Warn("Ignore alert event without alert", "nodeName", events.NodeName)
+				continue
+			}
+			data = event.Alert
+		}
+		PublishEvent(typ, event.Namespace, event.VmiName, events.NodeName, data)
+	}
+	return &agent.Ack{NodeName: events.NodeName, SessionId: events.SessionId, ReceivedAt: time.Now()}, nil
+}
+
+// vmsOnNode 返回事件涉及的VM中状态同步记录为运行在该节点上的VM. 节点只能上报自己的VM的任务和告警,
+// 避免一个节点的凭据被用来伪造其他节点或namespace的事件
+func vmsOnNode(nodeName string, events []agent.NodeEvent) (map[vmRecordKey]struct{}, error) {
+	var names []string
+	for _, event := range events {
+		if !slices.Contains(names, event.VmiName) {
+			names = append(names, event.VmiName)
+		}
+	}
+	vms := make(map[vmRecordKey]struct{})
+	if len(names) == 0 {
+		return vms, nil
+	}
+	var records []model.VirtualMachineRecord
+	err := database.DB.Select("namespace", "name").Where("node_name = ? AND name IN ?", nodeName, names).
+		Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		vms[vmRecordKey{record.Namespace, record.Name}] = struct{}{}
+	}
+	return vms, nil
+}
+
+func (s *nodeService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.markStale(time.Now()); err != nil {
+				slog.Error("Failed to mark stale nodes", "error", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *nodeService) markStale(now time.Time) error {
+	var nodes []model.Node
+	var stale []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Select("name", "status").
+			Where("status <> ? AND last_heartbeat_at < ?", model.NodeStale, now.Add(-s.cfg.StaleAfter))
+		if err := query.Find(&nodes).Error; err != nil || len(nodes) == 0 {
+			return err
+		}
+		names := make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			slog.Warn("Node missed heartbeats, mark as stale", "nodeName", node.Name, "staleAfter", s.cfg.StaleAfter)
+			names = append(names, node.Name)
+		}
+		// 期间收到心跳的节点不标记
+		err := tx.Model(&model.Node{}).Where("name IN ? AND last_heartbeat_at < ?", names, now.Add(-s.cfg.StaleAfter)).
+			Update("Status", model.NodeStale).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&model.Node{}).Where("name IN ? AND status = ?", names, model.NodeStale).Pluck("name", &stale).Error
+	})
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if slices.Contains(stale, node.Name) {
+			PublishEvent(model.EventNodeOffline, "", "", node.Name, model.NodeEventData{From: node.Status, To: model.NodeStale})
+		}
+	}
+	return nil
+}
+
+// truncateNodeError 截断pdcplet上报的错误信息, 超出列长度时PostgreSQL和MySQL会拒绝写入
+func truncateNodeError(s string) string {
+	return truncateString(s, MAX_NODE_ERROR_LENGTH)
+}
+
+// truncateString 截断到最多n个字节, 不保留被截断的UTF-8字符
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"pdcplet/pkg/agent"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"testing"
+	"time"
+)
+
+func TestNodeRegistrationAndHeartbeat(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	s := NewNodeService(config.NodesConfig{StaleAfter: time.Minute}).(*nodeService)
+
+	reg := agent.Registration{NodeName: "node1", Version: "1.0.0", SessionId: "s1", Modules: []string{"vmimetrics"},
+		InpplatStatus: agent.InpplatStatus{InpplatReachable: true}}
+	if _, err := s.Register(reg); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	_, err := s.Heartbeat(agent.Heartbeat{NodeName: "node1", SessionId: "old"})
+	if !errors.Is(err, ErrNodeNotRegistered) {
+		t.Fatalf("heartbeat with old session: err = %v, want ErrNodeNotRegistered", err)
+	}
+	if _, err := s.Heartbeat(agent.Heartbeat{NodeName: "node1", SessionId: "s1",
+		InpplatStatus: agent.InpplatStatus{InpplatError: "connection refused"}}); err != nil {
+		t.Fatalf("heartbeat: %v", err)
+	}
+
+	resp, _ := s.ListNodes(model.NodeListRequest{})
+	if len(resp.Items) != 1 || resp.Items[0].Status != model.NodeDegraded || resp.Items[0].Modules[0] != "vmimetrics" {
+		t.Fatalf("unexpected nodes: %+v", resp.Items)
+	}
+
+	if err := s.markStale(time.Now().Add(2 * time.Minute)); err != nil {
+		t.Fatalf("mark stale: %v", err)
+	}
+	resp, _ = s.ListNodes(model.NodeListRequest{Status: string(model.NodeStale)})
+	if len(resp.Items) != 1 {
+		t.Fatalf("node not marked stale")
+	}
+
+	// 重启后以新的session重新注册
+	reg.SessionId = "s2"
+	if _, err := s.Register(reg); err != nil {
+		t.Fatalf("re-register: %v", err)
+	}
+	resp, _ = s.ListNodes(model.NodeListRequest{})
+	if len(resp.Items) != 1 || resp.Items[0].Status != model.NodeReady {
+		t.Fatalf("unexpected nodes after re-register: %+v", resp.Items)
+	}
+}
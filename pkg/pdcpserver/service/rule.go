@@ -0,0 +1,274 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pdcplet/pkg/agent"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const MAX_RULE_FILTER_LENGTH = 1024
+
+var (
+	ErrRuleNotFound = errors.New("rule not found")
+	ErrRuleExists   = errors.New("rule already exists")
+	ErrInvalidRule  = errors.New("invalid rule")
+	ErrRuleConflict = errors.New("rule version conflict")
+)
+
+var ruleProtocolPattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+
+// RuleService 管理解析规则, 并计算每个节点上生效的规则集
+type RuleService interface {
+	CreateRule(req model.RuleRequest) (*model.RuleInfo, error)
+	UpdateRule(name string, req model.RuleRequest) (*model.RuleInfo, error)
+	DeleteRule(name string) error
+	GetRule(name string) (*model.RuleInfo, error)
+	ListRules() (*model.RuleListResponse, error)
+	EffectiveRules(nodeName string) (*agent.RuleSet, error)
+}
+
+type ruleService struct{}
+
+func NewRuleService() RuleService {
+	return &ruleService{}
+}
+
+func validateRuleRequest(req model.RuleRequest) error {
+	if errs := validation.IsDNS1123Label(req.Name); len(errs) > 0 {
+		return fmt.Errorf("%w: invalid name %q: %s", ErrInvalidRule, req.Name, strings.Join(errs, "; "))
+	}
+	if len(req.Description) > MAX_DESCRIPTION_LENGTH {
+		return fmt.Errorf("%w: description must be at most %d bytes", ErrInvalidRule, MAX_DESCRIPTION_LENGTH)
+	}
+	if !ruleProtocolPattern.MatchString(req.Protocol) {
+		return fmt.Errorf("%w: invalid protocol %q", ErrInvalidRule, req.Protocol)
+	}
+	if len(req.Filter) > MAX_RULE_FILTER_LENGTH || strings.ContainsAny(req.Filter, "\r\n") {
+		return fmt.Errorf("%w: filter must be a single line of at most %d bytes", ErrInvalidRule, MAX_RULE_FILTER_LENGTH)
+	}
+	for _, vm := range req.VMs {
+		namespace, name, found := strings.Cut(vm, "/")
+		if !found || len(validation.IsDNS1123Label(namespace)) > 0 || len(validation.IsDNS1123Subdomain(name)) > 0 {
+			return fmt.Errorf("%w: invalid vm %q, expect <namespace>/<name>", ErrInvalidRule, vm)
+		}
+	}
+	for k, v := range req.Labels {
+		if len(validation.IsQualifiedName(k)) > 0 || len(validation.IsValidLabelValue(v)) > 0 {
+			return fmt.Errorf("%w: invalid label %s=%s", ErrInvalidRule, k, v)
+		}
+	}
+	return nil
+}
+
+func applyRuleRequest(rule *model.DissectionRule, req model.RuleRequest) {
+	rule.Description = req.Description
+	rule.Protocol = req.Protocol
+	rule.Filter = req.Filter
+	rule.Priority = req.Priority
+	rule.Enabled = req.Enabled == nil || *req.Enabled
+	rule.VMs = req.VMs
+	rule.Labels = req.Labels
+}
+
+func newRuleInfo(rule model.DissectionRule) model.RuleInfo {
+	info := model.RuleInfo{
+		Name:        rule.Name,
+		Description: rule.Description,
+		Protocol:    rule.Protocol,
+		Filter:      rule.Filter,
+		Priority:    rule.Priority,
+		Enabled:     rule.Enabled,
+		VMs:         rule.VMs,
+		Labels:      rule.Labels,
+		Version:     rule.Version,
+		CreatedAt:   rule.CreatedAt,
+		UpdatedAt:   rule.UpdatedAt,
+	}
+	if info.VMs == nil {
+		info.VMs = []string{}
+	}
+	return info
+}
+
+func getRule(tx *gorm.DB, name string) (*model.DissectionRule, error) {
+	var rule model.DissectionRule
+	err := tx.Where("name = ?", name).First(&rule).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRuleNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (s *ruleService) CreateRule(req model.RuleRequest) (*model.RuleInfo, error) {
+	if err := validateRuleRequest(req); err != nil {
+		return nil, err
+	}
+
+	rule := model.DissectionRule{Name: req.Name, Version: 1}
+	applyRuleRequest(&rule, req)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.DissectionRule{}).Where("name = ?", req.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrRuleExists
+		}
+		return tx.Create(&rule).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info := newRuleInfo(rule)
+	return &info, nil
+}
+
+// UpdateRule 更新规则并将版本加1, req.Version不为0时用于乐观并发控制
+func (s *ruleService) UpdateRule(name string, req model.RuleRequest) (*model.RuleInfo, error) {
+	req.Name = name
+	if err := validateRuleRequest(req); err != nil {
+		return nil, err
+	}
+
+	var rule *model.DissectionRule
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		rule, err = getRule(tx, name)
+		if err != nil {
+			return err
+		}
+		if req.Version != 0 && req.Version != rule.Version {
+			return fmt.Errorf("%w: current version is %d", ErrRuleConflict, rule.Version)
+		}
+		applyRuleRequest(rule, req)
+		rule.Version++
+		return tx.Save(rule).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info := newRuleInfo(*rule)
+	return &info, nil
+}
+
+func (s *ruleService) DeleteRule(name string) error {
+	res := database.DB.Where("name = ?", name).Delete(&model.DissectionRule{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+func (s *ruleService) GetRule(name string) (*model.RuleInfo, error) {
+	rule, err := getRule(database.DB, name)
+	if err != nil {
+		return nil, err
+	}
+	info := newRuleInfo(*rule)
+	return &info, nil
+}
+
+func (s *ruleService) ListRules() (*model.RuleListResponse, error) {
+	var rules []model.DissectionRule
+	if err := database.DB.Order("name asc").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	resp := &model.RuleListResponse{Items: make([]model.RuleInfo, 0, len(rules))}
+	for _, rule := range rules {
+		resp.Items = append(resp.Items, newRuleInfo(rule))
+	}
+	return resp, nil
+}
+
+// ruleMatches VM在规则的VMs中, 或者规则指定了Labels且VM的labels全部匹配
+func ruleMatches(rule model.DissectionRule, vmr model.VirtualMachineRecord, labels map[string]string) bool {
+	if slices.Contains(rule.VMs, vmr.Namespace+"/"+vmr.Name) {
+		return true
+	}
+	if len(rule.Labels) == 0 {
+		return false
+	}
+	for k, v := range rule.Labels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// EffectiveRules 返回调度到该节点的VM上生效的规则, 按VM和规则优先级排序以保证Version稳定
+func (s *ruleService) EffectiveRules(nodeName string) (*agent.RuleSet, error) {
+	var rules []model.DissectionRule
+	if err := database.DB.Where("enabled = ?", true).Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	var vmrs []model.VirtualMachineRecord
+	err := database.DB.Where("node_name = ?", nodeName).Order("namespace asc, name asc").Find(&vmrs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	set := &agent.RuleSet{NodeName: nodeName, Bindings: []agent.RuleBinding{}}
+	for _, vmr := range vmrs {
+		labels := vmLabels(vmr)
+		var specs []agent.RuleSpec
+		for _, rule := range rules {
+			if !ruleMatches(rule, vmr, labels) {
+				continue
+			}
+			specs = append(specs, agent.RuleSpec{
+				Name:     rule.Name,
+				Protocol: rule.Protocol,
+				Filter:   rule.Filter,
+				Priority: rule.Priority,
+				Version:  rule.Version,
+			})
+		}
+		if len(specs) == 0 {
+			continue
+		}
+		sort.Slice(specs, func(i, j int) bool {
+			if specs[i].Priority != specs[j].Priority {
+				return specs[i].Priority > specs[j].Priority
+			}
+			return specs[i].Name < specs[j].Name
+		})
+		set.Bindings = append(set.Bindings, agent.RuleBinding{Namespace: vmr.Namespace, VmName: vmr.Name, Rules: specs})
+	}
+
+	b, err := json.Marshal(set.Bindings)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	set.Version = hex.EncodeToString(sum[:8])
+	return set, nil
+}
+
+// vmLabels 返回VM创建时指定的labels, 早期版本的记录没有Spec
+func vmLabels(vmr model.VirtualMachineRecord) map[string]string {
+	var req model.VMCreateRequest
+	if vmr.Spec == "" || json.Unmarshal([]byte(vmr.Spec), &req) != nil {
+		return nil
+	}
+	return req.Labels
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"testing"
+)
+
+func TestRuleCRUDAndEffectiveRules(t *testing.T) {
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	s := NewRuleService()
+
+	vms := []model.VirtualMachineRecord{
+		{Name: "vm1", Namespace: "default", CPU: 1, Memory: "1Gi", Status: model.Created, NodeName: "node1",
+			Spec: `{"name":"vm1","namespace":"default","labels":{"app":"web"}}`},
+		{Name: "vm2", Namespace: "default", CPU: 1, Memory: "1Gi", Status: model.Created, NodeName: "node1"},
+		{Name: "vm3", Namespace: "default", CPU: 1, Memory: "1Gi", Status: model.Created, NodeName: "node2",
+			Spec: `{"name":"vm3","namespace":"default","labels":{"app":"web"}}`},
+	}
+	if err := database.DB.Create(&vms).Error; err != nil {
+		t.Fatalf("create vms: %v", err)
+	}
+
+	if _, err := s.CreateRule(model.RuleRequest{Name: "http", Protocol: "HTTP"}); !errors.Is(err, ErrInvalidRule) {
+		t.Fatalf("invalid protocol: err = %v, want ErrInvalidRule", err)
+	}
+	if _, err := s.CreateRule(model.RuleRequest{Name: "http", Protocol: "http", Labels: map[string]string{"app": "web"}}); err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+	if _, err := s.CreateRule(model.RuleRequest{Name: "http", Protocol: "http"}); !errors.Is(err, ErrRuleExists) {
+		t.Fatalf("duplicate rule: err = %v, want ErrRuleExists", err)
+	}
+	if _, err := s.CreateRule(model.RuleRequest{Name: "dns", Protocol: "dns", Priority: 10,
+		VMs: []string{"default/vm2"}}); err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+
+	set, err := s.EffectiveRules("node1")
+	if err != nil {
+		t.Fatalf("effective rules: %v", err)
+	}
+	if len(set.Bindings) != 2 || set.Bindings[0].VmName != "vm1" || set.Bindings[0].Rules[0].Name != "http" ||
+		set.Bindings[1].VmName != "vm2" || set.Bindings[1].Rules[0].Name != "dns" {
+		t.Fatalf("unexpected bindings: %+v", set.Bindings)
+	}
+	again, _ := s.EffectiveRules("node1")
+	if again.Version != set.Version {
+		t.Fatalf("version changed without rule changes: %s -> %s", set.Version, again.Version)
+	}
+
+	if _, err := s.UpdateRule("http", model.RuleRequest{Protocol: "http", Filter: "tcp port 8080", Version: 2}); !errors.Is(err, ErrRuleConflict) {
+		t.Fatalf("stale version: err = %v, want ErrRuleConflict", err)
+	}
+	info, err := s.UpdateRule("http", model.RuleRequest{Protocol: "http", Filter: "tcp port 8080", Version: 1,
+		Labels: map[string]string{"app": "web"}})
+	if err != nil || info.Version != 2 {
+		t.Fatalf("update rule: info = %+v, err = %v", info, err)
+	}
+	updated, _ := s.EffectiveRules("node1")
+	if updated.Version == set.Version || updated.Bindings[0].Rules[0].Filter != "tcp port 8080" {
+		t.Fatalf("rule update not reflected: %+v", updated)
+	}
+
+	disabled := false
+	if _, err := s.UpdateRule("dns", model.RuleRequest{Protocol: "dns", Enabled: &disabled, VMs: []string{"default/vm2"}}); err != nil {
+		t.Fatalf("disable rule: %v", err)
+	}
+	if err := s.DeleteRule("http"); err != nil {
+		t.Fatalf("delete rule: %v", err)
+	}
+	empty, _ := s.EffectiveRules("node1")
+	if len(empty.Bindings) != 0 {
+		t.Fatalf("unexpected bindings after delete: %+v", empty.Bindings)
+	}
+	if err := s.DeleteRule("http"); !errors.Is(err, ErrRuleNotFound) {
+		t.Fatalf("delete missing rule: err = %v, want ErrRuleNotFound", err)
+	}
+}
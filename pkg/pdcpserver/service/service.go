@@ -1,92 +1,251 @@
 package service
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"pdcplet/pkg/kubevirt"
 	"pdcplet/pkg/pdcpserver/database"
 	"pdcplet/pkg/pdcpserver/model"
+	"strings"
 
 	"gorm.io/gorm"
 )
 
 type Service interface {
-	CreateVM(req model.VMCreateRequest) error
-	DeleteVM(req model.VMDeleteRequest) error
+	// CreateVM jobID不为空时在写入记录的同一事务中关联到该任务, 任务重试时不会因记录已存在而失败
+	CreateVM(req model.VMCreateRequest, owner string, jobID string) (uint, error)
+	DeleteVM(req model.VMDeleteRequest) (uint, error)
+	ListVMs(req model.VMListRequest) (*model.VMListResponse, error)
+	GetVM(name string, namespace string) (*model.VMInfo, error)
+	OperateVM(op model.VMOperation, req model.VMOperationRequest) (model.VirtualMachineStatus, error)
 }
 
-type service struct{}
+type service struct {
+	// notify 通知生命周期reconciler处理新写入的记录, 可以为nil
+	notify func()
+}
 
-func New() Service {
-	return &service{}
+// New 创建Service, notify在VM记录需要reconciler处理时调用
+func New(notify func()) Service {
+	return &service{notify: notify}
 }
 
-func (s *service) CreateVM(req model.VMCreateRequest) error {
-	vmr := model.VirtualMachineRecord{
-		Name:   req.Name,
-		CPU:    req.CPU,
-		Memory: req.Memory,
-		Status: model.StatusNotSet,
+func (s *service) trigger() {
+	if s.notify != nil {
+		s.notify()
 	}
-
-	return database.DB.Transaction(func(tx *gorm.DB) error {
-		if err := s.createKubeVirtVM(req); err != nil {
-			return err
-		}
-		vmr.Status = model.Created
-		if err := tx.Create(&vmr).Error; err != nil {
-			return err
-		}
-		return nil
-	})
 }
 
-func (s *service) createKubeVirtVM(req model.VMCreateRequest) error {
-	vm := model.NewKubeVirtVM(req)
-	err := kubevirt.CreateVM(vm)
+// CreateVM 以Pending状态写入记录, 由生命周期reconciler在KubeVirt中创建VM, 返回记录ID
+func (s *service) CreateVM(req model.VMCreateRequest, owner string, jobID string) (uint, error) {
+	if err := ValidateVMCreateRequest(req); err != nil {
+		return 0, err
+	}
+	spec, err := json.Marshal(req)
 	if err != nil {
-		slog.Error("Failed to create Kubevirt VirtualMachine", "error", err, "VmName", vm.Name, "Namespace", vm.Namespace)
+		return 0, err
 	}
-	return err
-}
 
-func (s *service) DeleteVM(req model.VMDeleteRequest) error {
+	vmr := model.VirtualMachineRecord{
+		Name:      req.Name,
+		Namespace: req.Namespace,
+		CPU:       req.CPU,
+		Memory:    req.Memory,
+		Template:  req.Template,
+		Owner:     owner,
+		Status:    model.Pending,
+		Spec:      string(spec),
+	}
 
-	return database.DB.Transaction(func(tx *gorm.DB) error {
-		if err := s.deleteKubeVirtVM(req); err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.VirtualMachineRecord{}).
+			Where("name = ? AND namespace = ?", req.Name, req.Namespace).Count(&count).Error; err != nil {
 			return err
 		}
-		vmr, err := GetVirtualMachineRecordByName(req.Name)
+		if count > 0 {
+			return ErrVMExists
+		}
+		adopted, err := checkRetainedDataVolumes(tx, req)
 		if err != nil {
-			slog.Error("Failed to get VirtualMachineRecord", "error", err, "VmName", req.Name)
 			return err
 		}
-		if vmr != nil {
-			vmr.Status = model.MarkDeleted
-			if err := tx.Model(&vmr).Update("Status", model.MarkDeleted).Error; err != nil {
+		// 并发创建同名VM时都可能通过上面的检查, 由唯一索引保证只有一个成功
+		if err := tx.Create(&vmr).Error; database.IsDuplicateKey(err) {
+			return ErrVMExists
+		} else if err != nil {
+			return err
+		}
+		if disks := model.NewVirtualMachineDisks(vmr.ID, req); len(disks) > 0 {
+			for i := range disks {
+				if retained, ok := adopted[disks[i].DataVolumeName]; ok {
+					disks[i].Size = retained.Size
+					disks[i].StorageClass = retained.StorageClass
+				}
+			}
+			if err := tx.Create(&disks).Error; err != nil {
 				return err
 			}
 		}
-
+		// 被接管的磁盘记录由新VM的磁盘记录代替
+		for _, retained := range adopted {
+			if err := tx.Delete(&retained).Error; err != nil {
+				return err
+			}
+		}
+		if ifaces := model.NewVirtualMachineInterfaces(vmr.ID, req); len(ifaces) > 0 {
+			if err := tx.Create(&ifaces).Error; err != nil {
+				return err
+			}
+		}
+		if jobID != "" {
+			return tx.Model(&model.Job{}).Where("id = ?", jobID).Update("VirtualMachineRecordID", vmr.ID).Error
+		}
 		return nil
 	})
+	if err != nil {
+		return 0, err
+	}
+
+	PublishEvent(model.EventVMStatus, vmr.Namespace, vmr.Name, "", model.VMStatusEventData{To: model.Pending})
+	s.trigger()
+	return vmr.ID, nil
+}
+
+// DeleteVM 将记录标记为Deleting, 由生命周期reconciler从KubeVirt中删除VM, 返回记录ID
+func (s *service) DeleteVM(req model.VMDeleteRequest) (uint, error) {
+	vmr, err := GetVirtualMachineRecordByName(req.Name, req.Namespace)
+	if err != nil {
+		slog.Error("Failed to get VirtualMachineRecord", "error", err, "VmName", req.Name)
+		return 0, err
+	}
+	if vmr == nil {
+		return 0, ErrVMNotFound
+	}
+	if vmr.Status == model.Deleting {
+		return vmr.ID, nil
+	}
+
+	res := database.DB.Model(vmr).Where("status = ?", vmr.Status).Updates(map[string]interface{}{
+		"Status":          model.Deleting,
+		"Attempts":        0,
+		"LastError":       "",
+		"LastErrorReason": "",
+		"NextAttemptAt":   nil,
+	})
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected > 0 {
+		PublishVMStatus(vmr, model.Deleting, "")
+	}
+
+	s.trigger()
+	return vmr.ID, nil
 }
 
-func (s *service) deleteKubeVirtVM(req model.VMDeleteRequest) error {
-	err := kubevirt.DeleteVM(req.Name, req.Namespace)
+var vmOperations = map[model.VMOperation]func(name string, namespace string) error{
+	model.VMOperationStart:   kubevirt.StartVM,
+	model.VMOperationStop:    kubevirt.StopVM,
+	model.VMOperationRestart: kubevirt.RestartVM,
+	model.VMOperationPause:   kubevirt.PauseVM,
+	model.VMOperationUnpause: kubevirt.UnpauseVM,
+}
+
+// OperateVM 对KubeVirt VM执行生命周期操作, 成功后更新VirtualMachineRecord的状态
+func (s *service) OperateVM(op model.VMOperation, req model.VMOperationRequest) (model.VirtualMachineStatus, error) {
+	operate, ok := vmOperations[op]
+	if !ok {
+		return model.StatusNotSet, fmt.Errorf("unsupported vm operation: %s", op)
+	}
+
+	vmr, err := GetVirtualMachineRecordByName(req.Name, req.Namespace)
 	if err != nil {
-		slog.Error("Failed to create Kubevirt VirtualMachine", "error", err, "VmName", req.Name, "Namespace", req.Namespace)
+		return model.StatusNotSet, err
+	}
+	if vmr == nil {
+		return model.StatusNotSet, ErrVMNotFound
 	}
-	return err
+	switch vmr.Status {
+	case model.Pending, model.CreateFailed, model.Deleting:
+		return vmr.Status, fmt.Errorf("%w: %s", ErrVMNotOperable, vmr.Status)
+	}
+
+	if err := operate(req.Name, req.Namespace); err != nil {
+		slog.Error("Failed to operate Kubevirt VirtualMachine", "error", err, "operation", op, "VmName", req.Name, "Namespace", req.Namespace)
+		return vmr.Status, err
+	}
+
+	status := op.TargetStatus()
+	from := *vmr
+	if err := database.DB.Model(vmr).Update("Status", status).Error; err != nil {
+		return vmr.Status, err
+	}
+	PublishVMStatus(&from, status, "")
+	return status, nil
 }
 
-func GetVirtualMachineRecordByName(name string) (*model.VirtualMachineRecord, error) {
+// GetVirtualMachineRecordByName 返回最新的记录, 不存在时返回nil, nil
+func GetVirtualMachineRecordByName(name string, namespace string) (*model.VirtualMachineRecord, error) {
 	var vmr model.VirtualMachineRecord
-	err := database.DB.First(&vmr, "name = ?", name).Error
+	err := database.DB.Where("name = ? AND namespace = ?", name, namespace).Order("id desc").First(&vmr).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, err
-	} else if err != nil {
 		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
 	return &vmr, nil
 }
+
+// checkRetainedDataVolumes 同名VM删除后保留的DataVolume仍然存在, KubeVirt无法以dataVolumeTemplate重新创建,
+// 需要以retained来源接管. 返回以DataVolume名称为key的被接管的磁盘记录
+func checkRetainedDataVolumes(tx *gorm.DB, req model.VMCreateRequest) (map[string]model.VirtualMachineDisk, error) {
+	var names []string
+	for _, disk := range req.DiskSpecs() {
+		if disk.DataVolume != nil {
+			names = append(names, model.DataVolumeName(req.Name, disk.Name))
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	var disks []model.VirtualMachineDisk
+	err := tx.Where("vm_namespace = ? AND data_volume_name IN ? AND status = ?", req.Namespace, names, model.DiskRetained).
+		Find(&disks).Error
+	if err != nil {
+		return nil, err
+	}
+	retained := make(map[string]model.VirtualMachineDisk, len(disks))
+	for _, disk := range disks {
+		retained[disk.DataVolumeName] = disk
+	}
+
+	adopted := make(map[string]model.VirtualMachineDisk)
+	var conflicts, missing []string
+	for _, disk := range req.DiskSpecs() {
+		if disk.DataVolume == nil {
+			continue
+		}
+		name := model.DataVolumeName(req.Name, disk.Name)
+		r, ok := retained[name]
+		switch {
+		case disk.DataVolume.Source == model.DataVolumeSourceRetained && !ok:
+			missing = append(missing, name)
+		case disk.DataVolume.Source == model.DataVolumeSourceRetained:
+			adopted[name] = r
+		case ok:
+			conflicts = append(conflicts, name)
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("%w: data volume %s retained from a deleted vm still exists, use source %q to adopt it",
+			ErrInvalidVMSpec, strings.Join(conflicts, ", "), model.DataVolumeSourceRetained)
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: no retained data volume %s to adopt", ErrInvalidVMSpec, strings.Join(missing, ", "))
+	}
+	return adopted, nil
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"testing"
+)
+
+func setupServiceTest(t *testing.T) *service {
+	t.Helper()
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	return New(nil).(*service)
+}
+
+// createRetainedDisk 写入已删除的VM保留的DataVolume磁盘记录
+func createRetainedDisk(t *testing.T, vmName string, diskName string) model.VirtualMachineDisk {
+	t.Helper()
+	disk := model.VirtualMachineDisk{
+		VirtualMachineRecordID: 100, VmName: vmName, VmNamespace: "default", Name: diskName, Type: model.DiskTypeDataVolume,
+		DataVolumeName: model.DataVolumeName(vmName, diskName), Source: model.DataVolumeSourceBlank, Size: "20Gi",
+		StorageClass: "local", Retention: model.RetentionRetain, Status: model.DiskRetained,
+	}
+	if err := database.DB.Create(&disk).Error; err != nil {
+		t.Fatalf("create disk: %v", err)
+	}
+	return disk
+}
+
+func TestCreateVMRetainedDataVolume(t *testing.T) {
+	blank := &model.DataVolumeSpec{Source: model.DataVolumeSourceBlank, Size: "20Gi"}
+	retained := &model.DataVolumeSpec{Source: model.DataVolumeSourceRetained}
+	tests := []struct {
+		name     string
+		retained bool // 是否存在vm1-data的保留记录
+		data     *model.DataVolumeSpec
+		wantErr  error
+		adopted  bool
+	}{
+		{name: "new data volume", data: blank},
+		{name: "retained data volume conflicts", retained: true, data: blank, wantErr: ErrInvalidVMSpec},
+		{name: "adopt retained data volume", retained: true, data: retained, adopted: true},
+		{name: "nothing to adopt", data: retained, wantErr: ErrInvalidVMSpec},
+		{name: "retained with size", retained: true, wantErr: ErrInvalidVMSpec,
+			data: &model.DataVolumeSpec{Source: model.DataVolumeSourceRetained, Size: "20Gi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := setupServiceTest(t)
+			var old model.VirtualMachineDisk
+			if tt.retained {
+				old = createRetainedDisk(t, "vm1", "data")
+			}
+			req := model.VMCreateRequest{Name: "vm1", Namespace: "default", Memory: "1Gi", CPU: 1, Disks: []model.DiskSpec{
+				{Name: "root", Image: "cirros"}, {Name: "data", DataVolume: tt.data},
+			}}
+			id, err := s.CreateVM(req, "", "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("create err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			var disk model.VirtualMachineDisk
+			if err := database.DB.Where("virtual_machine_record_id = ? AND name = ?", id, "data").First(&disk).Error; err != nil {
+				t.Fatalf("get disk: %v", err)
+			}
+			if disk.Status != model.DiskActive || disk.DataVolumeName != "vm1-data" || disk.Size != "20Gi" {
+				t.Fatalf("unexpected disk: %+v", disk)
+			}
+			if !tt.adopted {
+				return
+			}
+			// 被接管的记录不再是Retained, 沿用原DataVolume的大小和StorageClass
+			if disk.Source != model.DataVolumeSourceRetained || disk.StorageClass != "local" {
+				t.Fatalf("adopted disk = %+v", disk)
+			}
+			var count int64
+			database.DB.Model(&model.VirtualMachineDisk{}).Where("id = ?", old.ID).Count(&count)
+			if count != 0 {
+				t.Fatalf("retained disk record still exists")
+			}
+		})
+	}
+}
+
+// fakeVMOperations 替换KubeVirt的生命周期操作, 记录被调用的操作, 返回err
+func fakeVMOperations(t *testing.T, err error) *[]string {
+	t.Helper()
+	original := vmOperations
+	t.Cleanup(func() { vmOperations = original })
+	var calls []string
+	vmOperations = make(map[model.VMOperation]func(name string, namespace string) error, len(original))
+	for op := range original {
+		vmOperations[op] = func(name string, namespace string) error {
+			calls = append(calls, string(op)+" "+namespace+"/"+name)
+			return err
+		}
+	}
+	return &calls
+}
+
+func TestOperateVM(t *testing.T) {
+	errKubeVirt := errors.New("kubevirt unavailable")
+	tests := []struct {
+		name       string
+		status     model.VirtualMachineStatus // 为空时不创建记录
+		op         model.VMOperation
+		operateErr error
+		want       model.VirtualMachineStatus // 操作后记录的状态
+		wantErr    error
+		wantCall   bool
+	}{
+		{name: "start stopped", status: model.Stopped, op: model.VMOperationStart, want: model.Starting, wantCall: true},
+		{name: "stop running", status: model.Running, op: model.VMOperationStop, want: model.Stopped, wantCall: true},
+		{name: "restart running", status: model.Running, op: model.VMOperationRestart, want: model.Starting, wantCall: true},
+		{name: "pause running", status: model.Running, op: model.VMOperationPause, want: model.Paused, wantCall: true},
+		{name: "unpause paused", status: model.Paused, op: model.VMOperationUnpause, want: model.Running, wantCall: true},
+		{name: "stop starting", status: model.Starting, op: model.VMOperationStop, want: model.Stopped, wantCall: true},
+		// 状态不变时仍然调用KubeVirt, 但不发布事件
+		{name: "stop stopped", status: model.Stopped, op: model.VMOperationStop, want: model.Stopped, wantCall: true},
+		{name: "start pending", status: model.Pending, op: model.VMOperationStart, want: model.Pending, wantErr: ErrVMNotOperable},
+		{name: "stop create failed", status: model.CreateFailed, op: model.VMOperationStop, want: model.CreateFailed, wantErr: ErrVMNotOperable},
+		{name: "start deleting", status: model.Deleting, op: model.VMOperationStart, want: model.Deleting, wantErr: ErrVMNotOperable},
+		{name: "not found", op: model.VMOperationStart, wantErr: ErrVMNotFound},
+		{name: "kubevirt error", status: model.Running, op: model.VMOperationStop, operateErr: errKubeVirt,
+			want: model.Running, wantErr: errKubeVirt, wantCall: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := setupServiceTest(t)
+			calls := fakeVMOperations(t, tt.operateErr)
+			if tt.status != "" {
+				vmr := model.VirtualMachineRecord{Name: "vm1", Namespace: "default", CPU: 1, Memory: "1Gi", Status: tt.status}
+				if err := database.DB.Create(&vmr).Error; err != nil {
+					t.Fatalf("create record: %v", err)
+				}
+			}
+
+			status, err := s.OperateVM(tt.op, model.VMOperationRequest{Name: "vm1", Namespace: "default"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && status != tt.want {
+				t.Fatalf("returned status = %s, want %s", status, tt.want)
+			}
+			if called := len(*calls) == 1 && (*calls)[0] == string(tt.op)+" default/vm1"; called != tt.wantCall || len(*calls) > 1 {
+				t.Fatalf("kubevirt calls = %v", *calls)
+			}
+			if tt.status == "" {
+				return
+			}
+
+			vmr, _ := GetVirtualMachineRecordByName("vm1", "default")
+			if vmr.Status != tt.want {
+				t.Fatalf("record status = %s, want %s", vmr.Status, tt.want)
+			}
+			var events []model.Event
+			database.DB.Where("type = ?", model.EventVMStatus).Find(&events)
+			if tt.want == tt.status {
+				if len(events) != 0 {
+					t.Fatalf("unexpected events: %+v", events)
+				}
+				return
+			}
+			var data model.VMStatusEventData
+			if len(events) != 1 || json.Unmarshal([]byte(events[0].Data), &data) != nil || data.From != tt.status || data.To != tt.want {
+				t.Fatalf("events = %+v", events)
+			}
+		})
+	}
+
+	s := setupServiceTest(t)
+	calls := fakeVMOperations(t, nil)
+	if _, err := s.OperateVM("migrate", model.VMOperationRequest{Name: "vm1", Namespace: "default"}); err == nil || len(*calls) != 0 {
+		t.Fatalf("unsupported operation: err = %v, calls = %v", err, *calls)
+	}
+}
+
+// 同时创建同名VM时只有一个成功, 其余返回ErrVMExists
+func TestCreateVMConcurrent(t *testing.T) {
+	s := setupServiceTest(t)
+	req := model.VMCreateRequest{Name: "vm1", Namespace: "default", Memory: "1Gi", CPU: 1, Image: "cirros"}
+
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := s.CreateVM(req, "", "")
+			errs <- err
+		}()
+	}
+	created := 0
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err == nil {
+			created++
+		} else if !errors.Is(err, ErrVMExists) {
+			t.Fatalf("create: err = %v, want ErrVMExists", err)
+		}
+	}
+	var count int64
+	database.DB.Model(&model.VirtualMachineRecord{}).Where("name = ?", "vm1").Count(&count)
+	if created != 1 || count != 1 {
+		t.Fatalf("created = %d, records = %d, want 1", created, count)
+	}
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// 模板和规则描述的最大长度, 与表中description列的长度一致
+const MAX_DESCRIPTION_LENGTH = 1024
+
+var (
+	ErrTemplateNotFound = errors.New("vm template not found")
+	ErrTemplateExists   = errors.New("vm template already exists")
+	ErrInvalidTemplate  = errors.New("invalid vm template")
+)
+
+// TemplateService 管理VM模板, 并将引用模板的创建请求展开为完整的请求
+type TemplateService interface {
+	CreateTemplate(req model.VMTemplateRequest) (*model.VMTemplateInfo, error)
+	UpdateTemplate(name string, req model.VMTemplateRequest) (*model.VMTemplateInfo, error)
+	DeleteTemplate(name string) error
+	GetTemplate(name string) (*model.VMTemplateInfo, error)
+	ListTemplates() (*model.VMTemplateListResponse, error)
+	Resolve(req model.VMCreateRequest) (model.VMCreateRequest, error)
+}
+
+type templateService struct{}
+
+func NewTemplateService() TemplateService {
+	return &templateService{}
+}
+
+func validateTemplateRequest(req model.VMTemplateRequest) error {
+	if errs := validation.IsDNS1123Label(req.Name); len(errs) > 0 {
+		return fmt.Errorf("%w: invalid name %q: %s", ErrInvalidTemplate, req.Name, strings.Join(errs, "; "))
+	}
+	if len(req.Description) > MAX_DESCRIPTION_LENGTH {
+		return fmt.Errorf("%w: description must be at most %d bytes", ErrInvalidTemplate, MAX_DESCRIPTION_LENGTH)
+	}
+	if err := validateVMSpec(req.CPU, req.Memory, req.Disks, req.Networks, req.CloudInit, req.Labels); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+	}
+	for _, field := range req.AllowedOverrides {
+		if !slices.Contains(model.TemplateOverrideFields, field) {
+			return fmt.Errorf("%w: unsupported override field %q, supported: %s", ErrInvalidTemplate, field,
+				strings.Join(model.TemplateOverrideFields, ", "))
+		}
+	}
+	return nil
+}
+
+func applyTemplateRequest(tpl *model.VMTemplate, req model.VMTemplateRequest) {
+	tpl.Description = req.Description
+	tpl.CPU = req.CPU
+	tpl.Memory = req.Memory
+	tpl.Disks = req.Disks
+	tpl.Networks = req.Networks
+	tpl.CloudInit = req.CloudInit
+	tpl.Labels = req.Labels
+	tpl.AllowedOverrides = req.AllowedOverrides
+}
+
+func newTemplateInfo(tpl model.VMTemplate) model.VMTemplateInfo {
+	info := model.VMTemplateInfo{
+		Name:             tpl.Name,
+		Description:      tpl.Description,
+		CPU:              tpl.CPU,
+		Memory:           tpl.Memory,
+		Disks:            tpl.Disks,
+		Networks:         tpl.Networks,
+		CloudInit:        tpl.CloudInit,
+		Labels:           tpl.Labels,
+		AllowedOverrides: tpl.AllowedOverrides,
+		CreatedAt:        tpl.CreatedAt,
+		UpdatedAt:        tpl.UpdatedAt,
+	}
+	if info.AllowedOverrides == nil {
+		info.AllowedOverrides = []string{}
+	}
+	return info
+}
+
+func getTemplate(name string) (*model.VMTemplate, error) {
+	var tpl model.VMTemplate
+	err := database.DB.Where("name = ?", name).First(&tpl).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTemplateNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &tpl, nil
+}
+
+func (s *templateService) CreateTemplate(req model.VMTemplateRequest) (*model.VMTemplateInfo, error) {
+	if err := validateTemplateRequest(req); err != nil {
+		return nil, err
+	}
+
+	tpl := model.VMTemplate{Name: req.Name}
+	applyTemplateRequest(&tpl, req)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.VMTemplate{}).Where("name = ?", req.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrTemplateExists
+		}
+		return tx.Create(&tpl).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info := newTemplateInfo(tpl)
+	return &info, nil
+}
+
+func (s *templateService) UpdateTemplate(name string, req model.VMTemplateRequest) (*model.VMTemplateInfo, error) {
+	req.Name = name
+	if err := validateTemplateRequest(req); err != nil {
+		return nil, err
+	}
+
+	tpl, err := getTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	applyTemplateRequest(tpl, req)
+	if err := database.DB.Save(tpl).Error; err != nil {
+		return nil, err
+	}
+
+	info := newTemplateInfo(*tpl)
+	return &info, nil
+}
+
+// DeleteTemplate 删除模板. 已创建的VM记录保存了展开后的完整规格, 不受影响
+func (s *templateService) DeleteTemplate(name string) error {
+	res := database.DB.Where("name = ?", name).Delete(&model.VMTemplate{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
+
+func (s *templateService) GetTemplate(name string) (*model.VMTemplateInfo, error) {
+	tpl, err := getTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	info := newTemplateInfo(*tpl)
+	return &info, nil
+}
+
+func (s *templateService) ListTemplates() (*model.VMTemplateListResponse, error) {
+	var tpls []model.VMTemplate
+	if err := database.DB.Order("name asc").Find(&tpls).Error; err != nil {
+		return nil, err
+	}
+	resp := &model.VMTemplateListResponse{Items: make([]model.VMTemplateInfo, 0, len(tpls))}
+	for _, tpl := range tpls {
+		resp.Items = append(resp.Items, newTemplateInfo(tpl))
+	}
+	return resp, nil
+}
+
+// Resolve 将引用模板的创建请求展开为完整的请求, 请求中的非空字段覆盖模板中允许覆盖的字段
+func (s *templateService) Resolve(req model.VMCreateRequest) (model.VMCreateRequest, error) {
+	if req.Template == "" {
+		return req, ValidateVMCreateRequest(req)
+	}
+
+	tpl, err := getTemplate(req.Template)
+	if errors.Is(err, ErrTemplateNotFound) {
+		return req, fmt.Errorf("%w: template %q not found", ErrInvalidVMSpec, req.Template)
+	} else if err != nil {
+		return req, err
+	}
+
+	resolved := req
+	checks := []struct {
+		field string
+		set   bool
+		apply func()
+	}{
+		{model.OverrideCPU, req.CPU != 0, func() { resolved.CPU = tpl.CPU }},
+		{model.OverrideMemory, req.Memory != "", func() { resolved.Memory = tpl.Memory }},
+		{model.OverrideDisks, req.Image != "" || len(req.Disks) > 0, func() { resolved.Disks = tpl.Disks }},
+		{model.OverrideNetworks, req.Networks != nil, func() { resolved.Networks = tpl.Networks }},
+		{model.OverrideCloudInit, req.CloudInit != nil, func() { resolved.CloudInit = tpl.CloudInit }},
+		{model.OverrideLabels, len(req.Labels) > 0, func() { resolved.Labels = tpl.Labels }},
+	}
+	for _, check := range checks {
+		if !check.set {
+			check.apply()
+		} else if !slices.Contains(tpl.AllowedOverrides, check.field) {
+			return req, fmt.Errorf("%w: field %q of template %q cannot be overridden", ErrInvalidVMSpec, check.field, tpl.Name)
+		}
+	}
+	// labels与模板合并而不是替换
+	if len(req.Labels) > 0 && len(tpl.Labels) > 0 {
+		resolved.Labels = maps.Clone(tpl.Labels)
+		maps.Copy(resolved.Labels, req.Labels)
+	}
+
+	return resolved, ValidateVMCreateRequest(resolved)
+}
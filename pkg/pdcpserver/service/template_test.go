@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"testing"
+)
+
+func setupTemplateTest(t *testing.T) TemplateService {
+	t.Helper()
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	s := NewTemplateService()
+	_, err := s.CreateTemplate(model.VMTemplateRequest{
+		Name:             "small",
+		CPU:              1,
+		Memory:           "1Gi",
+		Disks:            []model.DiskSpec{{Name: "root", Image: "quay.io/containerdisks/fedora:latest"}},
+		Networks:         []model.NetworkSpec{{Name: "default"}},
+		Labels:           map[string]string{"flavor": "small"},
+		AllowedOverrides: []string{model.OverrideMemory, model.OverrideLabels},
+	})
+	if err != nil {
+		t.Fatalf("create template: %v", err)
+	}
+	return s
+}
+
+func TestTemplateValidation(t *testing.T) {
+	s := setupTemplateTest(t)
+
+	cases := map[string]model.VMTemplateRequest{
+		"bad name":     {Name: "Small_1", CPU: 1, Memory: "1Gi", Disks: []model.DiskSpec{{Name: "root", Image: "img"}}},
+		"bad memory":   {Name: "t1", CPU: 1, Memory: "lots", Disks: []model.DiskSpec{{Name: "root", Image: "img"}}},
+		"dup disk":     {Name: "t2", CPU: 1, Memory: "1Gi", Disks: []model.DiskSpec{{Name: "a", Image: "img"}, {Name: "a", Image: "img"}}},
+		"bad override": {Name: "t3", CPU: 1, Memory: "1Gi", Disks: []model.DiskSpec{{Name: "root", Image: "img"}}, AllowedOverrides: []string{"name"}},
+		"image and dv": {Name: "t4", CPU: 1, Memory: "1Gi", Disks: []model.DiskSpec{{Name: "root", Image: "img",
+			DataVolume: &model.DataVolumeSpec{Source: model.DataVolumeSourceBlank, Size: "1Gi"}}}},
+		"dv no size": {Name: "t5", CPU: 1, Memory: "1Gi", Disks: []model.DiskSpec{{Name: "root",
+			DataVolume: &model.DataVolumeSpec{Source: model.DataVolumeSourceHTTP, URL: "http://example.com/a.img"}}}},
+		"sriov on pod": {Name: "t7", CPU: 1, Memory: "1Gi", Disks: []model.DiskSpec{{Name: "root", Image: "img"}},
+			Networks: []model.NetworkSpec{{Name: "net", Binding: model.NetworkBindingSRIOV}}},
+		"multus no nad": {Name: "t8", CPU: 1, Memory: "1Gi", Disks: []model.DiskSpec{{Name: "root", Image: "img"}},
+			Networks: []model.NetworkSpec{{Name: "net", Type: model.NetworkTypeMultus}}},
+		"dup mac": {Name: "t9", CPU: 1, Memory: "1Gi", Disks: []model.DiskSpec{{Name: "root", Image: "img"}},
+			Networks: []model.NetworkSpec{
+				{Name: "a", Type: model.NetworkTypeMultus, NetworkName: "capture", MacAddress: "02:00:00:00:00:01"},
+				{Name: "b", Type: model.NetworkTypeMultus, NetworkName: "capture", MacAddress: "02-00-00-00-00-01"},
+			}},
+		"bad vlan": {Name: "t10", CPU: 1, Memory: "1Gi", Disks: []model.DiskSpec{{Name: "root", Image: "img"}},
+			Networks: []model.NetworkSpec{{Name: "a", Type: model.NetworkTypeMultus, NetworkName: "capture", VlanID: 4095}}},
+		"bad image": {Name: "t11", CPU: 1, Memory: "1Gi", Disks: []model.DiskSpec{{Name: "root", Image: "Quay.io/Fedora:latest"}}},
+		"dv bad url": {Name: "t6", CPU: 1, Memory: "1Gi", Disks: []model.DiskSpec{{Name: "root",
+			DataVolume: &model.DataVolumeSpec{Source: model.DataVolumeSourceRegistry, URL: "quay.io/a", Size: "1Gi"}}}},
+	}
+	for name, req := range cases {
+		if _, err := s.CreateTemplate(req); !errors.Is(err, ErrInvalidTemplate) {
+			t.Errorf("%s: err = %v, want ErrInvalidTemplate", name, err)
+		}
+	}
+
+	_, err := s.CreateTemplate(model.VMTemplateRequest{Name: "small", CPU: 1, Memory: "1Gi", Disks: []model.DiskSpec{{Name: "root", Image: "img"}}})
+	if !errors.Is(err, ErrTemplateExists) {
+		t.Errorf("duplicate template: err = %v", err)
+	}
+}
+
+func TestTemplateResolve(t *testing.T) {
+	s := setupTemplateTest(t)
+
+	resolved, err := s.Resolve(model.VMCreateRequest{
+		Name: "vm1", Namespace: "default", Template: "small", Memory: "2Gi", Labels: map[string]string{"team": "a"},
+	})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if resolved.CPU != 1 || resolved.Memory != "2Gi" || len(resolved.Disks) != 1 || len(resolved.Networks) != 1 {
+		t.Fatalf("unexpected resolved request: %+v", resolved)
+	}
+	if resolved.Labels["flavor"] != "small" || resolved.Labels["team"] != "a" {
+		t.Errorf("labels not merged: %v", resolved.Labels)
+	}
+
+	vm, err := model.NewKubeVirtVM(resolved)
+	if err != nil {
+		t.Fatalf("new vm: %v", err)
+	}
+	if got := vm.Spec.Template.Spec.Volumes[0].ContainerDisk.Image; got != "quay.io/containerdisks/fedora:latest" {
+		t.Errorf("boot disk image = %q", got)
+	}
+
+	_, err = s.Resolve(model.VMCreateRequest{Name: "vm2", Namespace: "default", Template: "small", CPU: 4})
+	if !errors.Is(err, ErrInvalidVMSpec) {
+		t.Errorf("override cpu: err = %v, want ErrInvalidVMSpec", err)
+	}
+	_, err = s.Resolve(model.VMCreateRequest{Name: "vm3", Namespace: "default", Template: "missing"})
+	if !errors.Is(err, ErrInvalidVMSpec) {
+		t.Errorf("missing template: err = %v, want ErrInvalidVMSpec", err)
+	}
+}
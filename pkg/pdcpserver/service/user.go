@@ -0,0 +1,163 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("user already exists")
+	ErrInvalidUser  = errors.New("invalid user")
+)
+
+var validRoles = []model.Role{model.RoleAdmin, model.RoleOperator, model.RoleViewer}
+
+// UserService 管理用户及其角色和可访问的namespace
+type UserService interface {
+	CreateUser(req model.UserRequest) (*model.UserInfo, error)
+	UpdateUser(name string, req model.UserRequest) (*model.UserInfo, error)
+	// DeleteUser 删除用户及其API Key
+	DeleteUser(name string) error
+	GetUser(name string) (*model.UserInfo, error)
+	ListUsers() (*model.UserListResponse, error)
+}
+
+type userService struct{}
+
+func NewUserService() UserService {
+	return &userService{}
+}
+
+func validateUserRequest(req model.UserRequest) error {
+	if errs := validation.IsDNS1123Subdomain(req.Name); len(errs) > 0 {
+		return fmt.Errorf("%w: invalid name %q: %s", ErrInvalidUser, req.Name, strings.Join(errs, "; "))
+	}
+	if !slices.Contains(validRoles, req.Role) {
+		return fmt.Errorf("%w: unsupported role %q", ErrInvalidUser, req.Role)
+	}
+	for _, ns := range req.Namespaces {
+		if ns == model.ALL_NAMESPACES {
+			continue
+		}
+		if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+			return fmt.Errorf("%w: invalid namespace %q: %s", ErrInvalidUser, ns, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+func newUserInfo(user model.User) model.UserInfo {
+	info := model.UserInfo{
+		Name:       user.Name,
+		Role:       user.Role,
+		Namespaces: user.Namespaces,
+		CreatedAt:  user.CreatedAt,
+		UpdatedAt:  user.UpdatedAt,
+	}
+	if info.Namespaces == nil {
+		info.Namespaces = []string{}
+	}
+	return info
+}
+
+func getUser(tx *gorm.DB, name string) (*model.User, error) {
+	var user model.User
+	err := tx.Where("name = ?", name).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *userService) CreateUser(req model.UserRequest) (*model.UserInfo, error) {
+	if err := validateUserRequest(req); err != nil {
+		return nil, err
+	}
+
+	user := model.User{Name: req.Name, Role: req.Role, Namespaces: req.Namespaces}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.User{}).Where("name = ?", req.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrUserExists
+		}
+		return tx.Create(&user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info := newUserInfo(user)
+	return &info, nil
+}
+
+func (s *userService) UpdateUser(name string, req model.UserRequest) (*model.UserInfo, error) {
+	req.Name = name
+	if err := validateUserRequest(req); err != nil {
+		return nil, err
+	}
+
+	var user *model.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = getUser(tx, name)
+		if err != nil {
+			return err
+		}
+		user.Role = req.Role
+		user.Namespaces = req.Namespaces
+		return tx.Save(user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info := newUserInfo(*user)
+	return &info, nil
+}
+
+func (s *userService) DeleteUser(name string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("name = ?", name).Delete(&model.User{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+		return tx.Where("kind = ? AND user_name = ?", model.APIKeyUser, name).Delete(&model.APIKey{}).Error
+	})
+}
+
+func (s *userService) GetUser(name string) (*model.UserInfo, error) {
+	user, err := getUser(database.DB, name)
+	if err != nil {
+		return nil, err
+	}
+	info := newUserInfo(*user)
+	return &info, nil
+}
+
+func (s *userService) ListUsers() (*model.UserListResponse, error) {
+	var users []model.User
+	if err := database.DB.Order("name asc").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	resp := &model.UserListResponse{Items: make([]model.UserInfo, 0, len(users))}
+	for _, user := range users {
+		resp.Items = append(resp.Items, newUserInfo(user))
+	}
+	return resp, nil
+}
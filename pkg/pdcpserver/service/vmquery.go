@@ -0,0 +1,249 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"pdcplet/pkg/kubevirt"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	k8sv1 "k8s.io/api/core/v1"
+	kubevirtv1 "kubevirt.io/api/core/v1"
+)
+
+const (
+	DEFAULT_VM_LIST_LIMIT = 50
+	DEFAULT_VM_SORT_BY    = "created_at"
+)
+
+var (
+	ErrVMNotFound      = errors.New("virtual machine not found")
+	ErrVMExists        = errors.New("virtual machine already exists")
+	ErrVMNotOperable   = errors.New("virtual machine is not operable in current status")
+	ErrInvalidVMSpec   = errors.New("invalid virtual machine spec")
+	ErrInvalidVMCursor = errors.New("invalid virtual machine list cursor")
+)
+
+// vmListCursor 基于(排序字段, id)的游标, 编码为base64 JSON返回给调用方
+type vmListCursor struct {
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+func encodeVMListCursor(sortBy string, vmr model.VirtualMachineRecord) string {
+	cursor := vmListCursor{ID: vmr.ID}
+	switch sortBy {
+	case "name":
+		cursor.Value = vmr.Name
+	case "status":
+		cursor.Value = string(vmr.Status)
+	default:
+		cursor.Value = vmr.CreatedAt.Format(time.RFC3339Nano)
+	}
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeVMListCursor(sortBy string, s string) (interface{}, uint, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, 0, ErrInvalidVMCursor
+	}
+	var cursor vmListCursor
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return nil, 0, ErrInvalidVMCursor
+	}
+	if sortBy != DEFAULT_VM_SORT_BY {
+		return cursor.Value, cursor.ID, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, cursor.Value)
+	if err != nil {
+		return nil, 0, ErrInvalidVMCursor
+	}
+	return t, cursor.ID, nil
+}
+
+func (s *service) ListVMs(req model.VMListRequest) (*model.VMListResponse, error) {
+	sortBy := req.SortBy
+	if sortBy == "" {
+		sortBy = DEFAULT_VM_SORT_BY
+	}
+	order := req.Order
+	if order == "" {
+		order = "desc"
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DEFAULT_VM_LIST_LIMIT
+	}
+
+	db := database.DB.Model(&model.VirtualMachineRecord{})
+	if req.Namespace != "" {
+		db = db.Where("namespace = ?", req.Namespace)
+	}
+	if req.Namespaces != nil {
+		db = db.Where("namespace IN ?", req.Namespaces)
+	}
+	if req.Status != "" {
+		db = db.Where("status = ?", req.Status)
+	}
+	if req.NamePrefix != "" {
+		db = db.Where("name LIKE ? ESCAPE '!'", escapeLike(req.NamePrefix)+"%")
+	}
+	if !req.CreatedAfter.IsZero() {
+		db = db.Where("created_at >= ?", req.CreatedAfter)
+	}
+	if !req.CreatedBefore.IsZero() {
+		db = db.Where("created_at < ?", req.CreatedBefore)
+	}
+
+	var total int64
+	if err := db.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	if req.Cursor != "" {
+		value, id, err := decodeVMListCursor(sortBy, req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		cmp := ">"
+		if order == "desc" {
+			cmp = "<"
+		}
+		db = db.Where(fmt.Sprintf("(%s %s ?) OR (%s = ? AND id %s ?)", sortBy, cmp, sortBy, cmp), value, value, id)
+	} else if req.Offset > 0 {
+		db = db.Offset(req.Offset)
+	}
+
+	var vmrs []model.VirtualMachineRecord
+	err := db.Order(sortBy + " " + order).Order("id " + order).Limit(limit + 1).Find(&vmrs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &model.VMListResponse{Total: total}
+	if len(vmrs) > limit {
+		vmrs = vmrs[:limit]
+		resp.NextCursor = encodeVMListCursor(sortBy, vmrs[limit-1])
+	}
+	resp.Items = make([]model.VMInfo, 0, len(vmrs))
+	for _, vmr := range vmrs {
+		info := newVMInfo(vmr)
+		if req.Live {
+			info.Live = getVMLiveStatus(vmr.Name, vmr.Namespace)
+		}
+		resp.Items = append(resp.Items, info)
+	}
+	return resp, nil
+}
+
+func (s *service) GetVM(name string, namespace string) (*model.VMInfo, error) {
+	var vmr model.VirtualMachineRecord
+	err := database.DB.Where("name = ? AND namespace = ?", name, namespace).Order("id desc").First(&vmr).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrVMNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var disks []model.VirtualMachineDisk
+	if err := database.DB.Where("virtual_machine_record_id = ?", vmr.ID).Order("id asc").Find(&disks).Error; err != nil {
+		return nil, err
+	}
+
+	var ifaces []model.VirtualMachineInterface
+	if err := database.DB.Where("virtual_machine_record_id = ?", vmr.ID).Order("id asc").Find(&ifaces).Error; err != nil {
+		return nil, err
+	}
+
+	info := newVMInfo(vmr)
+	for _, disk := range disks {
+		info.Disks = append(info.Disks, model.NewDiskInfo(disk))
+	}
+	for _, iface := range ifaces {
+		info.Interfaces = append(info.Interfaces, model.NewInterfaceInfo(iface))
+	}
+	info.Live = getVMLiveStatus(vmr.Name, vmr.Namespace)
+	return &info, nil
+}
+
+func newVMInfo(vmr model.VirtualMachineRecord) model.VMInfo {
+	info := model.VMInfo{
+		Name:               vmr.Name,
+		Namespace:          vmr.Namespace,
+		CPU:                vmr.CPU,
+		Memory:             vmr.Memory,
+		Template:           vmr.Template,
+		Owner:              vmr.Owner,
+		Status:             vmr.Status,
+		Phase:              vmr.Phase,
+		NodeName:           vmr.NodeName,
+		Ready:              vmr.Ready,
+		LastError:          vmr.LastError,
+		CreatedAt:          vmr.CreatedAt,
+		UpdatedAt:          vmr.UpdatedAt,
+		LastTransitionTime: vmr.LastTransitionTime,
+	}
+	if vmr.IPs != "" {
+		info.IPs = strings.Split(vmr.IPs, ",")
+	}
+	return info
+}
+
+// getVMLiveStatus 从KubeVirt读取VM和VMI的实时状态, 失败时记录在Error字段中
+func getVMLiveStatus(name string, namespace string) *model.VMLiveStatus {
+	live := &model.VMLiveStatus{}
+	vm, err := kubevirt.GetVM(name, namespace)
+	if err != nil {
+		live.Error = err.Error()
+		return live
+	}
+	live.PrintableStatus = string(vm.Status.PrintableStatus)
+	live.Ready = vm.Status.Ready
+
+	if !vm.Status.Created {
+		return live
+	}
+	vmi, err := kubevirt.GetVMI(name, namespace)
+	if err != nil {
+		live.Error = err.Error()
+		return live
+	}
+	fillVMILiveStatus(live, vmi)
+	return live
+}
+
+func fillVMILiveStatus(live *model.VMLiveStatus, vmi *kubevirtv1.VirtualMachineInstance) {
+	live.Phase = string(vmi.Status.Phase)
+	live.NodeName = vmi.Status.NodeName
+	for _, iface := range vmi.Status.Interfaces {
+		if len(iface.IPs) > 0 {
+			live.IPs = append(live.IPs, iface.IPs...)
+		} else if iface.IP != "" {
+			live.IPs = append(live.IPs, iface.IP)
+		}
+	}
+	for _, cond := range vmi.Status.Conditions {
+		if cond.Type == kubevirtv1.VirtualMachineInstanceReady {
+			live.Ready = cond.Status == k8sv1.ConditionTrue
+		}
+	}
+}
+
+// escapeLike 转义LIKE中的通配符. 反斜杠在MySQL的字符串字面量中是转义符, 因此使用!作为转义字符
+func escapeLike(s string) string {
+	out := make([]rune, 0, len(s))
+	for _, r := range s {
+		if r == '%' || r == '_' || r == '!' {
+			out = append(out, '!')
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
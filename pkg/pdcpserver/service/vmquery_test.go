@@ -0,0 +1,147 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestVMListCursor(t *testing.T) {
+	createdAt := time.Date(2026, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	vmr := model.VirtualMachineRecord{ID: 42, Name: "vm1", Status: model.Running}
+	vmr.CreatedAt = createdAt
+	tests := []struct {
+		sortBy string
+		want   interface{}
+	}{
+		{sortBy: "name", want: "vm1"},
+		{sortBy: "status", want: string(model.Running)},
+		{sortBy: DEFAULT_VM_SORT_BY, want: createdAt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sortBy, func(t *testing.T) {
+			value, id, err := decodeVMListCursor(tt.sortBy, encodeVMListCursor(tt.sortBy, vmr))
+			if err != nil || id != 42 || value != tt.want {
+				t.Fatalf("decode = %v, %d, %v, want %v", value, id, err, tt.want)
+			}
+		})
+	}
+
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	invalid := []struct {
+		name   string
+		sortBy string
+		cursor string
+	}{
+		{name: "not base64", sortBy: "name", cursor: "!!!"},
+		{name: "not json", sortBy: "name", cursor: encode("vm1")},
+		{name: "wrong id type", sortBy: "name", cursor: encode(`{"v":"vm1","id":"1"}`)},
+		// 按名称排序的游标不能用于按创建时间排序
+		{name: "sort changed", sortBy: DEFAULT_VM_SORT_BY, cursor: encodeVMListCursor("name", vmr)},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeVMListCursor(tt.sortBy, tt.cursor); !errors.Is(err, ErrInvalidVMCursor) {
+				t.Fatalf("err = %v, want ErrInvalidVMCursor", err)
+			}
+		})
+	}
+}
+
+func TestListVMsPages(t *testing.T) {
+	s := setupServiceTest(t)
+	base := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	// vm3和vm4的创建时间相同, 状态重复出现, 翻页时按id区分
+	records := []struct {
+		name      string
+		namespace string
+		status    model.VirtualMachineStatus
+		offset    time.Duration
+	}{
+		{"vm0", "default", model.Running, 0},
+		{"vm1", "default", model.Stopped, time.Minute},
+		{"vm2", "team-a", model.Running, 2 * time.Minute},
+		{"vm3", "default", model.Pending, 3 * time.Minute},
+		{"vm4", "default", model.Running, 3 * time.Minute},
+		{"vm5", "team-a", model.Stopped, 5 * time.Minute},
+		{"vm6", "default", model.Pending, 6 * time.Minute},
+	}
+	for _, r := range records {
+		vmr := model.VirtualMachineRecord{Name: r.name, Namespace: r.namespace, CPU: 1, Memory: "1Gi", Status: r.status}
+		vmr.CreatedAt = base.Add(r.offset)
+		if err := database.DB.Create(&vmr).Error; err != nil {
+			t.Fatalf("create record: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		req   model.VMListRequest
+		want  []string
+		pages int
+	}{
+		{name: "default newest first", req: model.VMListRequest{Limit: 3},
+			want: []string{"vm6", "vm5", "vm4", "vm3", "vm2", "vm1", "vm0"}, pages: 3},
+		{name: "created_at asc with equal values", req: model.VMListRequest{Order: "asc", Limit: 2},
+			want: []string{"vm0", "vm1", "vm2", "vm3", "vm4", "vm5", "vm6"}, pages: 4},
+		{name: "name desc", req: model.VMListRequest{SortBy: "name", Limit: 4},
+			want: []string{"vm6", "vm5", "vm4", "vm3", "vm2", "vm1", "vm0"}, pages: 2},
+		{name: "status asc", req: model.VMListRequest{SortBy: "status", Order: "asc", Limit: 2},
+			want: []string{"vm3", "vm6", "vm0", "vm2", "vm4", "vm1", "vm5"}, pages: 4},
+		{name: "status desc", req: model.VMListRequest{SortBy: "status", Limit: 1},
+			want: []string{"vm5", "vm1", "vm4", "vm2", "vm0", "vm6", "vm3"}, pages: 7},
+		// 记录数恰好等于limit时没有下一页
+		{name: "single full page", req: model.VMListRequest{Limit: 7},
+			want: []string{"vm6", "vm5", "vm4", "vm3", "vm2", "vm1", "vm0"}, pages: 1},
+		{name: "default limit", req: model.VMListRequest{SortBy: "name", Order: "asc"},
+			want: []string{"vm0", "vm1", "vm2", "vm3", "vm4", "vm5", "vm6"}, pages: 1},
+		{name: "namespace", req: model.VMListRequest{Namespace: "team-a", SortBy: "name", Order: "asc", Limit: 1},
+			want: []string{"vm2", "vm5"}, pages: 2},
+		{name: "status filter", req: model.VMListRequest{Status: string(model.Running), SortBy: "name", Order: "asc", Limit: 2},
+			want: []string{"vm0", "vm2", "vm4"}, pages: 2},
+		{name: "empty", req: model.VMListRequest{Namespace: "none", Limit: 2}, want: []string{}, pages: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			got := []string{}
+			pages := 0
+			for {
+				resp, err := s.ListVMs(req)
+				if err != nil {
+					t.Fatalf("list page %d: %v", pages, err)
+				}
+				pages++
+				if resp.Total != int64(len(tt.want)) {
+					t.Fatalf("total = %d, want %d", resp.Total, len(tt.want))
+				}
+				for _, item := range resp.Items {
+					got = append(got, item.Name)
+				}
+				if resp.NextCursor == "" {
+					break
+				}
+				if len(resp.Items) != req.Limit || pages > len(records) {
+					t.Fatalf("page %d has %d items with a next cursor", pages, len(resp.Items))
+				}
+				req.Cursor = resp.NextCursor
+			}
+			if !slices.Equal(got, tt.want) || pages != tt.pages {
+				t.Fatalf("names = %v in %d pages, want %v in %d pages", got, pages, tt.want, tt.pages)
+			}
+		})
+	}
+
+	resp, err := s.ListVMs(model.VMListRequest{SortBy: "name", Order: "asc", Limit: 2, Offset: 5})
+	if err != nil || len(resp.Items) != 2 || resp.Items[0].Name != "vm5" || resp.NextCursor != "" {
+		t.Fatalf("offset page = %+v, %v", resp, err)
+	}
+	_, err = s.ListVMs(model.VMListRequest{Cursor: "bogus"})
+	if !errors.Is(err, ErrInvalidVMCursor) {
+		t.Fatalf("invalid cursor: err = %v", err)
+	}
+}
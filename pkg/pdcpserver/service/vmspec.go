@@ -0,0 +1,266 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"pdcplet/pkg/pdcpserver/model"
+	"regexp"
+	"slices"
+	"strings"
+
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const MAX_IMAGE_LENGTH = 512
+
+var validDiskBuses = []string{"", model.DiskBusVirtio, model.DiskBusSata, model.DiskBusScsi}
+
+var validDataVolumeSources = []string{model.DataVolumeSourceHTTP, model.DataVolumeSourceRegistry,
+	model.DataVolumeSourcePVC, model.DataVolumeSourceBlank, model.DataVolumeSourceRetained}
+
+var validAccessModes = []string{"", string(k8sv1.ReadWriteOnce), string(k8sv1.ReadWriteMany), string(k8sv1.ReadOnlyMany)}
+
+var validRetentions = []string{"", model.RetentionDelete, model.RetentionRetain}
+
+var validNetworkTypes = []string{"", model.NetworkTypePod, model.NetworkTypeMultus}
+
+var validNetworkBindings = []string{"", model.NetworkBindingMasquerade, model.NetworkBindingBridge, model.NetworkBindingSRIOV}
+
+// ValidateVMCreateRequest 校验创建请求中无法由binding校验的字段, 引用模板的请求需要先经过TemplateService.Resolve
+func ValidateVMCreateRequest(req model.VMCreateRequest) error {
+	if errs := validation.IsDNS1123Label(req.Name); len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidVMSpec, &model.FieldError{Field: "name", Message: strings.Join(errs, "; ")})
+	}
+	if errs := validation.IsDNS1123Label(req.Namespace); len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidVMSpec, &model.FieldError{Field: "namespace", Message: strings.Join(errs, "; ")})
+	}
+	if req.Image != "" && len(req.Disks) > 0 {
+		return fmt.Errorf("%w: image and disks are mutually exclusive", ErrInvalidVMSpec)
+	}
+	if req.Image != "" {
+		if err := validateImage("image", req.Image); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidVMSpec, err)
+		}
+	}
+	err := validateVMSpec(req.CPU, req.Memory, req.DiskSpecs(), req.Networks, req.CloudInit, req.Labels)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidVMSpec, err)
+	}
+	for _, disk := range req.Disks {
+		if disk.DataVolume == nil {
+			continue
+		}
+		name := model.DataVolumeName(req.Name, disk.Name)
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return fmt.Errorf("%w: invalid data volume name %q: %s", ErrInvalidVMSpec, name, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// validateVMSpec 校验VM与模板共用的字段, 保证NewKubeVirtVM不会因为非法输入panic
+func validateVMSpec(cpu int, memory string, disks []model.DiskSpec, networks []model.NetworkSpec,
+	cloudInit *model.CloudInitSpec, labels map[string]string) error {
+
+	if cpu < 1 {
+		return &model.FieldError{Field: "cpu", Message: "must be at least 1"}
+	}
+	quantity, err := resource.ParseQuantity(memory)
+	if err != nil || quantity.Sign() <= 0 {
+		return &model.FieldError{Field: "memory", Message: fmt.Sprintf("invalid quantity %q, such as 2Gi", memory)}
+	}
+
+	if len(disks) == 0 {
+		return errors.New("at least one disk is required")
+	}
+	names := make(map[string]bool)
+	for i, disk := range disks {
+		if errs := validation.IsDNS1123Label(disk.Name); len(errs) > 0 {
+			return fmt.Errorf("invalid disk name %q: %s", disk.Name, strings.Join(errs, "; "))
+		}
+		if names[disk.Name] || disk.Name == model.CLOUD_INIT_DISK_NAME {
+			return fmt.Errorf("duplicate or reserved disk name %q", disk.Name)
+		}
+		names[disk.Name] = true
+		if !slices.Contains(validDiskBuses, disk.Bus) {
+			return fmt.Errorf("unsupported bus %q of disk %q", disk.Bus, disk.Name)
+		}
+		if (disk.Image == "") == (disk.DataVolume == nil) {
+			return fmt.Errorf("disk %q must have exactly one of image and dataVolume", disk.Name)
+		}
+		if disk.Image != "" {
+			if err := validateImage(fmt.Sprintf("disks[%d].image", i), disk.Image); err != nil {
+				return err
+			}
+		}
+		if disk.DataVolume != nil {
+			if err := validateDataVolume(disk.DataVolume); err != nil {
+				return fmt.Errorf("invalid dataVolume of disk %q: %v", disk.Name, err)
+			}
+		}
+	}
+
+	names = make(map[string]bool)
+	podNetworks := 0
+	macs := make(map[string]bool)
+	for _, network := range networks {
+		if errs := validation.IsDNS1123Label(network.Name); len(errs) > 0 {
+			return fmt.Errorf("invalid network name %q: %s", network.Name, strings.Join(errs, "; "))
+		}
+		if names[network.Name] {
+			return fmt.Errorf("duplicate network name %q", network.Name)
+		}
+		names[network.Name] = true
+		if err := validateNetwork(network); err != nil {
+			return fmt.Errorf("invalid network %q: %v", network.Name, err)
+		}
+		if network.NetworkType() == model.NetworkTypePod {
+			if podNetworks++; podNetworks > 1 {
+				return errors.New("at most one pod network is allowed")
+			}
+		}
+		if network.MacAddress != "" {
+			hw, _ := net.ParseMAC(network.MacAddress)
+			mac := hw.String()
+			if macs[mac] {
+				return fmt.Errorf("duplicate mac address %q", network.MacAddress)
+			}
+			macs[mac] = true
+		}
+	}
+
+	if cloudInit != nil {
+		if cloudInit.UserData == "" && cloudInit.NetworkData == "" && len(cloudInit.SSHAuthorizedKeys) == 0 {
+			return errors.New("cloudInit has neither userData, networkData nor sshAuthorizedKeys")
+		}
+		if _, err := model.RenderCloudInit(cloudInit); err != nil {
+			return fmt.Errorf("invalid cloudInit: %v", err)
+		}
+	}
+
+	for k, v := range labels {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return fmt.Errorf("invalid label key %q: %s", k, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			return fmt.Errorf("invalid value of label %q: %s", k, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+// imagePattern 容器镜像引用: [registry[:port]/]path[:tag][@digest], path各段为小写字母和数字
+var imagePattern = regexp.MustCompile(`^(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*(?::[0-9]+)?/)?` +
+	`[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*` +
+	`(?::[A-Za-z0-9_][A-Za-z0-9_.-]{0,127})?(?:@sha256:[a-f0-9]{64})?$`)
+
+// validateImage 校验containerDisk镜像, 避免非法镜像在KubeVirt中拉取失败后才被发现
+func validateImage(field string, image string) error {
+	if len(image) > MAX_IMAGE_LENGTH || !imagePattern.MatchString(image) {
+		return &model.FieldError{Field: field, Message: fmt.Sprintf("invalid image reference %q", image)}
+	}
+	return nil
+}
+
+func validateDataVolume(dv *model.DataVolumeSpec) error {
+	if !slices.Contains(validDataVolumeSources, dv.Source) {
+		return fmt.Errorf("unsupported source %q, supported: %s", dv.Source, strings.Join(validDataVolumeSources, ", "))
+	}
+	if dv.Source == model.DataVolumeSourceRetained {
+		// 大小、StorageClass等沿用保留的DataVolume
+		if dv.URL != "" || dv.PVCName != "" || dv.PVCNamespace != "" || dv.Size != "" || dv.StorageClass != "" || dv.AccessMode != "" {
+			return errors.New("retained source only allows retention")
+		}
+		if !slices.Contains(validRetentions, dv.Retention) {
+			return fmt.Errorf("unsupported retention %q", dv.Retention)
+		}
+		return nil
+	}
+	switch dv.Source {
+	case model.DataVolumeSourceHTTP:
+		if !strings.HasPrefix(dv.URL, "http://") && !strings.HasPrefix(dv.URL, "https://") {
+			return fmt.Errorf("invalid http url %q", dv.URL)
+		}
+	case model.DataVolumeSourceRegistry:
+		if !strings.HasPrefix(dv.URL, "docker://") && !strings.HasPrefix(dv.URL, "oci-archive://") {
+			return fmt.Errorf("invalid registry url %q", dv.URL)
+		}
+	case model.DataVolumeSourcePVC:
+		if errs := validation.IsDNS1123Subdomain(dv.PVCName); len(errs) > 0 {
+			return fmt.Errorf("invalid pvcName %q: %s", dv.PVCName, strings.Join(errs, "; "))
+		}
+	}
+	if dv.Source != model.DataVolumeSourcePVC && (dv.PVCName != "" || dv.PVCNamespace != "") {
+		return errors.New("pvcName and pvcNamespace are only allowed for pvc source")
+	}
+
+	size, err := resource.ParseQuantity(dv.Size)
+	if err != nil || size.Sign() <= 0 {
+		return fmt.Errorf("invalid size %q", dv.Size)
+	}
+	if dv.StorageClass != "" {
+		if errs := validation.IsDNS1123Subdomain(dv.StorageClass); len(errs) > 0 {
+			return fmt.Errorf("invalid storageClass %q: %s", dv.StorageClass, strings.Join(errs, "; "))
+		}
+	}
+	if !slices.Contains(validAccessModes, dv.AccessMode) {
+		return fmt.Errorf("unsupported accessMode %q", dv.AccessMode)
+	}
+	if !slices.Contains(validRetentions, dv.Retention) {
+		return fmt.Errorf("unsupported retention %q", dv.Retention)
+	}
+	return nil
+}
+
+func validateNetwork(n model.NetworkSpec) error {
+	if !slices.Contains(validNetworkTypes, n.Type) {
+		return fmt.Errorf("unsupported type %q", n.Type)
+	}
+	if !slices.Contains(validNetworkBindings, n.Binding) {
+		return fmt.Errorf("unsupported binding %q", n.Binding)
+	}
+
+	switch n.NetworkType() {
+	case model.NetworkTypePod:
+		if n.NetworkName != "" {
+			return errors.New("networkName is only allowed for multus network")
+		}
+		if n.BindingMethod() == model.NetworkBindingSRIOV {
+			return errors.New("sriov binding requires a multus network")
+		}
+	case model.NetworkTypeMultus:
+		if n.NetworkName == "" {
+			return errors.New("multus network requires networkName")
+		}
+		name := n.NetworkName
+		if namespace, rest, found := strings.Cut(name, "/"); found {
+			if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+				return fmt.Errorf("invalid networkName %q: %s", n.NetworkName, strings.Join(errs, "; "))
+			}
+			name = rest
+		}
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return fmt.Errorf("invalid networkName %q: %s", n.NetworkName, strings.Join(errs, "; "))
+		}
+		if n.BindingMethod() == model.NetworkBindingMasquerade {
+			return errors.New("masquerade binding is only allowed for pod network")
+		}
+	}
+
+	if n.MacAddress != "" {
+		hw, err := net.ParseMAC(n.MacAddress)
+		if err != nil || len(hw) != 6 {
+			return fmt.Errorf("invalid macAddress %q", n.MacAddress)
+		}
+	}
+	if n.VlanID < 0 || n.VlanID > 4094 {
+		return fmt.Errorf("vlanId %d out of range 0-4094", n.VlanID)
+	}
+	if n.VlanID > 0 && n.NetworkType() != model.NetworkTypeMultus {
+		return errors.New("vlanId is only allowed for multus network")
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+	"pdcplet/pkg/pdcpserver/model"
+	"strings"
+	"testing"
+)
+
+func TestValidateVMCreateRequest(t *testing.T) {
+	valid := model.VMCreateRequest{Name: "vm1", Namespace: "default", CPU: 1, Memory: "1Gi",
+		Image: "quay.io/containerdisks/fedora:40@sha256:" + strings.Repeat("a", 64)}
+	if err := ValidateVMCreateRequest(valid); err != nil {
+		t.Fatalf("valid request: %v", err)
+	}
+	for _, image := range []string{"cirros", "localhost:5000/vm/cirros:0.6.2", "docker.io/library/ubuntu_22.04"} {
+		req := valid
+		req.Image = image
+		if err := ValidateVMCreateRequest(req); err != nil {
+			t.Errorf("image %q: %v", image, err)
+		}
+	}
+
+	cases := []struct {
+		name  string
+		edit  func(req *model.VMCreateRequest)
+		field string
+	}{
+		{"upper case name", func(req *model.VMCreateRequest) { req.Name = "VM1" }, "name"},
+		{"empty namespace", func(req *model.VMCreateRequest) { req.Namespace = "" }, "namespace"},
+		{"bad memory", func(req *model.VMCreateRequest) { req.Memory = "2GB" }, "memory"},
+		{"negative memory", func(req *model.VMCreateRequest) { req.Memory = "-1Gi" }, "memory"},
+		{"no cpu", func(req *model.VMCreateRequest) { req.CPU = 0 }, "cpu"},
+		{"bad image", func(req *model.VMCreateRequest) { req.Image = "quay.io/Fedora:latest" }, "image"},
+		{"image with scheme", func(req *model.VMCreateRequest) { req.Image = "docker://cirros" }, "image"},
+		{"bad disk image", func(req *model.VMCreateRequest) {
+			req.Image = ""
+			req.Disks = []model.DiskSpec{{Name: "root", Image: "cirros"}, {Name: "data", Image: "cirros:"}}
+		}, "disks[1].image"},
+	}
+	for _, c := range cases {
+		req := valid
+		c.edit(&req)
+		err := ValidateVMCreateRequest(req)
+		var fieldErr *model.FieldError
+		if !errors.Is(err, ErrInvalidVMSpec) || !errors.As(err, &fieldErr) || fieldErr.Field != c.field {
+			t.Errorf("%s: err = %v, want ErrInvalidVMSpec on field %s", c.name, err, c.field)
+		}
+	}
+}
@@ -0,0 +1,664 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"pdcplet/pkg/metrics"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	DEFAULT_WEBHOOK_WORKERS        = 4
+	DEFAULT_WEBHOOK_TIMEOUT        = 10 * time.Second
+	DEFAULT_WEBHOOK_MAX_ATTEMPTS   = 8
+	DEFAULT_WEBHOOK_RETRY_BACKOFF  = 10 * time.Second
+	DEFAULT_WEBHOOK_POLL_INTERVAL  = 5 * time.Second
+	DEFAULT_WEBHOOK_RETENTION      = 168 * time.Hour
+	DEFAULT_WEBHOOK_DELIVERY_LIMIT = 100
+	MAX_WEBHOOK_RETRY_BACKOFF      = time.Hour
+	MAX_WEBHOOK_URL_LENGTH         = 2048
+	MAX_WEBHOOK_ERROR_LENGTH       = 1024 // 与投递记录中错误信息列的长度一致
+	MAX_WEBHOOK_SECRET_LENGTH      = 256
+	WEBHOOK_DELIVERY_BATCH         = 100
+	WEBHOOK_PURGE_INTERVAL         = 10 * time.Minute
+	WEBHOOK_RESPONSE_SNIPPET       = 256 // 错误信息中保留的响应内容长度
+)
+
+// 投递请求的头, 签名为HMAC-SHA256(secret, "<timestamp>.<body>")
+const (
+	HEADER_WEBHOOK_EVENT     = "X-Pdcp-Event"
+	HEADER_WEBHOOK_DELIVERY  = "X-Pdcp-Delivery"
+	HEADER_WEBHOOK_TIMESTAMP = "X-Pdcp-Timestamp"
+)
+
+var (
+	ErrWebhookNotFound = errors.New("webhook not found")
+	ErrWebhookExists   = errors.New("webhook already exists")
+	ErrInvalidWebhook  = errors.New("invalid webhook")
+)
+
+// WebhookService 管理Webhook订阅, 将事件投递到订阅的URL并记录投递结果
+type WebhookService interface {
+	CreateWebhook(req model.WebhookRequest) (*model.WebhookCreateResponse, error)
+	UpdateWebhook(name string, req model.WebhookRequest) (*model.WebhookInfo, error)
+	DeleteWebhook(name string) error
+	GetWebhook(name string) (*model.WebhookInfo, error)
+	ListWebhooks() (*model.WebhookListResponse, error)
+	ListDeliveries(name string, req model.WebhookDeliveryQuery) (*model.WebhookDeliveryListResponse, error)
+	// Run 订阅事件并投递到期的记录, 直到ctx结束
+	Run(ctx context.Context)
+}
+
+type webhookService struct {
+	cfg    config.WebhooksConfig
+	client *http.Client
+	cipher *webhookCipher
+	wake   chan struct{}
+}
+
+func NewWebhookService(cfg config.WebhooksConfig) WebhookService {
+	if cfg.Workers <= 0 {
+		cfg.Workers = DEFAULT_WEBHOOK_WORKERS
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DEFAULT_WEBHOOK_TIMEOUT
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DEFAULT_WEBHOOK_MAX_ATTEMPTS
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DEFAULT_WEBHOOK_RETRY_BACKOFF
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DEFAULT_WEBHOOK_POLL_INTERVAL
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = DEFAULT_WEBHOOK_RETENTION
+	}
+	return &webhookService{
+		cfg: cfg,
+		// 不跟随重定向, 避免签名的请求被转发到订阅时未指定的地址, 3xx视为接收方拒绝
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		cipher: newWebhookCipher(cfg.SecretKey),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+func validateWebhookRequest(req model.WebhookRequest) error {
+	if errs := validation.IsDNS1123Label(req.Name); len(errs) > 0 {
+		return fmt.Errorf("%w: invalid name %q: %s", ErrInvalidWebhook, req.Name, strings.Join(errs, "; "))
+	}
+	if len(req.Description) > MAX_DESCRIPTION_LENGTH {
+		return fmt.Errorf("%w: description must be at most %d bytes", ErrInvalidWebhook, MAX_DESCRIPTION_LENGTH)
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(req.URL) > MAX_WEBHOOK_URL_LENGTH {
+		return fmt.Errorf("%w: url must be an absolute http(s) url of at most %d bytes", ErrInvalidWebhook, MAX_WEBHOOK_URL_LENGTH)
+	}
+	if len(req.Secret) > MAX_WEBHOOK_SECRET_LENGTH {
+		return fmt.Errorf("%w: secret must be at most %d bytes", ErrInvalidWebhook, MAX_WEBHOOK_SECRET_LENGTH)
+	}
+	for _, typ := range req.EventTypes {
+		if !slices.Contains(model.EventTypes, typ) {
+			return fmt.Errorf("%w: unsupported event type %q", ErrInvalidWebhook, typ)
+		}
+	}
+	if req.Namespace != "" {
+		if errs := validation.IsDNS1123Label(req.Namespace); len(errs) > 0 {
+			return fmt.Errorf("%w: invalid namespace %q", ErrInvalidWebhook, req.Namespace)
+		}
+	}
+	return nil
+}
+
+func applyWebhookRequest(webhook *model.Webhook, req model.WebhookRequest) {
+	webhook.URL = req.URL
+	webhook.Description = req.Description
+	webhook.EventTypes = req.EventTypes
+	webhook.Namespace = req.Namespace
+	webhook.Enabled = req.Enabled == nil || *req.Enabled
+}
+
+func newWebhookInfo(webhook model.Webhook) model.WebhookInfo {
+	info := model.WebhookInfo{
+		Name:        webhook.Name,
+		URL:         webhook.URL,
+		Description: webhook.Description,
+		EventTypes:  webhook.EventTypes,
+		Namespace:   webhook.Namespace,
+		Enabled:     webhook.Enabled,
+		CreatedAt:   webhook.CreatedAt,
+		UpdatedAt:   webhook.UpdatedAt,
+	}
+	if info.EventTypes == nil {
+		info.EventTypes = []model.EventType{}
+	}
+	return info
+}
+
+func getWebhook(tx *gorm.DB, name string) (*model.Webhook, error) {
+	var webhook model.Webhook
+	err := tx.Where("name = ?", name).First(&webhook).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrWebhookNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (s *webhookService) CreateWebhook(req model.WebhookRequest) (*model.WebhookCreateResponse, error) {
+	if err := validateWebhookRequest(req); err != nil {
+		return nil, err
+	}
+
+	webhook := model.Webhook{Name: req.Name}
+	applyWebhookRequest(&webhook, req)
+	secret, generated := req.Secret, ""
+	if secret == "" {
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		generated = base64.RawURLEncoding.EncodeToString(random)
+		secret = generated
+	}
+	var err error
+	if webhook.Secret, err = s.cipher.encrypt(secret); err != nil {
+		return nil, err
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.Webhook{}).Where("name = ?", req.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrWebhookExists
+		}
+		return tx.Create(&webhook).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.WebhookCreateResponse{WebhookInfo: newWebhookInfo(webhook), Secret: generated}, nil
+}
+
+func (s *webhookService) UpdateWebhook(name string, req model.WebhookRequest) (*model.WebhookInfo, error) {
+	req.Name = name
+	if err := validateWebhookRequest(req); err != nil {
+		return nil, err
+	}
+
+	var secret string
+	if req.Secret != "" {
+		var err error
+		if secret, err = s.cipher.encrypt(req.Secret); err != nil {
+			return nil, err
+		}
+	}
+	var webhook *model.Webhook
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		webhook, err = getWebhook(tx, name)
+		if err != nil {
+			return err
+		}
+		applyWebhookRequest(webhook, req)
+		if secret != "" {
+			webhook.Secret = secret
+		}
+		return tx.Save(webhook).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info := newWebhookInfo(*webhook)
+	return &info, nil
+}
+
+// DeleteWebhook 删除Webhook及其投递记录, 未完成的投递不再进行
+func (s *webhookService) DeleteWebhook(name string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		webhook, err := getWebhook(tx, name)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("webhook_id = ?", webhook.ID).Delete(&model.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(webhook).Error
+	})
+}
+
+func (s *webhookService) GetWebhook(name string) (*model.WebhookInfo, error) {
+	webhook, err := getWebhook(database.DB, name)
+	if err != nil {
+		return nil, err
+	}
+	info := newWebhookInfo(*webhook)
+	return &info, nil
+}
+
+func (s *webhookService) ListWebhooks() (*model.WebhookListResponse, error) {
+	var webhooks []model.Webhook
+	if err := database.DB.Order("name asc").Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	resp := &model.WebhookListResponse{Items: make([]model.WebhookInfo, 0, len(webhooks))}
+	for _, webhook := range webhooks {
+		resp.Items = append(resp.Items, newWebhookInfo(webhook))
+	}
+	return resp, nil
+}
+
+func newWebhookDeliveryInfo(delivery model.WebhookDelivery) model.WebhookDeliveryInfo {
+	return model.WebhookDeliveryInfo{
+		ID:            delivery.ID,
+		EventID:       delivery.EventID,
+		EventType:     delivery.EventType,
+		Status:        delivery.Status,
+		Attempts:      delivery.Attempts,
+		StatusCode:    delivery.StatusCode,
+		Error:         delivery.Error,
+		DurationMs:    delivery.DurationMs,
+		NextAttemptAt: delivery.NextAttemptAt,
+		DeliveredAt:   delivery.DeliveredAt,
+		CreatedAt:     delivery.CreatedAt,
+	}
+}
+
+func (s *webhookService) ListDeliveries(name string, req model.WebhookDeliveryQuery) (*model.WebhookDeliveryListResponse, error) {
+	webhook, err := getWebhook(database.DB, name)
+	if err != nil {
+		return nil, err
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DEFAULT_WEBHOOK_DELIVERY_LIMIT
+	}
+
+	query := database.DB.Where("webhook_id = ?", webhook.ID)
+	if req.Status != "" {
+		query = query.Where("status = ?", req.Status)
+	}
+	if req.Cursor != "" {
+		cursor, err := strconv.ParseUint(req.Cursor, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid cursor %q", ErrInvalidWebhook, req.Cursor)
+		}
+		query = query.Where("id < ?", cursor)
+	}
+
+	// 多查一条用于判断是否还有下一页
+	var deliveries []model.WebhookDelivery
+	if err := query.Order("id desc").Limit(limit + 1).Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	resp := &model.WebhookDeliveryListResponse{Items: make([]model.WebhookDeliveryInfo, 0, min(len(deliveries), limit))}
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+		resp.NextCursor = strconv.FormatUint(uint64(deliveries[limit-1].ID), 10)
+	}
+	for _, delivery := range deliveries {
+		resp.Items = append(resp.Items, newWebhookDeliveryInfo(delivery))
+	}
+	return resp, nil
+}
+
+func (s *webhookService) Run(ctx context.Context) {
+	if err := s.cipher.encryptLegacySecrets(); err != nil {
+		slog.Error("Failed to encrypt webhook secrets", "error", err)
+	}
+	lastID, err := dispatchCursor()
+	if err != nil {
+		slog.Error("Failed to load webhook dispatch cursor, webhooks disabled", "error", err)
+		return
+	}
+	go s.dispatch(ctx, lastID)
+
+	slog.Info("Webhook workers started", "workers", s.cfg.Workers)
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+	lastPurge := time.Time{}
+	for {
+		now := time.Now()
+		if now.Sub(lastPurge) >= WEBHOOK_PURGE_INTERVAL {
+			if err := s.purge(now); err != nil {
+				slog.Error("Failed to purge webhook deliveries", "error", err)
+			}
+			lastPurge = now
+		}
+		if err := s.deliverDue(ctx, now); err != nil {
+			slog.Error("Failed to deliver webhooks", "error", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// dispatchCursor 返回最后一个已生成投递记录的事件ID. 首次启动时从最新事件开始, 不为之前的事件生成投递记录
+func dispatchCursor() (uint, error) {
+	var cursor model.WebhookDispatchCursor
+	err := database.DB.Where("id = ?", 1).First(&cursor).Error
+	if err == nil {
+		return cursor.LastEventID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+	lastID, err := latestEventID()
+	if err != nil {
+		return 0, err
+	}
+	cursor = model.WebhookDispatchCursor{ID: 1, LastEventID: lastID}
+	if err := database.DB.Create(&cursor).Error; err != nil {
+		return 0, err
+	}
+	return lastID, nil
+}
+
+// dispatch 为每个新事件生成投递记录. 订阅因处理过慢被关闭时从最后处理的事件续传
+func (s *webhookService) dispatch(ctx context.Context, lastID uint) {
+	for ctx.Err() == nil {
+		// 游标为0时没有处理过任何事件, 之后发布的事件都需要投递
+		subscription := subscribeEventsAfter(model.EventStreamRequest{}, lastID)
+		lastID = s.consume(ctx, subscription, lastID)
+		subscription.Close()
+	}
+}
+
+// consume 先分批处理Backlog, 再处理新发布的事件, 返回最后处理的事件ID
+func (s *webhookService) consume(ctx context.Context, subscription *EventSubscription, lastID uint) uint {
+	for {
+		backlog, err := subscription.NextBacklog()
+		if err != nil {
+			slog.Error("Failed to read events for webhooks", "lastEventId", lastID, "error", err)
+			select {
+			case <-time.After(s.cfg.PollInterval):
+			case <-ctx.Done():
+			}
+			return lastID
+		}
+		if len(backlog) == 0 {
+			break
+		}
+		for _, info := range backlog {
+			if !s.enqueueWithRetry(ctx, info) {
+				return lastID
+			}
+			lastID = info.ID
+		}
+	}
+	for {
+		select {
+		case info, ok := <-subscription.Events:
+			if !ok {
+				return lastID
+			}
+			if info.ID <= lastID {
+				continue
+			}
+			if !s.enqueueWithRetry(ctx, info) {
+				return lastID
+			}
+			lastID = info.ID
+		case <-ctx.Done():
+			return lastID
+		}
+	}
+}
+
+// enqueueWithRetry 生成投递记录失败时每隔pollInterval重试, 直到成功或ctx结束, 返回是否成功
+func (s *webhookService) enqueueWithRetry(ctx context.Context, info model.EventInfo) bool {
+	for {
+		err := s.enqueue(info)
+		if err == nil {
+			return true
+		}
+		slog.Error("Failed to enqueue webhook deliveries, will retry", "eventId", info.ID, "error", err)
+		select {
+		case <-time.After(s.cfg.PollInterval):
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func webhookMatches(webhook model.Webhook, info model.EventInfo) bool {
+	if len(webhook.EventTypes) > 0 && !slices.Contains(webhook.EventTypes, info.Type) {
+		return false
+	}
+	return webhook.Namespace == "" || webhook.Namespace == info.Namespace
+}
+
+// enqueue 为订阅了该事件的Webhook生成投递记录, 并在同一事务中将投递游标更新为该事件
+func (s *webhookService) enqueue(info model.EventInfo) error {
+	var webhooks []model.Webhook
+	if err := database.DB.Where("enabled = ?", true).Find(&webhooks).Error; err != nil {
+		return fmt.Errorf("list webhooks: %w", err)
+	}
+
+	now := time.Now()
+	var deliveries []model.WebhookDelivery
+	for _, webhook := range webhooks {
+		if !webhookMatches(webhook, info) {
+			continue
+		}
+		payload, err := json.Marshal(model.WebhookPayload{Webhook: webhook.Name, Event: info})
+		if err != nil {
+			return fmt.Errorf("marshal webhook payload: %w", err)
+		}
+		deliveries = append(deliveries, model.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       info.ID,
+			EventType:     info.Type,
+			Payload:       string(payload),
+			Status:        model.DeliveryPending,
+			NextAttemptAt: &now,
+		})
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(deliveries) > 0 {
+			if err := tx.Create(&deliveries).Error; err != nil {
+				return fmt.Errorf("create webhook deliveries: %w", err)
+			}
+		}
+		return tx.Save(&model.WebhookDispatchCursor{ID: 1, LastEventID: info.ID}).Error
+	})
+	if err != nil || len(deliveries) == 0 {
+		return err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// deliverDue 并发投递到期的记录, 直到没有到期的记录
+func (s *webhookService) deliverDue(ctx context.Context, now time.Time) error {
+	for ctx.Err() == nil {
+		var deliveries []model.WebhookDelivery
+		err := database.DB.Where("status = ? AND next_attempt_at <= ?", model.DeliveryPending, now).
+			Order("next_attempt_at asc").Limit(WEBHOOK_DELIVERY_BATCH).Find(&deliveries).Error
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		webhooks := map[uint]*model.Webhook{}
+		var ids []uint
+		for _, delivery := range deliveries {
+			ids = append(ids, delivery.WebhookID)
+		}
+		var found []model.Webhook
+		if err := database.DB.Where("id IN ?", ids).Find(&found).Error; err != nil {
+			return err
+		}
+		for i := range found {
+			webhooks[found[i].ID] = &found[i]
+		}
+
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, s.cfg.Workers)
+		for i := range deliveries {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(delivery *model.WebhookDelivery) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				s.deliver(ctx, webhooks[delivery.WebhookID], delivery)
+			}(&deliveries[i])
+		}
+		wg.Wait()
+		if len(deliveries) < WEBHOOK_DELIVERY_BATCH {
+			return nil
+		}
+	}
+	return nil
+}
+
+// webhookError 一次投递的失败, retryable为false时不再重试
+type webhookError struct {
+	statusCode int
+	retryable  bool
+	err        error
+}
+
+func (e *webhookError) Error() string {
+	return e.err.Error()
+}
+
+// deliver 投递一次并更新记录, 失败时按指数退避重试
+func (s *webhookService) deliver(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) {
+	attempt := delivery.Attempts + 1
+	start := time.Now()
+	var err *webhookError
+	switch {
+	case webhook == nil:
+		err = &webhookError{err: errors.New("webhook was deleted")}
+	case !webhook.Enabled:
+		err = &webhookError{err: errors.New("webhook is disabled")}
+	default:
+		err = s.post(ctx, webhook, delivery)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"Attempts":   attempt,
+		"DurationMs": now.Sub(start).Milliseconds(),
+	}
+	switch {
+	case err == nil:
+		updates["Status"] = model.DeliverySucceeded
+		updates["StatusCode"] = http.StatusOK
+		updates["Error"] = ""
+		updates["NextAttemptAt"] = nil
+		updates["DeliveredAt"] = &now
+	case err.retryable && attempt < s.cfg.MaxAttempts:
+		next := now.Add(s.backoff(attempt))
+		updates["StatusCode"] = err.statusCode
+		updates["Error"] = truncateString(err.Error(), MAX_WEBHOOK_ERROR_LENGTH)
+		updates["NextAttemptAt"] = &next
+		slog.Warn("Webhook delivery failed, will retry", "webhook", delivery.WebhookID, "deliveryId", delivery.ID,
+			"attempt", attempt, "nextAttemptAt", next, "error", err)
+	default:
+		updates["Status"] = model.DeliveryFailed
+		updates["StatusCode"] = err.statusCode
+		updates["Error"] = truncateString(err.Error(), MAX_WEBHOOK_ERROR_LENGTH)
+		updates["NextAttemptAt"] = nil
+		slog.Error("Webhook delivery failed", "webhook", delivery.WebhookID, "deliveryId", delivery.ID,
+			"attempt", attempt, "error", err)
+	}
+	if dbErr := database.DB.Model(delivery).Updates(updates).Error; dbErr != nil {
+		slog.Error("Failed to update webhook delivery", "deliveryId", delivery.ID, "error", dbErr)
+	}
+}
+
+func (s *webhookService) post(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) *webhookError {
+	secret, err := s.cipher.decrypt(webhook.Secret)
+	if err != nil {
+		return &webhookError{err: err}
+	}
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return &webhookError{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "pdcpserver-webhook")
+	req.Header.Set(HEADER_WEBHOOK_EVENT, string(delivery.EventType))
+	req.Header.Set(HEADER_WEBHOOK_DELIVERY, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HEADER_WEBHOOK_TIMESTAMP, timestamp)
+	req.Header.Set(metrics.HEADER_SIGNATURE, SignWebhook(secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &webhookError{retryable: true, err: err}
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, WEBHOOK_RESPONSE_SNIPPET))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	// 4xx中只重试超时和限流, 其余视为接收方拒绝
+	retryable := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout ||
+		resp.StatusCode == http.StatusTooManyRequests
+	return &webhookError{
+		statusCode: resp.StatusCode,
+		retryable:  retryable,
+		err:        fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet))),
+	}
+}
+
+// SignWebhook 计算投递请求的签名, 接收方以相同方式计算并比较X-Pdcp-Signature, 并检查时间戳以防重放
+func SignWebhook(secret string, timestamp string, body []byte) string {
+	return metrics.Sign(secret, append([]byte(timestamp+"."), body...))
+}
+
+func (s *webhookService) backoff(attempt int) time.Duration {
+	d := s.cfg.RetryBackoff
+	for i := 1; i < attempt && d < MAX_WEBHOOK_RETRY_BACKOFF; i++ {
+		d *= 2
+	}
+	return min(d, MAX_WEBHOOK_RETRY_BACKOFF)
+}
+
+// purge 删除超过保留时长的已完成投递记录
+func (s *webhookService) purge(now time.Time) error {
+	return database.DB.Where("status <> ? AND created_at < ?", model.DeliveryPending, now.Add(-s.cfg.Retention)).
+		Delete(&model.WebhookDelivery{}).Error
+}
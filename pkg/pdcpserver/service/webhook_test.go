@@ -0,0 +1,390 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"pdcplet/pkg/metrics"
+	"pdcplet/pkg/pdcpserver/config"
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver 校验签名并按顺序返回status中的响应码
+type webhookReceiver struct {
+	t      *testing.T
+	secret string
+
+	mu       sync.Mutex
+	status   []int
+	payloads []model.WebhookPayload
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	signature := req.Header.Get(metrics.HEADER_SIGNATURE)
+	if signature != SignWebhook(r.secret, req.Header.Get(HEADER_WEBHOOK_TIMESTAMP), body) {
+		r.t.Errorf("invalid signature %q", signature)
+	}
+	var payload model.WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		r.t.Errorf("decode payload: %v", err)
+	}
+	if req.Header.Get(HEADER_WEBHOOK_EVENT) != string(payload.Event.Type) {
+		r.t.Errorf("event header %q does not match payload %q", req.Header.Get(HEADER_WEBHOOK_EVENT), payload.Event.Type)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.payloads = append(r.payloads, payload)
+	code := http.StatusOK
+	if len(r.status) > 0 {
+		code, r.status = r.status[0], r.status[1:]
+	}
+	w.WriteHeader(code)
+}
+
+func setupWebhookTest(t *testing.T) *webhookService {
+	t.Helper()
+	if err := database.InitSQLite(filepath.Join(t.TempDir(), "pdcpserver.db")); err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	return NewWebhookService(config.WebhooksConfig{MaxAttempts: 3, RetryBackoff: time.Minute,
+		PollInterval: 10 * time.Millisecond, SecretKey: "test-secret-key"}).(*webhookService)
+}
+
+func listDeliveries(t *testing.T, s *webhookService, name string) []model.WebhookDeliveryInfo {
+	t.Helper()
+	resp, err := s.ListDeliveries(name, model.WebhookDeliveryQuery{})
+	if err != nil {
+		t.Fatalf("list deliveries: %v", err)
+	}
+	return resp.Items
+}
+
+func TestWebhookValidation(t *testing.T) {
+	s := setupWebhookTest(t)
+
+	invalid := []model.WebhookRequest{
+		{Name: "Bad_Name", URL: "http://example.com"},
+		{Name: "hook", URL: "ftp://example.com"},
+		{Name: "hook", URL: "/relative"},
+		{Name: "hook", URL: "http://example.com", EventTypes: []model.EventType{"vm.unknown"}},
+	}
+	for _, req := range invalid {
+		if _, err := s.CreateWebhook(req); !errors.Is(err, ErrInvalidWebhook) {
+			t.Errorf("create %+v: err = %v, want ErrInvalidWebhook", req, err)
+		}
+	}
+
+	resp, err := s.CreateWebhook(model.WebhookRequest{Name: "hook", URL: "http://example.com"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if resp.Secret == "" || !resp.Enabled {
+		t.Fatalf("unexpected create response: %+v", resp)
+	}
+	if _, err := s.CreateWebhook(model.WebhookRequest{Name: "hook", URL: "http://example.com"}); !errors.Is(err, ErrWebhookExists) {
+		t.Fatalf("duplicate create: err = %v, want ErrWebhookExists", err)
+	}
+
+	// 更新时未指定Secret则保持不变
+	disabled := false
+	if _, err := s.UpdateWebhook("hook", model.WebhookRequest{URL: "https://example.com/hook", Enabled: &disabled}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	webhook, _ := getWebhook(database.DB, "hook")
+	if secret, err := s.cipher.decrypt(webhook.Secret); err != nil || secret != resp.Secret ||
+		webhook.Enabled || webhook.URL != "https://example.com/hook" {
+		t.Fatalf("unexpected webhook after update: %+v, secret %q, %v", webhook, secret, err)
+	}
+
+	if err := s.DeleteWebhook("hook"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.GetWebhook("hook"); !errors.Is(err, ErrWebhookNotFound) {
+		t.Fatalf("get deleted: err = %v, want ErrWebhookNotFound", err)
+	}
+}
+
+func TestWebhookDeliveryWithRetry(t *testing.T) {
+	s := setupWebhookTest(t)
+	receiver := &webhookReceiver{t: t, secret: "s3cret", status: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	_, err := s.CreateWebhook(model.WebhookRequest{Name: "tickets", URL: server.URL, Secret: "s3cret",
+		EventTypes: []model.EventType{model.EventVMStatus}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	_, err = s.CreateWebhook(model.WebhookRequest{Name: "chat", URL: server.URL, Namespace: "other"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	s.enqueue(model.EventInfo{ID: 1, Type: model.EventVMStatus, Namespace: "ns1", Name: "vm1"})
+	s.enqueue(model.EventInfo{ID: 2, Type: model.EventTaskCreated, Namespace: "ns1", Name: "vm1"})
+	if n := len(listDeliveries(t, s, "chat")); n != 0 {
+		t.Fatalf("chat got %d deliveries for another namespace", n)
+	}
+
+	ctx := context.Background()
+	if err := s.deliverDue(ctx, time.Now()); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	deliveries := listDeliveries(t, s, "tickets")
+	if len(deliveries) != 1 || deliveries[0].Status != model.DeliveryPending || deliveries[0].Attempts != 1 ||
+		deliveries[0].StatusCode != http.StatusServiceUnavailable || deliveries[0].NextAttemptAt == nil {
+		t.Fatalf("unexpected deliveries after failure: %+v", deliveries)
+	}
+
+	// 未到重试时间不投递
+	if err := s.deliverDue(ctx, time.Now()); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	if err := s.deliverDue(ctx, deliveries[0].NextAttemptAt.Add(time.Second)); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	deliveries = listDeliveries(t, s, "tickets")
+	if deliveries[0].Status != model.DeliverySucceeded || deliveries[0].Attempts != 2 || deliveries[0].DeliveredAt == nil {
+		t.Fatalf("unexpected deliveries after retry: %+v", deliveries)
+	}
+	if len(receiver.payloads) != 2 || receiver.payloads[1].Webhook != "tickets" || receiver.payloads[1].Event.Name != "vm1" {
+		t.Fatalf("unexpected payloads: %+v", receiver.payloads)
+	}
+}
+
+func TestWebhookDeliveryGivesUp(t *testing.T) {
+	s := setupWebhookTest(t)
+	receiver := &webhookReceiver{t: t, secret: "s3cret",
+		status: []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusInternalServerError, http.StatusGone}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	if _, err := s.CreateWebhook(model.WebhookRequest{Name: "hook", URL: server.URL, Secret: "s3cret"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	s.enqueue(model.EventInfo{ID: 1, Type: model.EventAlert})
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := s.deliverDue(context.Background(), now); err != nil {
+			t.Fatalf("deliver: %v", err)
+		}
+		now = now.Add(MAX_WEBHOOK_RETRY_BACKOFF)
+	}
+	deliveries := listDeliveries(t, s, "hook")
+	if deliveries[0].Status != model.DeliveryFailed || deliveries[0].Attempts != 3 || deliveries[0].NextAttemptAt != nil {
+		t.Fatalf("unexpected delivery after max attempts: %+v", deliveries[0])
+	}
+
+	// 4xx不重试
+	s.enqueue(model.EventInfo{ID: 2, Type: model.EventAlert})
+	if err := s.deliverDue(context.Background(), time.Now()); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	deliveries = listDeliveries(t, s, "hook")
+	if deliveries[0].Status != model.DeliveryFailed || deliveries[0].Attempts != 1 || deliveries[0].StatusCode != http.StatusGone {
+		t.Fatalf("unexpected delivery after 410: %+v", deliveries[0])
+	}
+}
+
+func TestWebhookDispatchFromEvents(t *testing.T) {
+	s := setupWebhookTest(t)
+	if _, err := s.CreateWebhook(model.WebhookRequest{Name: "hook", URL: "http://127.0.0.1:1"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	PublishEvent(model.EventNodeOnline, "", "", "node1", nil)
+	lastID, err := latestEventID()
+	if err != nil {
+		t.Fatalf("latest event: %v", err)
+	}
+	PublishEvent(model.EventNodeOffline, "", "", "node1", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.dispatch(ctx, lastID)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if deliveries := listDeliveries(t, s, "hook"); len(deliveries) == 1 {
+			if deliveries[0].EventType != model.EventNodeOffline {
+				t.Fatalf("unexpected delivery: %+v", deliveries[0])
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no delivery created for published event")
+}
+
+func TestWebhookSecretEncryption(t *testing.T) {
+	s := setupWebhookTest(t)
+	receiver := &webhookReceiver{t: t, secret: "legacy"}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	if _, err := s.CreateWebhook(model.WebhookRequest{Name: "hook", URL: server.URL, Secret: "s3cret"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	webhook, _ := getWebhook(database.DB, "hook")
+	if !strings.HasPrefix(webhook.Secret, WEBHOOK_SECRET_PREFIX) || strings.Contains(webhook.Secret, "s3cret") {
+		t.Fatalf("secret stored in plaintext: %q", webhook.Secret)
+	}
+
+	// 未配置secretKey时不能保存Secret
+	unconfigured := NewWebhookService(config.WebhooksConfig{}).(*webhookService)
+	if _, err := unconfigured.CreateWebhook(model.WebhookRequest{Name: "other", URL: server.URL}); !errors.Is(err, ErrWebhookSecretKey) {
+		t.Fatalf("create without secretKey: err = %v, want ErrWebhookSecretKey", err)
+	}
+	if _, err := unconfigured.cipher.decrypt(webhook.Secret); !errors.Is(err, ErrWebhookSecretKey) {
+		t.Fatalf("decrypt without secretKey: err = %v, want ErrWebhookSecretKey", err)
+	}
+	other := NewWebhookService(config.WebhooksConfig{SecretKey: "another-key"}).(*webhookService)
+	if _, err := other.cipher.decrypt(webhook.Secret); err == nil {
+		t.Fatalf("decrypt with another secretKey should fail")
+	}
+
+	// 升级前以明文保存的Secret在启动时加密, 投递时仍使用原Secret签名
+	database.DB.Model(webhook).Update("Secret", "legacy")
+	if err := s.cipher.encryptLegacySecrets(); err != nil {
+		t.Fatalf("encrypt legacy secrets: %v", err)
+	}
+	webhook, _ = getWebhook(database.DB, "hook")
+	if secret, err := s.cipher.decrypt(webhook.Secret); err != nil || secret != "legacy" || webhook.Secret == "legacy" {
+		t.Fatalf("legacy secret = %q (%q), %v", webhook.Secret, secret, err)
+	}
+	if err := s.enqueue(model.EventInfo{ID: 1, Type: model.EventAlert}); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if err := s.deliverDue(context.Background(), time.Now()); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	if deliveries := listDeliveries(t, s, "hook"); deliveries[0].Status != model.DeliverySucceeded {
+		t.Fatalf("unexpected delivery: %+v", deliveries[0])
+	}
+}
+
+func TestWebhookDoesNotFollowRedirects(t *testing.T) {
+	s := setupWebhookTest(t)
+	target := &webhookReceiver{t: t, secret: "s3cret"}
+	targetServer := httptest.NewServer(target)
+	defer targetServer.Close()
+	redirect := httptest.NewServer(http.RedirectHandler(targetServer.URL, http.StatusTemporaryRedirect))
+	defer redirect.Close()
+
+	if _, err := s.CreateWebhook(model.WebhookRequest{Name: "hook", URL: redirect.URL, Secret: "s3cret"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := s.enqueue(model.EventInfo{ID: 1, Type: model.EventAlert}); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if err := s.deliverDue(context.Background(), time.Now()); err != nil {
+		t.Fatalf("deliver: %v", err)
+	}
+	deliveries := listDeliveries(t, s, "hook")
+	if deliveries[0].Status != model.DeliveryFailed || deliveries[0].StatusCode != http.StatusTemporaryRedirect {
+		t.Fatalf("unexpected delivery: %+v", deliveries[0])
+	}
+	if len(target.payloads) != 0 {
+		t.Fatalf("redirect was followed: %+v", target.payloads)
+	}
+}
+
+// waitDeliveries 等待Webhook的投递记录达到n条
+func waitDeliveries(t *testing.T, s *webhookService, name string, n int) []model.WebhookDeliveryInfo {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if deliveries := listDeliveries(t, s, name); len(deliveries) >= n {
+			return deliveries
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s: want %d deliveries, got %d", name, n, len(listDeliveries(t, s, name)))
+	return nil
+}
+
+// TestWebhookDispatchResumesFromCursor 重启后从数据库中的游标继续, 停止期间发布的事件不会丢失
+func TestWebhookDispatchResumesFromCursor(t *testing.T) {
+	s := setupWebhookTest(t)
+	if _, err := s.CreateWebhook(model.WebhookRequest{Name: "hook", URL: "http://127.0.0.1:1"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	// 首次启动时从最新事件开始
+	PublishEvent(model.EventNodeOnline, "", "", "node1", nil)
+	lastID, err := dispatchCursor()
+	if latest, _ := latestEventID(); err != nil || lastID != latest {
+		t.Fatalf("initial cursor = %d, %v, want %d", lastID, err, latest)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.dispatch(ctx, lastID)
+		close(done)
+	}()
+	PublishEvent(model.EventNodeOffline, "", "", "node1", nil)
+	waitDeliveries(t, s, "hook", 1)
+	cancel()
+	<-done
+
+	// 停止期间发布的事件在重启后生成投递记录
+	PublishEvent(model.EventNodeOnline, "", "", "node2", nil)
+	lastID, err = dispatchCursor()
+	if err != nil {
+		t.Fatalf("cursor: %v", err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go s.dispatch(ctx, lastID)
+	deliveries := waitDeliveries(t, s, "hook", 2)
+	if len(deliveries) != 2 || deliveries[0].EventType != model.EventNodeOnline || deliveries[1].EventType != model.EventNodeOffline {
+		t.Fatalf("unexpected deliveries: %+v", deliveries)
+	}
+}
+
+// TestWebhookEnqueueRetry 生成投递记录失败时重试, 不丢弃事件
+func TestWebhookEnqueueRetry(t *testing.T) {
+	s := setupWebhookTest(t)
+	if _, err := s.CreateWebhook(model.WebhookRequest{Name: "hook", URL: "http://127.0.0.1:1"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	lastID, err := dispatchCursor()
+	if err != nil {
+		t.Fatalf("cursor: %v", err)
+	}
+
+	// 投递记录表不可用时enqueue失败
+	if err := database.DB.Migrator().RenameTable("webhook_deliveries", "webhook_deliveries_unavailable"); err != nil {
+		t.Fatalf("rename table: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.dispatch(ctx, lastID)
+	PublishEvent(model.EventNodeOffline, "", "", "node1", nil)
+	if err := s.enqueue(model.EventInfo{ID: lastID + 1, Type: model.EventNodeOffline}); err == nil {
+		t.Fatalf("enqueue should fail without deliveries table")
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if err := database.DB.Migrator().RenameTable("webhook_deliveries_unavailable", "webhook_deliveries"); err != nil {
+		t.Fatalf("rename table: %v", err)
+	}
+	deliveries := waitDeliveries(t, s, "hook", 1)
+	if deliveries[0].EventType != model.EventNodeOffline {
+		t.Fatalf("unexpected delivery: %+v", deliveries[0])
+	}
+	if cursor, _ := dispatchCursor(); cursor <= lastID {
+		t.Fatalf("cursor = %d, want > %d", cursor, lastID)
+	}
+}
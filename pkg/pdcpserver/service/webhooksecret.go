@@ -0,0 +1,95 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"pdcplet/pkg/pdcpserver/database"
+	"pdcplet/pkg/pdcpserver/model"
+)
+
+// 加密后的Secret以该前缀开头, 没有前缀的是加密之前保存的明文
+const WEBHOOK_SECRET_PREFIX = "aesgcm:"
+
+var ErrWebhookSecretKey = errors.New("webhooks.secretKey is not configured")
+
+// webhookCipher 以webhooks.secretKey的SHA-256为密钥, 使用AES-256-GCM加密保存Webhook的Secret.
+// 投递时需要Secret原文计算签名, 因此不能只保存哈希
+type webhookCipher struct {
+	aead cipher.AEAD // 未配置secretKey时为nil
+}
+
+func newWebhookCipher(secretKey string) *webhookCipher {
+	if secretKey == "" {
+		return &webhookCipher{}
+	}
+	key := sha256.Sum256([]byte(secretKey))
+	// 32字节的AES密钥和默认的nonce长度不会出错
+	block, _ := aes.NewCipher(key[:])
+	aead, _ := cipher.NewGCM(block)
+	return &webhookCipher{aead: aead}
+}
+
+func (c *webhookCipher) encrypt(secret string) (string, error) {
+	if c.aead == nil {
+		return "", ErrWebhookSecretKey
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(secret), nil)
+	return WEBHOOK_SECRET_PREFIX + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt 返回Secret原文, 加密之前保存的明文原样返回
+func (c *webhookCipher) decrypt(stored string) (string, error) {
+	encoded, ok := strings.CutPrefix(stored, WEBHOOK_SECRET_PREFIX)
+	if !ok {
+		return stored, nil
+	}
+	if c.aead == nil {
+		return "", ErrWebhookSecretKey
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return "", errors.New("malformed webhook secret")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	secret, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt webhook secret, webhooks.secretKey may have changed: %w", err)
+	}
+	return string(secret), nil
+}
+
+// encryptLegacySecrets 加密之前以明文保存的Secret
+func (c *webhookCipher) encryptLegacySecrets() error {
+	if c.aead == nil {
+		return nil
+	}
+	var webhooks []model.Webhook
+	if err := database.DB.Where("secret NOT LIKE ?", WEBHOOK_SECRET_PREFIX+"%").Find(&webhooks).Error; err != nil {
+		return err
+	}
+	for _, webhook := range webhooks {
+		encrypted, err := c.encrypt(webhook.Secret)
+		if err != nil {
+			return err
+		}
+		if err := database.DB.Model(&webhook).Update("Secret", encrypted).Error; err != nil {
+			return err
+		}
+	}
+	if len(webhooks) > 0 {
+		slog.Info("Encrypted plaintext webhook secrets", "count", len(webhooks))
+	}
+	return nil
+}